@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AccountStats aggregates requests made under an authenticated remote user ($remote_user).
+type AccountStats struct {
+	User      string
+	Requests  int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	IPs       map[string]struct{}
+	Countries map[string]int
+	// ASNs counts requests per announcing network when an ASN database is loaded.
+	ASNs         map[uint]int
+	StatusCounts map[int]int
+	Errors       int
+	// sightings and asnSightings record when each country and network was seen.
+	sightings    []accountSighting
+	asnSightings []accountSighting
+}
+
+// AverageRPM returns the account's mean requests per minute over its active window.
+func (s *AccountStats) AverageRPM() float64 {
+	duration := s.LastSeen.Sub(s.FirstSeen)
+	if duration < time.Minute {
+		duration = time.Minute
+	}
+	return float64(s.Requests) / duration.Minutes()
+}
+
+// ErrorRatio returns the share of the account's requests that received a 4xx/5xx status.
+func (s *AccountStats) ErrorRatio() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+type accountSighting struct {
+	at    time.Time
+	value string
+}
+
+// AccountAnomaly reports an account whose activity looks like credential abuse.
+type AccountAnomaly struct {
+	User    string
+	Stats   *AccountStats
+	Reasons []string
+}
+
+// accountUser returns the authenticated user of an entry, or "" when the request was anonymous.
+func accountUser(entry Entry) string {
+	user := strings.TrimSpace(entry.UserAuth)
+	if user == "-" {
+		return ""
+	}
+	return user
+}
+
+func (a *Analyzer) recordAccount(user string, entry Entry, ipStat *IPStats) {
+	account, ok := a.accounts[user]
+	if !ok {
+		account = &AccountStats{
+			User:         user,
+			IPs:          make(map[string]struct{}),
+			Countries:    make(map[string]int),
+			ASNs:         make(map[uint]int),
+			StatusCounts: make(map[int]int),
+		}
+		a.accounts[user] = account
+	}
+
+	account.Requests++
+	if account.FirstSeen.IsZero() || entry.Time.Before(account.FirstSeen) {
+		account.FirstSeen = entry.Time
+	}
+	if entry.Time.After(account.LastSeen) {
+		account.LastSeen = entry.Time
+	}
+	account.IPs[ipStat.IP] = struct{}{}
+	account.StatusCounts[entry.Status]++
+	if entry.Status >= 400 {
+		account.Errors++
+	}
+	if ipStat.CountryISO != "" {
+		account.Countries[ipStat.CountryISO]++
+		account.sightings = append(account.sightings, accountSighting{at: entry.Time, value: ipStat.CountryISO})
+	}
+	if ipStat.ASN != 0 {
+		account.ASNs[ipStat.ASN]++
+		account.asnSightings = append(account.asnSightings, accountSighting{at: entry.Time, value: fmt.Sprintf("AS%d", ipStat.ASN)})
+	}
+}
+
+// AccountAnomalies returns accounts exceeding the per-account rate or error thresholds,
+// or seen from too many countries or networks within the travel window.
+func (a *Analyzer) AccountAnomalies() []AccountAnomaly {
+	anomalies := make([]AccountAnomaly, 0)
+
+	for _, account := range a.accounts {
+		reasons := make([]string, 0, 4)
+
+		if a.cfg.AccountMaxCountries > 0 && a.cfg.AccountTravelWindow > 0 {
+			countries := maxDistinctInWindow(account.sightings, a.cfg.AccountTravelWindow)
+			if len(countries) > a.cfg.AccountMaxCountries {
+				reasons = append(reasons, fmt.Sprintf("%d countries within %s (%s)",
+					len(countries), a.cfg.AccountTravelWindow, strings.Join(countries, ", ")))
+			}
+		}
+
+		if a.cfg.AccountMaxASNs > 0 && a.cfg.AccountTravelWindow > 0 {
+			networks := maxDistinctInWindow(account.asnSightings, a.cfg.AccountTravelWindow)
+			if len(networks) > a.cfg.AccountMaxASNs {
+				reasons = append(reasons, fmt.Sprintf("%d networks within %s (%s)",
+					len(networks), a.cfg.AccountTravelWindow, strings.Join(networks, ", ")))
+			}
+		}
+
+		if account.Requests >= a.cfg.AccountMinRequests {
+			if rpm := account.AverageRPM(); a.cfg.AccountMaxAverageRPM > 0 && rpm > a.cfg.AccountMaxAverageRPM {
+				reasons = append(reasons, fmt.Sprintf("avg rpm %.1f > %.1f", rpm, a.cfg.AccountMaxAverageRPM))
+			}
+			if ratio := account.ErrorRatio(); a.cfg.AccountMinErrorRatio > 0 && ratio >= a.cfg.AccountMinErrorRatio {
+				reasons = append(reasons, fmt.Sprintf("error ratio %.0f%%", ratio*100))
+			}
+		}
+
+		if len(reasons) == 0 {
+			continue
+		}
+		anomalies = append(anomalies, AccountAnomaly{
+			User:    account.User,
+			Stats:   account,
+			Reasons: reasons,
+		})
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		if anomalies[i].Stats.Requests == anomalies[j].Stats.Requests {
+			return anomalies[i].User < anomalies[j].User
+		}
+		return anomalies[i].Stats.Requests > anomalies[j].Stats.Requests
+	})
+	return anomalies
+}
+
+// maxDistinctInWindow returns the largest set of distinct countries or
+// networks seen within any window.
+func maxDistinctInWindow(sightings []accountSighting, window time.Duration) []string {
+	if len(sightings) == 0 {
+		return nil
+	}
+
+	sort.Slice(sightings, func(i, j int) bool { return sightings[i].at.Before(sightings[j].at) })
+
+	counts := make(map[string]int)
+	var best []string
+	start := 0
+	for end := 0; end < len(sightings); end++ {
+		counts[sightings[end].value]++
+		for sightings[end].at.Sub(sightings[start].at) > window {
+			counts[sightings[start].value]--
+			if counts[sightings[start].value] == 0 {
+				delete(counts, sightings[start].value)
+			}
+			start++
+		}
+		if len(counts) > len(best) {
+			best = make([]string, 0, len(counts))
+			for value := range counts {
+				best = append(best, value)
+			}
+		}
+	}
+
+	sort.Strings(best)
+	return best
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccountAnomaliesImpossibleTravel(t *testing.T) {
+	countries := map[string]string{
+		"198.51.100.1": "FR",
+		"198.51.100.2": "BR",
+		"198.51.100.3": "VN",
+	}
+	geo := func(ip string) (GeoInfo, bool) {
+		iso, ok := countries[ip]
+		return GeoInfo{CountryISO: iso}, ok
+	}
+
+	cfg := DefaultConfig()
+	cfg.AccountTravelWindow = 5 * time.Minute
+	cfg.AccountMaxCountries = 1
+
+	analyzer := New(cfg, geo)
+	now := time.Now()
+	analyzer.Process(Entry{ClientIP: "198.51.100.1", UserAuth: "alice", Time: now, URI: "/account", Status: 200})
+	analyzer.Process(Entry{ClientIP: "198.51.100.2", UserAuth: "alice", Time: now.Add(2 * time.Minute), URI: "/account", Status: 200})
+	analyzer.Process(Entry{ClientIP: "198.51.100.1", UserAuth: "bob", Time: now, URI: "/account", Status: 200})
+	analyzer.Process(Entry{ClientIP: "198.51.100.3", UserAuth: "bob", Time: now.Add(time.Hour), URI: "/account", Status: 200})
+	analyzer.Process(Entry{ClientIP: "198.51.100.3", UserAuth: "-", Time: now, URI: "/", Status: 200})
+
+	anomalies := analyzer.AccountAnomalies()
+	if len(anomalies) != 1 {
+		t.Fatalf("expected 1 anomaly, got %d", len(anomalies))
+	}
+	if anomalies[0].User != "alice" {
+		t.Fatalf("unexpected account flagged: %s", anomalies[0].User)
+	}
+}
+
+func TestAccountAnomaliesManyNetworks(t *testing.T) {
+	networks := map[string]uint{
+		"198.51.100.1": 3215,
+		"198.51.100.2": 14061,
+		"198.51.100.3": 16276,
+	}
+	geo := func(ip string) (GeoInfo, bool) {
+		asn, ok := networks[ip]
+		return GeoInfo{CountryISO: "FR", ASN: asn}, ok
+	}
+
+	cfg := DefaultConfig()
+	cfg.AccountTravelWindow = 5 * time.Minute
+	cfg.AccountMaxASNs = 2
+
+	analyzer := New(cfg, geo)
+	now := time.Now()
+	for i, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		analyzer.Process(Entry{ClientIP: ip, UserAuth: "alice", Time: now.Add(time.Duration(i) * time.Minute), URI: "/account", Status: 200})
+		analyzer.Process(Entry{ClientIP: ip, UserAuth: "bob", Time: now.Add(time.Duration(i) * time.Hour), URI: "/account", Status: 200})
+	}
+
+	anomalies := analyzer.AccountAnomalies()
+	if len(anomalies) != 1 || anomalies[0].User != "alice" {
+		t.Fatalf("expected only alice to be flagged, got %+v", anomalies)
+	}
+	if reason := anomalies[0].Reasons[0]; reason != "3 networks within 5m0s (AS14061, AS16276, AS3215)" {
+		t.Fatalf("unexpected reason %q", reason)
+	}
+}
+
+func TestAccountAnomaliesRateAndErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AccountMinRequests = 10
+	cfg.AccountMaxAverageRPM = 20
+	cfg.AccountMinErrorRatio = 0.5
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		ip := "203.0.113.1"
+		if i%2 == 0 {
+			ip = "203.0.113.2"
+		}
+		analyzer.Process(Entry{ClientIP: ip, UserAuth: "api-key-7", Time: now.Add(time.Duration(i) * time.Second), URI: "/api/orders", Status: 401})
+		analyzer.Process(Entry{ClientIP: ip, UserAuth: "api-key-8", Time: now.Add(time.Duration(i) * time.Minute), URI: "/api/orders", Status: 200})
+	}
+
+	anomalies := analyzer.AccountAnomalies()
+	if len(anomalies) != 1 || anomalies[0].User != "api-key-7" {
+		t.Fatalf("expected only api-key-7 to be flagged, got %+v", anomalies)
+	}
+	if len(anomalies[0].Reasons) != 2 {
+		t.Fatalf("expected rate and error reasons, got %v", anomalies[0].Reasons)
+	}
+	if len(anomalies[0].Stats.IPs) != 2 {
+		t.Fatalf("expected account to aggregate across IPs, got %d", len(anomalies[0].Stats.IPs))
+	}
+}
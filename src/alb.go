@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// albLogFormat reads AWS Application Load Balancer access logs and the older
+// Classic Load Balancer (ELB) logs, as delivered to S3.
+var albLogFormat = &LogFormat{Name: "alb", parse: parseALBLine}
+
+var (
+	// albLine matches the leading fields of an ALB entry: type, time, elb,
+	// client:port, target:port, three processing times, elb and target status,
+	// received and sent bytes, request and user agent. Later fields are ignored.
+	albLine = regexp.MustCompile(`^(?:http|https|h2|grpcs|ws|wss) (\S+) \S+ (\S+) \S+ (\S+) (\S+) (\S+) (\d{3}|-) (\S+) \S+ (\d+|-) "([^"]*)" "((?:[^"\\]|\\.)*)"`)
+	// elbLine is the same for Classic Load Balancer entries, which have no type.
+	elbLine = regexp.MustCompile(`^(\S+) \S+ (\S+) \S+ (\S+) (\S+) (\S+) (\d{3}|-) (\S+) \S+ (\d+|-) "([^"]*)" "((?:[^"\\]|\\.)*)"`)
+)
+
+// parseALBLine parses one load balancer entry. The status is what the load
+// balancer returned to the client, and RequestTime sums the three processing
+// times, which are -1 when the load balancer could not reach a target.
+func parseALBLine(line string) (Entry, error) {
+	matches := albLine.FindStringSubmatch(line)
+	if matches == nil {
+		matches = elbLine.FindStringSubmatch(line)
+	}
+	if matches == nil {
+		return Entry{}, fmt.Errorf("line does not match alb format: %w", ErrUnmatchedLine)
+	}
+	t, err := time.Parse(time.RFC3339Nano, matches[1])
+	if err != nil {
+		return Entry{}, fmt.Errorf("parse time: %w", err)
+	}
+	client := albClientIP(matches[2])
+	if client == "" {
+		return Entry{}, fmt.Errorf("parse client %q: %w", matches[2], ErrUnmatchedLine)
+	}
+	entry := Entry{
+		ClientIP:   client,
+		RemoteAddr: client,
+		Time:       t,
+		UserAgent:  strings.ReplaceAll(matches[10], `\"`, `"`),
+	}
+	// "-" is logged for connections closed before a response was sent; such
+	// entries keep status 0.
+	if matches[6] != "-" {
+		if entry.Status, err = strconv.Atoi(matches[6]); err != nil {
+			return Entry{}, fmt.Errorf("parse status: %w", err)
+		}
+	}
+	if matches[8] != "-" {
+		if entry.Bytes, err = strconv.ParseInt(matches[8], 10, 64); err != nil {
+			return Entry{}, fmt.Errorf("parse bytes: %w", err)
+		}
+	}
+	for _, raw := range matches[3:6] {
+		seconds, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Entry{}, fmt.Errorf("parse processing time: %w", err)
+		}
+		if seconds > 0 {
+			entry.RequestTime += seconds
+		}
+	}
+
+	// The request line carries an absolute URL, e.g. "GET https://www.example.com:443/path HTTP/1.1".
+	parts := strings.Fields(matches[9])
+	if len(parts) != 3 {
+		return Entry{}, fmt.Errorf("malformed request %q: %w", matches[9], ErrUnmatchedLine)
+	}
+	entry.Method, entry.URI, entry.Protocol = parts[0], parts[1], parts[2]
+	if target, err := url.Parse(parts[1]); err == nil && target.Host != "" {
+		entry.Host = target.Hostname()
+		entry.URI = target.RequestURI()
+	}
+	return entry, nil
+}
+
+// albClientIP strips the port from client:port. IPv6 clients may be logged
+// without brackets, so the last colon separates the port.
+func albClientIP(value string) string {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+	if idx := strings.LastIndex(value, ":"); idx > 0 && isValidIPAddress(value[:idx]) {
+		return value[:idx]
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const albAccessLine = `https 2025-10-19T12:02:35.250000Z app/my-loadbalancer/50dc6c495c0c9188 192.0.2.7:2817 10.0.0.1:80 0.001 0.120 0.004 404 404 34 512 "GET https://shop.example.com:443/cart?id=1 HTTP/1.1" "Mozilla/5.0 \"quoted\"" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337281-1d84f3d73c47ec4e58577259" "shop.example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012" 1 2025-10-19T12:02:35.120000Z "forward" "-" "-" "10.0.0.1:80" "404" "-" "-" TID_1234`
+
+func TestALBLogFormat(t *testing.T) {
+	format, err := logFormatFor("alb", "", LogTimes{})
+	if err != nil || format != albLogFormat {
+		t.Fatalf("expected alb format, got %v, %v", format, err)
+	}
+	entry, err := format.Parse(albAccessLine)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:    "192.0.2.7",
+		RemoteAddr:  "192.0.2.7",
+		Time:        time.Date(2025, 10, 19, 12, 2, 35, 250000000, time.UTC),
+		Method:      "GET",
+		URI:         "/cart?id=1",
+		Protocol:    "HTTP/1.1",
+		Status:      404,
+		Bytes:       512,
+		UserAgent:   `Mozilla/5.0 "quoted"`,
+		RequestTime: 0.125,
+		Host:        "shop.example.com",
+	}
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+
+	classic, err := format.Parse(`2025-10-19T12:02:35.250000Z my-loadbalancer 2001:db8::7:2817 10.0.0.1:80 -1 -1 -1 504 - 0 0 "GET http://www.example.com:80/ HTTP/1.1" "curl/8.0" - -`)
+	if err != nil {
+		t.Fatalf("classic: %v", err)
+	}
+	if classic.ClientIP != "2001:db8::7" || classic.Status != 504 || classic.RequestTime != 0 || classic.URI != "/" || classic.Host != "www.example.com" {
+		t.Fatalf("unexpected classic entry %+v", classic)
+	}
+}
+
+func TestStreamDetectsALB(t *testing.T) {
+	entries, errs := Stream(strings.NewReader(albAccessLine + "\n" + albAccessLine + "\n"))
+	count := 0
+	for range entries {
+		count++
+	}
+	if err := <-errs; err != nil || count != 2 {
+		t.Fatalf("expected 2 alb entries, got %d, %v", count, err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// suggestMinRequests is the minimum traffic needed to judge an IP's cadence.
+	suggestMinRequests = 10
+	// suggestMaxJitter is the largest coefficient of variation of request gaps
+	// still considered a steady, scheduled client.
+	suggestMaxJitter = 0.5
+)
+
+// monitorTokens are user agent substrings typical of health checks and monitoring tools.
+var monitorTokens = []string{
+	"monitor", "uptime", "healthcheck", "health-check", "probe", "check_http",
+	"nagios", "zabbix", "prometheus", "blackbox", "datadog", "newrelic", "site24x7",
+}
+
+// AllowSuggestion is a near-threshold IP that looks benign enough to allowlist.
+type AllowSuggestion struct {
+	IP       string
+	Agent    string
+	Score    int
+	Requests int
+	Reasons  []string
+}
+
+// AllowlistSuggestions returns unblocked IPs that scored points yet never
+// received an error and either poll on a steady schedule or identify as a
+// monitoring tool. They are candidates for review, not automatic allow entries.
+func (a *Analyzer) AllowlistSuggestions() []AllowSuggestion {
+	suggestions := make([]AllowSuggestion, 0)
+	for ip, stat := range a.stats {
+		if stat.Requests < suggestMinRequests || a.isAllowed(ip) {
+			continue
+		}
+		suspect, blocked := a.evaluate(stat)
+		if blocked || suspect.Score == 0 || errorResponses(stat) > 0 {
+			continue
+		}
+
+		reasons := []string{"0 errors"}
+		interval, jitter := requestCadence(stat.BurstWindows)
+		steady := interval > 0 && jitter <= suggestMaxJitter
+		if steady {
+			reasons = append(reasons, fmt.Sprintf("steady %s cadence", interval.Round(time.Second)))
+		}
+		agent := dominantAgent(stat)
+		monitor := agent != "" && matchSubstring(strings.ToLower(agent), monitorTokens) != ""
+		if monitor {
+			reasons = append(reasons, "monitoring user agent")
+		}
+		if !steady && !monitor {
+			continue
+		}
+
+		suggestion := AllowSuggestion{IP: ip, Score: suspect.Score, Requests: stat.Requests, Reasons: reasons}
+		if monitor {
+			suggestion.Agent = agent
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Requests == suggestions[j].Requests {
+			return suggestions[i].IP < suggestions[j].IP
+		}
+		return suggestions[i].Requests > suggestions[j].Requests
+	})
+	return suggestions
+}
+
+func errorResponses(stat *IPStats) int {
+	errors := 0
+	for status, count := range stat.StatusCounts {
+		if status >= 400 {
+			errors += count
+		}
+	}
+	return errors
+}
+
+// requestCadence returns the mean gap between requests and its coefficient of variation.
+func requestCadence(times []time.Time) (time.Duration, float64) {
+	if len(times) < 3 {
+		return 0, 0
+	}
+	sorted := append([]time.Time{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	gaps := make([]float64, 0, len(sorted)-1)
+	sum := 0.0
+	for i := 1; i < len(sorted); i++ {
+		gap := sorted[i].Sub(sorted[i-1]).Seconds()
+		gaps = append(gaps, gap)
+		sum += gap
+	}
+	mean := sum / float64(len(gaps))
+	if mean == 0 {
+		return 0, 0
+	}
+	variance := 0.0
+	for _, gap := range gaps {
+		variance += (gap - mean) * (gap - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(gaps)))
+	return time.Duration(mean * float64(time.Second)), stddev / mean
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowlistSuggestions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.MaxAverageRPM = 0.5
+	analyzer := New(cfg, nil)
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	irregular := []int{0, 1, 2, 30, 31, 90, 91, 92, 200, 201, 202, 203}
+	for i := 0; i < 20; i++ {
+		analyzer.Process(Entry{ClientIP: "192.0.2.1", Time: start.Add(time.Duration(i) * time.Minute), URI: "/status", Status: 200, UserAgent: "curl/8.4"})
+		status := 200
+		if i == 5 {
+			status = 500
+		}
+		analyzer.Process(Entry{ClientIP: "192.0.2.3", Time: start.Add(time.Duration(i) * time.Minute), URI: "/", Status: status, UserAgent: "curl/8.4"})
+	}
+	for _, sec := range irregular {
+		analyzer.Process(Entry{ClientIP: "192.0.2.2", Time: start.Add(time.Duration(sec) * time.Second), URI: "/", Status: 200, UserAgent: "Acme-Uptime-Monitor/1.0"})
+	}
+
+	suggestions := analyzer.AllowlistSuggestions()
+	if len(suggestions) != 2 {
+		t.Fatalf("expected two suggestions, got %+v", suggestions)
+	}
+	if suggestions[0].IP != "192.0.2.1" || suggestions[0].Agent != "" {
+		t.Fatalf("expected steady poller first without agent, got %+v", suggestions[0])
+	}
+	if suggestions[1].IP != "192.0.2.2" || suggestions[1].Agent != "Acme-Uptime-Monitor/1.0" {
+		t.Fatalf("expected monitor agent suggestion, got %+v", suggestions[1])
+	}
+}
+
+func TestRequestCadence(t *testing.T) {
+	start := time.Now()
+	times := []time.Time{start, start.Add(time.Minute), start.Add(2 * time.Minute), start.Add(3 * time.Minute)}
+	interval, jitter := requestCadence(times)
+	if interval != time.Minute || jitter != 0 {
+		t.Fatalf("expected steady one minute cadence, got %s %.2f", interval, jitter)
+	}
+}
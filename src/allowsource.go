@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AllowSource supplies allowlisted IPs and networks kept outside the config,
+// such as a partner list or a provider's published ranges.
+type AllowSource interface {
+	// Name identifies the source in logs and problems.
+	Name() string
+	// Load fetches the source's current entries.
+	Load(ctx context.Context) (ips, cidrs []string, err error)
+}
+
+// AllowSourceConfig is one allow_sources entry. Exactly one of File, URL,
+// Cloud and DNSTXT is set.
+type AllowSourceConfig struct {
+	// File lists one IP or CIDR per line; set_real_ip_from lines work too.
+	// A trailing "# expires <RFC3339>" comment drops the entry once past.
+	File string `yaml:"file"`
+	// URL serves the same layout over HTTP(S).
+	URL string `yaml:"url"`
+	// Cloud names a provider feed, see cloudFeeds.
+	Cloud string `yaml:"cloud"`
+	// DNSTXT is a name whose TXT records list IPs and CIDRs, as plain
+	// tokens or SPF-style ip4:/ip6: terms.
+	DNSTXT string `yaml:"dns_txt"`
+	// Refresh reloads the source this often in follow mode; empty or 0
+	// loads it once.
+	Refresh string `yaml:"refresh"`
+}
+
+// allowSourceTimeout bounds each load of a remote source.
+const allowSourceTimeout = 30 * time.Second
+
+// cloudFeed is a provider's published range list.
+type cloudFeed struct {
+	urls  []string
+	parse func(body []byte) ([]string, error)
+}
+
+// cloudFeeds are the providers allow_sources can name with cloud.
+var cloudFeeds = map[string]cloudFeed{
+	"cloudflare": {
+		urls:  []string{"https://www.cloudflare.com/ips-v4", "https://www.cloudflare.com/ips-v6"},
+		parse: parseAllowList,
+	},
+	"aws": {
+		urls:  []string{"https://ip-ranges.amazonaws.com/ip-ranges.json"},
+		parse: parseAWSRanges,
+	},
+	"google": {
+		urls:  []string{"https://www.gstatic.com/ipranges/goog.json"},
+		parse: parseGoogleRanges,
+	},
+	"googlebot": {
+		urls:  []string{"https://developers.google.com/static/search/apis/ipranges/googlebot.json"},
+		parse: parseGoogleRanges,
+	},
+}
+
+func cloudFeedNames() []string {
+	names := make([]string, 0, len(cloudFeeds))
+	for name := range cloudFeeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// source builds the configured source and its refresh interval.
+func (c AllowSourceConfig) source() (AllowSource, time.Duration, error) {
+	var refresh time.Duration
+	if c.Refresh != "" {
+		d, err := time.ParseDuration(c.Refresh)
+		if err != nil || d < 0 {
+			return nil, 0, fmt.Errorf("refresh: invalid duration %q", c.Refresh)
+		}
+		refresh = d
+	}
+	var sources []AllowSource
+	if c.File != "" {
+		sources = append(sources, fileAllowSource{path: c.File})
+	}
+	if c.URL != "" {
+		sources = append(sources, urlAllowSource{name: c.URL, urls: []string{c.URL}, parse: parseAllowList})
+	}
+	if c.Cloud != "" {
+		feed, ok := cloudFeeds[strings.ToLower(c.Cloud)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unknown cloud %q (want %s)", c.Cloud, strings.Join(cloudFeedNames(), ", "))
+		}
+		sources = append(sources, urlAllowSource{name: "cloud " + strings.ToLower(c.Cloud), urls: feed.urls, parse: feed.parse})
+	}
+	if c.DNSTXT != "" {
+		sources = append(sources, dnsAllowSource{name: c.DNSTXT})
+	}
+	if len(sources) != 1 {
+		return nil, 0, fmt.Errorf("set exactly one of file, url, cloud or dns_txt")
+	}
+	return sources[0], refresh, nil
+}
+
+// checkAllowSources validates allow_sources entries.
+func checkAllowSources(configs []AllowSourceConfig) error {
+	for i, c := range configs {
+		if _, _, err := c.source(); err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+type fileAllowSource struct {
+	path string
+}
+
+func (s fileAllowSource) Name() string { return s.path }
+
+func (s fileAllowSource) Load(context.Context) ([]string, []string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := parseAllowList(data)
+	ips, cidrs := splitAllowEntries(entries)
+	return ips, cidrs, err
+}
+
+type urlAllowSource struct {
+	name  string
+	urls  []string
+	parse func(body []byte) ([]string, error)
+}
+
+func (s urlAllowSource) Name() string { return s.name }
+
+func (s urlAllowSource) Load(ctx context.Context) ([]string, []string, error) {
+	client := &http.Client{Timeout: allowSourceTimeout}
+	var entries []string
+	for _, url := range s.urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s: %w", url, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("fetch %s: %s", url, resp.Status)
+		}
+		parsed, err := s.parse(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %w", url, err)
+		}
+		entries = append(entries, parsed...)
+	}
+	ips, cidrs := splitAllowEntries(entries)
+	return ips, cidrs, nil
+}
+
+type dnsAllowSource struct {
+	name     string
+	resolver *net.Resolver
+}
+
+func (s dnsAllowSource) Name() string { return "dns " + s.name }
+
+func (s dnsAllowSource) Load(ctx context.Context) ([]string, []string, error) {
+	resolver := s.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	records, err := resolver.LookupTXT(ctx, s.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []string
+	for _, record := range records {
+		for _, token := range strings.FieldsFunc(record, func(r rune) bool { return r == ' ' || r == ',' || r == ';' }) {
+			token = strings.TrimPrefix(strings.TrimPrefix(token, "ip4:"), "ip6:")
+			if isAllowEntry(token) {
+				entries = append(entries, token)
+			}
+		}
+	}
+	ips, cidrs := splitAllowEntries(entries)
+	return ips, cidrs, nil
+}
+
+// allowExpiresComment starts the comment that ends an allow list entry at a
+// given time, e.g. "192.0.2.10 # expires 2025-10-20T12:00:00Z".
+const allowExpiresComment = "# expires "
+
+// parseAllowList reads one IP or CIDR per line, skipping blank lines and #
+// comments. nginx set_real_ip_from directives are read as their address.
+// Entries whose "# expires" comment is in the past are dropped.
+func parseAllowList(data []byte) ([]string, error) {
+	var entries []string
+	now := time.Now()
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line, comment, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if stamp, ok := strings.CutPrefix("#"+comment, allowExpiresComment); ok {
+			expires, err := time.Parse(time.RFC3339, strings.TrimSpace(stamp))
+			if err != nil {
+				return entries, fmt.Errorf("line %d: bad expiry %q", lineNo, strings.TrimSpace(stamp))
+			}
+			if !now.Before(expires) {
+				continue
+			}
+		}
+		if rest, ok := strings.CutPrefix(line, "set_real_ip_from"); ok {
+			line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rest), ";"))
+		}
+		if !isAllowEntry(line) {
+			return entries, fmt.Errorf("line %d: %q is not an IP or CIDR", lineNo, line)
+		}
+		entries = append(entries, line)
+	}
+	return entries, scanner.Err()
+}
+
+// parseAWSRanges reads the prefixes of AWS's ip-ranges.json.
+func parseAWSRanges(body []byte) ([]string, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, len(feed.Prefixes)+len(feed.IPv6Prefixes))
+	for _, p := range feed.Prefixes {
+		entries = append(entries, p.IPPrefix)
+	}
+	for _, p := range feed.IPv6Prefixes {
+		entries = append(entries, p.IPv6Prefix)
+	}
+	return entries, nil
+}
+
+// parseGoogleRanges reads the prefixes of Google's goog.json and crawler
+// range files.
+func parseGoogleRanges(body []byte) ([]string, error) {
+	var feed struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+		} `json:"prefixes"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, len(feed.Prefixes))
+	for _, p := range feed.Prefixes {
+		if p.IPv4Prefix != "" {
+			entries = append(entries, p.IPv4Prefix)
+		}
+		if p.IPv6Prefix != "" {
+			entries = append(entries, p.IPv6Prefix)
+		}
+	}
+	return entries, nil
+}
+
+func isAllowEntry(value string) bool {
+	if _, err := netip.ParsePrefix(value); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
+
+// splitAllowEntries separates single IPs from networks, dropping anything
+// that is neither.
+func splitAllowEntries(entries []string) (ips, cidrs []string) {
+	for _, entry := range entries {
+		switch {
+		case !isAllowEntry(entry):
+		case strings.Contains(entry, "/"):
+			cidrs = append(cidrs, entry)
+		default:
+			ips = append(ips, entry)
+		}
+	}
+	return ips, cidrs
+}
+
+// allowRefresher keeps the entries of the allow sources current on top of a
+// base allowlist. A source that fails to load keeps its last entries.
+type allowRefresher struct {
+	baseIPs, baseCIDRs []string
+	sources            []*refreshedSource
+	problems           *Problems
+}
+
+type refreshedSource struct {
+	AllowSource
+	refresh    time.Duration
+	next       time.Time
+	ips, cidrs []string
+	loadedOnce bool
+}
+
+func newAllowRefresher(configs []AllowSourceConfig, baseIPs, baseCIDRs []string, problems *Problems) (*allowRefresher, error) {
+	r := &allowRefresher{baseIPs: baseIPs, baseCIDRs: baseCIDRs, problems: problems}
+	for i, c := range configs {
+		source, refresh, err := c.source()
+		if err != nil {
+			return nil, fmt.Errorf("allow_sources entry %d: %w", i+1, err)
+		}
+		r.sources = append(r.sources, &refreshedSource{AllowSource: source, refresh: refresh})
+	}
+	return r, nil
+}
+
+// Refresh reloads the sources due at now and reports whether any entries
+// changed. Every source is due on the first call; sources without a refresh
+// interval are loaded only then.
+func (r *allowRefresher) Refresh(ctx context.Context, now time.Time) bool {
+	changed := false
+	for _, s := range r.sources {
+		if s.loadedOnce && (s.refresh <= 0 || now.Before(s.next)) {
+			continue
+		}
+		s.loadedOnce = true
+		s.next = now.Add(s.refresh)
+		loadCtx, cancel := context.WithTimeout(ctx, allowSourceTimeout)
+		ips, cidrs, err := s.Load(loadCtx)
+		cancel()
+		if err != nil {
+			r.problems.Add(ProblemAllowList, fmt.Sprintf("%s: %v", s.Name(), err))
+			continue
+		}
+		if !sameStrings(ips, s.ips) || !sameStrings(cidrs, s.cidrs) {
+			s.ips, s.cidrs = ips, cidrs
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Apply sets the allowlist of cfg to the base entries plus those of every source.
+func (r *allowRefresher) Apply(cfg *Config) {
+	ips := append([]string{}, r.baseIPs...)
+	cidrs := append([]string{}, r.baseCIDRs...)
+	for _, s := range r.sources {
+		ips = append(ips, s.ips...)
+		cidrs = append(cidrs, s.cidrs...)
+	}
+	cfg.AllowedIPs = dedupeStrings(ips)
+	cfg.AllowedCIDRs = dedupeStrings(cidrs)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
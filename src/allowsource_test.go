@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAllowSource struct {
+	ips   []string
+	err   error
+	loads int
+}
+
+func (s *fakeAllowSource) Name() string { return "fake" }
+
+func (s *fakeAllowSource) Load(context.Context) ([]string, []string, error) {
+	s.loads++
+	return s.ips, nil, s.err
+}
+
+func TestFileAllowSourceReadsIPsAndCIDRs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partners.txt")
+	data := "# partners\n192.0.2.10\n198.51.100.0/24 # office\n\nset_real_ip_from 2001:db8::/32;\n" +
+		"192.0.2.11 # expires 2000-01-01T00:00:00Z\n192.0.2.12 # expires 2999-01-01T00:00:00Z\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	ips, cidrs, err := fileAllowSource{path: path}.Load(context.Background())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if fmt.Sprint(ips) != "[192.0.2.10 192.0.2.12]" || fmt.Sprint(cidrs) != "[198.51.100.0/24 2001:db8::/32]" {
+		t.Fatalf("unexpected entries %v %v", ips, cidrs)
+	}
+
+	if err := os.WriteFile(path, []byte("192.0.2.10\nnot-an-ip\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, _, err := (fileAllowSource{path: path}).Load(context.Background()); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected line 2 to be rejected, got %v", err)
+	}
+}
+
+func TestURLAllowSourceParsesFeeds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/list":
+			fmt.Fprintln(w, "203.0.113.0/24\n203.0.113.200")
+		case "/aws.json":
+			fmt.Fprint(w, `{"prefixes":[{"ip_prefix":"3.5.140.0/22"}],"ipv6_prefixes":[{"ipv6_prefix":"2600:1f14::/35"}]}`)
+		case "/goog.json":
+			fmt.Fprint(w, `{"prefixes":[{"ipv4Prefix":"66.249.64.0/27"},{"ipv6Prefix":"2001:4860:4801:10::/64"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		source urlAllowSource
+		want   string
+	}{
+		{urlAllowSource{urls: []string{server.URL + "/list"}, parse: parseAllowList}, "[203.0.113.200] [203.0.113.0/24]"},
+		{urlAllowSource{urls: []string{server.URL + "/aws.json"}, parse: parseAWSRanges}, "[] [3.5.140.0/22 2600:1f14::/35]"},
+		{urlAllowSource{urls: []string{server.URL + "/goog.json"}, parse: parseGoogleRanges}, "[] [66.249.64.0/27 2001:4860:4801:10::/64]"},
+	}
+	for _, tc := range cases {
+		ips, cidrs, err := tc.source.Load(context.Background())
+		if err != nil {
+			t.Fatalf("load %s: %v", tc.source.urls[0], err)
+		}
+		if got := fmt.Sprint(ips, " ", cidrs); got != tc.want {
+			t.Fatalf("load %s: got %s, want %s", tc.source.urls[0], got, tc.want)
+		}
+	}
+
+	missing := urlAllowSource{urls: []string{server.URL + "/missing"}, parse: parseAllowList}
+	if _, _, err := missing.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error, got %v", err)
+	}
+}
+
+func TestAllowSourceConfigValidation(t *testing.T) {
+	valid := []AllowSourceConfig{
+		{File: "partners.txt"},
+		{URL: "https://example.com/allow.txt", Refresh: "1h"},
+		{Cloud: "Cloudflare", Refresh: "24h"},
+		{DNSTXT: "_allow.example.com"},
+	}
+	if err := checkAllowSources(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []AllowSourceConfig{
+		{},
+		{File: "a.txt", URL: "https://example.com"},
+		{Cloud: "oracle"},
+		{File: "a.txt", Refresh: "soon"},
+	} {
+		if err := checkAllowSources([]AllowSourceConfig{c}); err == nil {
+			t.Fatalf("expected %+v to be rejected", c)
+		}
+	}
+}
+
+func TestAllowRefresherReloadsDueSources(t *testing.T) {
+	hourly := &fakeAllowSource{ips: []string{"192.0.2.1"}}
+	once := &fakeAllowSource{ips: []string{"192.0.2.2"}}
+	problems := newProblems()
+	r := &allowRefresher{
+		baseIPs:  []string{"192.0.2.100"},
+		problems: problems,
+		sources: []*refreshedSource{
+			{AllowSource: hourly, refresh: time.Hour},
+			{AllowSource: once},
+		},
+	}
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	if !r.Refresh(context.Background(), start) {
+		t.Fatal("expected the first refresh to change the allowlist")
+	}
+	var cfg Config
+	r.Apply(&cfg)
+	if fmt.Sprint(cfg.AllowedIPs) != "[192.0.2.100 192.0.2.1 192.0.2.2]" {
+		t.Fatalf("unexpected allowlist %v", cfg.AllowedIPs)
+	}
+
+	if r.Refresh(context.Background(), start.Add(30*time.Minute)) || hourly.loads != 1 {
+		t.Fatalf("expected no reload before the interval, got %d loads", hourly.loads)
+	}
+
+	// A failed load keeps the last entries.
+	hourly.err = errors.New("timeout")
+	if r.Refresh(context.Background(), start.Add(time.Hour)) || problems.Count(ProblemAllowList) != 1 {
+		t.Fatalf("expected a recorded failure without changes, got %d problems", problems.Count(ProblemAllowList))
+	}
+	hourly.err = nil
+	hourly.ips = []string{"192.0.2.3"}
+	if !r.Refresh(context.Background(), start.Add(2*time.Hour)) {
+		t.Fatal("expected the new entries to change the allowlist")
+	}
+	r.Apply(&cfg)
+	if fmt.Sprint(cfg.AllowedIPs) != "[192.0.2.100 192.0.2.3 192.0.2.2]" || once.loads != 1 {
+		t.Fatalf("unexpected allowlist %v after %d loads of the static source", cfg.AllowedIPs, once.loads)
+	}
+}
+
+func TestFollowerLiftsBlocksOfNewlyAllowedIPs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	source := &fakeAllowSource{}
+	sources := &allowRefresher{sources: []*refreshedSource{{AllowSource: source, refresh: time.Minute}}}
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:       5 * time.Minute,
+		Interval:     time.Minute,
+		DenyOutput:   denyPath,
+		Deny:         DenyOptions{TTL: time.Hour, Minimal: true},
+		AllowSources: sources,
+	})
+
+	for _, entry := range scannerEntries("192.0.2.1", start, 40) {
+		follower.Add(entry, start)
+	}
+	if _, err := follower.Tick(start.Add(time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if data, _ := os.ReadFile(denyPath); string(data) != "deny 192.0.2.1;\n" {
+		t.Fatalf("expected the scanner to be blocked, got %q", data)
+	}
+
+	source.ips = []string{"192.0.2.1"}
+	tick, err := follower.Tick(start.Add(2 * time.Minute))
+	if err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if data, _ := os.ReadFile(denyPath); string(data) != "" || len(tick.Suspects) != 0 {
+		t.Fatalf("expected the allowlisted scanner to be lifted, got %q and %d suspects", data, len(tick.Suspects))
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"net"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -19,6 +19,7 @@ type Config struct {
 	MinUniquePaths      int
 	ScoreThreshold      int
 	WhitelistAgents     []string
+	WhitelistMinShare   float64
 	MinPHP404s          int
 	SuspiciousCountries []string
 	AllowedIPs          []string
@@ -27,6 +28,90 @@ type Config struct {
 	AllowedURIs         []string
 	MinSQLInjections    int
 	SensitiveURLLimits  []PathLimit
+	AllowMonitors       bool
+	MonitorAgents       []string
+	MonitorCIDRs        []string
+	ClassLimits         map[UAClass]ClassLimit
+	// VhostScopes counts the traffic of some Host headers apart, with
+	// their own thresholds and allowlists.
+	VhostScopes         map[string]VhostScope
+	Honeytokens         []string
+	AccountTravelWindow time.Duration
+	AccountMaxCountries int
+	// AccountMaxASNs flags accounts seen from more networks than this within
+	// AccountTravelWindow; it needs an ASN database.
+	AccountMaxASNs int
+	// Per-account thresholds apply to traffic aggregated by authenticated user.
+	AccountMinRequests   int
+	AccountMaxAverageRPM float64
+	AccountMinErrorRatio float64
+	MinBytesServed       int64
+	Severity             SeverityBoundaries
+	MinCacheBusters      int
+	// PeerReports maps IPs reported by peer instances to the reporting peer; they are greylisted.
+	PeerReports map[string]string
+	// MaxUpstreamSeconds scores IPs by total $request_time consumed; each multiple adds a point (max 3).
+	MaxUpstreamSeconds float64
+	// CountryBaselines holds typical requests per hour by country ISO code,
+	// learned in the state DB; nil disables the country spike rule.
+	CountryBaselines map[string]float64
+	// CountrySpikeFactor is how many times its baseline a country's rate must reach to count as a spike.
+	CountrySpikeFactor float64
+	// CountrySpikeMinRequests ignores countries with fewer requests in the window.
+	CountrySpikeMinRequests int
+	// IgnoreWindows are maintenance or campaign periods. IPs sending most of
+	// their requests inside them are not blocked, or with IgnoreWindowRelax > 0
+	// face count and rate thresholds multiplied by it.
+	IgnoreWindows     []TimeWindow
+	IgnoreWindowRelax float64
+	// ChallengePassedIPs solved a botdeny challenge whose pass has not expired.
+	// They are only blocked for sensitive_urls, honeytokens and SQL injection.
+	ChallengePassedIPs []string
+	// MinCookielessPages flags IPs that request at least this many pages
+	// without ever sending a session cookie, when the log records cookies.
+	MinCookielessPages int
+	// MinCacheMisses flags IPs with at least this many requests the cache
+	// passed to the origin, when nearly all of their requests with a logged
+	// cache status did; 0 disables it.
+	MinCacheMisses int
+	// MinLegacyTLS flags IPs with at least this many requests over SSLv3,
+	// TLSv1 or TLSv1.1, when they make up most of the IP's requests with a
+	// logged protocol.
+	MinLegacyTLS int
+	// MinSingleCipher flags IPs with at least this many TLS requests that
+	// all negotiated the same cipher and sent the same JA3 fingerprint. Off
+	// by default, and never applies to logs without JA3.
+	MinSingleCipher int
+	// MinHeaderAnomalies flags IPs with at least this many requests whose
+	// Accept headers are empty or implausible for their user agent, when they
+	// make up most of the IP's requests with logged headers.
+	MinHeaderAnomalies int
+	// RawLines keeps the first and last this many raw log lines of each IP
+	// for reports; 0 keeps none.
+	RawLines int
+	// MinHostHeaders flags IPs sending at least this many distinct Host
+	// headers, as virtual-host scanners do, when the log records $host.
+	MinHostHeaders int
+	// MinQueryVariants flags IPs sending at least this many distinct query
+	// strings to a single path, as parameter fuzzers do.
+	MinQueryVariants int
+	// NewIPSpikeFactor reports a suspected distributed attack when IPs never
+	// seen before appear this many times faster than usual; 0 disables it.
+	NewIPSpikeFactor float64
+	// NewIPSpikeMin ignores minutes with fewer new IPs.
+	NewIPSpikeMin int
+	// StatusRules score IPs by the responses they get in status classes, on
+	// top of the error count and ratio rules.
+	StatusRules []StatusRule
+	// SequenceRules score IPs sending requests without the request a
+	// browser sends before them, such as form posts without the form.
+	SequenceRules []SequenceRule
+	// HourProfiles multiply the rate and burst thresholds by hour of day and
+	// day of week, on top of HourBaselines, the factors learned in the state DB.
+	HourProfiles  []HourProfile
+	HourBaselines []float64
+	// Annotations labels known IPs and networks in reports; nil labels none.
+	Annotations *Annotations
 }
 
 // PathLimit defines a URI prefix and the request count that should trigger blocking.
@@ -57,14 +142,56 @@ func DefaultConfig() Config {
 			"Applebot",
 			"Preload",
 		},
-		MinPHP404s:          10,
-		SuspiciousCountries: []string{"CN", "RU", "KP", "IR"},
-		AllowedIPs:          nil,
-		AllowedCIDRs:        nil,
-		MaxErrorPercent:     100,
-		AllowedURIs:         nil,
-		MinSQLInjections:    3,
-		SensitiveURLLimits:  nil,
+		WhitelistMinShare:    0.9,
+		MinPHP404s:           10,
+		SuspiciousCountries:  []string{"CN", "RU", "KP", "IR"},
+		AllowedIPs:           nil,
+		AllowedCIDRs:         nil,
+		MaxErrorPercent:      100,
+		AllowedURIs:          nil,
+		MinSQLInjections:     3,
+		SensitiveURLLimits:   nil,
+		AllowMonitors:        true,
+		MonitorAgents:        defaultMonitorAgents(),
+		MonitorCIDRs:         defaultMonitorCIDRs(),
+		AccountTravelWindow:  10 * time.Minute,
+		AccountMaxCountries:  1,
+		AccountMinRequests:   50,
+		AccountMaxAverageRPM: 90,
+		AccountMinErrorRatio: 0.5,
+		Severity:             DefaultSeverityBoundaries(),
+		MinCacheBusters:      50,
+		// Country spikes need baselines from the state DB, see CountryBaselines.
+		CountrySpikeFactor:      10,
+		CountrySpikeMinRequests: 200,
+		MinCookielessPages:      100,
+		MinHeaderAnomalies:      50,
+		MinLegacyTLS:            50,
+		MinHostHeaders:          20,
+		MinQueryVariants:        200,
+		NewIPSpikeFactor:        10,
+		NewIPSpikeMin:           50,
+	}
+}
+
+// defaultMonitorAgents lists user agent substrings of common uptime monitoring services.
+func defaultMonitorAgents() []string {
+	return []string{
+		"UptimeRobot",
+		"Pingdom.com_bot",
+		"StatusCake",
+	}
+}
+
+// defaultMonitorCIDRs lists the published UptimeRobot probe ranges. Pingdom and
+// StatusCake probe from single addresses that change too often to ship; add
+// them to monitor_cidrs from the providers' own lists.
+func defaultMonitorCIDRs() []string {
+	return []string{
+		"69.162.124.224/28",
+		"63.143.42.240/28",
+		"216.245.221.80/28",
+		"208.115.199.16/28",
 	}
 }
 
@@ -84,6 +211,73 @@ type IPStats struct {
 	CountryName   string
 	PHP404s       int
 	SQLInjections int
+	UAClassCounts map[UAClass]int
+	Honeytokens   int
+	// MaxResponseBytes is the largest single response body served to the IP.
+	MaxResponseBytes int64
+	// RequestTime is the total $request_time in seconds consumed by the IP.
+	RequestTime float64
+	// EndpointTimes splits RequestTime by endpoint, see endpointOf.
+	EndpointTimes map[string]EndpointTime
+	// ASN and ASOrg identify the announcing network when an ASN database is loaded.
+	ASN   uint
+	ASOrg string
+	// IgnoredWindowRequests counts requests made inside ignore windows.
+	IgnoredWindowRequests int
+	// CacheBusters counts distinct random-looking query strings appended to static assets.
+	CacheBusters int
+	// LoggedPages counts non-asset requests whose log line records cookies;
+	// SessionPages counts those that carried a session cookie.
+	LoggedPages  int
+	SessionPages int
+	// CachedRequests counts requests whose log line records a cache status;
+	// CacheMisses counts those the origin served.
+	CachedRequests int
+	CacheMisses    int
+	// TLSRequests counts requests whose log line records the TLS protocol or
+	// cipher; TLSProtocols, TLSCiphers and JA3s count them per value.
+	TLSRequests  int
+	TLSProtocols map[string]int
+	TLSCiphers   map[string]int
+	JA3s         map[string]int
+	// HeaderRequests counts requests whose log line records Accept headers;
+	// HeaderAnomalies counts those with empty or browser-inconsistent headers.
+	HeaderRequests  int
+	HeaderAnomalies int
+	headerIssues    map[string]int
+	// WhitelistedRequests counts requests with a whitelisted user agent;
+	// Traversals counts requests climbing out of a directory with "../".
+	WhitelistedRequests int
+	Traversals          int
+	// Sources counts requests per log file when several logs are analyzed together.
+	Sources map[string]int
+	// Vhost is the vhost scope the stats were counted in, or "" for the
+	// rest of the log.
+	Vhost string
+	// Backends counts requests per proxy router or service, for logs that record it.
+	Backends map[string]int
+	// ResponseFlags counts Envoy response flags such as "NR" or "UF".
+	ResponseFlags map[string]int
+	// Hosts counts requests per sending host, for logs shipped through syslog.
+	Hosts map[string]int
+	// Annotation is the label the annotations file gives the IP, if any.
+	Annotation string
+	// HostHeaders counts requests per Host header, for logs that record $host;
+	// failedHosts holds those answered with an error.
+	HostHeaders map[string]int
+	failedHosts map[string]struct{}
+	bustQueries map[string]struct{}
+	// queryVariants holds the distinct query strings sent to each path.
+	queryVariants map[string]map[string]struct{}
+	// sequences holds the IP's state for each of the analyzer's sequence rules.
+	sequences []sequenceState
+	// hourFactorSum adds up the hour-of-week threshold factor of each request.
+	hourFactorSum float64
+	// firstLines and lastLines sample the IP's raw log lines; rawLines counts
+	// every line offered to them.
+	firstLines []string
+	lastLines  []string
+	rawLines   int
 }
 
 // Analyzer encapsulates the detection logic state.
@@ -91,36 +285,36 @@ type Analyzer struct {
 	cfg        Config
 	stats      map[string]*IPStats
 	geoLookup  GeoLookup
-	allowIPs   map[string]struct{}
-	allowCIDRs []*net.IPNet
+	allow      allowSet
+	monitors   allowSet
+	passed     allowSet
+	vhosts     vhostScopes
 	allowURIs  []string
 	pathLimits []PathLimit
+	sequences  []sequenceMatcher
+	crawlers   map[string]*CrawlerStats
+	classTotal map[UAClass]int
+	accounts   map[string]*AccountStats
+	// spikes caches CountrySpikes during scoring; Process resets it.
+	spikes map[string]CountrySpike
+	// hourFactors holds a threshold factor per hour-of-week slot, nil when flat.
+	hourFactors  []float64
+	hourRequests map[int]int
+	hoursSeen    map[int64]int
+}
+
+// CrawlerStats aggregates traffic from a whitelisted user agent across all IPs.
+type CrawlerStats struct {
+	Agent     string
+	Requests  int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Times     []time.Time
+	IPs       map[string]struct{}
 }
 
 // New returns a configured Analyzer.
 func New(cfg Config, geo GeoLookup) *Analyzer {
-	allowed := make(map[string]struct{})
-	for _, ip := range cfg.AllowedIPs {
-		ip = strings.TrimSpace(ip)
-		if ip == "" {
-			continue
-		}
-		allowed[ip] = struct{}{}
-	}
-
-	cidrs := make([]*net.IPNet, 0, len(cfg.AllowedCIDRs))
-	for _, raw := range cfg.AllowedCIDRs {
-		raw = strings.TrimSpace(raw)
-		if raw == "" {
-			continue
-		}
-		_, network, err := net.ParseCIDR(raw)
-		if err != nil {
-			continue
-		}
-		cidrs = append(cidrs, network)
-	}
-
 	normalizedURIs := make([]string, 0, len(cfg.AllowedURIs))
 	for _, uri := range cfg.AllowedURIs {
 		uri = strings.TrimSpace(uri)
@@ -139,52 +333,127 @@ func New(cfg Config, geo GeoLookup) *Analyzer {
 		pathLimits = append(pathLimits, limit)
 	}
 
+	var sequences []sequenceMatcher
+	for _, rule := range cfg.SequenceRules {
+		if matcher, err := rule.compile(); err == nil {
+			sequences = append(sequences, matcher)
+		}
+	}
+
 	return &Analyzer{
-		cfg:        cfg,
-		stats:      make(map[string]*IPStats),
-		geoLookup:  geo,
-		allowIPs:   allowed,
-		allowCIDRs: cidrs,
-		allowURIs:  normalizedURIs,
-		pathLimits: pathLimits,
+		cfg:          cfg,
+		stats:        make(map[string]*IPStats),
+		geoLookup:    geo,
+		allow:        newAllowSet(cfg.AllowedIPs, cfg.AllowedCIDRs),
+		monitors:     newAllowSet(nil, cfg.MonitorCIDRs),
+		passed:       newAllowSet(cfg.ChallengePassedIPs, nil),
+		vhosts:       newVhostScopes(cfg.VhostScopes),
+		allowURIs:    normalizedURIs,
+		pathLimits:   pathLimits,
+		sequences:    sequences,
+		crawlers:     make(map[string]*CrawlerStats),
+		classTotal:   make(map[UAClass]int),
+		accounts:     make(map[string]*AccountStats),
+		hourFactors:  buildHourFactors(cfg.HourBaselines, cfg.HourProfiles),
+		hourRequests: make(map[int]int),
+		hoursSeen:    make(map[int64]int),
 	}
 }
 
 // Process updates the analyzer with a new log entry.
 func (a *Analyzer) Process(entry Entry) {
+	a.spikes = nil
 	ip := entry.ClientIP
 	if ip == "" {
 		ip = entry.RemoteAddr
 	}
+	a.recordHour(entry.Time)
 
-	if a.isAllowedURI(entry.URI) {
+	// Signature and prefix rules match the decoded URI; counters keep it as logged.
+	uri := normalizeURI(entry.URI)
+	if a.isAllowedURI(uri) {
 		return
 	}
 
-	// Skip requests with whitelisted user agents (e.g., legitimate bots)
-	if entry.UserAgent != "" && containsSubstring(entry.UserAgent, a.cfg.WhitelistAgents) {
+	class := classifyUserAgent(entry.UserAgent)
+	a.classTotal[class]++
+
+	// Requests with whitelisted user agents (e.g., legitimate bots) are still
+	// counted, since scanners append "Googlebot" to theirs; evaluate exempts
+	// the IP only while most of its traffic carries one. Per-agent totals let
+	// abusive crawlers be reported for throttling.
+	whitelisted := false
+	if entry.UserAgent != "" {
+		if agent := matchSubstring(entry.UserAgent, a.cfg.WhitelistAgents); agent != "" {
+			a.recordCrawler(agent, ip, entry.Time)
+			whitelisted = true
+		}
+	}
+
+	// Skip requests from uptime monitors, the most common false positives for error/burst rules
+	if a.monitorAgent(ip, entry.UserAgent) != "" {
 		return
 	}
 
-	ipStat, ok := a.stats[ip]
+	scope := a.vhosts.scopeOf(entry.Host)
+	key := statKey(ip, scope)
+	ipStat, ok := a.stats[key]
 	if !ok {
 		ipStat = &IPStats{
-			IP:           ip,
-			StatusCounts: make(map[int]int),
-			UniquePaths:  make(map[string]struct{}),
-			UserAgents:   make(map[string]int),
-			PathCounts:   make(map[string]int),
+			IP:            ip,
+			Vhost:         scope,
+			StatusCounts:  make(map[int]int),
+			UniquePaths:   make(map[string]struct{}),
+			UserAgents:    make(map[string]int),
+			PathCounts:    make(map[string]int),
+			UAClassCounts: make(map[UAClass]int),
+			Sources:       make(map[string]int),
 		}
 		if a.geoLookup != nil {
 			if info, ok := a.geoLookup(ip); ok {
 				ipStat.CountryISO = info.CountryISO
 				ipStat.CountryName = info.CountryName
+				ipStat.ASN = info.ASN
+				ipStat.ASOrg = info.ASOrg
 			}
 		}
-		a.stats[ip] = ipStat
+		ipStat.Annotation = a.cfg.Annotations.Label(ip)
+		a.stats[key] = ipStat
+	}
+
+	if user := accountUser(entry); user != "" {
+		a.recordAccount(user, entry, ipStat)
 	}
 
 	ipStat.Requests++
+	ipStat.recordRawLine(entry.Raw, a.cfg.RawLines)
+	if a.hourFactors != nil {
+		ipStat.hourFactorSum += a.hourFactors[hourOfWeek(entry.Time)]
+	}
+	if a.inIgnoreWindow(entry.Time) {
+		ipStat.IgnoredWindowRequests++
+	}
+	if entry.Source != "" {
+		ipStat.Sources[entry.Source]++
+	}
+	if entry.Backend != "" {
+		if ipStat.Backends == nil {
+			ipStat.Backends = make(map[string]int)
+		}
+		ipStat.Backends[entry.Backend]++
+	}
+	for _, flag := range envoyFlags(entry.ResponseFlags) {
+		if ipStat.ResponseFlags == nil {
+			ipStat.ResponseFlags = make(map[string]int)
+		}
+		ipStat.ResponseFlags[flag]++
+	}
+	if entry.Hostname != "" {
+		if ipStat.Hosts == nil {
+			ipStat.Hosts = make(map[string]int)
+		}
+		ipStat.Hosts[entry.Hostname]++
+	}
 	if ipStat.FirstSeen.IsZero() || entry.Time.Before(ipStat.FirstSeen) {
 		ipStat.FirstSeen = entry.Time
 	}
@@ -193,153 +462,432 @@ func (a *Analyzer) Process(entry Entry) {
 	}
 
 	ipStat.StatusCounts[entry.Status]++
-	if len(ipStat.UniquePaths) <= 500 {
-		if len(entry.URI) > 0 {
-			ipStat.UniquePaths[entry.URI] = struct{}{}
+	if len(entry.URI) > 0 {
+		path := normalizePath(entry.URI)
+		if len(ipStat.UniquePaths) <= 500 {
+			ipStat.UniquePaths[path] = struct{}{}
 		}
-	}
-	if len(ipStat.PathCounts) <= 500 {
-		if len(entry.URI) > 0 {
-			ipStat.PathCounts[entry.URI]++
+		if len(ipStat.PathCounts) <= 500 {
+			ipStat.PathCounts[path]++
+		}
+		// Random queries on static assets are scored as cache busting.
+		if !isStaticAsset(entry.URI) {
+			ipStat.recordQuery(path)
 		}
+		ipStat.recordSequences(a.sequences, entry, path)
 	}
 
 	if entry.UserAgent != "" {
 		ipStat.UserAgents[entry.UserAgent]++
 	}
+	ipStat.UAClassCounts[class]++
 
-	if entry.Status == 404 && strings.Contains(strings.ToLower(entry.URI), ".php") {
+	if entry.Status == 404 && strings.Contains(strings.ToLower(uri), ".php") {
 		ipStat.PHP404s++
 	}
 
-	if isSQLInjection(entry.URI) {
+	if isSQLInjection(uri) {
 		ipStat.SQLInjections++
 	}
+	if isPathTraversal(uri) {
+		ipStat.Traversals++
+	}
+	if whitelisted {
+		ipStat.WhitelistedRequests++
+	}
+
+	if isCacheBusting(entry.URI) {
+		if ipStat.bustQueries == nil {
+			ipStat.bustQueries = make(map[string]struct{})
+		}
+		if _, seen := ipStat.bustQueries[entry.URI]; !seen && len(ipStat.bustQueries) <= 500 {
+			ipStat.bustQueries[entry.URI] = struct{}{}
+			ipStat.CacheBusters++
+		}
+	}
+
+	ipStat.recordHeaders(entry, class)
+	ipStat.recordTLS(entry)
+	ipStat.recordHostHeader(entry.Host, entry.Status)
+
+	if entry.CacheStatus != "" {
+		ipStat.CachedRequests++
+		if cacheMiss(entry.CacheStatus) {
+			ipStat.CacheMisses++
+		}
+	}
+
+	if entry.SessionLogged && !isStaticAsset(entry.URI) {
+		ipStat.LoggedPages++
+		if entry.HasSession {
+			ipStat.SessionPages++
+		}
+	}
+
+	if containsSubstring(uri, a.cfg.Honeytokens) {
+		ipStat.Honeytokens++
+	}
 
 	ipStat.Bytes += entry.Bytes
+	ipStat.RequestTime += entry.RequestTime
+	if entry.RequestTime > 0 {
+		ipStat.recordEndpointTime(entry.URI, entry.RequestTime)
+	}
+	if entry.Bytes > ipStat.MaxResponseBytes {
+		ipStat.MaxResponseBytes = entry.Bytes
+	}
 	ipStat.BurstWindows = append(ipStat.BurstWindows, entry.Time)
 }
 
 // Suspicion represents an IP flagged as suspicious with supporting details.
 type Suspicion struct {
-	IP      string
-	Score   int
-	Reasons []string
-	Stats   *IPStats
+	IP       string
+	Score    int
+	Severity Severity
+	Reasons  []string
+	// Rules lists the codes of the scoring rules that fired, used for
+	// notification routing.
+	Rules []string
+	Stats *IPStats
 }
 
+// Rule codes identify the scoring rules recorded in Suspicion.Rules.
+const (
+	RuleSensitivePath = "sensitive_path"
+	RuleHoneytoken    = "honeytoken"
+	RuleRate          = "rate"
+	RuleBurst         = "burst"
+	RuleErrors        = "errors"
+	RuleErrorRatio    = "error_ratio"
+	RuleUniquePaths   = "unique_paths"
+	RulePHP404        = "php_404"
+	RuleSQLInjection  = "sql_injection"
+	RuleCacheBusting  = "cache_busting"
+	RuleCacheMiss     = "cache_miss"
+	RuleUpstreamTime  = "upstream_time"
+	RulePeer          = "peer"
+	RuleCountry       = "country"
+	RuleCountrySpike  = "country_spike"
+	RuleNoSession     = "no_session"
+	RuleHeaders       = "headers"
+	RuleLegacyTLS     = "legacy_tls"
+	RuleSingleCipher  = "single_cipher"
+	RuleVhostScan     = "vhost_scan"
+	RuleQueryFuzzing  = "query_fuzzing"
+	RuleStatus        = "status"
+	RuleSequence      = "sequence"
+)
+
 // Suspicious returns suspicious IPs sorted by score descending.
 func (a *Analyzer) Suspicious() []Suspicion {
 	suspects := make([]Suspicion, 0)
 
 	for _, stat := range a.stats {
-		if a.isAllowed(stat.IP) {
-			continue
-		}
-		sensitiveReasons := a.sensitiveURLReasons(stat)
-		forceBlock := len(sensitiveReasons) > 0
-		if !forceBlock && stat.Requests < a.cfg.MinRequests {
-			continue
-		}
-		score := 0
-		reasons := make([]string, 0, len(sensitiveReasons)+4)
-		if forceBlock {
-			score += len(sensitiveReasons) * 3
-			reasons = append(reasons, sensitiveReasons...)
+		if suspect, ok := a.evaluate(stat); ok {
+			suspects = append(suspects, suspect)
 		}
+	}
 
-		duration := stat.LastSeen.Sub(stat.FirstSeen)
-		if duration < time.Minute {
-			duration = time.Minute
-		}
-		avgRPM := float64(stat.Requests) / duration.Minutes()
-		if stat.Requests >= a.cfg.MinRequests && avgRPM > a.cfg.MaxAverageRPM {
-			score++
-			reasons = append(reasons, fmt.Sprintf("avg rpm %.1f > %.1f", avgRPM, a.cfg.MaxAverageRPM))
+	sort.Slice(suspects, func(i, j int) bool {
+		if suspects[i].Score == suspects[j].Score {
+			return suspects[i].Stats.Requests > suspects[j].Stats.Requests
 		}
+		return suspects[i].Score > suspects[j].Score
+	})
 
-		if burst := maxBurst(stat.BurstWindows, a.cfg.MaxBurstWindow); burst > a.cfg.MaxBurstRequests {
-			score++
-			reasons = append(reasons, fmt.Sprintf("burst %d req in %s", burst, a.cfg.MaxBurstWindow))
+	return suspects
+}
+
+// Explain scores a single IP regardless of whether it crosses the blocking thresholds.
+// The second result reports whether the IP was seen, the third whether it would be blocked.
+func (a *Analyzer) Explain(ip string) (Suspicion, bool, bool) {
+	stat, ok := a.stats[ip]
+	// An IP seen only in vhost scopes is explained in the first of them.
+	for _, scope := range vhostScopeNames(a.cfg.VhostScopes) {
+		if ok {
+			break
 		}
+		stat, ok = a.stats[statKey(ip, scope)]
+	}
+	if !ok {
+		return Suspicion{IP: ip}, false, false
+	}
+	suspect, blocked := a.evaluate(stat)
+	return suspect, true, blocked
+}
 
-		errorCount := 0
-		for status, count := range stat.StatusCounts {
-			if status >= 400 {
-				errorCount += count
-			}
+// evaluate computes the score and reasons for an IP and reports whether it should be blocked.
+func (a *Analyzer) evaluate(stat *IPStats) (Suspicion, bool) {
+	if len(a.cfg.IgnoreWindows) > 0 && mostlyInIgnoreWindows(stat) {
+		return a.evaluateInIgnoreWindow(stat)
+	}
+	if a.passed.allowedBy(stat.IP) != "" {
+		return a.evaluateChallengePassed(stat)
+	}
+	suspect := Suspicion{IP: stat.IP, Stats: stat}
+	if a.isAllowed(stat.IP) || a.vhosts.allow[stat.Vhost].allowedBy(stat.IP) != "" {
+		return suspect, false
+	}
+	if a.whitelistedAgent(stat) {
+		return suspect, false
+	}
+	sensitiveReasons := a.sensitiveURLReasons(stat)
+	if stat.Honeytokens > 0 {
+		sensitiveReasons = append(sensitiveReasons, fmt.Sprintf("%d honeytoken hits", stat.Honeytokens))
+	}
+	forceBlock := len(sensitiveReasons) > 0
+	limits := a.limitsFor(stat)
+	if !forceBlock && stat.Requests < limits.MinRequests {
+		return suspect, false
+	}
+	score := 0
+	reasons := make([]string, 0, len(sensitiveReasons)+4)
+	rules := make([]string, 0, 4)
+	if forceBlock {
+		score += len(sensitiveReasons) * 3
+		reasons = append(reasons, sensitiveReasons...)
+		if stat.Honeytokens > 0 {
+			rules = append(rules, RuleHoneytoken)
 		}
-		if errorCount >= a.cfg.Min404Errors {
-			score++
-			reasons = append(reasons, fmt.Sprintf("%d error responses", errorCount))
+		if len(sensitiveReasons) > 1 || stat.Honeytokens == 0 {
+			rules = append(rules, RuleSensitivePath)
 		}
+	}
 
-		if stat.Requests > 0 {
-			ratio := float64(errorCount) / float64(stat.Requests)
-			if ratio >= a.cfg.MinErrorRatio {
-				score++
-				reasons = append(reasons, fmt.Sprintf("error ratio %.0f%%", ratio*100))
-			}
-		}
+	duration := stat.LastSeen.Sub(stat.FirstSeen)
+	if duration < time.Minute {
+		duration = time.Minute
+	}
+	avgRPM := float64(stat.Requests) / duration.Minutes()
+	if stat.Requests >= limits.MinRequests && avgRPM > limits.MaxAverageRPM {
+		score++
+		rules = append(rules, RuleRate)
+		reasons = append(reasons, fmt.Sprintf("avg rpm %.1f > %.1f", avgRPM, limits.MaxAverageRPM))
+	}
 
-		if unique := len(stat.UniquePaths); unique >= a.cfg.MinUniquePaths {
-			score++
-			reasons = append(reasons, fmt.Sprintf("%d unique paths", unique))
+	if burst := maxBurst(stat.BurstWindows, a.cfg.MaxBurstWindow); burst > limits.MaxBurstRequests {
+		score++
+		rules = append(rules, RuleBurst)
+		reasons = append(reasons, fmt.Sprintf("burst %d req in %s", burst, a.cfg.MaxBurstWindow))
+	}
+
+	errorCount := 0
+	for status, count := range stat.StatusCounts {
+		if status >= 400 {
+			errorCount += count
 		}
+	}
+	if errorCount >= a.cfg.Min404Errors {
+		score++
+		rules = append(rules, RuleErrors)
+		reasons = append(reasons, fmt.Sprintf("%d error responses", errorCount))
+	}
 
-		if stat.PHP404s >= a.cfg.MinPHP404s {
+	if stat.Requests > 0 {
+		ratio := float64(errorCount) / float64(stat.Requests)
+		if ratio >= a.cfg.MinErrorRatio {
 			score++
-			reasons = append(reasons, fmt.Sprintf("%d php 404s", stat.PHP404s))
+			rules = append(rules, RuleErrorRatio)
+			reasons = append(reasons, fmt.Sprintf("error ratio %.0f%%", ratio*100))
 		}
+	}
 
-		if stat.SQLInjections >= a.cfg.MinSQLInjections {
-			score += 2
-			reasons = append(reasons, fmt.Sprintf("%d SQL injection attempts", stat.SQLInjections))
-		}
+	if unique := len(stat.UniquePaths); unique >= a.cfg.MinUniquePaths {
+		score++
+		rules = append(rules, RuleUniquePaths)
+		reasons = append(reasons, fmt.Sprintf("%d unique paths", unique))
+	}
 
-		if stat.CountryISO != "" && containsStringCI(stat.CountryISO, a.cfg.SuspiciousCountries) {
-			score++
-			reasons = append(reasons, fmt.Sprintf("country %s flagged", stat.CountryISO))
+	if stat.PHP404s >= a.cfg.MinPHP404s {
+		score++
+		rules = append(rules, RulePHP404)
+		reasons = append(reasons, fmt.Sprintf("%d php 404s", stat.PHP404s))
+	}
+
+	if stat.SQLInjections >= a.cfg.MinSQLInjections {
+		score += 2
+		rules = append(rules, RuleSQLInjection)
+		reasons = append(reasons, fmt.Sprintf("%d SQL injection attempts", stat.SQLInjections))
+	}
+
+	if a.cfg.MinCacheBusters > 0 && stat.CacheBusters >= a.cfg.MinCacheBusters {
+		score++
+		rules = append(rules, RuleCacheBusting)
+		reasons = append(reasons, fmt.Sprintf("%d cache-busting requests", stat.CacheBusters))
+	}
+
+	if a.cfg.MinCookielessPages > 0 && stat.SessionPages == 0 && stat.LoggedPages >= a.cfg.MinCookielessPages {
+		score++
+		rules = append(rules, RuleNoSession)
+		reasons = append(reasons, fmt.Sprintf("%d page requests without a session cookie", stat.LoggedPages))
+	}
+
+	if a.cfg.MinCacheMisses > 0 && stat.CacheMisses >= a.cfg.MinCacheMisses && float64(stat.CacheMisses) >= cacheMissShare*float64(stat.CachedRequests) {
+		score++
+		rules = append(rules, RuleCacheMiss)
+		reasons = append(reasons, fmt.Sprintf("%d requests past the cache (%.0f%% misses)", stat.CacheMisses, float64(stat.CacheMisses)/float64(stat.CachedRequests)*100))
+	}
+
+	if a.cfg.MinHeaderAnomalies > 0 && stat.HeaderAnomalies >= a.cfg.MinHeaderAnomalies && stat.HeaderAnomalies*2 >= stat.HeaderRequests {
+		score++
+		rules = append(rules, RuleHeaders)
+		reasons = append(reasons, fmt.Sprintf("%d requests with anomalous headers (%s)", stat.HeaderAnomalies, stat.topHeaderIssue()))
+	}
+
+	if legacy, protocols := stat.legacyTLSRequests(); a.cfg.MinLegacyTLS > 0 && legacy >= a.cfg.MinLegacyTLS && legacy*2 > stat.TLSRequests {
+		score++
+		rules = append(rules, RuleLegacyTLS)
+		reasons = append(reasons, fmt.Sprintf("%d requests over %s", legacy, escapeControl(strings.Join(protocols, "/"))))
+	}
+
+	if cipher, ja3 := stat.singleCipher(); a.cfg.MinSingleCipher > 0 && cipher != "" && stat.TLSRequests >= a.cfg.MinSingleCipher {
+		score++
+		rules = append(rules, RuleSingleCipher)
+		reasons = append(reasons, fmt.Sprintf("%d TLS requests all with cipher %s and JA3 %s", stat.TLSRequests, escapeControl(cipher), escapeControl(ja3)))
+	}
+
+	if weight, statusReasons := a.statusRuleReasons(stat); weight > 0 {
+		score += weight
+		rules = append(rules, RuleStatus)
+		reasons = append(reasons, statusReasons...)
+	}
+
+	if weight, sequenceReasons := a.sequenceRuleReasons(stat); weight > 0 {
+		score += weight
+		rules = append(rules, RuleSequence)
+		reasons = append(reasons, sequenceReasons...)
+	}
+
+	if hosts := len(stat.HostHeaders); a.cfg.MinHostHeaders > 0 && hosts >= a.cfg.MinHostHeaders {
+		score++
+		rules = append(rules, RuleVhostScan)
+		reasons = append(reasons, fmt.Sprintf("%d Host headers probed (%d answered with errors)", hosts, len(stat.failedHosts)))
+	}
+
+	if path, variants := stat.fuzzedPath(); a.cfg.MinQueryVariants > 0 && variants >= a.cfg.MinQueryVariants {
+		score++
+		rules = append(rules, RuleQueryFuzzing)
+		reasons = append(reasons, fmt.Sprintf("%d query strings on %s", variants, escapeControl(path)))
+	}
+
+	if a.cfg.MaxUpstreamSeconds > 0 && stat.RequestTime >= a.cfg.MaxUpstreamSeconds {
+		weight := int(stat.RequestTime / a.cfg.MaxUpstreamSeconds)
+		if weight > 3 {
+			weight = 3
 		}
+		score += weight
+		rules = append(rules, RuleUpstreamTime)
+		reasons = append(reasons, fmt.Sprintf("%.1fs upstream time consumed", stat.RequestTime))
+	}
 
-		if forceBlock || score >= a.cfg.ScoreThreshold {
-			// More intelligent blocking: require higher score for low-error traffic
-			errorRatio := 0.0
-			if stat.Requests > 0 {
-				errorRatio = float64(errorCount) / float64(stat.Requests)
-			}
+	if peer, ok := a.cfg.PeerReports[stat.IP]; ok {
+		score++
+		rules = append(rules, RulePeer)
+		reasons = append(reasons, fmt.Sprintf("reported by peer %s", peer))
+	}
 
-			// If traffic has very few errors (<10%), require score >= 4
-			// If traffic has no errors at all, require score >= 5
-			shouldBlock := forceBlock
-			if !forceBlock {
-				shouldBlock = true
-				if errorCount == 0 {
-					shouldBlock = score >= 5
-				} else if errorRatio < 0.10 {
-					shouldBlock = score >= 4
-				}
+	if stat.CountryISO != "" && containsStringCI(stat.CountryISO, a.cfg.SuspiciousCountries) {
+		score++
+		rules = append(rules, RuleCountry)
+		reasons = append(reasons, fmt.Sprintf("country %s flagged", stat.CountryISO))
+	}
+
+	if spike, ok := a.countrySpike(stat.CountryISO); ok {
+		score++
+		rules = append(rules, RuleCountrySpike)
+		reasons = append(reasons, spike.describe())
+	}
+
+	suspect.Score = score
+	suspect.Severity = a.cfg.Severity.Classify(score)
+	suspect.Reasons = reasons
+	suspect.Rules = rules
+	if forceBlock || score >= limits.ScoreThreshold {
+		// More intelligent blocking: require higher score for low-error traffic
+		errorRatio := 0.0
+		if stat.Requests > 0 {
+			errorRatio = float64(errorCount) / float64(stat.Requests)
+		}
+
+		// If traffic has very few errors (<10%), require score >= 4
+		// If traffic has no errors at all, require score >= 5
+		shouldBlock := forceBlock
+		if !forceBlock {
+			shouldBlock = true
+			if errorCount == 0 {
+				shouldBlock = score >= 5
+			} else if errorRatio < 0.10 {
+				shouldBlock = score >= 4
 			}
 
-			if shouldBlock {
-				suspects = append(suspects, Suspicion{
-					IP:      stat.IP,
-					Score:   score,
-					Reasons: reasons,
-					Stats:   stat,
-				})
+			// Blocking a client that only ever received tiny responses (e.g. edge
+			// redirects) saves nothing and risks collateral damage.
+			if a.cfg.MinBytesServed > 0 && stat.MaxResponseBytes < a.cfg.MinBytesServed {
+				shouldBlock = false
 			}
 		}
+
+		return suspect, shouldBlock
 	}
+	return suspect, false
+}
 
-	sort.Slice(suspects, func(i, j int) bool {
-		if suspects[i].Score == suspects[j].Score {
-			return suspects[i].Stats.Requests > suspects[j].Stats.Requests
+// IPLimits are the thresholds that apply to one IP.
+type IPLimits struct {
+	ClassLimit
+	MaxBurstRequests int
+}
+
+// limitsFor resolves the thresholds that apply to an IP given its dominant UA
+// class and, with hour profiles, the hours it was active in.
+func (a *Analyzer) limitsFor(stat *IPStats) IPLimits {
+	limits := IPLimits{
+		ClassLimit: ClassLimit{
+			MinRequests:    a.cfg.MinRequests,
+			MaxAverageRPM:  a.cfg.MaxAverageRPM,
+			ScoreThreshold: a.cfg.ScoreThreshold,
+		},
+		MaxBurstRequests: a.cfg.MaxBurstRequests,
+	}
+	if override, ok := a.cfg.ClassLimits[stat.DominantClass()]; ok {
+		if override.MinRequests > 0 {
+			limits.MinRequests = override.MinRequests
 		}
-		return suspects[i].Score > suspects[j].Score
-	})
+		if override.MaxAverageRPM > 0 {
+			limits.MaxAverageRPM = override.MaxAverageRPM
+		}
+		if override.ScoreThreshold > 0 {
+			limits.ScoreThreshold = override.ScoreThreshold
+		}
+	}
+	if scope, ok := a.cfg.VhostScopes[stat.Vhost]; ok {
+		if scope.MinRequests > 0 {
+			limits.MinRequests = scope.MinRequests
+		}
+		if scope.MaxAverageRPM > 0 {
+			limits.MaxAverageRPM = scope.MaxAverageRPM
+		}
+		if scope.ScoreThreshold > 0 {
+			limits.ScoreThreshold = scope.ScoreThreshold
+		}
+		if scope.MaxBurstRequests > 0 {
+			limits.MaxBurstRequests = scope.MaxBurstRequests
+		}
+	}
+	if factor := stat.hourFactor(); factor != 1 {
+		limits.MaxAverageRPM *= factor
+		limits.MaxBurstRequests = max(1, int(math.Round(float64(limits.MaxBurstRequests)*factor)))
+	}
+	return limits
+}
 
-	return suspects
+// ClassTotals returns request counts per user agent class, including whitelisted traffic.
+func (a *Analyzer) ClassTotals() map[UAClass]int {
+	totals := make(map[UAClass]int, len(a.classTotal))
+	for class, count := range a.classTotal {
+		totals[class] = count
+	}
+	return totals
 }
 
 func maxBurst(times []time.Time, window time.Duration) int {
@@ -365,26 +913,38 @@ func maxBurst(times []time.Time, window time.Duration) int {
 	return maxCount
 }
 
-func (a *Analyzer) isAllowed(ip string) bool {
-	if ip == "" {
-		return false
-	}
-	if _, ok := a.allowIPs[ip]; ok {
-		return true
-	}
-	if len(a.allowCIDRs) == 0 {
-		return false
+// monitorAgent returns the monitor_agents substring matched by agent when the
+// request also comes from monitor_cidrs, or "". Any client can send a monitor
+// user agent, so the agent alone does not exempt a request.
+func (a *Analyzer) monitorAgent(ip, agent string) string {
+	if !a.cfg.AllowMonitors || agent == "" {
+		return ""
 	}
-	parsed := net.ParseIP(ip)
-	if parsed == nil {
-		return false
+	match := matchSubstring(agent, a.cfg.MonitorAgents)
+	if match == "" || a.monitors.allowedBy(ip) == "" {
+		return ""
 	}
-	for _, network := range a.allowCIDRs {
-		if network.Contains(parsed) {
-			return true
+	return match
+}
+
+// requestsFrom returns how many requests of ip were counted, across vhost scopes.
+func (a *Analyzer) requestsFrom(ip string) int {
+	total := 0
+	for _, stat := range a.stats {
+		if stat.IP == ip {
+			total += stat.Requests
 		}
 	}
-	return false
+	return total
+}
+
+func (a *Analyzer) isAllowed(ip string) bool {
+	return a.allowedBy(ip) != ""
+}
+
+// allowedBy returns the allowlisted IP or network covering ip, or "".
+func (a *Analyzer) allowedBy(ip string) string {
+	return a.allow.allowedBy(ip)
 }
 
 // Stats returns a snapshot of the internal per-IP statistics.
@@ -397,15 +957,20 @@ func (a *Analyzer) Stats() []*IPStats {
 }
 
 func (a *Analyzer) isAllowedURI(uri string) bool {
-	if uri == "" || len(a.allowURIs) == 0 {
-		return false
+	return a.allowedURIPrefix(uri) != ""
+}
+
+// allowedURIPrefix returns the allow_urls prefix matching uri, or "".
+func (a *Analyzer) allowedURIPrefix(uri string) string {
+	if uri == "" {
+		return ""
 	}
 	for _, allowed := range a.allowURIs {
 		if strings.HasPrefix(uri, allowed) {
-			return true
+			return allowed
 		}
 	}
-	return false
+	return ""
 }
 
 func (a *Analyzer) sensitiveURLReasons(stat *IPStats) []string {
@@ -416,8 +981,9 @@ func (a *Analyzer) sensitiveURLReasons(stat *IPStats) []string {
 	reasons := make([]string, 0)
 	for _, limit := range a.pathLimits {
 		hits := 0
+		prefix := normalizePath(limit.Prefix)
 		for path, count := range stat.PathCounts {
-			if strings.HasPrefix(path, limit.Prefix) {
+			if strings.HasPrefix(path, prefix) {
 				hits += count
 			}
 		}
@@ -429,15 +995,20 @@ func (a *Analyzer) sensitiveURLReasons(stat *IPStats) []string {
 }
 
 func containsSubstring(value string, substrings []string) bool {
+	return matchSubstring(value, substrings) != ""
+}
+
+// matchSubstring returns the first non-empty substring contained in value.
+func matchSubstring(value string, substrings []string) string {
 	for _, sub := range substrings {
 		if sub == "" {
 			continue
 		}
 		if strings.Contains(value, sub) {
-			return true
+			return sub
 		}
 	}
-	return false
+	return ""
 }
 
 func containsStringCI(value string, items []string) bool {
@@ -449,6 +1020,22 @@ func containsStringCI(value string, items []string) bool {
 	return false
 }
 
+// whitelistedAgent reports whether the IP is exempt as a whitelisted
+// crawler: enough of its requests carry a whitelisted user agent and none
+// of them tried SQL injection or path traversal.
+func (a *Analyzer) whitelistedAgent(stat *IPStats) bool {
+	if stat.WhitelistedRequests == 0 || stat.SQLInjections > 0 || stat.Traversals > 0 {
+		return false
+	}
+	return float64(stat.WhitelistedRequests) >= a.cfg.WhitelistMinShare*float64(stat.Requests)
+}
+
+// isPathTraversal reports whether a normalized URI climbs out of a
+// directory, in its path or in a query parameter.
+func isPathTraversal(uri string) bool {
+	return strings.Contains(uri, "../") || strings.HasSuffix(uri, "/..")
+}
+
 // isSQLInjection checks if a URI contains SQL injection patterns.
 func isSQLInjection(uri string) bool {
 	if uri == "" {
@@ -508,6 +1095,158 @@ func isSQLInjection(uri string) bool {
 	return false
 }
 
+func (a *Analyzer) recordCrawler(agent, ip string, t time.Time) {
+	crawler, ok := a.crawlers[agent]
+	if !ok {
+		crawler = &CrawlerStats{Agent: agent, IPs: make(map[string]struct{})}
+		a.crawlers[agent] = crawler
+	}
+	crawler.Requests++
+	if crawler.FirstSeen.IsZero() || t.Before(crawler.FirstSeen) {
+		crawler.FirstSeen = t
+	}
+	if t.After(crawler.LastSeen) {
+		crawler.LastSeen = t
+	}
+	crawler.Times = append(crawler.Times, t)
+	if ip != "" {
+		crawler.IPs[ip] = struct{}{}
+	}
+}
+
+// CrawlerThrottle reports a whitelisted crawler whose request rate exceeds the thresholds.
+type CrawlerThrottle struct {
+	Agent   string
+	Stats   *CrawlerStats
+	AvgRPM  float64
+	Burst   int
+	Reasons []string
+	// CrawlDelay is the robots.txt crawl-delay in seconds that would keep the crawler under MaxAverageRPM.
+	CrawlDelay int
+	// RateLimit is a suggested nginx limit_req rate for the crawler.
+	RateLimit string
+}
+
+// ThrottledCrawlers returns whitelisted crawlers exceeding the rate or burst thresholds, busiest first.
+func (a *Analyzer) ThrottledCrawlers() []CrawlerThrottle {
+	results := make([]CrawlerThrottle, 0)
+	for _, crawler := range a.crawlers {
+		if crawler.Requests < a.cfg.MinRequests {
+			continue
+		}
+		duration := crawler.LastSeen.Sub(crawler.FirstSeen)
+		if duration < time.Minute {
+			duration = time.Minute
+		}
+		avgRPM := float64(crawler.Requests) / duration.Minutes()
+		burst := maxBurst(crawler.Times, a.cfg.MaxBurstWindow)
+
+		reasons := make([]string, 0, 2)
+		if avgRPM > a.cfg.MaxAverageRPM {
+			reasons = append(reasons, fmt.Sprintf("avg rpm %.1f > %.1f", avgRPM, a.cfg.MaxAverageRPM))
+		}
+		if burst > a.cfg.MaxBurstRequests {
+			reasons = append(reasons, fmt.Sprintf("burst %d req in %s", burst, a.cfg.MaxBurstWindow))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		crawlDelay := 1
+		rate := "1r/s"
+		if a.cfg.MaxAverageRPM > 0 {
+			crawlDelay = int(math.Ceil(60 / a.cfg.MaxAverageRPM))
+			if crawlDelay < 1 {
+				crawlDelay = 1
+			}
+			rate = fmt.Sprintf("%dr/m", int(math.Max(1, math.Floor(a.cfg.MaxAverageRPM))))
+		}
+
+		results = append(results, CrawlerThrottle{
+			Agent:      crawler.Agent,
+			Stats:      crawler,
+			AvgRPM:     avgRPM,
+			Burst:      burst,
+			Reasons:    reasons,
+			CrawlDelay: crawlDelay,
+			RateLimit:  rate,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].AvgRPM == results[j].AvgRPM {
+			return results[i].Agent < results[j].Agent
+		}
+		return results[i].AvgRPM > results[j].AvgRPM
+	})
+	return results
+}
+
+// staticAssetExtensions lists file types normally served from cache.
+var staticAssetExtensions = []string{
+	".js", ".css", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif",
+	".ico", ".woff", ".woff2", ".ttf", ".eot", ".map", ".mp4", ".webm", ".pdf",
+}
+
+// isStaticAsset reports whether uri requests one of staticAssetExtensions.
+func isStaticAsset(uri string) bool {
+	path, _, _ := strings.Cut(uri, "?")
+	path = strings.ToLower(path)
+	for _, ext := range staticAssetExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCacheBusting reports whether uri requests a static asset with a random-looking
+// query string (e.g. ?v=83749823 or ?_=1700000000000), which defeats CDN caching.
+func isCacheBusting(uri string) bool {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok || query == "" {
+		return false
+	}
+	if !isStaticAsset(path) {
+		return false
+	}
+
+	for _, pair := range strings.Split(query, "&") {
+		key, value, hasValue := strings.Cut(pair, "=")
+		if !hasValue {
+			value = key
+			key = ""
+		}
+		if key == "_" && value != "" {
+			return true
+		}
+		if looksRandom(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksRandom reports whether value resembles a nonce: a long run of digits or hex characters.
+func looksRandom(value string) bool {
+	if len(value) < 6 {
+		return false
+	}
+	digits, hex := 0, 0
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+			hex++
+		case (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F'):
+			hex++
+		default:
+			return false
+		}
+	}
+	return digits == len(value) || (len(value) >= 8 && digits > 0 && hex == len(value))
+}
+
 // TopPaths returns the highest frequency paths for display purposes.
 func TopPaths(stat *IPStats, limit int) []string {
 	if len(stat.PathCounts) == 0 || limit <= 0 {
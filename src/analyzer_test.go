@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -337,3 +338,386 @@ func TestSQLInjectionDetection(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalyzerSkipsUptimeMonitors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinErrorRatio = 0
+	cfg.Min404Errors = 0
+	// Pingdom probes are not built in; they are added from the provider's list.
+	cfg.MonitorCIDRs = append(defaultMonitorCIDRs(), "178.255.152.2/32")
+
+	now := time.Now()
+	monitorEntries := []Entry{
+		{ClientIP: "178.255.152.2", RemoteAddr: "178.255.152.2", Time: now, URI: "/health", Status: 503, UserAgent: "Pingdom.com_bot_version_1.4_(http://www.pingdom.com/)"},
+		{ClientIP: "69.162.124.230", RemoteAddr: "69.162.124.230", Time: now, URI: "/health", Status: 503, UserAgent: "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)"},
+	}
+
+	analyzer := New(cfg, nil)
+	for _, entry := range monitorEntries {
+		analyzer.Process(entry)
+	}
+	if suspects := analyzer.Suspicious(); len(suspects) != 0 {
+		t.Fatalf("expected monitors to be allowed, got %d suspects", len(suspects))
+	}
+
+	// A monitor user agent outside the published ranges is scored like any other client.
+	spoofed := Entry{ClientIP: "203.0.113.5", RemoteAddr: "203.0.113.5", Time: now, URI: "/health", Status: 503, UserAgent: "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)"}
+	analyzer.Process(spoofed)
+	if suspects := analyzer.Suspicious(); len(suspects) != 1 || suspects[0].IP != "203.0.113.5" {
+		t.Fatalf("expected the spoofed monitor agent to be scored, got %+v", suspects)
+	}
+
+	// A monitor range is not an allowlist: other agents from it are scored too.
+	analyzer = New(cfg, nil)
+	analyzer.Process(Entry{ClientIP: "69.162.124.231", RemoteAddr: "69.162.124.231", Time: now, URI: "/health", Status: 503, UserAgent: "curl/8.0"})
+	if suspects := analyzer.Suspicious(); len(suspects) != 1 || suspects[0].IP != "69.162.124.231" {
+		t.Fatalf("expected a non-monitor agent from a monitor range to be scored, got %+v", suspects)
+	}
+
+	cfg.AllowMonitors = false
+	analyzer = New(cfg, nil)
+	for _, entry := range monitorEntries {
+		analyzer.Process(entry)
+	}
+	if suspects := analyzer.Suspicious(); len(suspects) != 2 {
+		t.Fatalf("expected 2 suspects with monitors disabled, got %d", len(suspects))
+	}
+}
+
+func TestAnalyzerReportsAbusiveWhitelistedCrawler(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.MaxAverageRPM = 30
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 120; i++ {
+		analyzer.Process(Entry{
+			ClientIP:   "66.249.66.1",
+			RemoteAddr: "66.249.66.1",
+			Time:       now.Add(time.Duration(i) * 500 * time.Millisecond),
+			URI:        "/catalog",
+			Status:     200,
+			UserAgent:  "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		})
+	}
+
+	if suspects := analyzer.Suspicious(); len(suspects) != 0 {
+		t.Fatalf("expected whitelisted crawler to stay out of suspects, got %d", len(suspects))
+	}
+
+	throttles := analyzer.ThrottledCrawlers()
+	if len(throttles) != 1 {
+		t.Fatalf("expected 1 throttled crawler, got %d", len(throttles))
+	}
+	if throttles[0].Agent != "Googlebot" {
+		t.Fatalf("unexpected agent: %s", throttles[0].Agent)
+	}
+	if throttles[0].CrawlDelay != 2 || throttles[0].RateLimit != "30r/m" {
+		t.Fatalf("unexpected suggestions: delay=%d rate=%s", throttles[0].CrawlDelay, throttles[0].RateLimit)
+	}
+}
+
+func TestAnalyzerWhitelistNeedsMinShare(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.MaxAverageRPM = 30
+	cfg.ScoreThreshold = 1
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 120; i++ {
+		agent := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+		if i%4 == 0 {
+			agent = "python-requests/2.31"
+		}
+		analyzer.Process(Entry{
+			ClientIP:   "203.0.113.5",
+			RemoteAddr: "203.0.113.5",
+			Time:       now.Add(time.Duration(i) * 500 * time.Millisecond),
+			URI:        "/catalog",
+			Status:     404,
+			UserAgent:  agent,
+		})
+	}
+
+	suspects := analyzer.Suspicious()
+	if len(suspects) != 1 || suspects[0].IP != "203.0.113.5" {
+		t.Fatalf("expected IP below the whitelist share to be flagged, got %+v", suspects)
+	}
+	if suspects[0].Stats.WhitelistedRequests != 90 {
+		t.Fatalf("unexpected whitelisted requests: %d", suspects[0].Stats.WhitelistedRequests)
+	}
+
+	cfg.WhitelistMinShare = 0.75
+	analyzer = New(cfg, nil)
+	for i := 0; i < 120; i++ {
+		agent := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+		if i%4 == 0 {
+			agent = "python-requests/2.31"
+		}
+		analyzer.Process(Entry{
+			ClientIP:   "203.0.113.5",
+			RemoteAddr: "203.0.113.5",
+			Time:       now.Add(time.Duration(i) * 500 * time.Millisecond),
+			URI:        "/catalog",
+			Status:     404,
+			UserAgent:  agent,
+		})
+	}
+	if suspects := analyzer.Suspicious(); len(suspects) != 0 {
+		t.Fatalf("expected IP meeting the whitelist share to be exempt, got %+v", suspects)
+	}
+}
+
+func TestAnalyzerHostileSignalsOverrideWhitelist(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 5
+	cfg.MinSQLInjections = 1
+	cfg.MinUniquePaths = 1000
+	cfg.ScoreThreshold = 1
+
+	uris := map[string]string{
+		"203.0.113.6": "/item?id=1%20UNION%20SELECT%20password%20FROM%20users",
+		"203.0.113.7": "/download?file=..%2f..%2fetc%2fpasswd",
+	}
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for ip, uri := range uris {
+		for i := 0; i < 10; i++ {
+			analyzer.Process(Entry{
+				ClientIP:   ip,
+				RemoteAddr: ip,
+				Time:       now.Add(time.Duration(i) * time.Second),
+				URI:        uri,
+				Status:     404,
+				UserAgent:  "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			})
+		}
+	}
+
+	for ip := range uris {
+		stat := analyzer.stats[ip]
+		if stat == nil || analyzer.whitelistedAgent(stat) {
+			t.Fatalf("expected hostile requests from %s to lift the whitelist, got %+v", ip, stat)
+		}
+	}
+	if stat := analyzer.stats["203.0.113.7"]; stat.Traversals != 10 {
+		t.Fatalf("unexpected traversals: %d", stat.Traversals)
+	}
+	if suspects := analyzer.Suspicious(); len(suspects) != 2 {
+		t.Fatalf("expected both hostile IPs to be flagged, got %+v", suspects)
+	}
+}
+
+func TestIsPathTraversal(t *testing.T) {
+	cases := map[string]bool{
+		"/static/../../etc/passwd":     true,
+		"/download?file=../etc/passwd": true,
+		"/a/..":                        true,
+		"/docs/v1..v2":                 false,
+		"/catalog?page=2":              false,
+	}
+	for uri, want := range cases {
+		if got := isPathTraversal(normalizeURI(uri)); got != want {
+			t.Fatalf("isPathTraversal(%q) = %v, want %v", uri, got, want)
+		}
+	}
+}
+
+func TestAnalyzerAppliesClassThresholds(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 50
+	cfg.Min404Errors = 1000
+	cfg.MinErrorRatio = 0.5
+	cfg.ScoreThreshold = 1
+	cfg.ClassLimits = map[UAClass]ClassLimit{
+		UAClassBot: {MinRequests: 5},
+	}
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		analyzer.Process(Entry{ClientIP: "9.9.9.1", RemoteAddr: "9.9.9.1", Time: now, URI: "/missing", Status: 404, UserAgent: "python-requests/2.31.0"})
+		analyzer.Process(Entry{ClientIP: "9.9.9.2", RemoteAddr: "9.9.9.2", Time: now, URI: "/missing", Status: 404, UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/121.0"})
+	}
+
+	suspects := analyzer.Suspicious()
+	if len(suspects) != 1 || suspects[0].IP != "9.9.9.1" {
+		t.Fatalf("expected only the declared bot to be flagged, got %+v", suspects)
+	}
+
+	totals := analyzer.ClassTotals()
+	if totals[UAClassBot] != 10 || totals[UAClassBrowser] != 10 {
+		t.Fatalf("unexpected class totals: %v", totals)
+	}
+}
+
+func TestAnalyzerHoneytokenBlocksInstantly(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Honeytokens = []string{"trap=7f3a9c"}
+
+	analyzer := New(cfg, nil)
+	analyzer.Process(Entry{
+		ClientIP:   "10.1.1.1",
+		RemoteAddr: "10.1.1.1",
+		Time:       time.Now(),
+		URI:        "/products?trap=7f3a9c",
+		Status:     200,
+	})
+
+	suspects := analyzer.Suspicious()
+	if len(suspects) != 1 {
+		t.Fatalf("expected honeytoken hit to be flagged, got %d suspects", len(suspects))
+	}
+	if !strings.Contains(strings.Join(suspects[0].Reasons, ";"), "honeytoken") {
+		t.Fatalf("expected honeytoken reason, got %v", suspects[0].Reasons)
+	}
+}
+
+func TestAnalyzerMinBytesServedSkipsTinyResponses(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.Min404Errors = 1
+	cfg.MinErrorRatio = 0.5
+	cfg.MinBytesServed = 1024
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		analyzer.Process(Entry{ClientIP: "10.2.2.2", RemoteAddr: "10.2.2.2", Time: now, URI: "/old", Status: 404, Bytes: 150})
+		analyzer.Process(Entry{ClientIP: "10.3.3.3", RemoteAddr: "10.3.3.3", Time: now, URI: "/old", Status: 404, Bytes: 4096})
+	}
+
+	suspects := analyzer.Suspicious()
+	if len(suspects) != 1 || suspects[0].IP != "10.3.3.3" {
+		t.Fatalf("expected only the IP served large responses to be blocked, got %+v", suspects)
+	}
+}
+
+func TestAnalyzerWeightsUpstreamTime(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.ScoreThreshold = 2
+	cfg.MaxUpstreamSeconds = 60
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 200; i++ {
+		analyzer.Process(Entry{ClientIP: "10.4.4.4", Time: now.Add(time.Duration(i) * 10 * time.Second), URI: "/search", Status: 200, Bytes: 2048, RequestTime: 2})
+	}
+	for i := 0; i < 2000; i++ {
+		analyzer.Process(Entry{ClientIP: "10.5.5.5", Time: now.Add(time.Duration(i) * time.Second), URI: "/static/app.js", Status: 200, Bytes: 2048, RequestTime: 0.001})
+	}
+
+	heavy, _, _ := analyzer.Explain("10.4.4.4")
+	cached, _, _ := analyzer.Explain("10.5.5.5")
+	if heavy.Score <= cached.Score {
+		t.Fatalf("expected slow queries to outscore cached hits, got %d vs %d", heavy.Score, cached.Score)
+	}
+	if heavy.Score != 3 {
+		t.Fatalf("expected upstream weight capped at 3, got %d (%v)", heavy.Score, heavy.Reasons)
+	}
+}
+
+func TestCacheBustingDetection(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"/static/app.js?v=83749823", true},
+		{"/static/app.js?_=1700000000000", true},
+		{"/img/logo.png?9f86d081884c", true},
+		{"/static/app.css?ver=5.8.1", false},
+		{"/static/app.js", false},
+		{"/search?q=12345678", false},
+	}
+	for _, tt := range tests {
+		if got := isCacheBusting(tt.uri); got != tt.want {
+			t.Errorf("isCacheBusting(%q) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzerFlagsCacheBusters(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.ScoreThreshold = 1
+	cfg.MinCacheBusters = 20
+
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		analyzer.Process(Entry{ClientIP: "10.6.6.6", Time: now.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/static/app.js?v=%d", 10000000+i), Status: 200, Bytes: 50000})
+		analyzer.Process(Entry{ClientIP: "10.7.7.7", Time: now.Add(time.Duration(i) * time.Second), URI: "/static/app.js?v=10000000", Status: 200, Bytes: 50000})
+	}
+
+	suspect, _, _ := analyzer.Explain("10.6.6.6")
+	if suspect.Stats.CacheBusters != 30 || !strings.Contains(strings.Join(suspect.Reasons, ";"), "cache-busting") {
+		t.Fatalf("expected cache-busting reason, got %d busters and %v", suspect.Stats.CacheBusters, suspect.Reasons)
+	}
+	steady, _, _ := analyzer.Explain("10.7.7.7")
+	if steady.Stats.CacheBusters != 1 {
+		t.Fatalf("expected repeated query to count once, got %d", steady.Stats.CacheBusters)
+	}
+}
+
+func TestAnalyzerFlagsRequestsWithoutSessionCookie(t *testing.T) {
+	format, err := parseLogFormat(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$cookie_sessionid"`)
+	if err != nil {
+		t.Fatalf("parseLogFormat: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.ScoreThreshold = 1
+	cfg.MinCookielessPages = 20
+
+	analyzer := New(cfg, nil)
+	for i := 0; i < 30; i++ {
+		for ip, cookie := range map[string]string{"10.8.8.8": "-", "10.9.9.9": "a1b2c3"} {
+			for _, uri := range []string{fmt.Sprintf("/product/%d", i), "/static/app.css"} {
+				entry, err := format.Parse(fmt.Sprintf(`%s - - [19/Oct/2025:12:%02d:00 +0000] "GET %s HTTP/1.1" 200 5120 "-" "Mozilla/5.0" "%s"`, ip, i, uri, cookie))
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				analyzer.Process(entry)
+			}
+		}
+	}
+
+	headless, _, _ := analyzer.Explain("10.8.8.8")
+	if headless.Stats.LoggedPages != 30 || !containsStringCI(RuleNoSession, headless.Rules) {
+		t.Fatalf("expected 30 cookieless pages to be flagged, got %d pages and %v", headless.Stats.LoggedPages, headless.Reasons)
+	}
+	browser, _, _ := analyzer.Explain("10.9.9.9")
+	if browser.Stats.SessionPages != 30 || containsStringCI(RuleNoSession, browser.Rules) {
+		t.Fatalf("expected the session holder not to be flagged, got %v", browser.Reasons)
+	}
+
+	// Without cookies in the log format nothing is counted.
+	plain := New(cfg, nil)
+	for i := 0; i < 30; i++ {
+		plain.Process(Entry{ClientIP: "10.8.8.8", Time: time.Now(), URI: "/", Status: 200})
+	}
+	if suspect, _, _ := plain.Explain("10.8.8.8"); suspect.Stats.LoggedPages != 0 || containsStringCI(RuleNoSession, suspect.Rules) {
+		t.Fatalf("expected no session rule without cookie logging, got %v", suspect.Reasons)
+	}
+}
+
+func TestSuspicionRecordsRuleCodes(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.Honeytokens = []string{"/.env.bak"}
+	cfg.PeerReports = map[string]string{"192.0.2.60": "edge-2"}
+
+	analyzer := New(cfg, nil)
+	analyzer.Process(Entry{ClientIP: "192.0.2.60", Time: time.Now(), URI: "/.env.bak", Status: 404})
+
+	suspect, _, _ := analyzer.Explain("192.0.2.60")
+	got := strings.Join(suspect.Rules, ",")
+	if !strings.Contains(got, RuleHoneytoken) || !strings.Contains(got, RulePeer) || strings.Contains(got, RuleSensitivePath) {
+		t.Fatalf("unexpected rule codes: %s", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Annotations labels known IPs and networks, such as "office VPN" or
+// "partner X importer", so reports say who a suspect is.
+type Annotations struct {
+	ips      map[string]string
+	networks []annotatedNetwork
+}
+
+type annotatedNetwork struct {
+	network *net.IPNet
+	label   string
+}
+
+// loadAnnotations reads an annotations file: one IP or CIDR per line followed
+// by its label, with blank lines and # comments ignored.
+func loadAnnotations(path string) (*Annotations, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	annotations := &Annotations{ips: make(map[string]string)}
+	scanner := bufio.NewScanner(fh)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		address, label := fields[0], strings.Join(fields[1:], " ")
+		if label == "" {
+			return nil, fmt.Errorf("%s:%d: %s has no label", path, lineNo, address)
+		}
+		if strings.Contains(address, "/") {
+			_, network, err := net.ParseCIDR(address)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+			annotations.networks = append(annotations.networks, annotatedNetwork{network: network, label: label})
+			continue
+		}
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, fmt.Errorf("%s:%d: invalid IP %q", path, lineNo, address)
+		}
+		annotations.ips[ip.String()] = label
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return annotations, nil
+}
+
+// Label returns the label of ip: its own entry, else that of the most
+// specific network containing it, else "".
+func (a *Annotations) Label(ip string) string {
+	if a == nil {
+		return ""
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if label, ok := a.ips[parsed.String()]; ok {
+		return label
+	}
+	label, best := "", -1
+	for _, entry := range a.networks {
+		if !entry.network.Contains(parsed) {
+			continue
+		}
+		if ones, _ := entry.network.Mask.Size(); ones > best {
+			label, best = entry.label, ones
+		}
+	}
+	return label
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadAnnotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.txt")
+	data := `# known clients
+203.0.113.0/24   office VPN
+203.0.113.128/25 office VPN, guest Wi-Fi
+198.51.100.7     partner X importer
+2001:db8::/32    staging
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write annotations: %v", err)
+	}
+	annotations, err := loadAnnotations(path)
+	if err != nil {
+		t.Fatalf("loadAnnotations: %v", err)
+	}
+	cases := map[string]string{
+		"203.0.113.9":   "office VPN",
+		"203.0.113.200": "office VPN, guest Wi-Fi",
+		"198.51.100.7":  "partner X importer",
+		"2001:db8::1":   "staging",
+		"192.0.2.1":     "",
+		"not an ip":     "",
+	}
+	for ip, want := range cases {
+		if got := annotations.Label(ip); got != want {
+			t.Errorf("Label(%q) = %q, want %q", ip, got, want)
+		}
+	}
+	if got := (*Annotations)(nil).Label("198.51.100.7"); got != "" {
+		t.Errorf("expected no label without annotations, got %q", got)
+	}
+
+	for _, bad := range []string{"198.51.100.7\n", "198.51.100.300 typo\n", "10.0.0.0/33 too wide\n"} {
+		if err := os.WriteFile(path, []byte(bad), 0o644); err != nil {
+			t.Fatalf("write annotations: %v", err)
+		}
+		if _, err := loadAnnotations(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+			t.Errorf("expected an error naming line 1 for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestAnalyzerAnnotatesSuspects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24 partner X importer\n"), 0o644); err != nil {
+		t.Fatalf("write annotations: %v", err)
+	}
+	annotations, err := loadAnnotations(path)
+	if err != nil {
+		t.Fatalf("loadAnnotations: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.Annotations = annotations
+	a := New(cfg, nil)
+	now := time.Now()
+	for _, ip := range []string{"192.0.2.10", "198.51.100.4"} {
+		for i := 0; i < 40; i++ {
+			a.Process(Entry{Time: now, ClientIP: ip, RemoteAddr: ip, Status: 404, URI: "/wp-login.php"})
+		}
+	}
+
+	labels := make(map[string]string)
+	for _, suspect := range a.Suspicious() {
+		labels[suspect.IP] = suspect.Stats.Annotation
+	}
+	if labels["192.0.2.10"] != "partner X importer" || labels["198.51.100.4"] != "" {
+		t.Fatalf("unexpected annotations %v", labels)
+	}
+
+	blockLog := filepath.Join(t.TempDir(), "blocked.log")
+	if err := appendBlockLog(blockLog, newRunInfo(), a.Suspicious()); err != nil {
+		t.Fatalf("appendBlockLog: %v", err)
+	}
+	data, _ := os.ReadFile(blockLog)
+	if !strings.Contains(string(data), ` note="partner X importer" reasons=`) {
+		t.Fatalf("expected the annotation in the block log, got:\n%s", data)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiBlockedPath = "/v1/blocked"
+	apiBanPath     = "/v1/ban"
+	apiUnbanPath   = "/v1/unban"
+	// apiMaxBody bounds ban and unban request bodies.
+	apiMaxBody = 4096
+)
+
+// API token scopes: read lists the blocked IPs, ban also bans and unbans them.
+const (
+	apiScopeRead = "read"
+	apiScopeBan  = "ban"
+)
+
+// APIConfig enables the HTTP API of follow mode.
+type APIConfig struct {
+	// Listen is the address the API serves plain HTTP on; empty disables it.
+	Listen string `yaml:"listen"`
+	// AuditLog receives one line per API request, naming the token used.
+	AuditLog string     `yaml:"audit_log"`
+	Tokens   []APIToken `yaml:"tokens"`
+}
+
+// APIToken is a bearer token of the API, named in the audit log.
+type APIToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Scope string `yaml:"scope"`
+}
+
+func (c APIConfig) validate() error {
+	names := make(map[string]bool, len(c.Tokens))
+	secrets := make(map[string]bool, len(c.Tokens))
+	for i, token := range c.Tokens {
+		switch {
+		case strings.TrimSpace(token.Name) == "":
+			return fmt.Errorf("api: tokens entry %d: name is required", i+1)
+		case names[token.Name]:
+			return fmt.Errorf("api: tokens: duplicate name %s", token.Name)
+		case strings.TrimSpace(token.Token) == "":
+			return fmt.Errorf("api: tokens %s: token is required", token.Name)
+		case secrets[token.Token]:
+			return fmt.Errorf("api: tokens %s: token is shared with another entry", token.Name)
+		case token.Scope != apiScopeRead && token.Scope != apiScopeBan:
+			return fmt.Errorf("api: tokens %s: unknown scope %q (want %s or %s)", token.Name, token.Scope, apiScopeRead, apiScopeBan)
+		}
+		names[token.Name] = true
+		secrets[token.Token] = true
+	}
+	if c.Listen != "" && len(c.Tokens) == 0 {
+		return fmt.Errorf("api: listen requires at least one entry in tokens")
+	}
+	return nil
+}
+
+// apiAction is a ban or unban queued by the API for the next tick.
+type apiAction struct {
+	Ban    bool
+	IP     string
+	TTL    time.Duration
+	Reason string
+	// Token names the API token that asked for it.
+	Token string
+}
+
+// apiBlock is a blocked IP as listed by the API.
+type apiBlock struct {
+	IP       string    `json:"ip"`
+	Vhost    string    `json:"vhost,omitempty"`
+	Score    int       `json:"score"`
+	Severity Severity  `json:"severity"`
+	Reasons  []string  `json:"reasons"`
+	Since    time.Time `json:"since"`
+	Expires  time.Time `json:"expires"`
+	Staged   bool      `json:"staged,omitempty"`
+}
+
+// followAPI serves the HTTP API of follow mode. The follower owns the
+// blocked set and runs on its own goroutine, so bans and unbans are queued
+// until its next tick and reads see the set as of the last tick.
+type followAPI struct {
+	tokens   []APIToken
+	auditLog string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending []apiAction
+	blocked []apiBlock
+	updated time.Time
+}
+
+func newFollowAPI(cfg APIConfig) *followAPI {
+	return &followAPI{tokens: cfg.Tokens, auditLog: cfg.AuditLog, now: time.Now, blocked: []apiBlock{}}
+}
+
+// takePending returns and clears the queued actions. A nil API has none.
+func (a *followAPI) takePending() []apiAction {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pending := a.pending
+	a.pending = nil
+	return pending
+}
+
+// publish records the blocked set of a tick for reads.
+func (a *followAPI) publish(blocked map[string]blockedSuspect, now time.Time) {
+	if a == nil {
+		return
+	}
+	list := make([]apiBlock, 0, len(blocked))
+	for _, block := range blocked {
+		item := apiBlock{
+			IP:       block.IP,
+			Score:    block.Score,
+			Severity: block.Severity,
+			Reasons:  block.Reasons,
+			Since:    block.Since,
+			Expires:  block.Expires,
+			Staged:   block.Staged,
+		}
+		if block.Stats != nil {
+			item.Vhost = block.Stats.Vhost
+		}
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].IP != list[j].IP {
+			return list[i].IP < list[j].IP
+		}
+		return list[i].Vhost < list[j].Vhost
+	})
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.blocked, a.updated = list, now
+}
+
+// authenticate returns the token sent as "Authorization: Bearer <token>".
+// Every token is compared so the time taken does not reveal which matched.
+func (a *followAPI) authenticate(r *http.Request) (APIToken, bool) {
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	var found APIToken
+	matched := false
+	for _, token := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(token.Token)) == 1 {
+			found, matched = token, true
+		}
+	}
+	return found, ok && matched
+}
+
+// apiResponse captures the status written by a handler for the audit log.
+type apiResponse struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *apiResponse) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (a *followAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := &apiResponse{ResponseWriter: w, status: http.StatusOK}
+	token, ok := a.authenticate(r)
+	name, detail := "-", ""
+	if ok {
+		name = token.Name
+		detail = a.route(resp, r, token)
+	} else {
+		http.Error(resp, "missing or unknown API token", http.StatusUnauthorized)
+	}
+	if err := a.audit(name, r, resp.status, detail); err != nil {
+		log.Printf("write API audit log: %v", err)
+	}
+}
+
+// route serves an authenticated request and returns what the audit log
+// records about it besides the request line and status.
+func (a *followAPI) route(w http.ResponseWriter, r *http.Request, token APIToken) string {
+	switch r.URL.Path {
+	case apiBlockedPath:
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return ""
+		}
+		a.mu.Lock()
+		body := struct {
+			Updated time.Time  `json:"updated"`
+			Blocked []apiBlock `json:"blocked"`
+		}{a.updated, a.blocked}
+		a.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+		return ""
+	case apiBanPath, apiUnbanPath:
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return ""
+		}
+		if token.Scope != apiScopeBan {
+			http.Error(w, "token scope does not allow bans", http.StatusForbidden)
+			return ""
+		}
+		action, err := parseAPIAction(http.MaxBytesReader(w, r.Body, apiMaxBody), r.URL.Path == apiBanPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return ""
+		}
+		action.Token = token.Name
+		a.mu.Lock()
+		a.pending = append(a.pending, action)
+		a.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		detail := action.IP
+		if action.Reason != "" {
+			detail += " " + action.Reason
+		}
+		return detail
+	default:
+		http.NotFound(w, r)
+		return ""
+	}
+}
+
+// parseAPIAction reads a JSON ban or unban request: {"ip": "192.0.2.1"},
+// with "ttl" (a duration, the deny expiry by default) and "reason" for bans.
+func parseAPIAction(body io.Reader, ban bool) (apiAction, error) {
+	var req struct {
+		IP     string `json:"ip"`
+		TTL    string `json:"ttl"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return apiAction{}, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	parsed := net.ParseIP(strings.TrimSpace(req.IP))
+	if parsed == nil {
+		return apiAction{}, fmt.Errorf("invalid ip %q", req.IP)
+	}
+	action := apiAction{Ban: ban, IP: parsed.String()}
+	if !ban {
+		return action, nil
+	}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			return apiAction{}, fmt.Errorf("invalid ttl %q", req.TTL)
+		}
+		action.TTL = ttl
+	}
+	action.Reason = stripControl(strings.TrimSpace(req.Reason))
+	return action, nil
+}
+
+// audit appends a tab-separated line for a request: time, token name,
+// method and path, status, and the IP and reason of bans and unbans.
+func (a *followAPI) audit(token string, r *http.Request, status int, detail string) error {
+	if a.auditLog == "" {
+		return nil
+	}
+	line := fmt.Sprintf("%s\t%s\t%s %s\t%d\t%s\n", a.now().UTC().Format(time.RFC3339), token, r.Method, escapeControl(r.URL.Path), status, detail)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fh, err := os.OpenFile(a.auditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	_, err = fh.WriteString(line)
+	return err
+}
+
+// serveFollowAPI listens on cfg.Listen and serves api until ctx is done. The
+// listener is opened before it returns so address errors stop the run.
+func serveFollowAPI(ctx context.Context, cfg APIConfig, api *followAPI) error {
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("api listen: %w", err)
+	}
+	if !loopbackListen(cfg.Listen) {
+		log.Printf("warning: the API sends bearer tokens over plain HTTP on %s; put a TLS proxy in front of it", cfg.Listen)
+	}
+	server := &http.Server{Handler: api, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("api: %v", err)
+		}
+	}()
+	log.Printf("serving the API on %s (%d tokens)", cfg.Listen, len(cfg.Tokens))
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIConfigValidate(t *testing.T) {
+	valid := APIConfig{Listen: "127.0.0.1:8090", Tokens: []APIToken{
+		{Name: "grafana", Token: "read-secret", Scope: apiScopeRead},
+		{Name: "soar", Token: "ban-secret", Scope: apiScopeBan},
+	}}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	for want, cfg := range map[string]APIConfig{
+		"at least one entry": {Listen: "127.0.0.1:8090"},
+		"unknown scope":      {Tokens: []APIToken{{Name: "a", Token: "x", Scope: "admin"}}},
+		"duplicate name":     {Tokens: []APIToken{{Name: "a", Token: "x", Scope: "read"}, {Name: "a", Token: "y", Scope: "read"}}},
+		"shared with":        {Tokens: []APIToken{{Name: "a", Token: "x", Scope: "read"}, {Name: "b", Token: "x", Scope: "ban"}}},
+		"token is required":  {Tokens: []APIToken{{Name: "a", Scope: "read"}}},
+	} {
+		if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q error, got %v", want, err)
+		}
+	}
+}
+
+func TestFollowAPIScopesAndAudit(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	api := newFollowAPI(APIConfig{AuditLog: auditPath, Tokens: []APIToken{
+		{Name: "grafana", Token: "read-secret", Scope: apiScopeRead},
+		{Name: "soar", Token: "ban-secret", Scope: apiScopeBan},
+	}})
+	api.now = func() time.Time { return time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC) }
+
+	call := func(method, path, token, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := call(http.MethodGet, apiBlockedPath, "", ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", code)
+	}
+	if code := call(http.MethodGet, apiBlockedPath, "read-secret", ""); code != http.StatusOK {
+		t.Fatalf("expected a read token to list blocks, got %d", code)
+	}
+	if code := call(http.MethodPost, apiBanPath, "read-secret", `{"ip":"192.0.2.1"}`); code != http.StatusForbidden {
+		t.Fatalf("expected a read token to be refused bans, got %d", code)
+	}
+	if code := call(http.MethodPost, apiBanPath, "ban-secret", `{"ip":"not-an-ip"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid IP to be rejected, got %d", code)
+	}
+	if code := call(http.MethodPost, apiBanPath, "ban-secret", `{"ip":"192.0.2.1","ttl":"2h","reason":"card testing\nfake"}`); code != http.StatusAccepted {
+		t.Fatalf("expected a ban token to queue a ban, got %d", code)
+	}
+	pending := api.takePending()
+	if len(pending) != 1 || !pending[0].Ban || pending[0].IP != "192.0.2.1" || pending[0].TTL != 2*time.Hour || pending[0].Token != "soar" {
+		t.Fatalf("unexpected queued actions: %+v", pending)
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	want := "2025-10-19T12:00:00Z\t-\tGET /v1/blocked\t401\t\n" +
+		"2025-10-19T12:00:00Z\tgrafana\tGET /v1/blocked\t200\t\n" +
+		"2025-10-19T12:00:00Z\tgrafana\tPOST /v1/ban\t403\t\n" +
+		"2025-10-19T12:00:00Z\tsoar\tPOST /v1/ban\t400\t\n" +
+		"2025-10-19T12:00:00Z\tsoar\tPOST /v1/ban\t202\t192.0.2.1 card testing fake\n"
+	if string(data) != want {
+		t.Fatalf("unexpected audit log:\n%s", data)
+	}
+}
+
+func TestFollowerAppliesAPIBansAndUnbans(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	api := newFollowAPI(APIConfig{Tokens: []APIToken{{Name: "soar", Token: "ban-secret", Scope: apiScopeBan}}})
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:     5 * time.Minute,
+		Interval:   time.Minute,
+		DenyOutput: denyPath,
+		Deny:       DenyOptions{TTL: time.Hour, Minimal: true},
+		API:        api,
+	})
+	queue := func(path, body string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer ban-secret")
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("%s: expected 202, got %d", path, rec.Code)
+		}
+	}
+
+	queue(apiBanPath, `{"ip":"198.51.100.7","reason":"fraud"}`)
+	for _, entry := range scannerEntries("192.0.2.1", start, 40) {
+		follower.Add(entry, start)
+	}
+	if _, err := follower.Tick(start.Add(time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	data, _ := os.ReadFile(denyPath)
+	if string(data) != "deny 192.0.2.1;\ndeny 198.51.100.7;\n" {
+		t.Fatalf("expected the scanner and the API ban, got %q", data)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, apiBlockedPath, nil)
+	req.Header.Set("Authorization", "Bearer ban-secret")
+	api.ServeHTTP(rec, req)
+	var listed struct {
+		Blocked []apiBlock `json:"blocked"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(listed.Blocked) != 2 || listed.Blocked[1].IP != "198.51.100.7" || listed.Blocked[1].Reasons[0] != "banned through the API by soar: fraud" {
+		t.Fatalf("unexpected blocked list: %+v", listed.Blocked)
+	}
+
+	// An unbanned scanner is not blocked again by the requests still in the window.
+	queue(apiUnbanPath, `{"ip":"192.0.2.1"}`)
+	if _, err := follower.Tick(start.Add(2 * time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	data, _ = os.ReadFile(denyPath)
+	if string(data) != "deny 198.51.100.7;\n" {
+		t.Fatalf("expected the unban to remove the scanner, got %q", data)
+	}
+}
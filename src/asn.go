@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	geoip2 "github.com/oschwald/geoip2-golang"
+)
+
+// newASNLookup opens a MaxMind-compatible ASN database (such as GeoLite2-ASN)
+// and returns a lookup that fills the ASN fields of GeoInfo.
+func newASNLookup(path string, problems *Problems) (GeoLookup, func() error, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var invalid geoip2.InvalidMethodError
+	if _, err := reader.ASN(net.IPv4(192, 0, 2, 1)); errors.As(err, &invalid) {
+		reader.Close()
+		return nil, nil, fmt.Errorf("%s is a %s database, not an ASN database", path, reader.Metadata().DatabaseType)
+	}
+
+	lookup := func(ip string) (GeoInfo, bool) {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: invalid IP", ip))
+			return GeoInfo{}, false
+		}
+		record, err := reader.ASN(parsed)
+		if err != nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: %v", ip, err))
+			return GeoInfo{}, false
+		}
+		if record == nil || record.AutonomousSystemNumber == 0 {
+			return GeoInfo{}, false
+		}
+		return GeoInfo{ASN: record.AutonomousSystemNumber, ASOrg: record.AutonomousSystemOrganization}, true
+	}
+	return lookup, reader.Close, nil
+}
+
+// mergeGeoLookups queries every non-nil lookup and combines the fields they
+// fill, so a country database and an ASN database can be used together.
+func mergeGeoLookups(lookups ...GeoLookup) GeoLookup {
+	active := make([]GeoLookup, 0, len(lookups))
+	for _, lookup := range lookups {
+		if lookup != nil {
+			active = append(active, lookup)
+		}
+	}
+	switch len(active) {
+	case 0:
+		return nil
+	case 1:
+		return active[0]
+	}
+	return func(ip string) (GeoInfo, bool) {
+		var merged GeoInfo
+		found := false
+		for _, lookup := range active {
+			info, ok := lookup(ip)
+			if !ok {
+				continue
+			}
+			found = true
+			if info.CountryISO != "" || info.CountryName != "" {
+				merged.CountryISO, merged.CountryName = info.CountryISO, info.CountryName
+			}
+			if info.ASN != 0 {
+				merged.ASN, merged.ASOrg = info.ASN, info.ASOrg
+			}
+		}
+		return merged, found
+	}
+}
+
+// ASNGroup aggregates the suspects announced by one autonomous system.
+type ASNGroup struct {
+	ASN      uint
+	Org      string
+	IPs      []string
+	Requests int
+	Score    int
+	Severity Severity
+	// Prefixes are the ASN's announced ranges from the prefix list, if any.
+	Prefixes []string
+}
+
+// groupSuspectsByASN returns the ASNs with at least minIPs suspects, most IPs first.
+func groupSuspectsByASN(suspects []Suspicion, minIPs int, prefixes map[uint][]string) []ASNGroup {
+	byASN := make(map[uint]*ASNGroup)
+	for _, suspect := range suspects {
+		if suspect.Stats == nil || suspect.Stats.ASN == 0 {
+			continue
+		}
+		group, ok := byASN[suspect.Stats.ASN]
+		if !ok {
+			group = &ASNGroup{ASN: suspect.Stats.ASN, Org: suspect.Stats.ASOrg, Prefixes: prefixes[suspect.Stats.ASN]}
+			byASN[suspect.Stats.ASN] = group
+		}
+		group.IPs = append(group.IPs, suspect.IP)
+		group.Requests += suspect.Stats.Requests
+		group.Score = max(group.Score, suspect.Score)
+		group.Severity = max(group.Severity, suspect.Severity)
+	}
+
+	groups := make([]ASNGroup, 0, len(byASN))
+	for _, group := range byASN {
+		if len(group.IPs) >= max(1, minIPs) {
+			sort.Strings(group.IPs)
+			groups = append(groups, *group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].IPs) != len(groups[j].IPs) {
+			return len(groups[i].IPs) > len(groups[j].IPs)
+		}
+		return groups[i].ASN < groups[j].ASN
+	})
+	return groups
+}
+
+// asnDenyEntries turns the prefixes of reported ASNs into deny entries that
+// carry the group's highest score and severity.
+func asnDenyEntries(groups []ASNGroup) []Suspicion {
+	entries := make([]Suspicion, 0)
+	for _, group := range groups {
+		reason := fmt.Sprintf("AS%d %s: %d offending IPs", group.ASN, group.Org, len(group.IPs))
+		for _, prefix := range group.Prefixes {
+			entries = append(entries, Suspicion{
+				IP:       prefix,
+				Score:    group.Score,
+				Severity: group.Severity,
+				Reasons:  []string{reason},
+				Stats:    &IPStats{IP: prefix, Requests: group.Requests, ASN: group.ASN, ASOrg: group.Org},
+			})
+		}
+	}
+	return entries
+}
+
+// loadASNPrefixes reads a prefix list with one "ASN CIDR" pair per line, in
+// either order, e.g. "AS64500 203.0.113.0/24". Blank lines and # comments are ignored.
+func loadASNPrefixes(path string) (map[uint][]string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	prefixes := make(map[uint][]string)
+	scanner := bufio.NewScanner(fh)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"ASN CIDR\", got %q", path, lineNo, line)
+		}
+		asnField, cidr := fields[0], fields[1]
+		if strings.Contains(asnField, "/") {
+			asnField, cidr = cidr, asnField
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asnField), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid ASN %q", path, lineNo, asnField)
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		prefixes[uint(asn)] = append(prefixes[uint(asn)], network.String())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadASNPrefixes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prefixes.txt")
+	content := "# announced prefixes\nAS64500 203.0.113.0/24\n198.51.100.0/25 64500 # reversed\n\nas64501 2001:db8::/32\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	prefixes, err := loadASNPrefixes(path)
+	if err != nil {
+		t.Fatalf("loadASNPrefixes: %v", err)
+	}
+	want := map[uint][]string{64500: {"203.0.113.0/24", "198.51.100.0/25"}, 64501: {"2001:db8::/32"}}
+	if !reflect.DeepEqual(prefixes, want) {
+		t.Fatalf("expected %v, got %v", want, prefixes)
+	}
+
+	if err := os.WriteFile(path, []byte("AS64500 not-a-cidr\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := loadASNPrefixes(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Fatalf("expected error with line number, got %v", err)
+	}
+}
+
+func TestASNGroupsAndDenyEntries(t *testing.T) {
+	suspect := func(ip string, asn uint, severity Severity) Suspicion {
+		return Suspicion{IP: ip, Score: int(severity) + 2, Severity: severity, Stats: &IPStats{IP: ip, Requests: 10, ASN: asn, ASOrg: "Example Hosting"}}
+	}
+	suspects := []Suspicion{
+		suspect("203.0.113.1", 64500, SeverityLow),
+		suspect("203.0.113.2", 64500, SeverityHigh),
+		suspect("203.0.113.3", 64500, SeverityLow),
+		suspect("192.0.2.1", 64501, SeverityCritical),
+		{IP: "192.0.2.99", Stats: &IPStats{}},
+	}
+	groups := groupSuspectsByASN(suspects, 2, map[uint][]string{64500: {"203.0.113.0/24"}})
+	if len(groups) != 1 || groups[0].ASN != 64500 || len(groups[0].IPs) != 3 || groups[0].Requests != 30 || groups[0].Severity != SeverityHigh {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+
+	entries := asnDenyEntries(groups)
+	if len(entries) != 1 || entries[0].IP != "203.0.113.0/24" || entries[0].Severity != SeverityHigh {
+		t.Fatalf("unexpected deny entries: %+v", entries)
+	}
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	if err := writeDenyFile(denyPath, entries, DenyOptions{Minimal: true}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ := os.ReadFile(denyPath)
+	if string(data) != "deny 203.0.113.0/24;\n" {
+		t.Fatalf("unexpected deny file %q", data)
+	}
+}
+
+func TestMergeGeoLookups(t *testing.T) {
+	country := func(ip string) (GeoInfo, bool) { return GeoInfo{CountryISO: "NL"}, true }
+	asn := func(ip string) (GeoInfo, bool) {
+		if ip == "192.0.2.1" {
+			return GeoInfo{ASN: 64500, ASOrg: "Example Hosting"}, true
+		}
+		return GeoInfo{}, false
+	}
+	lookup := mergeGeoLookups(nil, country, asn)
+	info, ok := lookup("192.0.2.1")
+	if !ok || info != (GeoInfo{CountryISO: "NL", ASN: 64500, ASOrg: "Example Hosting"}) {
+		t.Fatalf("unexpected merged info %+v", info)
+	}
+	if info, ok := lookup("192.0.2.2"); !ok || info.ASN != 0 || info.CountryISO != "NL" {
+		t.Fatalf("expected country-only info, got %+v", info)
+	}
+	if mergeGeoLookups(nil, nil) != nil {
+		t.Fatal("expected nil lookup when none are configured")
+	}
+}
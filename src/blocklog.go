@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readBlockLog reads the ban records of a block log written by
+// appendBlockLog: each run header gives the ban time and run ID of the IP
+// lines under it. Lines that do not parse are skipped, so logs from older
+// versions import what they can.
+func readBlockLog(path string) ([]BanRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bans []BanRecord
+	var runID string
+	var bannedAt time.Time
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			runID, bannedAt = parseBlockLogHeader(line)
+			continue
+		}
+		if bannedAt.IsZero() {
+			continue
+		}
+		if ban, ok := parseBlockLogEntry(strings.TrimSpace(line)); ok {
+			ban.RunID = runID
+			ban.BannedAt = bannedAt
+			bans = append(bans, ban)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return bans, nil
+}
+
+// parseBlockLogHeader parses "TIME run=ID window=... total=N", returning a
+// zero time for anything else.
+func parseBlockLogHeader(line string) (string, time.Time) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return "", time.Time{}
+	}
+	runID := ""
+	for _, field := range fields[1:] {
+		if value, ok := strings.CutPrefix(field, "run="); ok {
+			runID = value
+		}
+	}
+	return runID, t
+}
+
+// parseBlockLogEntry parses "IP score=N severity=S country=C ... reasons=R".
+func parseBlockLogEntry(line string) (BanRecord, bool) {
+	head, reasons, _ := strings.Cut(line, " reasons=")
+	fields := strings.Fields(head)
+	if len(fields) == 0 || net.ParseIP(fields[0]) == nil {
+		return BanRecord{}, false
+	}
+	ban := BanRecord{IP: fields[0]}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "score":
+			ban.Score, _ = strconv.Atoi(value)
+		case "severity":
+			ban.Severity, _ = parseSeverity(value)
+		}
+	}
+	for _, reason := range strings.Split(reasons, "; ") {
+		if reason != "" {
+			ban.Reasons = append(ban.Reasons, reason)
+		}
+	}
+	return ban, true
+}
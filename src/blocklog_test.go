@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendBlockLogStripsControlCharacters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.log")
+	stat := &IPStats{Hosts: map[string]int{"shop\r.example.com": 1}}
+	suspects := []Suspicion{{IP: "198.51.100.7", Score: 4, Severity: SeverityHigh, Reasons: []string{"60 query strings on /a\rwrite-host pwned"}, Stats: stat}}
+	if err := appendBlockLog(path, RunInfo{ID: "run-1"}, suspects); err != nil {
+		t.Fatalf("appendBlockLog: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "\r") {
+		t.Fatalf("expected no CR in the block log, got %q", data)
+	}
+}
+
+func TestReadBlockLogRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.log")
+	stat := &IPStats{IP: "198.51.100.7", CountryISO: "NL", Annotation: "seen in incident"}
+	suspects := []Suspicion{
+		{IP: "198.51.100.7", Score: 4, Severity: SeverityHigh, Reasons: []string{"avg rpm 120.0 > 90.0", "burst 300 req in 1m0s"}, Stats: stat},
+		{IP: "2001:db8::1", Score: 2, Severity: SeverityLow, Reasons: []string{"40 php 404s"}, Stats: &IPStats{}},
+	}
+	if err := appendBlockLog(path, RunInfo{ID: "run-1"}, suspects); err != nil {
+		t.Fatalf("appendBlockLog: %v", err)
+	}
+	if err := appendBlockLog(path, RunInfo{ID: "run-2"}, nil); err != nil {
+		t.Fatalf("appendBlockLog: %v", err)
+	}
+
+	bans, err := readBlockLog(path)
+	if err != nil {
+		t.Fatalf("readBlockLog: %v", err)
+	}
+	if len(bans) != 2 {
+		t.Fatalf("expected 2 bans, got %+v", bans)
+	}
+	ban := bans[0]
+	if ban.IP != "198.51.100.7" || ban.RunID != "run-1" || ban.Score != 4 || ban.Severity != SeverityHigh || ban.BannedAt.IsZero() {
+		t.Fatalf("unexpected ban %+v", ban)
+	}
+	if len(ban.Reasons) != 2 || ban.Reasons[1] != "burst 300 req in 1m0s" {
+		t.Fatalf("unexpected reasons %q", ban.Reasons)
+	}
+	if bans[1].IP != "2001:db8::1" || bans[1].Severity != SeverityLow {
+		t.Fatalf("unexpected ban %+v", bans[1])
+	}
+}
+
+func TestReadBlockLogSkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.log")
+	data := "garbage header\n" +
+		"  192.0.2.1 score=3 severity=medium country=- reasons=orphan\n" +
+		"2025-10-19T06:00:00Z run=abc window=- total=2\n" +
+		"  not-an-ip score=3 reasons=x\n" +
+		"  192.0.2.2 score=5 severity=critical country=CN reasons=42 SQL injection attempts\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bans, err := readBlockLog(path)
+	if err != nil {
+		t.Fatalf("readBlockLog: %v", err)
+	}
+	if len(bans) != 1 || bans[0].IP != "192.0.2.2" || bans[0].RunID != "abc" || bans[0].Score != 5 {
+		t.Fatalf("unexpected bans %+v", bans)
+	}
+	if want := time.Date(2025, 10, 19, 6, 0, 0, 0, time.UTC); !bans[0].BannedAt.Equal(want) {
+		t.Fatalf("unexpected ban time %s", bans[0].BannedAt)
+	}
+}
+
+func TestStateDBImportBans(t *testing.T) {
+	db := &StateDB{Bans: []BanRecord{{IP: "192.0.2.1", RunID: "current"}}}
+	older := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+	imported := db.ImportBans([]BanRecord{
+		{IP: "192.0.2.1", RunID: "old", BannedAt: older},
+		{IP: "192.0.2.2", RunID: "first", BannedAt: older},
+		{IP: "192.0.2.2", RunID: "second", BannedAt: newer},
+	})
+	if imported != 1 || len(db.Bans) != 2 {
+		t.Fatalf("expected one imported IP, got %d: %+v", imported, db.Bans)
+	}
+	if db.Bans[0].RunID != "current" || db.Bans[1].RunID != "second" {
+		t.Fatalf("unexpected bans %+v", db.Bans)
+	}
+	if first, ok := db.Canary["192.0.2.2"]; !ok || !first.Equal(newer) {
+		t.Fatalf("expected imported IP to count as flagged since its ban, got %v", db.Canary)
+	}
+	staged := db.StageCanary([]Suspicion{{IP: "192.0.2.2"}}, time.Hour, newer.Add(2*time.Hour))
+	if staged["192.0.2.2"] {
+		t.Fatalf("expected past offender to skip the canary period")
+	}
+}
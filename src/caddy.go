@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// caddyLogFormat reads Caddy's structured JSON access logs.
+var caddyLogFormat = &LogFormat{Name: "caddy", parse: parseCaddyLine}
+
+// caddyTimeLayouts cover the string values of Caddy's time_format encoder option.
+var caddyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000Z0700",
+	"2006/01/02 15:04:05.000000000",
+	"2006/01/02 15:04:05.000",
+	"2006/01/02 15:04:05",
+	timeLayout,
+}
+
+// caddyAccessLog is the subset of a Caddy access log entry botdeny uses.
+type caddyAccessLog struct {
+	TS      json.RawMessage `json:"ts"`
+	Request *struct {
+		RemoteIP string `json:"remote_ip"`
+		// RemoteAddr is "ip:port", logged instead of remote_ip before Caddy 2.5.
+		RemoteAddr string      `json:"remote_addr"`
+		ClientIP   string      `json:"client_ip"`
+		Proto      string      `json:"proto"`
+		Method     string      `json:"method"`
+		Host       string      `json:"host"`
+		URI        string      `json:"uri"`
+		Headers    http.Header `json:"headers"`
+		// TLS is set for HTTPS requests.
+		TLS *struct {
+			Version     uint16 `json:"version"`
+			CipherSuite uint16 `json:"cipher_suite"`
+		} `json:"tls"`
+	} `json:"request"`
+	UserID   string          `json:"user_id"`
+	Duration json.RawMessage `json:"duration"`
+	Size     int64           `json:"size"`
+	Status   int             `json:"status"`
+}
+
+// parseCaddyLine parses one JSON access log entry. The client is Caddy's
+// client_ip, which honours its trusted_proxies setting, and otherwise the
+// first X-Forwarded-For address or remote_ip as for nginx logs.
+func parseCaddyLine(line string) (Entry, error) {
+	if !strings.HasPrefix(line, "{") {
+		return Entry{}, fmt.Errorf("line is not a caddy JSON entry: %w", ErrUnmatchedLine)
+	}
+	var record caddyAccessLog
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return Entry{}, fmt.Errorf("parse caddy entry: %v: %w", err, ErrUnmatchedLine)
+	}
+	if record.Request == nil || record.Status == 0 {
+		return Entry{}, fmt.Errorf("caddy entry is not an access log: %w", ErrUnmatchedLine)
+	}
+	t, err := parseCaddyTime(record.TS)
+	if err != nil {
+		return Entry{}, err
+	}
+	requestTime, err := parseCaddyDuration(record.Duration)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	request := record.Request
+	remote := request.RemoteIP
+	if remote == "" {
+		if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+			remote = host
+		}
+	}
+	forwarded := request.Headers.Get("X-Forwarded-For")
+	clientIP := request.ClientIP
+	if !isValidIPAddress(clientIP) {
+		clientIP = deriveClientIP(remote, forwarded)
+	}
+	entry := Entry{
+		ClientIP:     clientIP,
+		RemoteAddr:   remote,
+		ForwardedFor: forwarded,
+		UserAuth:     record.UserID,
+		Time:         t,
+		Method:       request.Method,
+		URI:          request.URI,
+		Protocol:     request.Proto,
+		Status:       record.Status,
+		Bytes:        record.Size,
+		Referer:      request.Headers.Get("Referer"),
+		UserAgent:    request.Headers.Get("User-Agent"),
+		RequestTime:  requestTime,
+		Host:         request.Host,
+		// Caddy redacts the Cookie header by default but still logs it when sent.
+		SessionLogged: true,
+		HasSession:    len(request.Headers.Values("Cookie")) > 0,
+	}
+	entry.setHeader(HeaderAcceptLanguage, request.Headers.Get("Accept-Language"))
+	entry.setHeader(HeaderAccept, request.Headers.Get("Accept"))
+	entry.setHeader(HeaderAcceptEncoding, request.Headers.Get("Accept-Encoding"))
+	if request.TLS != nil && request.TLS.Version != 0 {
+		entry.TLSProtocol = tlsVersionNames[request.TLS.Version]
+		if entry.TLSProtocol == "" {
+			entry.TLSProtocol = tls.VersionName(request.TLS.Version)
+		}
+		entry.TLSCipher = tls.CipherSuiteName(request.TLS.CipherSuite)
+	}
+	return entry, nil
+}
+
+// parseCaddyTime reads ts, a Unix timestamp in seconds (the default),
+// milliseconds or nanoseconds, or a formatted string.
+func parseCaddyTime(raw json.RawMessage) (time.Time, error) {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		for _, layout := range caddyTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("parse time %q", value)
+	}
+	var number float64
+	if err := json.Unmarshal(raw, &number); err != nil {
+		return time.Time{}, fmt.Errorf("parse time %s: %w", raw, ErrUnmatchedLine)
+	}
+	switch {
+	case number > 1e17:
+		return time.Unix(0, int64(number)).UTC(), nil
+	case number > 1e11:
+		return time.UnixMilli(int64(number)).UTC(), nil
+	}
+	secs, frac := math.Modf(number)
+	return time.Unix(int64(secs), int64(frac*1e9)).UTC(), nil
+}
+
+// parseCaddyDuration reads duration in seconds, or as a Go duration string
+// with duration_format string.
+func parseCaddyDuration(raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 {
+		return 0, nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("parse duration: %w", err)
+		}
+		return d.Seconds(), nil
+	}
+	seconds, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration: %w", err)
+	}
+	return seconds, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const caddyAccessLine = `{"level":"info","ts":1760875355.25,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"10.0.0.5","remote_port":"41342","client_ip":"192.0.2.7","proto":"HTTP/2.0","method":"GET","host":"shop.example.com","uri":"/cart?id=1","headers":{"User-Agent":["curl/8.0"],"Accept":["*/*"],"Referer":["https://example.com/"],"X-Forwarded-For":["192.0.2.7"]}},"bytes_read":0,"user_id":"alice","duration":0.125,"size":512,"status":404,"resp_headers":{"Server":["Caddy"]}}`
+
+func TestCaddyLogFormat(t *testing.T) {
+	format, err := logFormatFor("caddy", "", LogTimes{})
+	if err != nil || format != caddyLogFormat {
+		t.Fatalf("expected caddy format, got %v, %v", format, err)
+	}
+	entry, err := format.Parse(caddyAccessLine)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:      "192.0.2.7",
+		RemoteAddr:    "10.0.0.5",
+		ForwardedFor:  "192.0.2.7",
+		UserAuth:      "alice",
+		Time:          time.Date(2025, 10, 19, 12, 2, 35, 250000000, time.UTC),
+		Method:        "GET",
+		URI:           "/cart?id=1",
+		Protocol:      "HTTP/2.0",
+		Status:        404,
+		Bytes:         512,
+		Referer:       "https://example.com/",
+		UserAgent:     "curl/8.0",
+		RequestTime:   0.125,
+		Host:          "shop.example.com",
+		SessionLogged: true,
+		Accept:        "*/*",
+		LoggedHeaders: HeaderAcceptLanguage | HeaderAccept | HeaderAcceptEncoding,
+	}
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+
+	// Older releases log remote_addr with a port and no client_ip; time_format
+	// and duration_format may turn ts and duration into strings.
+	legacy, err := format.Parse(`{"ts":"2025-10-19T12:02:35.000Z","request":{"remote_addr":"198.51.100.4:5123","method":"POST","uri":"/login","proto":"HTTP/1.1","headers":{"Cookie":["REDACTED"]}},"duration":"1.5ms","size":0,"status":401}`)
+	if err != nil {
+		t.Fatalf("legacy: %v", err)
+	}
+	if legacy.ClientIP != "198.51.100.4" || legacy.RequestTime != 0.0015 || !legacy.HasSession || !legacy.Time.Equal(want.Time.Truncate(time.Second)) {
+		t.Fatalf("unexpected legacy entry %+v", legacy)
+	}
+
+	for _, line := range []string{
+		`{"level":"info","ts":1760875355.25,"logger":"tls","msg":"certificate obtained"}`,
+		`192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`,
+	} {
+		if _, err := format.Parse(line); err == nil {
+			t.Fatalf("expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestStreamDetectsCaddy(t *testing.T) {
+	entries, errs := Stream(strings.NewReader(caddyAccessLine + "\n" + caddyAccessLine + "\n"))
+	count := 0
+	for entry := range entries {
+		if entry.ClientIP != "192.0.2.7" {
+			t.Fatalf("unexpected entry %+v", entry)
+		}
+		count++
+	}
+	if err := <-errs; err != nil || count != 2 {
+		t.Fatalf("expected 2 caddy entries, got %d, %v", count, err)
+	}
+}
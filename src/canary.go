@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// renderNginxCanary writes a geo block marking log-only suspects in
+// $botdeny_canary; nginx serves them normally and the marker shows up in any
+// log_format that includes the variable.
+func renderNginxCanary(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	renderNginxGeo(b, "botdeny_canary", items)
+}
+
+// StageCanary records when each suspect was first flagged and returns the
+// IPs flagged for less than period, which stay log-only. An IP is promoted
+// to the deny file the first time it is flagged again after period.
+func (db *StateDB) StageCanary(suspects []Suspicion, period time.Duration, now time.Time) map[string]bool {
+	if db.Canary == nil {
+		db.Canary = make(map[string]time.Time)
+	}
+	staged := make(map[string]bool)
+	for _, suspect := range suspects {
+		first, ok := db.Canary[suspect.IP]
+		if !ok {
+			first = now.UTC()
+			db.Canary[suspect.IP] = first
+		}
+		if now.Sub(first) < period {
+			staged[suspect.IP] = true
+		}
+	}
+	return staged
+}
+
+// splitCanary separates suspects still in the canary period from those to deny.
+func splitCanary(suspects []Suspicion, staged map[string]bool) (deny, canary []Suspicion) {
+	for _, suspect := range suspects {
+		if staged[suspect.IP] {
+			canary = append(canary, suspect)
+			continue
+		}
+		deny = append(deny, suspect)
+	}
+	return deny, canary
+}
+
+// writeCanaryFile writes the log-only suspects as an nginx-canary file.
+func writeCanaryFile(path string, suspects []Suspicion, opts DenyOptions) error {
+	opts.Format = "nginx-canary"
+	return writeDenyFile(path, suspects, opts)
+}
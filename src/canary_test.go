@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateDBStageCanary(t *testing.T) {
+	db := &StateDB{}
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	suspects := []Suspicion{{IP: "192.0.2.1"}}
+	if staged := db.StageCanary(suspects, 6*time.Hour, start); !staged["192.0.2.1"] {
+		t.Fatalf("expected a new suspect to be staged, got %v", staged)
+	}
+
+	suspects = append(suspects, Suspicion{IP: "192.0.2.2"})
+	staged := db.StageCanary(suspects, 6*time.Hour, start.Add(6*time.Hour))
+	if staged["192.0.2.1"] || !staged["192.0.2.2"] {
+		t.Fatalf("expected only the older suspect to be promoted, got %v", staged)
+	}
+	deny, canary := splitCanary(suspects, staged)
+	if len(deny) != 1 || deny[0].IP != "192.0.2.1" || len(canary) != 1 || canary[0].IP != "192.0.2.2" {
+		t.Fatalf("unexpected split: deny %v, canary %v", deny, canary)
+	}
+	if !db.Canary["192.0.2.2"].Equal(start.Add(6 * time.Hour)) {
+		t.Fatalf("expected first-flagged time to be recorded, got %v", db.Canary)
+	}
+}
+
+func TestFollowerPromotesCanaryBlocks(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	dir := t.TempDir()
+	denyPath := filepath.Join(dir, "deny.conf")
+	canaryPath := filepath.Join(dir, "canary.conf")
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:       5 * time.Minute,
+		Interval:     time.Minute,
+		DenyOutput:   denyPath,
+		Deny:         DenyOptions{TTL: 24 * time.Hour, Minimal: true},
+		Canary:       time.Hour,
+		CanaryOutput: canaryPath,
+	})
+
+	for _, entry := range scannerEntries("192.0.2.1", start, 40) {
+		follower.Add(entry, start)
+	}
+	if _, err := follower.Tick(start.Add(time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	deny, _ := os.ReadFile(denyPath)
+	canary, _ := os.ReadFile(canaryPath)
+	if string(deny) != "" || string(canary) != "geo $botdeny_canary {\n    default 0;\n    192.0.2.1 1;\n}\n" {
+		t.Fatalf("expected the new suspect to be log-only, got deny %q, canary %q", deny, canary)
+	}
+
+	if _, err := follower.Tick(start.Add(61 * time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	deny, _ = os.ReadFile(denyPath)
+	canary, _ = os.ReadFile(canaryPath)
+	if string(deny) != "deny 192.0.2.1;\n" || string(canary) != "geo $botdeny_canary {\n    default 0;\n}\n" {
+		t.Fatalf("expected the suspect to be promoted after the canary period, got deny %q, canary %q", deny, canary)
+	}
+}
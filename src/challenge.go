@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"math/bits"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	challengePrefix     = "/.botdeny/"
+	challengeVerifyPath = challengePrefix + "verify"
+	// challengeTokenTTL is how long a challenge page may take to be solved.
+	challengeTokenTTL       = 10 * time.Minute
+	defaultChallengeBits    = 14
+	defaultChallengePassTTL = 24 * time.Hour
+)
+
+// renderNginxChallenge writes a geo block marking flagged clients and a map
+// that challenges them until they hold a valid pass cookie, checked by
+// nginx's secure_link module. The server block part is described in the README.
+func renderNginxChallenge(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	renderNginxGeo(b, "botdeny_flagged", items)
+	b.WriteString("\n")
+	b.WriteString("map \"$botdeny_flagged:$secure_link:$uri\" $botdeny_challenge {\n")
+	b.WriteString("    default 0;\n")
+	b.WriteString("    \"~^1:[^:]*:/\\.botdeny/\" 0;\n")
+	b.WriteString("    \"~^1:0?:\" 1;\n")
+	b.WriteString("}\n")
+}
+
+// challengeServer issues proof-of-work challenges and pass cookies.
+type challengeServer struct {
+	secret  string
+	bits    int
+	passTTL time.Duration
+	// passedPath receives the IPs that solved a challenge, one per line with
+	// the expiry of their pass, for the challenge_passed setting.
+	passedPath string
+	now        func() time.Time
+
+	mu sync.Mutex
+	// passed maps the IPs recorded in passedPath to their pass expiry.
+	passed map[string]time.Time
+}
+
+// challengeToken binds a challenge to a client IP and issue time.
+func (s *challengeServer) challengeToken(ip string, issued time.Time) string {
+	ts := strconv.FormatInt(issued.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write([]byte(ts + "|" + ip))
+	return ts + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkToken reports whether token was issued to ip recently.
+func (s *challengeServer) checkToken(token, ip string) bool {
+	ts, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	issued := time.Unix(unix, 0)
+	if age := s.now().Sub(issued); age < 0 || age > challengeTokenTTL {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(s.challengeToken(ip, issued)))
+}
+
+// solvesChallenge reports whether SHA-256(token:nonce) starts with at least n zero bits.
+func solvesChallenge(token, nonce string, n int) bool {
+	sum := sha256.Sum256([]byte(token + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= n
+}
+
+// passCookie returns the value nginx recomputes with
+// secure_link_md5 "$cookie_botdeny_expires$remote_addr <secret>".
+func (s *challengeServer) passCookie(ip string, expires int64) string {
+	sum := md5.Sum([]byte(strconv.FormatInt(expires, 10) + ip + " " + s.secret))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// clientIP is the address nginx passes in X-Real-IP; the handler is meant to
+// listen on loopback behind nginx only.
+func clientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); isValidIPAddress(ip) {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *challengeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	ip := clientIP(r)
+	if r.Method == http.MethodPost && r.URL.Path == challengeVerifyPath {
+		s.verify(w, r, ip)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	challengePage.Execute(w, struct {
+		Token  string
+		Bits   int
+		Verify string
+	}{s.challengeToken(ip, s.now()), s.bits, challengeVerifyPath})
+}
+
+func (s *challengeServer) verify(w http.ResponseWriter, r *http.Request, ip string) {
+	token, nonce := r.PostFormValue("token"), r.PostFormValue("nonce")
+	if !s.checkToken(token, ip) || !solvesChallenge(token, nonce, s.bits) {
+		http.Error(w, "challenge failed", http.StatusForbidden)
+		return
+	}
+	expires := s.now().Add(s.passTTL).Unix()
+	for name, value := range map[string]string{
+		"botdeny_pass":    s.passCookie(ip, expires),
+		"botdeny_expires": strconv.FormatInt(expires, 10),
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     "/",
+			MaxAge:   int(s.passTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	if err := s.recordPass(ip); err != nil {
+		log.Printf("record challenge pass for %s: %v", ip, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordPass appends ip to the passed file with the expiry of its pass,
+// once per pass: an IP is written again only after its last pass expired.
+func (s *challengeServer) recordPass(ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if expires, seen := s.passed[ip]; (seen && now.Before(expires)) || s.passedPath == "" {
+		return nil
+	}
+	expires := now.Add(s.passTTL).UTC().Truncate(time.Second)
+	fh, err := os.OpenFile(s.passedPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	if _, err := fmt.Fprintf(fh, "%s %s%s\n", ip, allowExpiresComment, expires.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	s.passed[ip] = expires
+	log.Printf("%s passed the challenge", ip)
+	return nil
+}
+
+// loadChallengePassed returns the IPs whose pass in the challenge_passed file
+// has not expired. A missing file only means nobody passed yet.
+func loadChallengePassed(path string, problems *Problems) []string {
+	ips, _, err := fileAllowSource{path: path}.Load(context.Background())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		problems.Add(ProblemAllowFile, fmt.Sprintf("%s: %v", path, err))
+	}
+	return ips
+}
+
+// evaluateChallengePassed scores an IP that solved a challenge. Solving one
+// only shows the client runs JavaScript, so a pass lifts the score-based
+// rules but honeytoken, sensitive_urls and SQL injection hits still block.
+func (a *Analyzer) evaluateChallengePassed(stat *IPStats) (Suspicion, bool) {
+	saved := a.passed
+	defer func() { a.passed = saved }()
+	a.passed = allowSet{}
+	suspect, blocked := a.evaluate(stat)
+	if blocked {
+		blocked = containsStringCI(RuleSensitivePath, suspect.Rules) || containsStringCI(RuleHoneytoken, suspect.Rules) || containsStringCI(RuleSQLInjection, suspect.Rules)
+	}
+	return suspect, blocked
+}
+
+// challengePage solves the proof of work in the browser, then reloads the
+// original URL with the pass cookies set. crypto.subtle needs HTTPS.
+var challengePage = template.Must(template.New("challenge").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Checking your browser</title></head>
+<body><p>Checking your browser, this takes a few seconds…</p>
+<noscript><p>Please enable JavaScript to continue.</p></noscript>
+<script>
+(async () => {
+  const token = {{.Token}}, bits = {{.Bits}}, encoder = new TextEncoder();
+  const zeros = (hash) => { let n = 0; for (const b of hash) { if (b === 0) { n += 8; continue; } n += Math.clz32(b) - 24; break; } return n; };
+  for (let nonce = 0; ; nonce++) {
+    const hash = new Uint8Array(await crypto.subtle.digest("SHA-256", encoder.encode(token + ":" + nonce)));
+    if (zeros(hash) < bits) continue;
+    const res = await fetch({{.Verify}}, {method: "POST", credentials: "same-origin", body: new URLSearchParams({token: token, nonce: String(nonce)})});
+    if (res.ok) location.reload();
+    return;
+  }
+})();
+</script></body></html>
+`))
+
+func runChallenge(args []string) int {
+	if len(args) == 0 || args[0] != "serve" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny challenge serve --secret SECRET [--listen 127.0.0.1:8089] [--passed passed.conf] [--bits 14] [--pass-ttl 24h]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("challenge serve", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	listen := fs.String("listen", "127.0.0.1:8089", "address to listen on; keep it private to nginx, which supplies X-Real-IP")
+	secret := fs.String("secret", "", "secret shared with the secure_link_md5 directive")
+	passedPath := fs.String("passed", "", "file receiving IPs that pass the challenge, read by runs with challenge_passed set (optional)")
+	difficulty := fs.Int("bits", defaultChallengeBits, "leading zero bits the proof of work must reach")
+	passTTL := fs.Duration("pass-ttl", defaultChallengePassTTL, "how long a solved challenge lets the client through")
+	fs.Parse(args[1:])
+
+	_, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *secret == "" {
+		*secret = defaults.ChallengeSecret
+	}
+	if *passedPath == "" {
+		*passedPath = defaults.ChallengePassed
+	}
+	if *secret == "" {
+		fmt.Fprintln(os.Stderr, "challenge serve requires --secret (or challenge_secret in the config)")
+		return 2
+	}
+	if *difficulty < 1 || *difficulty > 32 || *passTTL <= 0 {
+		fmt.Fprintln(os.Stderr, "challenge serve: --bits must be 1-32 and --pass-ttl positive")
+		return 2
+	}
+
+	server := &http.Server{
+		Addr: *listen,
+		Handler: &challengeServer{
+			secret:     *secret,
+			bits:       *difficulty,
+			passTTL:    *passTTL,
+			passedPath: *passedPath,
+			now:        time.Now,
+			passed:     make(map[string]time.Time),
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("serving challenges on %s", *listen)
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "challenge serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
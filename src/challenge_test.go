@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChallengeServerIssuesPass(t *testing.T) {
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	passedPath := filepath.Join(t.TempDir(), "passed.conf")
+	server := &challengeServer{
+		secret:     "s3cret",
+		bits:       8,
+		passTTL:    time.Hour,
+		passedPath: passedPath,
+		now:        func() time.Time { return now },
+		passed:     make(map[string]time.Time),
+	}
+
+	page := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/shop?page=2", nil)
+	req.Header.Set("X-Real-IP", "192.0.2.10")
+	server.ServeHTTP(page, req)
+	if page.Code != http.StatusForbidden || page.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("unexpected challenge response %d %v", page.Code, page.Header())
+	}
+	match := regexp.MustCompile(`const token = "([^"]+)"`).FindStringSubmatch(page.Body.String())
+	if match == nil {
+		t.Fatalf("no token in challenge page:\n%s", page.Body.String())
+	}
+	token := match[1]
+
+	nonce := 0
+	for !solvesChallenge(token, strconv.Itoa(nonce), server.bits) {
+		nonce++
+	}
+	verify := func(ip, nonce string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}, "nonce": {nonce}}
+		req := httptest.NewRequest(http.MethodPost, challengeVerifyPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Real-IP", ip)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := verify("192.0.2.99", strconv.Itoa(nonce)); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a token issued to another IP to fail, got %d", rec.Code)
+	}
+	rec := verify("192.0.2.10", strconv.Itoa(nonce))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the solved challenge to pass, got %d %s", rec.Code, rec.Body.String())
+	}
+	cookies := map[string]string{}
+	for _, cookie := range rec.Result().Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	expires := now.Add(time.Hour).Unix()
+	// Matches nginx: secure_link_md5 "$cookie_botdeny_expires$remote_addr s3cret".
+	if cookies["botdeny_expires"] != strconv.FormatInt(expires, 10) || cookies["botdeny_pass"] != server.passCookie("192.0.2.10", expires) {
+		t.Fatalf("unexpected pass cookies %v", cookies)
+	}
+	verify("192.0.2.10", strconv.Itoa(nonce))
+
+	data, err := os.ReadFile(passedPath)
+	if err != nil {
+		t.Fatalf("read passed file: %v", err)
+	}
+	if string(data) != "192.0.2.10 # expires 2025-10-19T13:00:00Z\n" {
+		t.Fatalf("unexpected passed file:\n%s", data)
+	}
+
+	now = now.Add(challengeTokenTTL + time.Second)
+	if rec := verify("192.0.2.10", strconv.Itoa(nonce)); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a stale token to fail, got %d", rec.Code)
+	}
+}
+
+func TestChallengePassRelaxesOnlyScoredRules(t *testing.T) {
+	start := time.Date(2025, 11, 28, 10, 0, 0, 0, time.UTC)
+	scraper := func(analyzer *Analyzer, ip string) {
+		for i := 0; i < 300; i++ {
+			status := 200
+			if i%10 == 0 {
+				status = 404
+			}
+			analyzer.Process(Entry{ClientIP: ip, Time: start.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/product/%d", i), Status: status})
+		}
+	}
+	passedPath := filepath.Join(t.TempDir(), "passed.txt")
+	passes := "192.0.2.50 # expires 2999-01-01T00:00:00Z\n" +
+		"192.0.2.9 # expires 2001-01-01T00:00:00Z\n"
+	if err := os.WriteFile(passedPath, []byte(passes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.MinUniquePaths = 100
+	cfg.ChallengePassedIPs = loadChallengePassed(passedPath, nil)
+	if len(cfg.ChallengePassedIPs) != 1 || cfg.ChallengePassedIPs[0] != "192.0.2.50" {
+		t.Fatalf("expected only the unexpired pass, got %v", cfg.ChallengePassedIPs)
+	}
+	if _, _, blocked := explainAfter(cfg, scraper); blocked {
+		t.Fatal("expected a passed challenge to lift the score-based rules")
+	}
+
+	cfg.Honeytokens = []string{"/product/7"}
+	if _, _, blocked := explainAfter(cfg, scraper); !blocked {
+		t.Fatal("expected honeytoken hits to block after a passed challenge")
+	}
+
+	if ips := loadChallengePassed(filepath.Join(t.TempDir(), "missing.txt"), nil); len(ips) != 0 {
+		t.Fatalf("expected no passes before the file exists, got %v", ips)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// checkpointHeadBytes is how much of the start of a log identifies it.
+// Unlike an inode, the start of a log survives renames by logrotate and
+// copies, and it is the same on every platform.
+const checkpointHeadBytes = 512
+
+// LogCheckpoint records how far a log file was analyzed, for --resume.
+type LogCheckpoint struct {
+	Path string `json:"path"`
+	// Offset is the end of the last complete line analyzed.
+	Offset int64 `json:"offset"`
+	// Head is the SHA-256 of the first HeadLength bytes of the file.
+	Head       string    `json:"head"`
+	HeadLength int       `json:"head_length"`
+	Updated    time.Time `json:"updated"`
+}
+
+// logResumer opens logs from where the previous run's checkpoints left off
+// and collects the checkpoints of this run.
+type logResumer struct {
+	previous []LogCheckpoint
+	next     []LogCheckpoint
+}
+
+// open opens the log at path past the part previous runs analyzed, up to its
+// last complete line; lines still being written are left for the next run.
+// A rotated log is recognized under its new name, and a log that was
+// replaced or truncated is read from the start. Compressed logs are read
+// whole, or skipped once analyzed, since they are not appended to.
+func (r *logResumer) open(path string) (io.ReadCloser, error) {
+	if path == stdinPath {
+		return nil, fmt.Errorf("cannot resume standard input")
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	size := info.Size()
+	head := make([]byte, min(size, checkpointHeadBytes))
+	if _, err := fh.ReadAt(head, 0); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	start := int64(0)
+	if previous, ok := r.match(path, head); ok && previous.Offset <= size {
+		start = previous.Offset
+	}
+
+	end := size
+	compressed := isCompressedLog(head)
+	if compressed && start < size {
+		start = 0
+	} else if !compressed {
+		if end, err = lastLineEnd(fh, start, size); err != nil {
+			fh.Close()
+			return nil, err
+		}
+	}
+	r.next = append(r.next, LogCheckpoint{
+		Path:       path,
+		Offset:     end,
+		Head:       headDigest(head),
+		HeadLength: len(head),
+		Updated:    time.Now().UTC(),
+	})
+
+	section := logReader{Reader: io.NewSectionReader(fh, start, end-start), close: fh.Close}
+	if !compressed || start == end {
+		return section, nil
+	}
+	return decompressLog(section)
+}
+
+// match finds the checkpoint of the file whose start is head, preferring one
+// recorded under path.
+func (r *logResumer) match(path string, head []byte) (LogCheckpoint, bool) {
+	var found LogCheckpoint
+	ok := false
+	for _, checkpoint := range r.previous {
+		if checkpoint.HeadLength == 0 || checkpoint.HeadLength > len(head) {
+			continue
+		}
+		if headDigest(head[:checkpoint.HeadLength]) != checkpoint.Head {
+			continue
+		}
+		if checkpoint.Path == path {
+			return checkpoint, true
+		}
+		if !ok || checkpoint.Offset > found.Offset {
+			found, ok = checkpoint, true
+		}
+	}
+	return found, ok
+}
+
+func headDigest(head []byte) string {
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:])
+}
+
+// lastLineEnd returns the offset just past the last newline between start
+// and size, or start when there is none.
+func lastLineEnd(fh *os.File, start, size int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for end := size; end > start; {
+		from := max(start, end-int64(len(buf)))
+		chunk := buf[:end-from]
+		if _, err := fh.ReadAt(chunk, from); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return from + int64(i) + 1, nil
+		}
+		end = from
+	}
+	return start, nil
+}
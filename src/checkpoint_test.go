@@ -0,0 +1,113 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func checkpointLine(i int) string {
+	return fmt.Sprintf("192.0.2.%d - - [19/Oct/2025:12:00:%02d +0000] \"GET /%d HTTP/1.1\" 200 0 \"-\" \"curl/8.0\"\n", i, i, i)
+}
+
+// resumeRun analyzes paths from the previous checkpoints and returns the
+// paths of the entries read and the new checkpoints.
+func resumeRun(t *testing.T, previous []LogCheckpoint, paths ...string) ([]string, []LogCheckpoint) {
+	t.Helper()
+	resumer := &logResumer{previous: previous}
+	var uris []string
+	if err := streamLogFilesWith(paths, StreamOptions{}, resumer.open, func(entry Entry) {
+		uris = append(uris, entry.URI)
+	}); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	return uris, resumer.next
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer fh.Close()
+	if _, err := fh.WriteString(data); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestResumeReadsOnlyNewLines(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	third := checkpointLine(3)
+	appendFile(t, logPath, checkpointLine(1)+checkpointLine(2)+third[:20])
+
+	uris, checkpoints := resumeRun(t, nil, logPath)
+	if strings.Join(uris, ",") != "/1,/2" {
+		t.Fatalf("first run read %v, want the complete lines", uris)
+	}
+	if want := int64(2 * len(checkpointLine(1))); checkpoints[0].Offset != want {
+		t.Fatalf("checkpoint at %d, want %d", checkpoints[0].Offset, want)
+	}
+
+	appendFile(t, logPath, third[20:]+checkpointLine(4))
+	uris, checkpoints = resumeRun(t, checkpoints, logPath)
+	if strings.Join(uris, ",") != "/3,/4" {
+		t.Fatalf("second run read %v, want only the new lines", uris)
+	}
+
+	uris, _ = resumeRun(t, checkpoints, logPath)
+	if len(uris) != 0 {
+		t.Fatalf("third run read %v, want nothing", uris)
+	}
+}
+
+func TestResumeFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	appendFile(t, logPath, checkpointLine(1)+checkpointLine(2))
+	_, checkpoints := resumeRun(t, nil, logPath)
+
+	// Lines logged before logrotate renamed the file are read from its new
+	// name, and the new file is read from its start.
+	appendFile(t, logPath, checkpointLine(3))
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	appendFile(t, logPath, checkpointLine(4))
+	uris, checkpoints := resumeRun(t, checkpoints, logPath+".1", logPath)
+	if strings.Join(uris, ",") != "/3,/4" {
+		t.Fatalf("read %v after rotation, want /3,/4", uris)
+	}
+
+	// A log replaced by different content is read from its start.
+	if err := os.WriteFile(logPath, []byte(checkpointLine(5)+checkpointLine(6)+checkpointLine(7)), 0o644); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	uris, _ = resumeRun(t, checkpoints, logPath)
+	if strings.Join(uris, ",") != "/5,/6,/7" {
+		t.Fatalf("read %v after replacement, want the whole file", uris)
+	}
+}
+
+func TestResumeSkipsAnalyzedCompressedLogs(t *testing.T) {
+	gzPath := filepath.Join(t.TempDir(), "access.log.2.gz")
+	fh, err := os.Create(gzPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	zw := gzip.NewWriter(fh)
+	zw.Write([]byte(checkpointLine(1) + checkpointLine(2)))
+	zw.Close()
+	fh.Close()
+
+	uris, checkpoints := resumeRun(t, nil, gzPath)
+	if strings.Join(uris, ",") != "/1,/2" {
+		t.Fatalf("first run read %v", uris)
+	}
+	if uris, _ = resumeRun(t, checkpoints, gzPath); len(uris) != 0 {
+		t.Fatalf("second run read %v, want the analyzed archive skipped", uris)
+	}
+}
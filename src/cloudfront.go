@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cloudfrontLogFormat reads CloudFront standard access logs: tab-separated
+// W3C fields in the fixed order AWS documents, after #Version and #Fields
+// header lines.
+var cloudfrontLogFormat = &LogFormat{Name: "cloudfront", parse: parseCloudFrontLine}
+
+// Positions of the CloudFront fields botdeny reads. AWS only ever appends new
+// fields, so older logs simply end earlier.
+const (
+	cfDate        = 0
+	cfTime        = 1
+	cfBytes       = 3
+	cfClientIP    = 4
+	cfMethod      = 5
+	cfURIStem     = 7
+	cfStatus      = 8
+	cfReferer     = 9
+	cfUserAgent   = 10
+	cfURIQuery    = 11
+	cfHostHeader  = 15
+	cfTimeTaken   = 18
+	cfForwarded   = 19
+	cfProtocolVer = 23
+	// cfMinFields covers date through cs-uri-query, present in every version.
+	cfMinFields = 12
+)
+
+// parseCloudFrontLine parses one CloudFront entry. Header lines yield an
+// empty entry, which Stream skips.
+func parseCloudFrontLine(line string) (Entry, error) {
+	if strings.HasPrefix(line, "#") {
+		return Entry{}, nil
+	}
+	fields := strings.Split(line, "\t")
+	if len(fields) < cfMinFields {
+		return Entry{}, fmt.Errorf("line does not match cloudfront format: %w", ErrUnmatchedLine)
+	}
+	field := func(i int) string {
+		if i >= len(fields) || fields[i] == "-" {
+			return ""
+		}
+		return fields[i]
+	}
+
+	t, err := time.Parse("2006-01-02 15:04:05", fields[cfDate]+" "+fields[cfTime])
+	if err != nil {
+		return Entry{}, fmt.Errorf("parse time: %v: %w", err, ErrUnmatchedLine)
+	}
+	client := field(cfClientIP)
+	if !isValidIPAddress(client) {
+		return Entry{}, fmt.Errorf("parse client %q: %w", client, ErrUnmatchedLine)
+	}
+	entry := Entry{
+		ClientIP:     client,
+		RemoteAddr:   client,
+		ForwardedFor: field(cfForwarded),
+		Time:         t,
+		Method:       field(cfMethod),
+		URI:          field(cfURIStem),
+		Protocol:     field(cfProtocolVer),
+		Referer:      cloudfrontUnescape(field(cfReferer)),
+		UserAgent:    cloudfrontUnescape(field(cfUserAgent)),
+		Host:         field(cfHostHeader),
+	}
+	if query := field(cfURIQuery); query != "" {
+		entry.URI += "?" + query
+	}
+	// Viewers that disconnect before a response are logged with status 000.
+	if entry.Status, err = strconv.Atoi(fields[cfStatus]); err != nil {
+		return Entry{}, fmt.Errorf("parse status: %v: %w", err, ErrUnmatchedLine)
+	}
+	if raw := field(cfBytes); raw != "" {
+		if entry.Bytes, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return Entry{}, fmt.Errorf("parse bytes: %w", err)
+		}
+	}
+	if raw := field(cfTimeTaken); raw != "" {
+		if entry.RequestTime, err = strconv.ParseFloat(raw, 64); err != nil {
+			return Entry{}, fmt.Errorf("parse time-taken: %w", err)
+		}
+	}
+	return entry, nil
+}
+
+// cloudfrontUnescape decodes the URL-encoded user agent and referer fields.
+// CloudFront encodes spaces and other unsafe bytes as %XX, and encodes the
+// percent sign of already-encoded input a second time, so one pass restores
+// what the client sent. Malformed escapes are kept as logged.
+func cloudfrontUnescape(value string) string {
+	decoded, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
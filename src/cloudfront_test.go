@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const cloudfrontLog = "#Version: 1.0\n" +
+	"#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status cs(Referer) cs(User-Agent) cs-uri-query cs(Cookie) x-edge-result-type x-edge-request-id x-host-header cs-protocol cs-bytes time-taken x-forwarded-for ssl-protocol ssl-cipher x-edge-response-result-type cs-protocol-version fle-status fle-encrypted-fields c-port time-to-first-byte x-edge-detailed-result-type sc-content-type sc-content-len sc-range-start sc-range-end\n" +
+	"2025-10-19\t12:02:35\tFRA56-P5\t512\t192.0.2.7\tGET\td111111abcdef8.cloudfront.net\t/cart\t404\thttps://example.com/\tMozilla/5.0%20(X11;%20Linux%20x86_64)%20curl%2520like\tid=1\t-\tError\tSOX4xwn4XV6Q4rgb7XiVGOHms_BGlTAC4KyHmureZmBNrjGdRLiNIQ==\tshop.example.com\thttps\t23\t0.125\t-\tTLSv1.3\tTLS_AES_128_GCM_SHA256\tError\tHTTP/2.0\t-\t-\t51234\t0.120\tError\ttext/html\t512\t-\t-\n"
+
+func TestCloudFrontLogFormat(t *testing.T) {
+	format, err := logFormatFor("cloudfront", "", LogTimes{})
+	if err != nil || format != cloudfrontLogFormat {
+		t.Fatalf("expected cloudfront format, got %v, %v", format, err)
+	}
+	lines := strings.Split(strings.TrimSpace(cloudfrontLog), "\n")
+	if entry, err := format.Parse(lines[1]); err != nil || entry.ClientIP != "" {
+		t.Fatalf("expected the #Fields line to be skipped, got %+v, %v", entry, err)
+	}
+	entry, err := format.Parse(lines[2])
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:    "192.0.2.7",
+		RemoteAddr:  "192.0.2.7",
+		Time:        time.Date(2025, 10, 19, 12, 2, 35, 0, time.UTC),
+		Method:      "GET",
+		URI:         "/cart?id=1",
+		Protocol:    "HTTP/2.0",
+		Status:      404,
+		Bytes:       512,
+		Referer:     "https://example.com/",
+		UserAgent:   "Mozilla/5.0 (X11; Linux x86_64) curl%20like",
+		RequestTime: 0.125,
+		Host:        "shop.example.com",
+	}
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+
+	// Logs written before newer columns were added end after cs-uri-query.
+	legacy := strings.Join(strings.Split(lines[2], "\t")[:12], "\t")
+	if entry, err := format.Parse(legacy); err != nil || entry.URI != "/cart?id=1" || entry.Host != "" {
+		t.Fatalf("expected a short legacy entry to parse, got %+v, %v", entry, err)
+	}
+}
+
+func TestStreamDetectsCloudFront(t *testing.T) {
+	entries, errs := Stream(strings.NewReader(cloudfrontLog))
+	var got []Entry
+	for entry := range entries {
+		got = append(got, entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(got) != 1 || got[0].ClientIP != "192.0.2.7" || got[0].Status != 404 {
+		t.Fatalf("expected the CloudFront entry to be detected, got %+v", got)
+	}
+}
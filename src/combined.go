@@ -0,0 +1,209 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseCombinedFast parses a combined-format line by scanning it once instead
+// of running logPattern, which dominates the CPU time of large runs. It
+// returns false for any line it is not sure about, including lines that do
+// not parse at all; ParseLine then falls back to logPattern, so both paths
+// yield the same entries and errors.
+func parseCombinedFast(line string) (Entry, bool) {
+	var entry Entry
+	i, ok := 0, true
+
+	var remoteAddr string
+	if remoteAddr, i, ok = logToken(line, i); !ok {
+		return Entry{}, false
+	}
+	if entry.UserIdent, i, ok = logToken(line, i); !ok {
+		return Entry{}, false
+	}
+	if entry.UserAuth, i, ok = logToken(line, i); !ok {
+		return Entry{}, false
+	}
+
+	// [time]
+	if i >= len(line) || line[i] != '[' {
+		return Entry{}, false
+	}
+	end := strings.IndexByte(line[i+1:], ']')
+	if end <= 0 {
+		return Entry{}, false
+	}
+	t, err := time.Parse(timeLayout, line[i+1:i+1+end])
+	if err != nil {
+		return Entry{}, false
+	}
+	entry.Time = t
+	i += end + 2
+
+	// "METHOD URI PROTOCOL"
+	if !strings.HasPrefix(line[i:], ` "`) {
+		return Entry{}, false
+	}
+	i += 2
+	start := i
+	for i < len(line) && line[i] >= 'A' && line[i] <= 'Z' {
+		i++
+	}
+	if i == start || i >= len(line) || line[i] != ' ' {
+		return Entry{}, false
+	}
+	entry.Method = line[start:i]
+	i++
+	start = i
+	if i, ok = skipQuoted(line, i, true); !ok || i == start || line[i] != ' ' {
+		return Entry{}, false
+	}
+	uri := line[start:i]
+	i++
+	start = i
+	if i, ok = skipQuoted(line, i, false); !ok || i == start {
+		return Entry{}, false
+	}
+	protocol := line[start:i]
+	i++
+
+	// status and bytes
+	if i+5 > len(line) || line[i] != ' ' || !isDigits(line[i+1:i+4]) || line[i+4] != ' ' {
+		return Entry{}, false
+	}
+	status, _ := strconv.Atoi(line[i+1 : i+4])
+	entry.Status = status
+	i += 5
+	start = i
+	for i < len(line) && !isRegexSpace(line[i]) {
+		i++
+	}
+	if i == start {
+		return Entry{}, false
+	}
+	if size := line[start:i]; size != "-" {
+		if entry.Bytes, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return Entry{}, false
+		}
+	}
+
+	// "referer" "user agent"
+	var referer, userAgent string
+	if referer, i, ok = logQuoted(line, i); !ok {
+		return Entry{}, false
+	}
+	if userAgent, i, ok = logQuoted(line, i); !ok {
+		return Entry{}, false
+	}
+
+	// Optional "forwarded for" and request time; like the optional groups of
+	// logPattern they are skipped when they do not match.
+	forwarded := ""
+	if strings.HasPrefix(line[i:], ` "`) {
+		if value, next, ok := logQuoted(line, i); ok {
+			forwarded, i = value, next
+		} else if next < 0 {
+			return Entry{}, false
+		}
+	}
+	if i+1 < len(line) && line[i] == ' ' && isDigit(line[i+1]) {
+		start = i + 1
+		end := start
+		for end < len(line) && isDigit(line[end]) {
+			end++
+		}
+		if end+1 < len(line) && line[end] == '.' && isDigit(line[end+1]) {
+			end++
+			for end < len(line) && isDigit(line[end]) {
+				end++
+			}
+		}
+		if end == len(line) || isRegexSpace(line[end]) {
+			if entry.RequestTime, err = strconv.ParseFloat(line[start:end], 64); err != nil {
+				return Entry{}, false
+			}
+		}
+	}
+
+	entry.RemoteAddr = remoteAddr
+	entry.ForwardedFor = unescapeLogValue(forwarded)
+	entry.URI = unescapeLogValue(uri)
+	entry.Protocol = unescapeLogValue(protocol)
+	entry.Referer = unescapeLogValue(referer)
+	entry.UserAgent = unescapeLogValue(userAgent)
+	entry.ClientIP = deriveClientIP(remoteAddr, entry.ForwardedFor)
+	return entry, true
+}
+
+// logToken reads a run of non-space bytes starting at i that is followed by
+// a single space, returning it and the offset after the space.
+func logToken(line string, i int) (string, int, bool) {
+	start := i
+	for i < len(line) && !isRegexSpace(line[i]) {
+		i++
+	}
+	if i == start || i >= len(line) || line[i] != ' ' {
+		return "", i, false
+	}
+	return line[start:i], i + 1, true
+}
+
+// logQuoted reads ` "value"` starting at i, returning the still escaped value
+// and the offset after the closing quote. When the value is not closed the
+// returned offset is i, or -1 when the line holds an escape the scanner does
+// not mirror logPattern for.
+func logQuoted(line string, i int) (string, int, bool) {
+	if !strings.HasPrefix(line[i:], ` "`) {
+		return "", i, false
+	}
+	end, ok := skipQuoted(line, i+2, false)
+	if !ok {
+		if end < 0 {
+			return "", -1, false
+		}
+		return "", i, false
+	}
+	return line[i+2 : end], end + 1, true
+}
+
+// skipQuoted returns the offset of the first unescaped '"' from i, or of the
+// first unescaped space when stopAtSpace is set. A backslash escapes the byte
+// after it. It returns -1 for a backslash at the end of the line or before a
+// newline, which logPattern's "." does not match.
+func skipQuoted(line string, i int, stopAtSpace bool) (int, bool) {
+	for i < len(line) {
+		switch c := line[i]; {
+		case c == '\\':
+			if i+1 >= len(line) || line[i+1] == '\n' {
+				return -1, false
+			}
+			i += 2
+		case c == '"':
+			return i, true
+		case c == ' ' && stopAtSpace:
+			return i, true
+		default:
+			i++
+		}
+	}
+	return len(line), false
+}
+
+// isRegexSpace reports whether c matches \s in Go regular expressions.
+func isRegexSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -11,57 +11,247 @@ import (
 
 // FileConfig represents configuration options supplied via YAML.
 type FileConfig struct {
-	File             string      `yaml:"file"`
-	Top              *int        `yaml:"top"`
-	Color            *bool       `yaml:"color"`
-	GeoIPDB          string      `yaml:"geoip_db"`
-	DenyOutput       string      `yaml:"deny_output"`
-	DenyExpiry       string      `yaml:"deny_expiry"`
-	NginxReload      *bool       `yaml:"nginx_reload"`
-	NginxBin         string      `yaml:"nginx_bin"`
-	BlockLog         string      `yaml:"block_log"`
-	AllowAgents      []string    `yaml:"allow_agents"`
-	BotCountries     []string    `yaml:"bot_countries"`
-	AllowIPs         []string    `yaml:"allow_ips"`
-	AllowCIDRs       []string    `yaml:"allow_cidrs"`
-	AllowIPFiles     []string    `yaml:"allow_ip_files"`
-	AllowURLs        []string    `yaml:"allow_urls"`
-	SensitiveURLs    []PathLimit `yaml:"sensitive_urls"`
-	MinRequests      *int        `yaml:"min_requests"`
-	MaxAverageRPM    *float64    `yaml:"max_average_rpm"`
-	MaxBurstWindow   string      `yaml:"max_burst_window"`
-	MaxBurstRequests *int        `yaml:"max_burst_requests"`
-	Min404Errors     *int        `yaml:"min_404_errors"`
-	MinErrorRatio    *float64    `yaml:"min_error_ratio"`
-	MinUniquePaths   *int        `yaml:"min_unique_paths"`
-	ScoreThreshold   *int        `yaml:"score_threshold"`
-	MinPHP404s       *int        `yaml:"min_php_404s"`
-	MaxErrorPercent  *float64    `yaml:"max_error_percent"`
-	MinSQLInjections *int        `yaml:"min_sql_injections"`
+	File             string                 `yaml:"file"`
+	JournalUnit      string                 `yaml:"journal_unit"`
+	Remotes          []string               `yaml:"remotes"`
+	SyslogListen     []string               `yaml:"syslog_listen"`
+	SyslogAllow      []string               `yaml:"syslog_allow"`
+	Since            string                 `yaml:"since"`
+	Annotations      string                 `yaml:"annotations"`
+	Resume           *bool                  `yaml:"resume"`
+	Until            string                 `yaml:"until"`
+	StrictParsing    *bool                  `yaml:"strict_parsing"`
+	CaptureLimit     *int                   `yaml:"capture_unparsed_limit"`
+	DeadLetter       string                 `yaml:"dead_letter"`
+	Workers          *int                   `yaml:"workers"`
+	Top              *int                   `yaml:"top"`
+	Color            *bool                  `yaml:"color"`
+	GeoIPDB          string                 `yaml:"geoip_db"`
+	GeoProvider      string                 `yaml:"geo_provider"`
+	GeoIPLocale      string                 `yaml:"geoip_locale"`
+	GeoIPMaxAge      string                 `yaml:"geoip_max_age"`
+	DenyOutput       string                 `yaml:"deny_output"`
+	DenyExpiry       string                 `yaml:"deny_expiry"`
+	NginxReload      *bool                  `yaml:"nginx_reload"`
+	NginxBin         string                 `yaml:"nginx_bin"`
+	BlockLog         string                 `yaml:"block_log"`
+	AllowAgents      []string               `yaml:"allow_agents"`
+	AllowAgentsShare *float64               `yaml:"allow_agents_min_share"`
+	BotCountries     []string               `yaml:"bot_countries"`
+	AllowIPs         []string               `yaml:"allow_ips"`
+	AllowCIDRs       []string               `yaml:"allow_cidrs"`
+	AllowIPFiles     []string               `yaml:"allow_ip_files"`
+	AllowSources     []AllowSourceConfig    `yaml:"allow_sources"`
+	AllowURLs        []string               `yaml:"allow_urls"`
+	SensitiveURLs    []PathLimit            `yaml:"sensitive_urls"`
+	StatusRules      []StatusRule           `yaml:"status_rules"`
+	SequenceRules    []SequenceRule         `yaml:"sequence_rules"`
+	MinRequests      *int                   `yaml:"min_requests"`
+	MaxAverageRPM    *float64               `yaml:"max_average_rpm"`
+	MaxBurstWindow   string                 `yaml:"max_burst_window"`
+	MaxBurstRequests *int                   `yaml:"max_burst_requests"`
+	Min404Errors     *int                   `yaml:"min_404_errors"`
+	MinErrorRatio    *float64               `yaml:"min_error_ratio"`
+	MinUniquePaths   *int                   `yaml:"min_unique_paths"`
+	ScoreThreshold   *int                   `yaml:"score_threshold"`
+	MinPHP404s       *int                   `yaml:"min_php_404s"`
+	MaxErrorPercent  *float64               `yaml:"max_error_percent"`
+	MinSQLInjections *int                   `yaml:"min_sql_injections"`
+	AllowMonitors    *bool                  `yaml:"allow_monitors"`
+	MonitorAgents    []string               `yaml:"monitor_agents"`
+	MonitorCIDRs     []string               `yaml:"monitor_cidrs"`
+	ClassThresholds  map[UAClass]ClassLimit `yaml:"class_thresholds"`
+	VhostScopes      map[string]VhostScope  `yaml:"vhost_scopes"`
+	Honeytokens      []string               `yaml:"honeytokens"`
+	AccountWindow    string                 `yaml:"account_travel_window"`
+	AccountCountries *int                   `yaml:"account_max_countries"`
+	AccountASNs      *int                   `yaml:"account_max_asns"`
+	AccountRequests  *int                   `yaml:"account_min_requests"`
+	AccountMaxRPM    *float64               `yaml:"account_max_average_rpm"`
+	AccountErrRatio  *float64               `yaml:"account_min_error_ratio"`
+	MinBytesServed   *int64                 `yaml:"min_bytes_served"`
+	Severity         *SeverityBoundaries    `yaml:"severity"`
+	SeverityExpiry   map[Severity]string    `yaml:"severity_expiry"`
+	DenyTemplate     string                 `yaml:"deny_comment_template"`
+	DenyMinimal      *bool                  `yaml:"deny_minimal"`
+	DenyIPv6Prefix   *int                   `yaml:"deny_ipv6_prefix"`
+	DenyFormat       string                 `yaml:"deny_format"`
+	MaxUpstreamSecs  *float64               `yaml:"max_upstream_seconds"`
+	CountrySpike     *float64               `yaml:"country_spike_factor"`
+	CountrySpikeMin  *int                   `yaml:"country_spike_min_requests"`
+	NewIPSpike       *float64               `yaml:"new_ip_spike_factor"`
+	NewIPSpikeMin    *int                   `yaml:"new_ip_spike_min"`
+	MinCacheBusters  *int                   `yaml:"min_cache_busters"`
+	CookielessPages  *int                   `yaml:"min_cookieless_pages"`
+	MinCacheMisses   *int                   `yaml:"min_cache_misses"`
+	MinLegacyTLS     *int                   `yaml:"min_legacy_tls"`
+	MinSingleCipher  *int                   `yaml:"min_single_cipher"`
+	HeaderAnomalies  *int                   `yaml:"min_header_anomalies"`
+	RawLines         *int                   `yaml:"raw_lines"`
+	MinHostHeaders   *int                   `yaml:"min_host_headers"`
+	MinQueryVariants *int                   `yaml:"min_query_variants"`
+	Peers            []string               `yaml:"peers"`
+	PeerSecret       string                 `yaml:"peer_secret"`
+	PeerExport       string                 `yaml:"peer_export"`
+	ChallengeSecret  string                 `yaml:"challenge_secret"`
+	ChallengePassed  string                 `yaml:"challenge_passed"`
+	API              APIConfig              `yaml:"api"`
+	Vhost            string                 `yaml:"vhost"`
+	Notify           NotifyConfig           `yaml:"notify"`
+	Incidents        IncidentConfig         `yaml:"incidents"`
+	StateDB          string                 `yaml:"state_db"`
+	StateRetention   string                 `yaml:"state_retention"`
+	ImportBlockLog   string                 `yaml:"import_block_log"`
+	CaptureUnparsed  string                 `yaml:"capture_unparsed"`
+	OTLPEndpoint     string                 `yaml:"otlp_endpoint"`
+	HAProxySocket    string                 `yaml:"haproxy_socket"`
+	HAProxyTable     string                 `yaml:"haproxy_table"`
+	Sample           string                 `yaml:"sample"`
+	SampleBy         string                 `yaml:"sample_by"`
+	ASNDB            string                 `yaml:"asn_db"`
+	ASNPrefixes      string                 `yaml:"asn_prefixes"`
+	ASNMinIPs        *int                   `yaml:"asn_min_ips"`
+	ASNBlock         *bool                  `yaml:"asn_block"`
+	SlowEndpoints    *int                   `yaml:"slow_endpoints"`
+	TimeFormat       string                 `yaml:"time_format"`
+	Timezone         string                 `yaml:"timezone"`
+	LogFormat        string                 `yaml:"log_format"`
+	LogTimeLayout    string                 `yaml:"log_time_layout"`
+	UTC              *bool                  `yaml:"utc"`
+	Format           string                 `yaml:"format"`
+	IgnoreWindows    []string               `yaml:"ignore_windows"`
+	IgnoreRelax      *float64               `yaml:"ignore_window_relax"`
+	HourProfiles     []string               `yaml:"hour_profiles"`
+	LearnHours       *bool                  `yaml:"learn_hour_profile"`
+	Canary           string                 `yaml:"canary"`
+	CanaryOutput     string                 `yaml:"canary_output"`
+	// Profiles holds per-site overrides selected with --profile-name.
+	Profiles map[string]yaml.Node `yaml:"profiles"`
 }
 
 // RuntimeDefaults carries non-Config defaults sourced from YAML.
 type RuntimeDefaults struct {
-	File         string
-	Top          int
-	Color        bool
-	GeoIPDB      string
-	DenyOutput   string
-	DenyExpiry   time.Duration
-	NginxReload  bool
-	NginxBin     string
-	BlockLog     string
-	AllowIPFiles []string
+	File           string
+	Top            int
+	Color          bool
+	GeoIPDB        string
+	GeoProvider    string
+	GeoIPLocale    string
+	GeoIPMaxAge    time.Duration
+	DenyOutput     string
+	DenyExpiry     time.Duration
+	NginxReload    bool
+	NginxBin       string
+	BlockLog       string
+	AllowIPFiles   []string
+	AllowSources   []AllowSourceConfig
+	SeverityExpiry map[Severity]time.Duration
+	// DenyCommentTemplate is a text/template for deny entry comments.
+	DenyCommentTemplate string
+	DenyMinimal         bool
+	DenyFormat          string
+	DenyIPv6Prefix      int
+	Peers               []string
+	PeerSecret          string
+	PeerExport          string
+	// Vhost labels the site this log belongs to for notification routing.
+	Vhost     string
+	Notify    NotifyConfig
+	Incidents IncidentConfig
+	// StateDB is the JSON file remembering bans between runs.
+	StateDB        string
+	StateRetention time.Duration
+	// ImportBlockLog seeds an empty state DB with the bans of a block log.
+	ImportBlockLog string
+	// CaptureUnparsed collects lines the parser rejects.
+	CaptureUnparsed string
+	// OTLPEndpoint is the OTLP/HTTP collector receiving spans and metrics.
+	OTLPEndpoint string
+	// HAProxySocket is the Runtime API address receiving suspects for a stick table.
+	HAProxySocket string
+	HAProxyTable  string
+	// Sample is a "1/N" fraction of entries to analyze on very busy sites,
+	// picked per request or, with SampleBy "ip", per client IP.
+	Sample   string
+	SampleBy string
+	// TimeFormat and Timezone control how report tables display timestamps.
+	TimeFormat string
+	Timezone   string
+	// Format names the log format (nginx, apache); LogFormat is an nginx
+	// log_format template, empty for combined.
+	Format    string
+	LogFormat string
+	// LogTimes sets the layout of $time_local and whether times are
+	// converted to UTC.
+	LogTimes LogTimes
+	// ASNDB enables the ASN report; with ASNBlock the announced prefixes of
+	// reported ASNs, read from ASNPrefixes, are added to the deny file.
+	ASNDB       string
+	ASNPrefixes string
+	ASNMinIPs   int
+	ASNBlock    bool
+	// SlowEndpoints is how many endpoints the slow endpoint report lists.
+	SlowEndpoints int
+	// ChallengeSecret signs challenge passes; ChallengePassed records the IPs
+	// that solved one, see `botdeny challenge serve`, and relaxes their scoring.
+	ChallengeSecret string
+	ChallengePassed string
+	// API serves the blocked set, bans and unbans over HTTP in follow mode.
+	API APIConfig
+	// LearnHourProfile lowers thresholds in hours that are usually quiet,
+	// learned in the state DB.
+	LearnHourProfile bool
+	// Canary keeps new suspects log-only in CanaryOutput for this long
+	// before they are written to the deny file.
+	Canary       time.Duration
+	CanaryOutput string
+	// JournalUnit reads the log from the systemd journal of this unit
+	// instead of File.
+	JournalUnit string
+	// Remotes are [user@]host:/path logs read over ssh instead of File.
+	Remotes []string
+	// SyslogListen are udp:// or tcp:// addresses that receive access lines
+	// in follow mode; SyslogAllow limits the senders.
+	SyslogListen []string
+	SyslogAllow  []string
+	// Since and Until restrict analysis to entries logged in that window,
+	// as durations before now or timestamps; see parseTimeBound.
+	Since string
+	Until string
+	// Annotations is a file of "IP-or-CIDR label" lines naming known clients.
+	Annotations string
+	// Resume analyzes only the lines appended to each log since the last
+	// run, as recorded in the state DB.
+	Resume bool
+	// StrictParsing stops parsing at the first rejected line instead of
+	// skipping and counting it.
+	StrictParsing bool
+	// CaptureUnparsedLimit caps how many rejected lines a run appends to
+	// CaptureUnparsed; 0 keeps them all.
+	CaptureUnparsedLimit int
+	// DeadLetter collects the entries allow rules kept out of scoring.
+	DeadLetter string
+	// Workers is the number of goroutines parsing log lines.
+	Workers int
 }
 
 // detectConfigPath extracts the --config flag from arguments before flag.Parse.
 func detectConfigPath(args []string) string {
+	return detectFlagValue(args, "config")
+}
+
+// detectProfileName extracts the --profile-name flag from arguments before flag.Parse.
+func detectProfileName(args []string) string {
+	return detectFlagValue(args, "profile-name")
+}
+
+func detectFlagValue(args []string, name string) string {
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
-		if strings.HasPrefix(arg, "--config=") {
-			return strings.TrimPrefix(arg, "--config=")
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"=")
 		}
-		if arg == "--config" || arg == "-config" {
+		if arg == "--"+name || arg == "-"+name {
 			if i+1 < len(args) {
 				return args[i+1]
 			}
@@ -82,6 +272,35 @@ func loadFileConfig(path string) (FileConfig, error) {
 	return cfg, nil
 }
 
+// loadConfigForCommand builds the detection config and runtime defaults for a
+// subcommand, optionally for a named profile.
+func loadConfigForCommand(path, profile string) (Config, RuntimeDefaults, error) {
+	var fc FileConfig
+	if path != "" {
+		loaded, err := loadFileConfig(path)
+		if err != nil {
+			return Config{}, RuntimeDefaults{}, fmt.Errorf("load config %s: %w", path, err)
+		}
+		fc = loaded
+	} else if profile != "" {
+		return Config{}, RuntimeDefaults{}, fmt.Errorf("--profile-name requires --config")
+	}
+	fc, err := fc.withProfile(profile)
+	if err != nil {
+		return Config{}, RuntimeDefaults{}, err
+	}
+
+	cfg := DefaultConfig()
+	if err := applyConfigDefaults(&cfg, fc); err != nil {
+		return Config{}, RuntimeDefaults{}, fmt.Errorf("apply config defaults: %w", err)
+	}
+	defaults, err := defaultsFromFileConfig(fc)
+	if err != nil {
+		return Config{}, RuntimeDefaults{}, fmt.Errorf("config defaults: %w", err)
+	}
+	return cfg, defaults, nil
+}
+
 func applyConfigDefaults(target *Config, fc FileConfig) error {
 	if fc.MinRequests != nil {
 		target.MinRequests = *fc.MinRequests
@@ -117,6 +336,9 @@ func applyConfigDefaults(target *Config, fc FileConfig) error {
 	if len(fc.AllowAgents) > 0 {
 		target.WhitelistAgents = dedupeStrings(append(target.WhitelistAgents, fc.AllowAgents...))
 	}
+	if fc.AllowAgentsShare != nil {
+		target.WhitelistMinShare = *fc.AllowAgentsShare
+	}
 	if len(fc.BotCountries) > 0 {
 		target.SuspiciousCountries = dedupeStrings(append(target.SuspiciousCountries, fc.BotCountries...))
 	}
@@ -138,23 +360,208 @@ func applyConfigDefaults(target *Config, fc FileConfig) error {
 	if len(fc.SensitiveURLs) > 0 {
 		target.SensitiveURLLimits = append([]PathLimit{}, fc.SensitiveURLs...)
 	}
+	if fc.AllowMonitors != nil {
+		target.AllowMonitors = *fc.AllowMonitors
+	}
+	// Monitor lists replace the built-ins so stale published ranges can be dropped.
+	if fc.MonitorAgents != nil {
+		target.MonitorAgents = dedupeStrings(append([]string{}, fc.MonitorAgents...))
+	}
+	if fc.MonitorCIDRs != nil {
+		target.MonitorCIDRs = dedupeStrings(append([]string{}, fc.MonitorCIDRs...))
+	}
+	if fc.AccountWindow != "" {
+		d, err := time.ParseDuration(fc.AccountWindow)
+		if err != nil {
+			return fmt.Errorf("parse account_travel_window: %w", err)
+		}
+		target.AccountTravelWindow = d
+	}
+	if fc.AccountCountries != nil {
+		target.AccountMaxCountries = *fc.AccountCountries
+	}
+	if fc.AccountASNs != nil {
+		target.AccountMaxASNs = *fc.AccountASNs
+	}
+	if fc.AccountRequests != nil {
+		target.AccountMinRequests = *fc.AccountRequests
+	}
+	if fc.AccountMaxRPM != nil {
+		target.AccountMaxAverageRPM = *fc.AccountMaxRPM
+	}
+	if fc.AccountErrRatio != nil {
+		target.AccountMinErrorRatio = *fc.AccountErrRatio
+	}
+	if fc.Severity != nil {
+		if err := fc.Severity.validate(); err != nil {
+			return err
+		}
+		target.Severity = *fc.Severity
+	}
+	if fc.MinCacheBusters != nil {
+		target.MinCacheBusters = *fc.MinCacheBusters
+	}
+	if fc.CookielessPages != nil {
+		target.MinCookielessPages = *fc.CookielessPages
+	}
+	if fc.MinCacheMisses != nil {
+		target.MinCacheMisses = *fc.MinCacheMisses
+	}
+	if fc.MinLegacyTLS != nil {
+		target.MinLegacyTLS = *fc.MinLegacyTLS
+	}
+	if fc.MinSingleCipher != nil {
+		target.MinSingleCipher = *fc.MinSingleCipher
+	}
+	if fc.HeaderAnomalies != nil {
+		target.MinHeaderAnomalies = *fc.HeaderAnomalies
+	}
+	if fc.RawLines != nil {
+		target.RawLines = *fc.RawLines
+	}
+	if fc.MinHostHeaders != nil {
+		target.MinHostHeaders = *fc.MinHostHeaders
+	}
+	if fc.MinQueryVariants != nil {
+		target.MinQueryVariants = *fc.MinQueryVariants
+	}
+	if fc.MaxUpstreamSecs != nil {
+		target.MaxUpstreamSeconds = *fc.MaxUpstreamSecs
+	}
+	if fc.CountrySpike != nil {
+		target.CountrySpikeFactor = *fc.CountrySpike
+	}
+	if fc.CountrySpikeMin != nil {
+		target.CountrySpikeMinRequests = *fc.CountrySpikeMin
+	}
+	if fc.NewIPSpike != nil {
+		target.NewIPSpikeFactor = *fc.NewIPSpike
+	}
+	if fc.NewIPSpikeMin != nil {
+		target.NewIPSpikeMin = *fc.NewIPSpikeMin
+	}
+	if len(fc.IgnoreWindows) > 0 {
+		windows, err := parseTimeWindows(fc.IgnoreWindows)
+		if err != nil {
+			return fmt.Errorf("ignore_windows: %w", err)
+		}
+		target.IgnoreWindows = windows
+	}
+	if fc.IgnoreRelax != nil {
+		target.IgnoreWindowRelax = *fc.IgnoreRelax
+	}
+	if len(fc.HourProfiles) > 0 {
+		profiles, err := parseHourProfiles(fc.HourProfiles)
+		if err != nil {
+			return fmt.Errorf("hour_profiles: %w", err)
+		}
+		target.HourProfiles = profiles
+	}
+	if fc.MinBytesServed != nil {
+		target.MinBytesServed = *fc.MinBytesServed
+	}
+	if len(fc.Honeytokens) > 0 {
+		target.Honeytokens = dedupeStrings(append(target.Honeytokens, fc.Honeytokens...))
+	}
+	if len(fc.ClassThresholds) > 0 {
+		if target.ClassLimits == nil {
+			target.ClassLimits = make(map[UAClass]ClassLimit, len(fc.ClassThresholds))
+		}
+		for class, limit := range fc.ClassThresholds {
+			switch class {
+			case UAClassBot, UAClassBrowser, UAClassUnknown:
+			default:
+				return fmt.Errorf("class_thresholds: unknown class %q (want bot, browser or unknown)", class)
+			}
+			target.ClassLimits[class] = limit
+		}
+	}
+	if len(fc.VhostScopes) > 0 {
+		outputs := make(map[string]string)
+		for _, name := range vhostScopeNames(fc.VhostScopes) {
+			scope := fc.VhostScopes[name]
+			if strings.TrimSpace(name) == "" {
+				return fmt.Errorf("vhost_scopes: empty scope name")
+			}
+			if scope.DenyOutput != "" {
+				if other, ok := outputs[scope.DenyOutput]; ok {
+					return fmt.Errorf("vhost_scopes: %s and %s share deny_output %s", other, name, scope.DenyOutput)
+				}
+				outputs[scope.DenyOutput] = name
+			}
+		}
+		target.VhostScopes = fc.VhostScopes
+	}
+	if len(fc.StatusRules) > 0 {
+		target.StatusRules = make([]StatusRule, len(fc.StatusRules))
+		for i, rule := range fc.StatusRules {
+			if err := rule.validate(); err != nil {
+				return fmt.Errorf("status_rules %d: %w", i+1, err)
+			}
+			target.StatusRules[i] = rule
+		}
+	}
+	if len(fc.SequenceRules) > 0 {
+		target.SequenceRules = make([]SequenceRule, len(fc.SequenceRules))
+		for i, rule := range fc.SequenceRules {
+			if err := rule.validate(); err != nil {
+				return fmt.Errorf("sequence_rules %d: %w", i+1, err)
+			}
+			target.SequenceRules[i] = rule
+		}
+	}
 	return nil
 }
 
 func defaultsFromFileConfig(fc FileConfig) (RuntimeDefaults, error) {
 	defaults := RuntimeDefaults{
-		File:         "access.log",
-		Top:          10,
-		Color:        false,
-		GeoIPDB:      fc.GeoIPDB,
-		DenyOutput:   fc.DenyOutput,
-		DenyExpiry:   7 * 24 * time.Hour,
-		NginxReload:  false,
-		NginxBin:     "nginx",
-		BlockLog:     fc.BlockLog,
-		AllowIPFiles: append([]string{}, fc.AllowIPFiles...),
+		File:            "access.log",
+		Top:             10,
+		Color:           false,
+		GeoIPDB:         fc.GeoIPDB,
+		GeoProvider:     defaultGeoProvider,
+		GeoIPLocale:     defaultGeoLocale,
+		GeoIPMaxAge:     defaultGeoMaxAge,
+		DenyOutput:      fc.DenyOutput,
+		DenyExpiry:      7 * 24 * time.Hour,
+		NginxReload:     false,
+		NginxBin:        "nginx",
+		BlockLog:        fc.BlockLog,
+		AllowIPFiles:    append([]string{}, fc.AllowIPFiles...),
+		AllowSources:    append([]AllowSourceConfig{}, fc.AllowSources...),
+		Peers:           append([]string{}, fc.Peers...),
+		PeerSecret:      fc.PeerSecret,
+		PeerExport:      fc.PeerExport,
+		ChallengeSecret: fc.ChallengeSecret,
+		ChallengePassed: fc.ChallengePassed,
+		API:             fc.API,
+		Vhost:           fc.Vhost,
+		Notify:          fc.Notify,
+		Incidents:       fc.Incidents,
+		StateDB:         fc.StateDB,
+		ImportBlockLog:  fc.ImportBlockLog,
+		Workers:         1,
 	}
 
+	if fc.GeoProvider != "" {
+		if _, err := geoProviderFor(fc.GeoProvider); err != nil {
+			return defaults, err
+		}
+		defaults.GeoProvider = fc.GeoProvider
+	}
+	if err := checkAllowSources(fc.AllowSources); err != nil {
+		return defaults, fmt.Errorf("allow_sources: %w", err)
+	}
+	if fc.GeoIPLocale != "" {
+		defaults.GeoIPLocale = fc.GeoIPLocale
+	}
+	if fc.GeoIPMaxAge != "" {
+		d, err := time.ParseDuration(fc.GeoIPMaxAge)
+		if err != nil {
+			return defaults, fmt.Errorf("parse geoip_max_age: %w", err)
+		}
+		defaults.GeoIPMaxAge = d
+	}
 	if fc.File != "" {
 		defaults.File = fc.File
 	}
@@ -171,6 +578,51 @@ func defaultsFromFileConfig(fc FileConfig) (RuntimeDefaults, error) {
 		}
 		defaults.DenyExpiry = d
 	}
+	if len(fc.SeverityExpiry) > 0 {
+		defaults.SeverityExpiry = make(map[Severity]time.Duration, len(fc.SeverityExpiry))
+		for severity, raw := range fc.SeverityExpiry {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return defaults, fmt.Errorf("parse severity_expiry.%s: %w", severity, err)
+			}
+			defaults.SeverityExpiry[severity] = d
+		}
+	}
+	if err := fc.Notify.validate(); err != nil {
+		return defaults, err
+	}
+	if err := fc.Incidents.validate(); err != nil {
+		return defaults, err
+	}
+	if err := fc.API.validate(); err != nil {
+		return defaults, err
+	}
+	defaults.StateRetention = defaultStateRetention
+	if fc.StateRetention != "" {
+		d, err := time.ParseDuration(fc.StateRetention)
+		if err != nil {
+			return defaults, fmt.Errorf("parse state_retention: %w", err)
+		}
+		defaults.StateRetention = d
+	}
+	if fc.DenyTemplate != "" {
+		defaults.DenyCommentTemplate = fc.DenyTemplate
+	}
+	if fc.DenyMinimal != nil {
+		defaults.DenyMinimal = *fc.DenyMinimal
+	}
+	if fc.DenyIPv6Prefix != nil {
+		if err := checkIPv6Prefix(*fc.DenyIPv6Prefix); err != nil {
+			return defaults, fmt.Errorf("deny_ipv6_prefix: %w", err)
+		}
+		defaults.DenyIPv6Prefix = *fc.DenyIPv6Prefix
+	}
+	if fc.DenyFormat != "" {
+		if _, err := denyFormatFor(fc.DenyFormat); err != nil {
+			return defaults, fmt.Errorf("deny_format: %w", err)
+		}
+		defaults.DenyFormat = fc.DenyFormat
+	}
 	if fc.NginxReload != nil {
 		defaults.NginxReload = *fc.NginxReload
 	}
@@ -180,6 +632,112 @@ func defaultsFromFileConfig(fc FileConfig) (RuntimeDefaults, error) {
 	if fc.BlockLog != "" {
 		defaults.BlockLog = fc.BlockLog
 	}
+	if fc.CaptureUnparsed != "" {
+		defaults.CaptureUnparsed = fc.CaptureUnparsed
+	}
+	defaults.OTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if fc.OTLPEndpoint != "" {
+		defaults.OTLPEndpoint = fc.OTLPEndpoint
+	}
+	defaults.HAProxySocket = fc.HAProxySocket
+	display, err := parseTimeDisplay(fc.TimeFormat, fc.Timezone)
+	if err != nil {
+		return defaults, err
+	}
+	defaults.TimeFormat = fc.TimeFormat
+	defaults.Timezone = fc.Timezone
+	if fc.Sample != "" {
+		if _, err := parseSampleRate(fc.Sample); err != nil {
+			return defaults, fmt.Errorf("sample: %w", err)
+		}
+		defaults.Sample = fc.Sample
+	}
+	defaults.SampleBy = SampleByRequest
+	if fc.SampleBy != "" {
+		if err := checkSampleBy(fc.SampleBy); err != nil {
+			return defaults, fmt.Errorf("sample_by: %w", err)
+		}
+		defaults.SampleBy = fc.SampleBy
+	}
+	defaults.HAProxyTable = "botdeny"
+	if fc.HAProxyTable != "" {
+		defaults.HAProxyTable = fc.HAProxyTable
+	}
+	defaults.LogTimes.Layout = fc.LogTimeLayout
+	if fc.UTC != nil {
+		defaults.LogTimes.UTC = *fc.UTC
+	}
+	if _, err := logFormatFor(fc.Format, fc.LogFormat, defaults.LogTimes); err != nil {
+		return defaults, err
+	}
+	defaults.Format = fc.Format
+	defaults.LogFormat = fc.LogFormat
+	defaults.ASNDB = fc.ASNDB
+	defaults.ASNPrefixes = fc.ASNPrefixes
+	defaults.ASNMinIPs = 5
+	if fc.ASNMinIPs != nil {
+		defaults.ASNMinIPs = *fc.ASNMinIPs
+	}
+	if fc.ASNBlock != nil {
+		defaults.ASNBlock = *fc.ASNBlock
+	}
+	defaults.SlowEndpoints = 10
+	if fc.SlowEndpoints != nil {
+		defaults.SlowEndpoints = *fc.SlowEndpoints
+	}
+	if fc.LearnHours != nil {
+		defaults.LearnHourProfile = *fc.LearnHours
+	}
+	if fc.Canary != "" {
+		d, err := time.ParseDuration(fc.Canary)
+		if err != nil {
+			return defaults, fmt.Errorf("parse canary: %w", err)
+		}
+		defaults.Canary = d
+	}
+	defaults.CanaryOutput = fc.CanaryOutput
+	defaults.JournalUnit = fc.JournalUnit
+	for _, spec := range fc.Remotes {
+		if _, err := parseRemoteLog(spec); err != nil {
+			return defaults, err
+		}
+	}
+	defaults.Remotes = append([]string{}, fc.Remotes...)
+	for _, spec := range fc.SyslogListen {
+		if _, _, err := parseSyslogListen(spec); err != nil {
+			return defaults, err
+		}
+	}
+	if _, err := parseSyslogAllow(fc.SyslogAllow); err != nil {
+		return defaults, err
+	}
+	defaults.SyslogListen = append([]string{}, fc.SyslogListen...)
+	defaults.SyslogAllow = append([]string{}, fc.SyslogAllow...)
+	if _, _, err := parseTimeBounds(fc.Since, fc.Until, time.Now(), display.Location); err != nil {
+		return defaults, err
+	}
+	defaults.Annotations = fc.Annotations
+	if fc.Resume != nil {
+		defaults.Resume = *fc.Resume
+	}
+	defaults.Since = fc.Since
+	defaults.Until = fc.Until
+	if fc.StrictParsing != nil {
+		defaults.StrictParsing = *fc.StrictParsing
+	}
+	if fc.CaptureLimit != nil {
+		if *fc.CaptureLimit < 0 {
+			return defaults, fmt.Errorf("capture_unparsed_limit must not be negative")
+		}
+		defaults.CaptureUnparsedLimit = *fc.CaptureLimit
+	}
+	defaults.DeadLetter = fc.DeadLetter
+	if fc.Workers != nil {
+		if *fc.Workers < 1 {
+			return defaults, fmt.Errorf("workers must be at least 1")
+		}
+		defaults.Workers = *fc.Workers
+	}
 	return defaults, nil
 }
 
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renamedConfigKeys maps keys of older config layouts, named after the
+// detection settings or the command-line flags, to their current names.
+var renamedConfigKeys = map[string]string{
+	"whitelist_agents":     "allow_agents",
+	"allowed_ips":          "allow_ips",
+	"allowed_cidrs":        "allow_cidrs",
+	"allowed_uris":         "allow_urls",
+	"allowed_urls":         "allow_urls",
+	"suspicious_countries": "bot_countries",
+	"sensitive_url_limits": "sensitive_urls",
+	"max_rpm":              "max_average_rpm",
+	"error_ratio":          "min_error_ratio",
+	"unique_paths":         "min_unique_paths",
+	"sql_injections":       "min_sql_injections",
+	"burst":                "max_burst_requests",
+	"burst_window":         "max_burst_window",
+	"threshold":            "score_threshold",
+	"output":               "deny_output",
+	"geoip":                "geoip_db",
+}
+
+// ConfigChange is one thing config migrate changed or could not fix.
+type ConfigChange struct {
+	Line    int
+	Message string
+	// Unknown marks keys left in place that botdeny ignores.
+	Unknown bool
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("line %d: %s", c.Line, c.Message)
+}
+
+// configKeyTypes returns the type of each top-level config key.
+func configKeyTypes() map[string]reflect.Type {
+	t := reflect.TypeOf(FileConfig{})
+	types := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			types[name] = field.Type
+		}
+	}
+	return types
+}
+
+// migrateConfig upgrades a config file to the current layout: renamed keys
+// get their current names, comma-separated strings become lists where a
+// list is expected, and "/path=COUNT" sensitive_urls entries become
+// prefix/threshold mappings. Profiles are migrated the same way. Unknown
+// keys are reported and kept. Comments are preserved.
+func migrateConfig(data []byte) ([]byte, []ConfigChange, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return data, nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("line %d: config is not a mapping", root.Line)
+	}
+	types := configKeyTypes()
+	changes := migrateConfigMapping(root, types, "")
+	if profiles := mappingValue(root, "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			if profile := profiles.Content[i+1]; profile.Kind == yaml.MappingNode {
+				prefix := "profiles." + profiles.Content[i].Value + "."
+				changes = append(changes, migrateConfigMapping(profile, types, prefix)...)
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Line < changes[j].Line })
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, nil, err
+	}
+	var check FileConfig
+	if err := yaml.Unmarshal(out.Bytes(), &check); err != nil {
+		return nil, changes, fmt.Errorf("migrated config does not load: %w", err)
+	}
+	return out.Bytes(), changes, nil
+}
+
+func migrateConfigMapping(m *yaml.Node, types map[string]reflect.Type, prefix string) []ConfigChange {
+	var changes []ConfigChange
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key, value := m.Content[i], m.Content[i+1]
+		name := key.Value
+		if _, known := types[name]; !known {
+			current := currentConfigKey(name, types)
+			switch {
+			case current == "":
+				message := fmt.Sprintf("unknown key %s%s is ignored", prefix, name)
+				if guess := closestConfigKey(name, types); guess != "" {
+					message += fmt.Sprintf(" (did you mean %s?)", guess)
+				}
+				changes = append(changes, ConfigChange{Line: key.Line, Message: message, Unknown: true})
+				continue
+			case mappingValue(m, current) != nil:
+				changes = append(changes, ConfigChange{Line: key.Line, Unknown: true,
+					Message: fmt.Sprintf("%s%s is deprecated and %s%s is also set; remove it", prefix, name, prefix, current)})
+				continue
+			}
+			changes = append(changes, ConfigChange{Line: key.Line, Message: fmt.Sprintf("renamed %s%s to %s", prefix, name, current)})
+			key.Value = current
+			name = current
+		}
+		changes = append(changes, migrateConfigValue(prefix+name, key, value, types[name])...)
+	}
+	return changes
+}
+
+// currentConfigKey returns the current name of a renamed or flag-style key,
+// or "".
+func currentConfigKey(name string, types map[string]reflect.Type) string {
+	normalized := strings.ReplaceAll(strings.ToLower(name), "-", "_")
+	if current, ok := renamedConfigKeys[normalized]; ok {
+		return current
+	}
+	if _, ok := types[normalized]; ok {
+		return normalized
+	}
+	return ""
+}
+
+// migrateConfigValue rewrites values in layouts the key no longer accepts.
+func migrateConfigValue(name string, key, value *yaml.Node, t reflect.Type) []ConfigChange {
+	var changes []ConfigChange
+	if t.Kind() == reflect.Slice && value.Kind == yaml.ScalarNode && value.Tag == "!!str" {
+		items := make([]*yaml.Node, 0)
+		for _, item := range strings.Split(value.Value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		changes = append(changes, ConfigChange{Line: value.Line, Message: fmt.Sprintf("split %s into a list of %d", name, len(items))})
+		// A comment after the string stays on the key's line.
+		if key.LineComment == "" {
+			key.LineComment = value.LineComment
+		}
+		*value = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items, Line: value.Line}
+	}
+	if t == reflect.TypeOf([]PathLimit(nil)) && value.Kind == yaml.SequenceNode {
+		for i, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				continue
+			}
+			prefix, count, ok := strings.Cut(item.Value, "=")
+			if !ok {
+				continue
+			}
+			value.Content[i] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: item.Line, Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "prefix"},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.TrimSpace(prefix)},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "threshold"},
+				{Kind: yaml.ScalarNode, Tag: "!!int", Value: strings.TrimSpace(count)},
+			}}
+			changes = append(changes, ConfigChange{Line: item.Line, Message: fmt.Sprintf("converted %s entry %s to prefix and threshold", name, item.Value)})
+		}
+	}
+	return changes
+}
+
+// mappingValue returns the value of key in mapping m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// closestConfigKey suggests the known key within two edits of name, if any.
+func closestConfigKey(name string, types map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for known := range types {
+		if d := editDistance(name, known); d < bestDistance || (d == bestDistance && known < best) {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// configKeyWarning summarizes what config migrate would change in a config
+// file, or returns "" when it is current.
+func configKeyWarning(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	_, changes, err := migrateConfig(data)
+	if err != nil || len(changes) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("config %s uses %d deprecated or unknown settings, starting with %s; run botdeny config migrate %s", path, len(changes), changes[0], path)
+}
+
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny config migrate [--write] config.yaml")
+		return 2
+	}
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	write := fs.Bool("write", false, "rewrite the file in place, keeping the original as FILE.bak, instead of printing the result")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: botdeny config migrate [--write] config.yaml")
+		return 2
+	}
+	path := fs.Arg(0)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	migrated, changes, err := migrateConfig(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", path, err)
+		return 1
+	}
+	unknown := 0
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, change.Line, change.Message)
+		if change.Unknown {
+			unknown++
+		}
+	}
+	if !*write {
+		os.Stdout.Write(migrated)
+	} else if len(changes) > unknown {
+		if err := os.WriteFile(path+".bak", data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := os.WriteFile(path, migrated, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "wrote %s (original kept as %s.bak)\n", path, path)
+	}
+	if unknown > 0 {
+		return 1
+	}
+	return 0
+}
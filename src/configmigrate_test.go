@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	old := `# thresholds
+max-rpm: 120
+whitelist_agents: "Googlebot, FriendlyCrawler" # trusted
+allowed_ips:
+  - 192.0.2.1
+sensitive_urls:
+  - /login=5
+  - prefix: /admin
+    threshold: 3
+min_reqests: 40
+profiles:
+  blog:
+    threshold: 3
+`
+	migrated, changes, err := migrateConfig([]byte(old))
+	if err != nil {
+		t.Fatalf("migrateConfig: %v", err)
+	}
+	want := `# thresholds
+max_average_rpm: 120
+allow_agents: # trusted
+  - Googlebot
+  - FriendlyCrawler
+allow_ips:
+  - 192.0.2.1
+sensitive_urls:
+  - prefix: /login
+    threshold: 5
+  - prefix: /admin
+    threshold: 3
+min_reqests: 40
+profiles:
+  blog:
+    score_threshold: 3
+`
+	if string(migrated) != want {
+		t.Fatalf("unexpected migrated config:\n%s", migrated)
+	}
+	messages := make([]string, 0, len(changes))
+	unknown := 0
+	for _, change := range changes {
+		messages = append(messages, change.String())
+		if change.Unknown {
+			unknown++
+		}
+	}
+	joined := strings.Join(messages, "\n")
+	for _, expected := range []string{
+		"line 2: renamed max-rpm to max_average_rpm",
+		"line 3: split allow_agents into a list of 2",
+		"line 7: converted sensitive_urls entry /login=5 to prefix and threshold",
+		"line 10: unknown key min_reqests is ignored (did you mean min_requests?)",
+		"line 13: renamed profiles.blog.threshold to score_threshold",
+	} {
+		if !strings.Contains(joined, expected) {
+			t.Fatalf("expected %q in changes:\n%s", expected, joined)
+		}
+	}
+	if unknown != 1 {
+		t.Fatalf("expected one unknown key, got %d", unknown)
+	}
+
+	var cfg FileConfig
+	if err := yaml.Unmarshal(migrated, &cfg); err != nil {
+		t.Fatalf("load migrated config: %v", err)
+	}
+	if *cfg.MaxAverageRPM != 120 || len(cfg.AllowAgents) != 2 || cfg.SensitiveURLs[0] != (PathLimit{Prefix: "/login", Threshold: 5}) {
+		t.Fatalf("unexpected migrated values %+v", cfg)
+	}
+}
+
+func TestMigrateConfigKeepsConflictsAndCurrentConfigs(t *testing.T) {
+	_, changes, err := migrateConfig([]byte("allow_ips: [192.0.2.1]\nallowed_ips: [192.0.2.2]\n"))
+	if err != nil {
+		t.Fatalf("migrateConfig: %v", err)
+	}
+	if len(changes) != 1 || !changes[0].Unknown || !strings.Contains(changes[0].Message, "allow_ips is also set") {
+		t.Fatalf("expected a conflict to be reported, got %+v", changes)
+	}
+
+	current := "min_requests: 40\nallow_agents:\n  - Googlebot\n"
+	migrated, changes, err := migrateConfig([]byte(current))
+	if err != nil || len(changes) != 0 || string(migrated) != current {
+		t.Fatalf("expected a current config to be unchanged, got %q %+v %v", migrated, changes, err)
+	}
+}
+
+func TestRunConfigMigrateWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "botdeny.yaml")
+	if err := os.WriteFile(path, []byte("max_rpm: 60\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runConfig([]string{"migrate", "--write", path}); code != 0 {
+		t.Fatalf("expected exit 0, got %d", code)
+	}
+	data, _ := os.ReadFile(path)
+	backup, _ := os.ReadFile(path + ".bak")
+	if string(data) != "max_average_rpm: 60\n" || string(backup) != "max_rpm: 60\n" {
+		t.Fatalf("unexpected files %q %q", data, backup)
+	}
+	if warning := configKeyWarning(path); warning != "" {
+		t.Fatalf("expected no warning for a migrated config, got %q", warning)
+	}
+}
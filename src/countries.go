@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// countryBaselineAlpha weights the latest run in the per-country moving average.
+	countryBaselineAlpha = 0.2
+	// countryBaselineMinRuns is how many runs the state DB must have recorded
+	// before country baselines are trusted.
+	countryBaselineMinRuns = 3
+	// countryBaselineFloor drops countries whose baseline decayed below this rate.
+	countryBaselineFloor = 0.01
+)
+
+// CountryBaseline is the typical traffic of a country, learned across runs.
+type CountryBaseline struct {
+	// RequestsPerHour is an exponentially weighted average over recorded runs.
+	RequestsPerHour float64   `json:"requests_per_hour"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// CountrySpike is a country sending far more traffic than its baseline.
+type CountrySpike struct {
+	Country  string
+	Requests int
+	Rate     float64
+	Baseline float64
+	IPs      int
+}
+
+// CountryRates returns requests per hour by country ISO code over the analyzed window.
+func (a *Analyzer) CountryRates() map[string]float64 {
+	requests, _, window := a.countryTotals()
+	rates := make(map[string]float64, len(requests))
+	for country, count := range requests {
+		rates[country] = float64(count) / window.Hours()
+	}
+	return rates
+}
+
+// countryTotals sums requests and IPs per country and returns the analyzed
+// window, at least one minute long.
+func (a *Analyzer) countryTotals() (map[string]int, map[string]int, time.Duration) {
+	requests := make(map[string]int)
+	ips := make(map[string]int)
+	var first, last time.Time
+	for _, stat := range a.stats {
+		if first.IsZero() || stat.FirstSeen.Before(first) {
+			first = stat.FirstSeen
+		}
+		if stat.LastSeen.After(last) {
+			last = stat.LastSeen
+		}
+		if stat.CountryISO == "" {
+			continue
+		}
+		requests[stat.CountryISO] += stat.Requests
+		ips[stat.CountryISO]++
+	}
+	return requests, ips, max(time.Minute, last.Sub(first))
+}
+
+// CountrySpikes lists countries whose request rate is at least
+// CountrySpikeFactor times their baseline, largest jump first. Countries
+// missing from the baselines count as sending no traffic. Nothing is reported
+// until baselines have been learned.
+func (a *Analyzer) CountrySpikes() []CountrySpike {
+	if a.cfg.CountrySpikeFactor <= 0 || a.cfg.CountryBaselines == nil {
+		return nil
+	}
+	requests, ips, window := a.countryTotals()
+	spikes := make([]CountrySpike, 0)
+	for country, count := range requests {
+		if count < a.cfg.CountrySpikeMinRequests {
+			continue
+		}
+		rate := float64(count) / window.Hours()
+		baseline := a.cfg.CountryBaselines[country]
+		if rate < baseline*a.cfg.CountrySpikeFactor {
+			continue
+		}
+		spikes = append(spikes, CountrySpike{Country: country, Requests: count, Rate: rate, Baseline: baseline, IPs: ips[country]})
+	}
+	sort.Slice(spikes, func(i, j int) bool {
+		ri, rj := spikes[i].Rate/max(spikes[i].Baseline, countryBaselineFloor), spikes[j].Rate/max(spikes[j].Baseline, countryBaselineFloor)
+		if ri != rj {
+			return ri > rj
+		}
+		return spikes[i].Country < spikes[j].Country
+	})
+	return spikes
+}
+
+// countrySpike returns the spike for country, computing spikes once per analysis.
+func (a *Analyzer) countrySpike(country string) (CountrySpike, bool) {
+	if country == "" || a.cfg.CountryBaselines == nil {
+		return CountrySpike{}, false
+	}
+	if a.spikes == nil {
+		a.spikes = make(map[string]CountrySpike)
+		for _, spike := range a.CountrySpikes() {
+			a.spikes[spike.Country] = spike
+		}
+	}
+	spike, ok := a.spikes[country]
+	return spike, ok
+}
+
+// describe renders the spike for reasons and reports.
+func (s CountrySpike) describe() string {
+	return fmt.Sprintf("country %s spiking: %.0f req/h vs baseline %.1f", s.Country, s.Rate, s.Baseline)
+}
+
+// CountryBaselines returns the learned baselines in requests per hour, or nil
+// while fewer than countryBaselineMinRuns runs have been recorded.
+func (db *StateDB) CountryBaselines() map[string]float64 {
+	if db.CountryRuns < countryBaselineMinRuns {
+		return nil
+	}
+	baselines := make(map[string]float64, len(db.Countries))
+	for country, baseline := range db.Countries {
+		baselines[country] = baseline.RequestsPerHour
+	}
+	return baselines
+}
+
+// RecordCountryRates folds one run's per-country rates into the baselines.
+// Countries absent from the run decay towards zero and are eventually dropped.
+func (db *StateDB) RecordCountryRates(rates map[string]float64) {
+	if db.Countries == nil {
+		db.Countries = make(map[string]CountryBaseline)
+	}
+	now := time.Now().UTC()
+	for country, baseline := range db.Countries {
+		if _, ok := rates[country]; ok {
+			continue
+		}
+		baseline.RequestsPerHour *= 1 - countryBaselineAlpha
+		if baseline.RequestsPerHour < countryBaselineFloor {
+			delete(db.Countries, country)
+			continue
+		}
+		db.Countries[country] = baseline
+	}
+	for country, rate := range rates {
+		baseline, ok := db.Countries[country]
+		if !ok && db.CountryRuns == 0 {
+			// The first run seeds the baselines instead of averaging against zero.
+			baseline.RequestsPerHour = rate
+		} else {
+			baseline.RequestsPerHour += countryBaselineAlpha * (rate - baseline.RequestsPerHour)
+		}
+		baseline.UpdatedAt = now
+		db.Countries[country] = baseline
+	}
+	db.CountryRuns++
+}
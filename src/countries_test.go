@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCountryBaselinesLearnAcrossRuns(t *testing.T) {
+	db, err := openStateDB(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 0; i < countryBaselineMinRuns-1; i++ {
+		db.RecordCountryRates(map[string]float64{"US": 1000, "FR": 10})
+		if db.CountryBaselines() != nil {
+			t.Fatalf("baselines must not be used after only %d runs", db.CountryRuns)
+		}
+	}
+	db.RecordCountryRates(map[string]float64{"US": 2000})
+	baselines := db.CountryBaselines()
+	if got := baselines["US"]; got != 1200 {
+		t.Fatalf("expected US baseline to move 20%% towards 2000, got %.1f", got)
+	}
+	if got := baselines["FR"]; got != 8 {
+		t.Fatalf("expected absent FR baseline to decay to 8, got %.1f", got)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	reloaded, err := openStateDB(db.path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reloaded.CountryRuns != countryBaselineMinRuns || reloaded.Countries["US"].RequestsPerHour != 1200 {
+		t.Fatalf("baselines not persisted: %+v", reloaded.Countries)
+	}
+}
+
+func TestCountrySpikeRule(t *testing.T) {
+	geo := func(ip string) (GeoInfo, bool) {
+		if ip[:7] == "192.0.2" {
+			return GeoInfo{CountryISO: "VN"}, true
+		}
+		return GeoInfo{CountryISO: "US"}, true
+	}
+	cfg := DefaultConfig()
+	cfg.CountryBaselines = map[string]float64{"US": 500, "VN": 2}
+	analyzer := New(cfg, geo)
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	// 40 botnet IPs, 60 requests each over an hour, all served successfully.
+	for i := 0; i < 40; i++ {
+		for j := 0; j < 60; j++ {
+			analyzer.Process(Entry{ClientIP: fmt.Sprintf("192.0.2.%d", i), Time: start.Add(time.Duration(j) * time.Minute), URI: "/", Status: 200})
+		}
+	}
+	analyzer.Process(Entry{ClientIP: "198.51.100.1", Time: start, URI: "/", Status: 200})
+
+	spikes := analyzer.CountrySpikes()
+	if len(spikes) != 1 || spikes[0].Country != "VN" || spikes[0].IPs != 40 {
+		t.Fatalf("expected a single VN spike, got %+v", spikes)
+	}
+	suspect, _, _ := analyzer.Explain("192.0.2.1")
+	if !containsStringCI(RuleCountrySpike, suspect.Rules) {
+		t.Fatalf("expected country_spike rule, got %v", suspect.Rules)
+	}
+
+	cfg.CountryBaselines = nil
+	quiet := New(cfg, geo)
+	quiet.Process(Entry{ClientIP: "192.0.2.1", Time: start, URI: "/", Status: 200})
+	if spikes := quiet.CountrySpikes(); spikes != nil {
+		t.Fatalf("expected no spikes without baselines, got %+v", spikes)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// DeadLetter appends the entries allow rules kept out of scoring to a file,
+// one "rule<TAB>match<TAB>line" record each, so admins can audit whether an
+// allowlist hides malicious traffic.
+type DeadLetter struct {
+	fh      *os.File
+	w       *bufio.Writer
+	Entries int
+}
+
+func openDeadLetter(path string) (*DeadLetter, error) {
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetter{fh: fh, w: bufio.NewWriter(fh)}, nil
+}
+
+// Record appends entry when analyzer excludes it, and reports whether it did.
+func (d *DeadLetter) Record(analyzer *Analyzer, entry Entry) bool {
+	rule, match := analyzer.exclusion(entry)
+	if rule == "" {
+		return false
+	}
+	line := entry.Raw
+	if line == "" {
+		line = fmt.Sprintf("%s %s %s %d", entry.ClientIP, entry.Method, entry.URI, entry.Status)
+	}
+	fmt.Fprintf(d.w, "%s\t%s\t%s\n", rule, match, line)
+	d.Entries++
+	return true
+}
+
+// Flush writes buffered records, so follow mode shows them every tick.
+func (d *DeadLetter) Flush() error {
+	return d.w.Flush()
+}
+
+// Close flushes recorded entries to disk.
+func (d *DeadLetter) Close() error {
+	if err := d.w.Flush(); err != nil {
+		d.fh.Close()
+		return err
+	}
+	return d.fh.Close()
+}
+
+// exclusion names the allow rule keeping entry out of scoring and what it
+// matched, or returns "" when the entry is scored. URL and monitor rules
+// drop the entry in Process; allowlisted IPs are tracked but never flagged,
+// and so are IPs mostly sending trusted agents, see whitelistedAgent.
+func (a *Analyzer) exclusion(entry Entry) (rule, match string) {
+	if prefix := a.allowedURIPrefix(normalizeURI(entry.URI)); prefix != "" {
+		return "allow_urls", prefix
+	}
+	ip := entry.ClientIP
+	if ip == "" {
+		ip = entry.RemoteAddr
+	}
+	if entry.UserAgent != "" {
+		if agent := matchSubstring(entry.UserAgent, a.cfg.WhitelistAgents); agent != "" {
+			return "allow_agents", agent
+		}
+		if agent := a.monitorAgent(ip, entry.UserAgent); agent != "" {
+			return "monitor_agents", agent
+		}
+	}
+	if allowed := a.allowedBy(ip); allowed != "" {
+		return "allowlist", allowed
+	}
+	return "", ""
+}
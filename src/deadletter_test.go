@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterRecordsExcludedEntries(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowedURIs = []string{"/health"}
+	cfg.AllowedCIDRs = []string{"10.0.0.0/8"}
+	analyzer := New(cfg, nil)
+
+	path := filepath.Join(t.TempDir(), "dead-letter.log")
+	deadLetter, err := openDeadLetter(path)
+	if err != nil {
+		t.Fatalf("openDeadLetter: %v", err)
+	}
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{ClientIP: "192.0.2.7", URI: "/health/live", UserAgent: "kube-probe", Raw: "health check"},
+		{ClientIP: "192.0.2.8", URI: "/", UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1)", Raw: "crawler"},
+		{ClientIP: "69.162.124.231", URI: "/", UserAgent: "Mozilla/5.0+(compatible; UptimeRobot/2.0)", Raw: "monitor"},
+		{ClientIP: "10.1.2.3", URI: "/wp-login.php", UserAgent: "curl/8.0", Raw: "office"},
+		{ClientIP: "192.0.2.10", URI: "/wp-login.php", UserAgent: "curl/8.0", Raw: "scored"},
+	}
+	for _, entry := range entries {
+		entry.Time = now
+		deadLetter.Record(analyzer, entry)
+	}
+	if err := deadLetter.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	want := "allow_urls\t/health\thealth check\n" +
+		"allow_agents\tGooglebot\tcrawler\n" +
+		"monitor_agents\tUptimeRobot\tmonitor\n" +
+		"allowlist\t10.0.0.0/8\toffice\n"
+	if string(data) != want {
+		t.Fatalf("unexpected dead-letter file:\n%s", data)
+	}
+	if deadLetter.Entries != 4 {
+		t.Fatalf("expected 4 recorded entries, got %d", deadLetter.Entries)
+	}
+}
+
+func TestFollowerRecordsDeadLettersOnce(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowedURIs = []string{"/health"}
+	path := filepath.Join(t.TempDir(), "dead-letter.log")
+	deadLetter, err := openDeadLetter(path)
+	if err != nil {
+		t.Fatalf("openDeadLetter: %v", err)
+	}
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:     time.Hour,
+		Interval:   time.Minute,
+		DenyOutput: filepath.Join(t.TempDir(), "deny.conf"),
+		DeadLetter: deadLetter,
+	})
+	now := time.Now()
+	follower.Add(Entry{ClientIP: "192.0.2.7", Time: now, URI: "/health", Raw: "probe"}, now)
+	for i := 0; i < 3; i++ {
+		if _, err := follower.Tick(now.Add(time.Duration(i) * time.Minute)); err != nil {
+			t.Fatalf("tick: %v", err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "probe") != 1 {
+		t.Fatalf("expected the entry once after the first tick, got:\n%s", data)
+	}
+	deadLetter.Close()
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// windowsRuleChunk caps the addresses per Windows Firewall rule; netsh rejects
+// very long remoteip lists.
+const windowsRuleChunk = 200
+
+// denyItem is one validated deny target with its rendered comment.
+type denyItem struct {
+	IP      string
+	Comment string
+	Expires time.Time
+}
+
+// denyFormat renders deny entries for a firewall or proxy.
+type denyFormat struct {
+	// Usage is an optional header hint on how to load the file; %s is the output path.
+	Usage string
+	// CommentPrefix starts header comment lines; empty means "#".
+	CommentPrefix string
+	// NoComments marks formats that cannot hold comments, such as JSON.
+	NoComments bool
+	// Managed marks formats whose entries go between BEGIN/END markers, so
+	// the rest of the file and `deny` lines tagged "# manual" survive a
+	// rewrite.
+	Managed bool
+	Render  func(b *strings.Builder, items []denyItem, opts DenyOptions)
+}
+
+// comment renders a header comment line in the format's syntax.
+func (f denyFormat) comment(text string) string {
+	prefix := f.CommentPrefix
+	if prefix == "" {
+		prefix = "#"
+	}
+	return prefix + " " + text + "\n"
+}
+
+var denyFormats = map[string]denyFormat{
+	"nginx": {Managed: true, Render: renderNginxDeny},
+	"pf": {
+		Usage:  "load with: pfctl -t botdeny -T replace -f %s",
+		Render: renderPFTable,
+	},
+	"netsh": {
+		Usage:  "apply with: netsh -f %s",
+		Render: renderNetshScript,
+	},
+	"powershell": {
+		Usage:  "apply with: powershell -ExecutionPolicy Bypass -File %s",
+		Render: renderPowerShellScript,
+	},
+	"lua": {
+		Usage:         "load from an OpenResty timer with loadfile(\"%s\"), see README",
+		CommentPrefix: "--",
+		Render:        renderLuaTable,
+	},
+	"varnish": {
+		Usage:  "include \"%s\"; before your own vcl_recv",
+		Render: renderVarnishACL,
+	},
+	"haproxy": {
+		Usage:  "use with: http-request deny if { src -f %s }",
+		Render: renderHAProxyACL,
+	},
+	"caddy": {
+		Usage:  "import %s inside a site block",
+		Render: renderCaddySnippet,
+	},
+	"nginx-challenge": {
+		Usage:  "include %s in the http block and see the README for the server block",
+		Render: renderNginxChallenge,
+	},
+	"nginx-canary": {
+		Usage:  "include %s in the http block and log $botdeny_canary",
+		Render: renderNginxCanary,
+	},
+	"aws-waf": {
+		NoComments: true,
+		Render:     renderAWSWAFAddresses,
+	},
+}
+
+// denyFormatFor resolves a --deny-format name; empty selects nginx.
+func denyFormatFor(name string) (denyFormat, error) {
+	if name == "" {
+		name = "nginx"
+	}
+	format, ok := denyFormats[strings.ToLower(name)]
+	if !ok {
+		return denyFormat{}, fmt.Errorf("unknown deny format %q (want %s)", name, strings.Join(denyFormatNames(), ", "))
+	}
+	return format, nil
+}
+
+func denyFormatNames() []string {
+	names := make([]string, 0, len(denyFormats))
+	for name := range denyFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkIPv6Prefix validates a deny_ipv6_prefix length; 0 turns it off.
+func checkIPv6Prefix(bits int) error {
+	if bits < 0 || bits > 128 {
+		return fmt.Errorf("prefix length %d is not between 0 and 128", bits)
+	}
+	return nil
+}
+
+// widenIPv6 returns the covering /bits prefix of an IPv6 address, since
+// clients rotate freely within their assigned /64. IPv4 addresses, ranges
+// and a zero length are returned as they are.
+func widenIPv6(target string, bits int) string {
+	if bits <= 0 || bits >= 128 {
+		return target
+	}
+	addr, err := netip.ParseAddr(target)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return target
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return target
+	}
+	return prefix.String()
+}
+
+// Markers around the entries botdeny writes into an nginx deny file. Lines
+// outside them are left as they are.
+const (
+	denyBlockBegin = "# BEGIN botdeny"
+	denyBlockEnd   = "# END botdeny"
+)
+
+// manualDenyComment matches the "# manual" tag of a hand-added deny line.
+var manualDenyComment = regexp.MustCompile(`#\s*manual\b`)
+
+// managedDenyFile is an existing deny file split around its managed block.
+type managedDenyFile struct {
+	// Marked is set when the file has a BEGIN/END block; without one the
+	// whole file is the previous output.
+	Marked        bool
+	Before, After string
+	// Manual holds the `deny` lines inside the block tagged "# manual".
+	Manual []string
+	// Targets lists the targets of Manual and of every `deny` line outside
+	// the block, which generated entries skip.
+	Targets map[string]bool
+}
+
+// readManagedDenyFile reads path for writeDenyFile. A missing file is empty.
+func readManagedDenyFile(path string) (managedDenyFile, error) {
+	file := managedDenyFile{Targets: make(map[string]bool)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return file, err
+	}
+	text := string(data)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	block := text
+	// The markers must be whole lines.
+	if begin := strings.Index("\n"+text, "\n"+denyBlockBegin+"\n"); begin >= 0 {
+		if end := strings.Index(text[begin:], "\n"+denyBlockEnd+"\n"); end >= 0 {
+			end += begin + 1
+			file.Marked = true
+			file.Before = text[:begin]
+			file.After = text[end+len(denyBlockEnd)+1:]
+			block = text[begin+len(denyBlockBegin)+1 : end]
+		}
+	}
+	for _, line := range strings.Split(file.Before+"\n"+file.After, "\n") {
+		if target, _, ok := denyLineTarget(line); ok {
+			file.Targets[target] = true
+		}
+	}
+	for _, line := range strings.Split(block, "\n") {
+		target, comment, ok := denyLineTarget(line)
+		if !ok || !manualDenyComment.MatchString(comment) {
+			continue
+		}
+		file.Manual = append(file.Manual, strings.TrimSpace(line))
+		file.Targets[target] = true
+	}
+	return file, nil
+}
+
+// denyLineTarget splits an nginx `deny <target>; # comment` line.
+func denyLineTarget(line string) (target, comment string, ok bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "deny ")
+	if !ok {
+		return "", "", false
+	}
+	target, comment, ok = strings.Cut(rest, ";")
+	return strings.TrimSpace(target), comment, ok
+}
+
+func renderNginxDeny(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	for _, item := range items {
+		if item.Comment == "" {
+			fmt.Fprintf(b, "deny %s;\n", item.IP)
+			continue
+		}
+		fmt.Fprintf(b, "deny %s; # %s\n", item.IP, item.Comment)
+	}
+}
+
+// renderNginxGeo writes a geo block setting $variable to 1 for the listed
+// clients and 0 for everyone else.
+func renderNginxGeo(b *strings.Builder, variable string, items []denyItem) {
+	fmt.Fprintf(b, "geo $%s {\n    default 0;\n", variable)
+	for _, item := range items {
+		if item.Comment == "" {
+			fmt.Fprintf(b, "    %s 1;\n", item.IP)
+			continue
+		}
+		fmt.Fprintf(b, "    %s 1; # %s\n", item.IP, item.Comment)
+	}
+	b.WriteString("}\n")
+}
+
+// renderPFTable writes a pf table file: one address per line.
+func renderPFTable(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	for _, item := range items {
+		if item.Comment == "" {
+			fmt.Fprintf(b, "%s\n", item.IP)
+			continue
+		}
+		fmt.Fprintf(b, "%s # %s\n", item.IP, item.Comment)
+	}
+}
+
+// renderNetshScript replaces the inbound "botdeny" block rules. netsh scripts
+// only allow whole-line comments, so entry comments precede the rules.
+func renderNetshScript(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	for _, item := range items {
+		if item.Comment != "" {
+			fmt.Fprintf(b, "# %s %s\n", item.IP, scriptLineComment(item.Comment))
+		}
+	}
+	b.WriteString("advfirewall firewall delete rule name=\"botdeny\"\n")
+	for _, chunk := range chunkDenyItems(items, windowsRuleChunk) {
+		ips := make([]string, 0, len(chunk))
+		for _, item := range chunk {
+			ips = append(ips, item.IP)
+		}
+		fmt.Fprintf(b, "advfirewall firewall add rule name=\"botdeny\" dir=in action=block remoteip=%s\n", strings.Join(ips, ","))
+	}
+}
+
+// renderPowerShellScript replaces the inbound "botdeny" block rules using the
+// NetSecurity module.
+func renderPowerShellScript(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	b.WriteString("Remove-NetFirewallRule -DisplayName 'botdeny' -ErrorAction SilentlyContinue\n")
+	for _, chunk := range chunkDenyItems(items, windowsRuleChunk) {
+		b.WriteString("New-NetFirewallRule -DisplayName 'botdeny' -Direction Inbound -Action Block -RemoteAddress @(\n")
+		for i, item := range chunk {
+			sep := ","
+			if i == len(chunk)-1 {
+				sep = ""
+			}
+			if item.Comment == "" {
+				fmt.Fprintf(b, "    '%s'%s\n", item.IP, sep)
+				continue
+			}
+			fmt.Fprintf(b, "    '%s'%s # %s\n", item.IP, sep, scriptLineComment(item.Comment))
+		}
+		b.WriteString(") | Out-Null\n")
+	}
+}
+
+// renderLuaTable writes a Lua chunk returning single addresses keyed to their
+// expiry (Unix seconds) and a list of CIDR ranges, for access_by_lua lookups.
+func renderLuaTable(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	var cidrs []denyItem
+	b.WriteString("return {\n    ips = {\n")
+	for _, item := range items {
+		if strings.Contains(item.IP, "/") {
+			cidrs = append(cidrs, item)
+			continue
+		}
+		fmt.Fprintf(b, "        [%q] = %d,%s\n", item.IP, item.Expires.Unix(), luaComment(item.Comment))
+	}
+	b.WriteString("    },\n    cidrs = {\n")
+	for _, item := range cidrs {
+		fmt.Fprintf(b, "        { %q, %d },%s\n", item.IP, item.Expires.Unix(), luaComment(item.Comment))
+	}
+	b.WriteString("    },\n}\n")
+}
+
+// luaComment returns text as a trailing Lua comment on one line. "]]" is
+// split so the text can never close a long bracket.
+func luaComment(text string) string {
+	if text == "" {
+		return ""
+	}
+	return " -- " + strings.ReplaceAll(scriptLineComment(text), "]]", "] ]")
+}
+
+// scriptLineComment makes text safe to follow a line comment marker in an
+// executable script such as PowerShell or Lua: control characters and the
+// Unicode line and paragraph separators, which either language may read as
+// the end of the comment, become spaces.
+func scriptLineComment(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// renderVarnishACL writes an `acl botdeny` block and a vcl_recv that rejects
+// matching clients. Varnish concatenates multiple vcl_recv definitions, so the
+// include runs ahead of the site's own vcl_recv.
+func renderVarnishACL(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	b.WriteString("acl botdeny {\n")
+	for _, item := range items {
+		entry := fmt.Sprintf("%q", item.IP)
+		if addr, bits, ok := strings.Cut(item.IP, "/"); ok {
+			entry = fmt.Sprintf("%q/%s", addr, bits)
+		}
+		if item.Comment == "" {
+			fmt.Fprintf(b, "    %s;\n", entry)
+			continue
+		}
+		fmt.Fprintf(b, "    %s; # %s\n", entry, item.Comment)
+	}
+	b.WriteString("}\n\nsub vcl_recv {\n    if (client.ip ~ botdeny) {\n        return (synth(403, \"Forbidden\"));\n    }\n}\n")
+}
+
+// renderCaddySnippet writes a Caddyfile snippet answering matching clients
+// with 403. Repeated remote_ip matchers in a named matcher are OR'ed, which
+// leaves room for a comment per entry.
+func renderCaddySnippet(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	if len(items) == 0 {
+		return
+	}
+	b.WriteString("@botdeny {\n")
+	for _, item := range items {
+		if item.Comment == "" {
+			fmt.Fprintf(b, "\tremote_ip %s\n", item.IP)
+			continue
+		}
+		fmt.Fprintf(b, "\tremote_ip %s # %s\n", item.IP, item.Comment)
+	}
+	b.WriteString("}\nrespond @botdeny 403\n")
+}
+
+// renderAWSWAFAddresses writes the entries as CIDR ranges in a JSON object
+// with "IPv4" and "IPv6" lists, since an AWS WAF IP set holds one family.
+func renderAWSWAFAddresses(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	addresses := struct {
+		IPv4 []string `json:"IPv4"`
+		IPv6 []string `json:"IPv6"`
+	}{IPv4: []string{}, IPv6: []string{}}
+	for _, item := range items {
+		var network *net.IPNet
+		if _, parsed, err := net.ParseCIDR(item.IP); err == nil {
+			network = parsed
+		} else if ip := net.ParseIP(item.IP); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		} else {
+			continue
+		}
+		if network.IP.To4() != nil {
+			addresses.IPv4 = append(addresses.IPv4, network.String())
+			continue
+		}
+		addresses.IPv6 = append(addresses.IPv6, network.String())
+	}
+	data, _ := json.MarshalIndent(addresses, "", "  ")
+	b.Write(data)
+	b.WriteString("\n")
+}
+
+func chunkDenyItems(items []denyItem, size int) [][]denyItem {
+	var chunks [][]denyItem
+	for len(items) > size {
+		chunks = append(chunks, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		chunks = append(chunks, items)
+	}
+	return chunks
+}
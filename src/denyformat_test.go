@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func denyFormatSuspects() []Suspicion {
+	stats := &IPStats{Requests: 10, StatusCounts: map[int]int{404: 10}}
+	return []Suspicion{
+		{IP: "192.0.2.1", Score: 4, Severity: SeverityHigh, Stats: stats},
+		{IP: "2001:db8::1", Score: 2, Severity: SeverityLow, Stats: stats},
+	}
+}
+
+func renderDenyFormat(t *testing.T, format string, suspects []Suspicion, minimal bool) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "deny."+format)
+	opts := DenyOptions{TTL: time.Hour, Format: format, Minimal: minimal, CommentTemplate: "score={{.Score}}"}
+	if err := writeDenyFile(path, suspects, opts); err != nil {
+		t.Fatalf("writeDenyFile %s: %v", format, err)
+	}
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
+
+func TestWriteDenyFilePF(t *testing.T) {
+	out := renderDenyFormat(t, "pf", denyFormatSuspects(), false)
+	if !strings.Contains(out, "# load with: pfctl -t botdeny -T replace -f ") {
+		t.Fatalf("missing pfctl hint:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "192.0.2.1 # score=4\n2001:db8::1 # score=2\n") {
+		t.Fatalf("unexpected pf table:\n%s", out)
+	}
+	if got := renderDenyFormat(t, "pf", denyFormatSuspects(), true); got != "192.0.2.1\n2001:db8::1\n" {
+		t.Fatalf("unexpected minimal pf table: %q", got)
+	}
+}
+
+func TestWriteDenyFileNetsh(t *testing.T) {
+	out := renderDenyFormat(t, "netsh", denyFormatSuspects(), false)
+	want := "# 192.0.2.1 score=4\n# 2001:db8::1 score=2\n" +
+		"advfirewall firewall delete rule name=\"botdeny\"\n" +
+		"advfirewall firewall add rule name=\"botdeny\" dir=in action=block remoteip=192.0.2.1,2001:db8::1\n"
+	if !strings.HasSuffix(out, want) {
+		t.Fatalf("unexpected netsh script:\n%s", out)
+	}
+
+	// An empty list still clears the previous rules.
+	if got := renderDenyFormat(t, "netsh", nil, true); got != "advfirewall firewall delete rule name=\"botdeny\"\n" {
+		t.Fatalf("unexpected empty netsh script: %q", got)
+	}
+}
+
+func TestWriteDenyFilePowerShellChunksRules(t *testing.T) {
+	suspects := make([]Suspicion, 0, windowsRuleChunk+1)
+	for i := 0; i <= windowsRuleChunk; i++ {
+		suspects = append(suspects, Suspicion{IP: fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), Stats: &IPStats{}})
+	}
+	out := renderDenyFormat(t, "powershell", suspects, true)
+	if !strings.HasPrefix(out, "Remove-NetFirewallRule -DisplayName 'botdeny' -ErrorAction SilentlyContinue\n") {
+		t.Fatalf("expected rules to be replaced:\n%s", out[:200])
+	}
+	if got := strings.Count(out, "New-NetFirewallRule"); got != 2 {
+		t.Fatalf("expected 2 rules for %d addresses, got %d", len(suspects), got)
+	}
+	if !strings.Contains(out, "    '10.0.0.200'\n) | Out-Null\n") || !strings.Contains(out, "    '10.0.0.1',\n") {
+		t.Fatalf("unexpected PowerShell address list:\n%s", out)
+	}
+
+	commented := renderDenyFormat(t, "powershell", denyFormatSuspects(), false)
+	if !strings.Contains(commented, "    '192.0.2.1', # score=4\n    '2001:db8::1' # score=2\n") {
+		t.Fatalf("unexpected PowerShell comments:\n%s", commented)
+	}
+}
+
+func TestWindowsScriptsKeepCommentsOnOneLine(t *testing.T) {
+	items := []denyItem{{IP: "192.0.2.1", Comment: "60 query strings on /a\rwrite-host pwned\u2028x"}}
+	for name, render := range map[string]func(*strings.Builder, []denyItem, DenyOptions){
+		"powershell": renderPowerShellScript,
+		"netsh":      renderNetshScript,
+	} {
+		var b strings.Builder
+		render(&b, items, DenyOptions{})
+		if strings.ContainsAny(b.String(), "\r\u2028") || !strings.Contains(b.String(), "# ") || strings.Contains(b.String(), "\nwrite-host") {
+			t.Fatalf("%s: expected the comment to stay on its line:\n%q", name, b.String())
+		}
+	}
+}
+
+func TestDenyFormatForRejectsUnknown(t *testing.T) {
+	if _, err := denyFormatFor("iptables"); err == nil || !strings.Contains(err.Error(), "netsh") {
+		t.Fatalf("expected unknown format error listing formats, got %v", err)
+	}
+	if _, err := denyFormatFor("PF"); err != nil {
+		t.Fatalf("format names should be case-insensitive: %v", err)
+	}
+}
+
+func TestWriteDenyFileLua(t *testing.T) {
+	out := renderDenyFormat(t, "lua", denyFormatSuspects(), false)
+	if !strings.HasPrefix(out, "-- generated by botdeny on ") || strings.Contains(out, "\n# ") {
+		t.Fatalf("expected Lua comments in header:\n%s", out)
+	}
+	if !strings.Contains(out, "        [\"192.0.2.1\"] = ") || !strings.Contains(out, ", -- score=4\n") {
+		t.Fatalf("unexpected Lua entries:\n%s", out)
+	}
+
+	expires := time.Unix(1760900000, 0)
+	var b strings.Builder
+	renderLuaTable(&b, []denyItem{{IP: "192.0.2.1", Expires: expires}, {IP: "198.51.100.0/24", Expires: expires, Comment: "subnet"}}, DenyOptions{})
+	want := "return {\n    ips = {\n        [\"192.0.2.1\"] = 1760900000,\n    },\n" +
+		"    cidrs = {\n        { \"198.51.100.0/24\", 1760900000 }, -- subnet\n    },\n}\n"
+	if b.String() != want {
+		t.Fatalf("unexpected Lua table:\n%s", b.String())
+	}
+
+	b.Reset()
+	renderLuaTable(&b, []denyItem{{IP: "192.0.2.1", Expires: expires, Comment: "/a\ros.execute('id') ]] --"}}, DenyOptions{})
+	if want := "        [\"192.0.2.1\"] = 1760900000, -- /a os.execute('id') ] ] --\n"; !strings.Contains(b.String(), want) {
+		t.Fatalf("expected the comment to stay on its line:\n%q", b.String())
+	}
+}
+
+func TestWriteDenyFileVarnish(t *testing.T) {
+	out := renderDenyFormat(t, "varnish", denyFormatSuspects(), false)
+	if !strings.Contains(out, "acl botdeny {\n    \"192.0.2.1\"; # score=4\n    \"2001:db8::1\"; # score=2\n}\n") {
+		t.Fatalf("unexpected varnish acl:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "sub vcl_recv {\n    if (client.ip ~ botdeny) {\n        return (synth(403, \"Forbidden\"));\n    }\n}\n") {
+		t.Fatalf("missing vcl_recv snippet:\n%s", out)
+	}
+
+	var b strings.Builder
+	renderVarnishACL(&b, []denyItem{{IP: "198.51.100.0/24"}}, DenyOptions{})
+	if !strings.HasPrefix(b.String(), "acl botdeny {\n    \"198.51.100.0\"/24;\n}\n") {
+		t.Fatalf("unexpected CIDR entry:\n%s", b.String())
+	}
+}
+
+func TestWriteDenyFileCaddy(t *testing.T) {
+	out := renderDenyFormat(t, "caddy", denyFormatSuspects(), false)
+	if !strings.HasSuffix(out, "@botdeny {\n\tremote_ip 192.0.2.1 # score=4\n\tremote_ip 2001:db8::1 # score=2\n}\nrespond @botdeny 403\n") {
+		t.Fatalf("unexpected caddy snippet:\n%s", out)
+	}
+
+	var b strings.Builder
+	renderCaddySnippet(&b, nil, DenyOptions{})
+	if b.String() != "" {
+		t.Fatalf("expected no matcher without entries, got:\n%s", b.String())
+	}
+}
+
+func TestWriteDenyFileAWSWAF(t *testing.T) {
+	suspects := append(denyFormatSuspects(), Suspicion{IP: "198.51.100.0/24", Stats: &IPStats{}})
+	out := renderDenyFormat(t, "aws-waf", suspects, false)
+	want := "{\n  \"IPv4\": [\n    \"192.0.2.1/32\",\n    \"198.51.100.0/24\"\n  ],\n  \"IPv6\": [\n    \"2001:db8::1/128\"\n  ]\n}\n"
+	if out != want {
+		t.Fatalf("unexpected WAF addresses:\n%s", out)
+	}
+	if got := renderDenyFormat(t, "aws-waf", nil, false); got != "{\n  \"IPv4\": [],\n  \"IPv6\": []\n}\n" {
+		t.Fatalf("expected empty lists without comments, got:\n%s", got)
+	}
+}
+
+func TestWriteDenyFileNginxChallenge(t *testing.T) {
+	out := renderDenyFormat(t, "nginx-challenge", denyFormatSuspects(), false)
+	if !strings.Contains(out, "geo $botdeny_flagged {\n    default 0;\n    192.0.2.1 1; # score=4\n    2001:db8::1 1; # score=2\n}\n") {
+		t.Fatalf("unexpected geo block:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "map \"$botdeny_flagged:$secure_link:$uri\" $botdeny_challenge {\n    default 0;\n    \"~^1:[^:]*:/\\.botdeny/\" 0;\n    \"~^1:0?:\" 1;\n}\n") {
+		t.Fatalf("unexpected challenge map:\n%s", out)
+	}
+}
+
+func TestWriteDenyFileNginxCanary(t *testing.T) {
+	out := renderDenyFormat(t, "nginx-canary", denyFormatSuspects(), false)
+	if !strings.HasSuffix(out, "geo $botdeny_canary {\n    default 0;\n    192.0.2.1 1; # score=4\n    2001:db8::1 1; # score=2\n}\n") {
+		t.Fatalf("unexpected canary map:\n%s", out)
+	}
+}
+
+func TestWriteDenyFileKeepsManualLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.conf")
+	previous := "# generated by botdeny on 2025-10-19T20:51:31Z UTC\n" +
+		"deny 198.51.100.9; # expires 2025-10-26; errors=3 (100.0%)\n" +
+		"deny 203.0.113.0/24; # manual: scraper farm, ticket 812\n" +
+		"  deny 192.0.2.1; #manual\n"
+	if err := os.WriteFile(path, []byte(previous), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writeDenyFile(path, denyFormatSuspects(), DenyOptions{Minimal: true}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "deny 203.0.113.0/24; # manual: scraper farm, ticket 812\n" +
+		"deny 192.0.2.1; #manual\n" +
+		"deny 2001:db8::1;\n"
+	if string(data) != want {
+		t.Fatalf("unexpected deny file:\n%s", data)
+	}
+
+	// Other formats are rewritten whole.
+	pf := filepath.Join(t.TempDir(), "deny.pf")
+	os.WriteFile(pf, []byte("198.51.100.9 # manual\n"), 0o644)
+	if err := writeDenyFile(pf, nil, DenyOptions{Format: "pf", Minimal: true}); err != nil {
+		t.Fatalf("writeDenyFile pf: %v", err)
+	}
+	if data, _ := os.ReadFile(pf); len(data) != 0 {
+		t.Fatalf("expected an empty pf table, got %q", data)
+	}
+}
+
+func TestWriteDenyFileRewritesManagedBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.conf")
+	previous := "# hand-maintained\n" +
+		"deny 198.51.100.0/24;\n" +
+		"# BEGIN botdeny\n" +
+		"# generated by botdeny on 2025-10-19T20:51:31Z UTC\n" +
+		"deny 203.0.113.9; # expires 2025-10-26\n" +
+		"deny 203.0.113.10; # manual\n" +
+		"# END botdeny\n" +
+		"allow all;"
+	if err := os.WriteFile(path, []byte(previous), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	suspects := append(denyFormatSuspects(), Suspicion{IP: "198.51.100.0/24", Stats: denyFormatSuspects()[0].Stats})
+	if err := writeDenyFile(path, suspects, DenyOptions{Minimal: true}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "# hand-maintained\n" +
+		"deny 198.51.100.0/24;\n" +
+		"# BEGIN botdeny\n" +
+		"deny 203.0.113.10; # manual\n" +
+		"deny 192.0.2.1;\n" +
+		"deny 2001:db8::1;\n" +
+		"# END botdeny\n" +
+		"allow all;\n"
+	if string(data) != want {
+		t.Fatalf("unexpected deny file:\n%s", data)
+	}
+
+	// A new file gets the markers around the generated entries.
+	fresh := renderDenyFormat(t, "nginx", denyFormatSuspects(), false)
+	if !strings.HasPrefix(fresh, "# BEGIN botdeny\n# generated by botdeny on ") || !strings.HasSuffix(fresh, "# END botdeny\n") {
+		t.Fatalf("expected a marked block, got:\n%s", fresh)
+	}
+}
+
+func TestWriteDenyFileWidensIPv6(t *testing.T) {
+	stats := denyFormatSuspects()[0].Stats
+	suspects := []Suspicion{
+		{IP: "2001:db8:0:7::1", Score: 5, Stats: stats},
+		{IP: "2001:db8:0:7:a::2", Score: 3, Stats: stats},
+		{IP: "192.0.2.1", Score: 2, Stats: stats},
+		{IP: "2001:db8::/48", Score: 2, Stats: stats},
+	}
+	path := filepath.Join(t.TempDir(), "deny.conf")
+	if err := writeDenyFile(path, suspects, DenyOptions{Minimal: true, IPv6Prefix: 64}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "deny 2001:db8:0:7::/64;\ndeny 192.0.2.1;\ndeny 2001:db8::/48;\n"
+	if string(data) != want {
+		t.Fatalf("unexpected deny file:\n%s", data)
+	}
+	if err := checkIPv6Prefix(129); err == nil {
+		t.Fatal("expected a prefix over 128 to be rejected")
+	}
+}
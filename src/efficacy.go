@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DenyEntry is a single deny directive read back from a deny file.
+type DenyEntry struct {
+	Target string
+	prefix netip.Prefix
+}
+
+// DenyList is a parsed deny file.
+type DenyList struct {
+	Generated time.Time
+	Entries   []DenyEntry
+}
+
+// BlockEfficacy reports the traffic a deny entry received after it became active.
+type BlockEfficacy struct {
+	Target   string
+	Requests int
+	Denied   int
+	LastSeen time.Time
+}
+
+// Served returns requests that were not answered with a deny status.
+func (b BlockEfficacy) Served() int {
+	return b.Requests - b.Denied
+}
+
+// Verdict summarizes whether the block is working.
+func (b BlockEfficacy) Verdict() string {
+	switch {
+	case b.Requests == 0:
+		return "quiet"
+	case b.Served() > 0:
+		return "leaking"
+	default:
+		return "absorbed"
+	}
+}
+
+// readDenyFile parses `deny <ip|cidr>;` directives and the botdeny header timestamp.
+func readDenyFile(path string) (DenyList, error) {
+	var list DenyList
+	fh, err := os.Open(path)
+	if err != nil {
+		return list, err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if rest, ok := strings.CutPrefix(line, "# generated by botdeny on "); ok {
+			if ts, err := time.Parse(time.RFC3339, strings.TrimSuffix(rest, " UTC")); err == nil {
+				list.Generated = ts
+			}
+			continue
+		}
+		rest, ok := strings.CutPrefix(line, "deny ")
+		if !ok {
+			continue
+		}
+		target, _, ok := strings.Cut(rest, ";")
+		if !ok {
+			continue
+		}
+		target = strings.TrimSpace(target)
+		prefix, err := parseDenyTarget(target)
+		if err != nil {
+			continue
+		}
+		list.Entries = append(list.Entries, DenyEntry{Target: target, prefix: prefix})
+	}
+	if err := scanner.Err(); err != nil {
+		return list, err
+	}
+	if list.Generated.IsZero() {
+		if info, err := fh.Stat(); err == nil {
+			list.Generated = info.ModTime()
+		}
+	}
+	return list, nil
+}
+
+func parseDenyTarget(target string) (netip.Prefix, error) {
+	if strings.Contains(target, "/") {
+		prefix, err := netip.ParsePrefix(target)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(target)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// EfficacyCounter tallies log entries hitting deny entries after a cutoff.
+type EfficacyCounter struct {
+	since        time.Time
+	deniedStatus map[int]bool
+	entries      []DenyEntry
+	results      map[string]*BlockEfficacy
+}
+
+func newEfficacyCounter(list DenyList, since time.Time, deniedStatus []int) *EfficacyCounter {
+	counter := &EfficacyCounter{
+		since:        since,
+		deniedStatus: make(map[int]bool, len(deniedStatus)),
+		entries:      list.Entries,
+		results:      make(map[string]*BlockEfficacy, len(list.Entries)),
+	}
+	for _, status := range deniedStatus {
+		counter.deniedStatus[status] = true
+	}
+	for _, entry := range list.Entries {
+		counter.results[entry.Target] = &BlockEfficacy{Target: entry.Target}
+	}
+	return counter
+}
+
+// Add counts an entry against the first deny entry covering its client IP.
+func (c *EfficacyCounter) Add(entry Entry) {
+	if entry.Time.Before(c.since) {
+		return
+	}
+	addr, err := netip.ParseAddr(entry.ClientIP)
+	if err != nil {
+		return
+	}
+	for _, deny := range c.entries {
+		if !deny.prefix.Contains(addr.Unmap()) {
+			continue
+		}
+		result := c.results[deny.Target]
+		result.Requests++
+		if c.deniedStatus[entry.Status] {
+			result.Denied++
+		}
+		if entry.Time.After(result.LastSeen) {
+			result.LastSeen = entry.Time
+		}
+		return
+	}
+}
+
+// Results returns per-entry efficacy, busiest entries first.
+func (c *EfficacyCounter) Results() []BlockEfficacy {
+	results := make([]BlockEfficacy, 0, len(c.results))
+	for _, result := range c.results {
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Requests == results[j].Requests {
+			return results[i].Target < results[j].Target
+		}
+		return results[i].Requests > results[j].Requests
+	})
+	return results
+}
+
+func printEfficacy(w io.Writer, since time.Time, results []BlockEfficacy, verbose bool) {
+	var denied, leaked, absorbing, leaking, quiet int
+	for _, result := range results {
+		denied += result.Denied
+		leaked += result.Served()
+		switch result.Verdict() {
+		case "absorbed":
+			absorbing++
+		case "leaking":
+			leaking++
+		default:
+			quiet++
+		}
+	}
+
+	fmt.Fprintf(w, "Block efficacy since %s (%d deny entries)\n", since.UTC().Format(time.RFC3339), len(results))
+	fmt.Fprintf(w, "  requests absorbed: %d\n", denied)
+	fmt.Fprintf(w, "  requests served despite deny: %d\n", leaked)
+	fmt.Fprintf(w, "  entries absorbing traffic: %d\n", absorbing)
+	fmt.Fprintf(w, "  entries leaking traffic: %d\n", leaking)
+	fmt.Fprintf(w, "  entries with no traffic (rotated or gave up): %d\n", quiet)
+	if leaking > 0 {
+		fmt.Fprintln(w, "  note: leaking entries usually mean nginx was not reloaded or the deny file is not included for that server")
+	}
+
+	fmt.Fprintf(w, "\n%-43s %-10s %-10s %-10s %-10s %s\n", "Target", "Requests", "Denied", "Served", "Verdict", "Last Seen")
+	for _, result := range results {
+		if result.Requests == 0 && !verbose {
+			continue
+		}
+		lastSeen := "-"
+		if !result.LastSeen.IsZero() {
+			lastSeen = result.LastSeen.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%-43s %-10d %-10d %-10d %-10s %s\n", result.Target, result.Requests, result.Denied, result.Served(), result.Verdict(), lastSeen)
+	}
+}
+
+func runReportEfficacy(args []string) int {
+	fs := flag.NewFlagSet("report efficacy", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	filePath := fs.String("file", "", "path to Nginx access log written after the deny file became active (defaults to config file or access.log)")
+	denyPath := fs.String("deny", "", "path to the deny file to evaluate (defaults to deny_output from the config)")
+	sinceFlag := fs.String("since", "", "only count requests at or after this RFC3339 time (defaults to the deny file's generation time)")
+	verbose := fs.Bool("all", false, "list deny entries that received no traffic")
+	deniedStatus := make([]int, 0)
+	fs.Func("denied-status", "status code nginx returns to denied clients (can repeat, default 403 and 444)", func(val string) error {
+		status, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return fmt.Errorf("invalid status %q", val)
+		}
+		deniedStatus = append(deniedStatus, status)
+		return nil
+	})
+	fs.Parse(args)
+	if len(deniedStatus) == 0 {
+		deniedStatus = []int{403, 444}
+	}
+
+	_, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *filePath == "" {
+		*filePath = defaults.File
+	}
+	if *denyPath == "" {
+		*denyPath = defaults.DenyOutput
+	}
+	if *denyPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny report efficacy --deny botdeny.conf [--file access.log] [--since RFC3339]")
+		return 2
+	}
+
+	list, err := readDenyFile(*denyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read deny file: %v\n", err)
+		return 1
+	}
+	since := list.Generated
+	if *sinceFlag != "" {
+		since, err = time.Parse(time.RFC3339, *sinceFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --since: %v\n", err)
+			return 2
+		}
+	}
+
+	logFormat, err := logFormatFor(defaults.Format, defaults.LogFormat, defaults.LogTimes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	counter := newEfficacyCounter(list, since, deniedStatus)
+	if err := streamLogFileWith(*filePath, StreamOptions{Format: logFormat}, counter.Add); err != nil {
+		fmt.Fprintf(os.Stderr, "parse log: %v\n", err)
+		return 1
+	}
+	printEfficacy(os.Stdout, since, counter.Results(), *verbose)
+	return 0
+}
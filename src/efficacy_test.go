@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadDenyFileParsesEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "botdeny.conf")
+	suspects := []Suspicion{
+		{IP: "192.0.2.10", Score: 4, Stats: &IPStats{}},
+		{IP: "2001:db8::1", Score: 4, Stats: &IPStats{}},
+	}
+	if err := writeDenyFile(path, suspects, DenyOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	f.WriteString("deny 198.51.100.0/24;\n# deny 203.0.113.1;\n")
+	f.Close()
+
+	list, err := readDenyFile(path)
+	if err != nil {
+		t.Fatalf("readDenyFile: %v", err)
+	}
+	if list.Generated.IsZero() || time.Since(list.Generated) > time.Minute {
+		t.Fatalf("expected header timestamp, got %v", list.Generated)
+	}
+	targets := make([]string, 0, len(list.Entries))
+	for _, entry := range list.Entries {
+		targets = append(targets, entry.Target)
+	}
+	if got := strings.Join(targets, ","); got != "192.0.2.10,2001:db8::1,198.51.100.0/24" {
+		t.Fatalf("unexpected deny targets: %s", got)
+	}
+}
+
+func TestEfficacyCounterVerdicts(t *testing.T) {
+	activated := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	list := DenyList{Generated: activated}
+	for _, target := range []string{"192.0.2.10", "192.0.2.11", "198.51.100.0/24"} {
+		prefix, err := parseDenyTarget(target)
+		if err != nil {
+			t.Fatalf("parseDenyTarget(%s): %v", target, err)
+		}
+		list.Entries = append(list.Entries, DenyEntry{Target: target, prefix: prefix})
+	}
+
+	counter := newEfficacyCounter(list, activated, []int{403})
+	after := activated.Add(time.Minute)
+	counter.Add(Entry{ClientIP: "192.0.2.10", Time: activated.Add(-time.Minute), Status: 200})
+	counter.Add(Entry{ClientIP: "192.0.2.10", Time: after, Status: 403})
+	counter.Add(Entry{ClientIP: "192.0.2.10", Time: after, Status: 403})
+	counter.Add(Entry{ClientIP: "198.51.100.7", Time: after, Status: 200})
+	counter.Add(Entry{ClientIP: "203.0.113.5", Time: after, Status: 200})
+
+	verdicts := make(map[string]BlockEfficacy)
+	for _, result := range counter.Results() {
+		verdicts[result.Target] = result
+	}
+	if r := verdicts["192.0.2.10"]; r.Verdict() != "absorbed" || r.Denied != 2 || r.Requests != 2 {
+		t.Fatalf("expected absorbed block, got %+v", r)
+	}
+	if r := verdicts["198.51.100.0/24"]; r.Verdict() != "leaking" || r.Served() != 1 {
+		t.Fatalf("expected leaking CIDR block, got %+v", r)
+	}
+	if r := verdicts["192.0.2.11"]; r.Verdict() != "quiet" {
+		t.Fatalf("expected quiet block, got %+v", r)
+	}
+
+	var out bytes.Buffer
+	printEfficacy(&out, activated, counter.Results(), false)
+	if !strings.Contains(out.String(), "requests absorbed: 2") || strings.Contains(out.String(), "192.0.2.11") {
+		t.Fatalf("unexpected efficacy report:\n%s", out.String())
+	}
+}
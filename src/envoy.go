@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envoyLogFormat reads Envoy access logs in Envoy's default text format,
+// Istio's longer default text format and the JSON encoding Istio uses.
+var envoyLogFormat = &LogFormat{Name: "envoy", parse: parseEnvoyLine}
+
+// envoyTextLog matches Envoy's default format:
+//
+//	[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS%
+//	%BYTES_RECEIVED% %BYTES_SENT% %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%"
+//	"%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"
+//
+// and Istio's, which adds the response code details, connection termination
+// details and upstream failure reason after the flags, and the upstream
+// cluster, local and remote addresses, SNI and route name at the end.
+var envoyTextLog = regexp.MustCompile(`^\[([^\]]+)\] "([^"]*)" (\d{1,3}) (\S+)(?: \S+ \S+ "[^"]*")? (\d+|-) (\d+|-) (\d+|-) (\S+) "([^"]*)" "([^"]*)" "([^"]*)" "([^"]*)" "([^"]*)"(?: (\S+) \S+ \S+ (\S+) \S+ \S+)?$`)
+
+// envoyAccessLog is the subset of a JSON access log entry botdeny uses, with
+// the keys of Istio's JSON encoding. Envoy writes null for unset values.
+type envoyAccessLog struct {
+	StartTime       string `json:"start_time"`
+	Method          string `json:"method"`
+	Path            string `json:"path"`
+	Protocol        string `json:"protocol"`
+	ResponseCode    int    `json:"response_code"`
+	ResponseFlags   string `json:"response_flags"`
+	BytesSent       int64  `json:"bytes_sent"`
+	Duration        int64  `json:"duration"`
+	ForwardedFor    string `json:"x_forwarded_for"`
+	UserAgent       string `json:"user_agent"`
+	Authority       string `json:"authority"`
+	UpstreamHost    string `json:"upstream_host"`
+	UpstreamCluster string `json:"upstream_cluster"`
+	DownstreamAddr  string `json:"downstream_remote_address"`
+}
+
+// parseEnvoyLine parses a JSON entry or a default format line.
+func parseEnvoyLine(line string) (Entry, error) {
+	if strings.HasPrefix(line, "{") {
+		return parseEnvoyJSON(line)
+	}
+	m := envoyTextLog.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, fmt.Errorf("line does not match the envoy format: %w", ErrUnmatchedLine)
+	}
+	method, uri, protocol, ok := splitEnvoyRequest(m[2])
+	if !ok {
+		return Entry{}, fmt.Errorf("envoy entry %q is not an HTTP request: %w", m[2], ErrUnmatchedLine)
+	}
+	status, _ := strconv.Atoi(m[3])
+	record := envoyAccessLog{
+		StartTime:       m[1],
+		Method:          method,
+		Path:            uri,
+		Protocol:        protocol,
+		ResponseCode:    status,
+		ResponseFlags:   m[4],
+		ForwardedFor:    envoyValue(m[9]),
+		UserAgent:       envoyValue(m[10]),
+		Authority:       envoyValue(m[12]),
+		UpstreamHost:    envoyValue(m[13]),
+		UpstreamCluster: envoyValue(m[14]),
+		DownstreamAddr:  envoyValue(m[15]),
+	}
+	if m[6] != "-" {
+		record.BytesSent, _ = strconv.ParseInt(m[6], 10, 64)
+	}
+	if m[7] != "-" {
+		record.Duration, _ = strconv.ParseInt(m[7], 10, 64)
+	}
+	return record.entry()
+}
+
+func parseEnvoyJSON(line string) (Entry, error) {
+	var record envoyAccessLog
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return Entry{}, fmt.Errorf("parse envoy entry: %v: %w", err, ErrUnmatchedLine)
+	}
+	if record.StartTime == "" || record.Method == "" {
+		return Entry{}, fmt.Errorf("envoy entry is not an HTTP access log: %w", ErrUnmatchedLine)
+	}
+	return record.entry()
+}
+
+// splitEnvoyRequest splits the quoted request, which is "- - -" for TCP
+// proxy entries.
+func splitEnvoyRequest(request string) (method, uri, protocol string, ok bool) {
+	parts := strings.Fields(request)
+	if len(parts) != 3 || parts[0] == "-" || parts[1] == "-" {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], parts[2], true
+}
+
+// envoyValue maps the "-" Envoy writes for unset values to "".
+func envoyValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+func (r envoyAccessLog) entry() (Entry, error) {
+	t, err := time.Parse(time.RFC3339Nano, r.StartTime)
+	if err != nil {
+		return Entry{}, fmt.Errorf("parse time: %w", err)
+	}
+	remote := r.DownstreamAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	// Envoy's default format has no client address, only X-Forwarded-For.
+	if remote == "" && (r.ForwardedFor == "" || r.ForwardedFor == "-") {
+		return Entry{}, fmt.Errorf("envoy entry has no client address: %w", ErrUnmatchedLine)
+	}
+	flags := r.ResponseFlags
+	if flags == "-" {
+		flags = ""
+	}
+	backend := r.UpstreamCluster
+	if backend == "" {
+		backend = r.UpstreamHost
+	}
+	return Entry{
+		ClientIP:      deriveClientIP(remote, r.ForwardedFor),
+		RemoteAddr:    remote,
+		ForwardedFor:  r.ForwardedFor,
+		Time:          t,
+		Method:        r.Method,
+		URI:           r.Path,
+		Protocol:      r.Protocol,
+		Status:        r.ResponseCode,
+		Bytes:         r.BytesSent,
+		UserAgent:     r.UserAgent,
+		RequestTime:   float64(r.Duration) / 1000,
+		Host:          r.Authority,
+		Backend:       backend,
+		UpstreamHost:  r.UpstreamHost,
+		ResponseFlags: flags,
+	}, nil
+}
+
+// envoyFlags splits a response flags value such as "UH,UF" into its flags.
+func envoyFlags(flags string) []string {
+	if flags == "" || flags == "-" {
+		return nil
+	}
+	return strings.Split(flags, ",")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const envoyDefaultLine = `[2025-10-19T12:02:35.250Z] "GET /wp-login.php?x=1 HTTP/1.1" 404 NR 0 0 3 - "192.0.2.7, 10.0.0.5" "zgrab/0.x" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "shop.example.com" "-"`
+
+const istioDefaultLine = `[2025-10-19T12:02:35.250Z] "GET /status/418 HTTP/1.1" 418 - via_upstream - "-" 0 135 4 4 "-" "curl/8.0" "84961386-6d84-929d-98bd-c5aee93b5c88" "httpbin:8000" "10.44.1.27:80" outbound|8000||httpbin.foo.svc.cluster.local 10.44.1.23:37652 10.0.45.184:8000 192.0.2.9:46520 - default`
+
+func TestEnvoyDefaultFormat(t *testing.T) {
+	format, err := logFormatFor("envoy", "", LogTimes{})
+	if err != nil || format != envoyLogFormat {
+		t.Fatalf("expected envoy format, got %v, %v", format, err)
+	}
+	entry, err := format.Parse(envoyDefaultLine)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:      "192.0.2.7",
+		ForwardedFor:  "192.0.2.7, 10.0.0.5",
+		Time:          time.Date(2025, 10, 19, 12, 2, 35, 250000000, time.UTC),
+		Method:        "GET",
+		URI:           "/wp-login.php?x=1",
+		Protocol:      "HTTP/1.1",
+		Status:        404,
+		UserAgent:     "zgrab/0.x",
+		RequestTime:   0.003,
+		Host:          "shop.example.com",
+		ResponseFlags: "NR",
+	}
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+
+	entry, err = format.Parse(istioDefaultLine)
+	if err != nil {
+		t.Fatalf("Parse istio line: %v", err)
+	}
+	if entry.ClientIP != "192.0.2.9" || entry.Status != 418 || entry.Bytes != 135 || entry.ResponseFlags != "" ||
+		entry.UpstreamHost != "10.44.1.27:80" || entry.Backend != "outbound|8000||httpbin.foo.svc.cluster.local" {
+		t.Fatalf("unexpected istio entry %+v", entry)
+	}
+
+	for _, line := range []string{
+		// A TCP proxy entry has no request.
+		`[2025-10-19T12:02:35.250Z] "- - -" 0 - 120 80 15 - "-" "-" "-" "-" "10.44.1.27:5432"`,
+		// Without X-Forwarded-For the default format names no client.
+		`[2025-10-19T12:02:35.250Z] "GET / HTTP/1.1" 200 - 0 12 1 1 "-" "curl/8.0" "-" "shop.example.com" "10.44.1.27:80"`,
+	} {
+		if _, err := format.Parse(line); err == nil {
+			t.Errorf("expected %q to be rejected", line)
+		}
+	}
+}
+
+func TestEnvoyJSONFormat(t *testing.T) {
+	line := `{"authority":"shop.example.com","bytes_received":0,"bytes_sent":512,"downstream_local_address":"10.44.1.23:8080","downstream_remote_address":"192.0.2.7:51234",` +
+		`"duration":125,"method":"POST","path":"/login","protocol":"HTTP/2","request_id":"84961386","requested_server_name":null,"response_code":429,"response_flags":"RL",` +
+		`"route_name":"default","start_time":"2025-10-19T12:02:35.250Z","upstream_cluster":null,"upstream_host":null,"user_agent":"python-requests/2.31","x_forwarded_for":null}`
+	entry, err := envoyLogFormat.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if entry.ClientIP != "192.0.2.7" || entry.RemoteAddr != "192.0.2.7" || entry.Method != "POST" || entry.Status != 429 ||
+		entry.Bytes != 512 || entry.RequestTime != 0.125 || entry.ResponseFlags != "RL" || entry.Backend != "" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if _, err := envoyLogFormat.Parse(`{"level":"info","msg":"cds: add 3 clusters"}`); err == nil {
+		t.Fatal("expected a non-access JSON line to be rejected")
+	}
+}
+
+func TestStreamDetectsEnvoy(t *testing.T) {
+	line := strings.Replace(envoyDefaultLine, `"-"`, `"10.44.1.27:80"`, 1)
+	line = strings.Replace(line, "404 NR", "503 UH,UF", 1)
+	entries, errs := Stream(strings.NewReader(line + "\n" + envoyDefaultLine + "\n"))
+	analyzer := New(DefaultConfig(), nil)
+	for entry := range entries {
+		analyzer.Process(entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	stat := analyzer.stats["192.0.2.7"]
+	if stat == nil || stat.Requests != 2 || stat.ResponseFlags["NR"] != 1 || stat.ResponseFlags["UF"] != 1 || stat.Backends["10.44.1.27:80"] != 1 {
+		t.Fatalf("expected envoy entries with their flags and upstream, got %+v", stat)
+	}
+}
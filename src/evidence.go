@@ -0,0 +1,264 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// EvidenceSummary is the machine-readable part of an evidence bundle.
+type EvidenceSummary struct {
+	IP            string         `json:"ip"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	SourceFile    string         `json:"source_file"`
+	Lines         int            `json:"lines"`
+	Requests      int            `json:"requests"`
+	FirstSeen     time.Time      `json:"first_seen"`
+	LastSeen      time.Time      `json:"last_seen"`
+	Bytes         int64          `json:"bytes"`
+	CountryISO    string         `json:"country_iso,omitempty"`
+	CountryName   string         `json:"country_name,omitempty"`
+	StatusCounts  map[int]int    `json:"status_counts"`
+	UserAgents    map[string]int `json:"user_agents"`
+	TopPaths      []string       `json:"top_paths"`
+	PHP404s       int            `json:"php_404s"`
+	SQLInjections int            `json:"sql_injections"`
+	Score         int            `json:"score"`
+	Reasons       []string       `json:"reasons"`
+	Blocked       bool           `json:"blocked"`
+	// FirstLines and LastLines repeat the raw_lines sample a regular run reports.
+	FirstLines []string `json:"first_lines,omitempty"`
+	LastLines  []string `json:"last_lines,omitempty"`
+}
+
+// collectEvidence reads the logs at paths as a regular run does, with
+// format detection, the time window of opts and several logs merged in
+// time order, and scores ip with cfg. It returns the raw lines of the
+// requests the IP was scored on; lines that cannot be parsed are ignored
+// since they cannot be attributed to an IP, and so are requests dropped
+// by allow_urls or the monitor rules.
+func collectEvidence(paths []string, opts StreamOptions, ip string, cfg Config, geo GeoLookup) ([]string, EvidenceSummary, error) {
+	summary := EvidenceSummary{IP: ip, GeneratedAt: time.Now().UTC()}
+	analyzer := New(cfg, geo)
+	lines := make([]string, 0)
+
+	err := streamLogFiles(paths, opts, func(entry Entry) {
+		if entry.ClientIP != ip && entry.RemoteAddr != ip {
+			return
+		}
+		entry.ClientIP = ip
+		before := analyzer.requestsFrom(ip)
+		analyzer.Process(entry)
+		if analyzer.requestsFrom(ip) > before {
+			lines = append(lines, entry.Raw)
+		}
+	})
+	if err != nil {
+		return nil, summary, err
+	}
+
+	summary.Lines = len(lines)
+	suspect, seen, blocked := analyzer.Explain(ip)
+	if !seen {
+		return lines, summary, nil
+	}
+	stat := suspect.Stats
+	summary.Requests = stat.Requests
+	summary.FirstSeen = stat.FirstSeen
+	summary.LastSeen = stat.LastSeen
+	summary.Bytes = stat.Bytes
+	summary.CountryISO = stat.CountryISO
+	summary.CountryName = stat.CountryName
+	summary.StatusCounts = stat.StatusCounts
+	summary.UserAgents = stat.UserAgents
+	summary.TopPaths = TopPaths(stat, 20)
+	summary.PHP404s = stat.PHP404s
+	summary.SQLInjections = stat.SQLInjections
+	summary.Score = suspect.Score
+	summary.Reasons = suspect.Reasons
+	summary.Blocked = blocked
+	summary.FirstLines = stat.FirstLines()
+	summary.LastLines = stat.LastLines()
+	return lines, summary, nil
+}
+
+// writeEvidenceArchive stores the raw lines plus JSON and text summaries in a zip archive.
+func writeEvidenceArchive(path string, lines []string, summary EvidenceSummary) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeEvidenceZip(f, lines, summary); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeEvidenceZip writes the archive of writeEvidenceArchive to w.
+func writeEvidenceZip(w io.Writer, lines []string, summary EvidenceSummary) error {
+	zw := zip.NewWriter(w)
+
+	logFile, err := zw.Create("access.log")
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(logFile, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	statsFile, err := zw.Create("stats.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(statsFile)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(summary); err != nil {
+		return err
+	}
+
+	textFile, err := zw.Create("summary.txt")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(textFile, formatEvidenceSummary(summary)); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func formatEvidenceSummary(summary EvidenceSummary) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("botdeny evidence for %s\n", summary.IP))
+	builder.WriteString(fmt.Sprintf("generated: %s\n", summary.GeneratedAt.Format(time.RFC3339)))
+	builder.WriteString(fmt.Sprintf("source:    %s\n", summary.SourceFile))
+	builder.WriteString(fmt.Sprintf("requests:  %d (%d log lines)\n", summary.Requests, summary.Lines))
+	if summary.Requests > 0 {
+		builder.WriteString(fmt.Sprintf("window:    %s - %s\n", summary.FirstSeen.Format(time.RFC3339), summary.LastSeen.Format(time.RFC3339)))
+	}
+	if summary.CountryISO != "" || summary.CountryName != "" {
+		builder.WriteString(fmt.Sprintf("country:   %s (%s)\n", summary.CountryISO, summary.CountryName))
+	}
+	builder.WriteString(fmt.Sprintf("score:     %d (blocked=%t)\n", summary.Score, summary.Blocked))
+	if len(summary.Reasons) > 0 {
+		builder.WriteString(fmt.Sprintf("reasons:   %s\n", strings.Join(summary.Reasons, "; ")))
+	}
+	if len(summary.TopPaths) > 0 {
+		builder.WriteString("top paths:\n")
+		for _, path := range summary.TopPaths {
+			builder.WriteString(fmt.Sprintf("  %s\n", path))
+		}
+	}
+	return builder.String()
+}
+
+// runEvidence implements `botdeny evidence <ip> --file access.log --out evidence.zip`.
+func runEvidence(args []string) int {
+	fs := flag.NewFlagSet("evidence", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	var filePaths []string
+	fs.Func("file", "path or glob of Nginx access logs (can repeat; defaults to config file or access.log)", func(val string) error {
+		filePaths = append(filePaths, val)
+		return nil
+	})
+	since := fs.String("since", "", "only include entries logged since this time, as in the main --since (optional)")
+	until := fs.String("until", "", "only include entries logged before this time, in the same forms as --since (optional)")
+	outPath := fs.String("out", "", "path of the zip archive to write (default evidence-<ip>.zip)")
+	geoDB := fs.String("geoip-db", "", "path to MaxMind GeoIP2/GeoLite2 Country database")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: botdeny evidence <ip> [--file access.log]... [--since 24h] [--until TIME] [--out evidence.zip]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil || len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+	ip := positional[0]
+	if !isValidIP(ip) {
+		fmt.Fprintf(os.Stderr, "invalid IP %q\n", ip)
+		return 2
+	}
+
+	cfg, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(filePaths) == 0 {
+		filePaths = []string{defaults.File}
+	}
+	if filePaths, err = expandLogPaths(filePaths); err != nil {
+		fmt.Fprintf(os.Stderr, "file: %v\n", err)
+		return 1
+	}
+	if *since == "" {
+		*since = defaults.Since
+	}
+	if *until == "" {
+		*until = defaults.Until
+	}
+	display, err := parseTimeDisplay(defaults.TimeFormat, defaults.Timezone)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	windowStart, windowEnd, err := parseTimeBounds(*since, *until, time.Now(), display.Location)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *geoDB == "" {
+		*geoDB = defaults.GeoIPDB
+	}
+	if *outPath == "" {
+		*outPath = fmt.Sprintf("evidence-%s.zip", strings.ReplaceAll(ip, ":", "_"))
+	}
+
+	logFormat, err := logFormatFor(defaults.Format, defaults.LogFormat, defaults.LogTimes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var geoLookup GeoLookup
+	if *geoDB != "" {
+		lookup, closer, err := newGeoLookup(defaults.GeoProvider, *geoDB, defaults.GeoIPLocale, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open geoip db: %v\n", err)
+			return 1
+		}
+		defer closer()
+		geoLookup = lookup
+	}
+
+	opts := StreamOptions{Format: logFormat, Since: windowStart, Until: windowEnd}
+	lines, summary, err := collectEvidence(filePaths, opts, ip, cfg, geoLookup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read log: %v\n", err)
+		return 1
+	}
+	source := strings.Join(filePaths, ", ")
+	if len(lines) == 0 {
+		fmt.Fprintf(os.Stderr, "no log lines found for %s in %s\n", ip, source)
+		return 1
+	}
+	summary.SourceFile = source
+
+	if err := writeEvidenceArchive(*outPath, lines, summary); err != nil {
+		fmt.Fprintf(os.Stderr, "write evidence: %v\n", err)
+		return 1
+	}
+	log.Printf("wrote evidence for %s to %s (%d lines, score %d)", ip, *outPath, len(lines), summary.Score)
+	return 0
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectEvidenceExtractsOnlyTargetIP(t *testing.T) {
+	dir := t.TempDir()
+	rotated := filepath.Join(dir, "access.log.1")
+	current := filepath.Join(dir, "access.log")
+	writeLog := func(path string, lines ...string) {
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	writeLog(rotated,
+		"192.0.2.10 - - [18/Oct/2025:23:00:00 +0200] \"GET /old HTTP/1.1\" 404 0 \"-\" \"agent\"",
+		"192.0.2.10 - - [19/Oct/2025:00:00:07 +0200] \"GET /wp-login.php HTTP/1.1\" 404 0 \"-\" \"agent\"",
+	)
+	writeLog(current,
+		"198.51.100.7 - - [19/Oct/2025:00:00:08 +0200] \"GET / HTTP/1.1\" 200 512 \"-\" \"browser\"",
+		"invalid line",
+		"192.0.2.10 - - [19/Oct/2025:00:00:09 +0200] \"GET /xmlrpc.php HTTP/1.1\" 404 0 \"-\" \"agent\"",
+		"192.0.2.10 - - [19/Oct/2025:00:00:10 +0200] \"GET /health HTTP/1.1\" 200 2 \"-\" \"agent\"",
+	)
+
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.AllowedURIs = []string{"/health"}
+	opts := StreamOptions{Since: time.Date(2025, 10, 18, 22, 0, 0, 0, time.UTC)}
+	lines, summary, err := collectEvidence([]string{current, rotated}, opts, "192.0.2.10", cfg, nil)
+	if err != nil {
+		t.Fatalf("collectEvidence: %v", err)
+	}
+	// The entry before --since and the allow_urls request are left out, and
+	// the rotated log is merged in time order.
+	if len(lines) != 2 || !strings.Contains(lines[0], "/wp-login.php") || !strings.Contains(lines[1], "/xmlrpc.php") {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if summary.Requests != 2 || summary.StatusCounts[404] != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	out := filepath.Join(t.TempDir(), "evidence.zip")
+	if err := writeEvidenceArchive(out, lines, summary); err != nil {
+		t.Fatalf("writeEvidenceArchive: %v", err)
+	}
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer zr.Close()
+	names := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "access.log,stats.json,summary.txt" {
+		t.Fatalf("unexpected archive contents: %v", names)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// fingerprintPaths is the number of most requested paths kept in a fingerprint.
+	fingerprintPaths = 20
+	// rotationMinRequests ignores IPs too quiet to fingerprint meaningfully.
+	rotationMinRequests = 5
+	// rotationMinOverlap is the path-set Jaccard similarity required for a match.
+	rotationMinOverlap = 0.5
+)
+
+// Fingerprint describes how a client behaves independently of its IP.
+type Fingerprint struct {
+	UserAgent string   `json:"user_agent"`
+	Paths     []string `json:"paths"`
+	// Interval is the log2 bucket of the mean milliseconds between requests.
+	Interval int `json:"interval"`
+}
+
+// RotationFinding links an IP to a prior ban with the same fingerprint.
+type RotationFinding struct {
+	IP      string
+	Flagged bool
+	Overlap float64
+	Prior   BanRecord
+}
+
+func fingerprintFor(stat *IPStats) Fingerprint {
+	fp := Fingerprint{UserAgent: dominantAgent(stat)}
+
+	counts := make(map[string]int, len(stat.PathCounts))
+	for uri, count := range stat.PathCounts {
+		counts[normalizeFingerprintPath(uri)] += count
+	}
+	paths := make([]string, 0, len(counts))
+	for path := range counts {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if counts[paths[i]] == counts[paths[j]] {
+			return paths[i] < paths[j]
+		}
+		return counts[paths[i]] > counts[paths[j]]
+	})
+	if len(paths) > fingerprintPaths {
+		paths = paths[:fingerprintPaths]
+	}
+	sort.Strings(paths)
+	fp.Paths = paths
+
+	if stat.Requests > 1 {
+		mean := stat.LastSeen.Sub(stat.FirstSeen).Milliseconds() / int64(stat.Requests-1)
+		if mean > 0 {
+			fp.Interval = bits.Len64(uint64(mean))
+		}
+	}
+	return fp
+}
+
+// normalizeFingerprintPath drops the query and collapses numeric segments so
+// /item/123 and /item/456 count as the same path.
+func normalizeFingerprintPath(uri string) string {
+	if idx := strings.IndexAny(uri, "?#"); idx >= 0 {
+		uri = uri[:idx]
+	}
+	segments := strings.Split(strings.ToLower(uri), "/")
+	for i, segment := range segments {
+		if segment != "" && strings.IndexFunc(segment, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			segments[i] = ":n"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Match reports the path overlap with other when both fingerprints share a user
+// agent and request cadence.
+func (f Fingerprint) Match(other Fingerprint) (float64, bool) {
+	if f.UserAgent == "" || !strings.EqualFold(f.UserAgent, other.UserAgent) {
+		return 0, false
+	}
+	if diff := f.Interval - other.Interval; diff > 1 || diff < -1 {
+		return 0, false
+	}
+	overlap := jaccard(f.Paths, other.Paths)
+	return overlap, overlap >= rotationMinOverlap
+}
+
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, v := range a {
+		set[v] = struct{}{}
+	}
+	shared := 0
+	for _, v := range b {
+		if _, ok := set[v]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// RotationFindings returns IPs in this run whose fingerprint matches a prior
+// ban of a different IP, i.e. the same actor returning from a new address.
+func (a *Analyzer) RotationFindings(bans []BanRecord) []RotationFinding {
+	if len(bans) == 0 {
+		return nil
+	}
+	byAgent := make(map[string][]BanRecord)
+	banned := make(map[string]struct{}, len(bans))
+	for _, ban := range bans {
+		banned[ban.IP] = struct{}{}
+		if ban.Fingerprint.UserAgent == "" {
+			continue
+		}
+		key := strings.ToLower(ban.Fingerprint.UserAgent)
+		byAgent[key] = append(byAgent[key], ban)
+	}
+
+	findings := make([]RotationFinding, 0)
+	for ip, stat := range a.stats {
+		if stat.Requests < rotationMinRequests || a.isAllowed(ip) {
+			continue
+		}
+		if _, ok := banned[ip]; ok {
+			continue
+		}
+		fp := fingerprintFor(stat)
+		best := RotationFinding{IP: ip}
+		for _, ban := range byAgent[strings.ToLower(fp.UserAgent)] {
+			if overlap, ok := fp.Match(ban.Fingerprint); ok && overlap > best.Overlap {
+				best.Overlap = overlap
+				best.Prior = ban
+			}
+		}
+		if best.Prior.IP == "" {
+			continue
+		}
+		_, best.Flagged = a.evaluate(stat)
+		findings = append(findings, best)
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Overlap == findings[j].Overlap {
+			return findings[i].IP < findings[j].IP
+		}
+		return findings[i].Overlap > findings[j].Overlap
+	})
+	return findings
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func feedActor(analyzer *Analyzer, ip, ua string, start time.Time, offset int) {
+	for i := 0; i < 10; i++ {
+		analyzer.Process(Entry{
+			ClientIP:  ip,
+			Time:      start.Add(time.Duration(i) * 2 * time.Second),
+			URI:       fmt.Sprintf("/product/%d?ref=%d", offset+i, i),
+			Status:    200,
+			UserAgent: ua,
+		})
+		analyzer.Process(Entry{ClientIP: ip, Time: start.Add(time.Duration(i)*2*time.Second + time.Second), URI: "/cart", Status: 200, UserAgent: ua})
+	}
+}
+
+func TestNormalizeFingerprintPath(t *testing.T) {
+	if got := normalizeFingerprintPath("/Item/123/reviews?page=2"); got != "/item/:n/reviews" {
+		t.Fatalf("unexpected normalized path %q", got)
+	}
+}
+
+func TestRotationFindingsMatchPriorBan(t *testing.T) {
+	cfg := DefaultConfig()
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	before := New(cfg, nil)
+	feedActor(before, "192.0.2.10", "ScraperKit/2.1", start, 0)
+	stat := before.stats["192.0.2.10"]
+	bans := []BanRecord{{IP: "192.0.2.10", RunID: "run-1", BannedAt: start, Score: 5, Fingerprint: fingerprintFor(stat)}}
+
+	after := New(cfg, nil)
+	feedActor(after, "198.51.100.20", "ScraperKit/2.1", start.Add(time.Hour), 500)
+	feedActor(after, "198.51.100.21", "Mozilla/5.0", start.Add(time.Hour), 500)
+	feedActor(after, "192.0.2.10", "ScraperKit/2.1", start.Add(time.Hour), 0)
+
+	findings := after.RotationFindings(bans)
+	if len(findings) != 1 {
+		t.Fatalf("expected one rotation finding, got %+v", findings)
+	}
+	if findings[0].IP != "198.51.100.20" || findings[0].Prior.RunID != "run-1" || findings[0].Overlap != 1 {
+		t.Fatalf("unexpected finding %+v", findings[0])
+	}
+}
+
+func TestFingerprintMatchRequiresCadence(t *testing.T) {
+	a := Fingerprint{UserAgent: "bot", Paths: []string{"/a", "/b"}, Interval: 10}
+	b := Fingerprint{UserAgent: "BOT", Paths: []string{"/a", "/b", "/c"}, Interval: 11}
+	if overlap, ok := a.Match(b); !ok || overlap < 0.6 {
+		t.Fatalf("expected match, got %.2f %v", overlap, ok)
+	}
+	b.Interval = 14
+	if _, ok := a.Match(b); ok {
+		t.Fatalf("expected different cadence to not match")
+	}
+}
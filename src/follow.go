@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultFollowPoll = 250 * time.Millisecond
+
+// followReader reads a growing file like `tail -F`: at end of file it waits for
+// more data instead of returning io.EOF, until done is closed. When path is
+// set, rotation is detected at end of file: a new file at path (rename and
+// create) is opened from its start once the old one is read to the end, and a
+// file truncated in place (copytruncate) is read again from its start.
+type followReader struct {
+	f    *os.File
+	path string
+	poll time.Duration
+	done <-chan struct{}
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		if r.path != "" && r.reopen() {
+			continue
+		}
+		select {
+		case <-r.done:
+			return 0, io.EOF
+		case <-time.After(r.poll):
+		}
+	}
+}
+
+// reopen checks path for rotation after the current file was read to the end
+// and switches to the file now there. It reports whether there may be more to
+// read. Errors, such as path being briefly absent between rename and create,
+// keep the current file until the next poll.
+func (r *followReader) reopen() bool {
+	current, err := r.f.Stat()
+	if err != nil {
+		return false
+	}
+	latest, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	if os.SameFile(current, latest) {
+		offset, err := r.f.Seek(0, io.SeekCurrent)
+		if err != nil || latest.Size() >= offset {
+			return false
+		}
+		log.Printf("%s was truncated, reading from the start", r.path)
+		_, err = r.f.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	fh, err := os.Open(r.path)
+	if err != nil {
+		return false
+	}
+	// Lines written to the old file since the last read are still read
+	// before switching.
+	if n, _ := r.f.Seek(0, io.SeekCurrent); n < current.Size() {
+		fh.Close()
+		return true
+	}
+	log.Printf("%s was rotated, reopening", r.path)
+	r.f.Close()
+	r.f = fh
+	return true
+}
+
+// Close closes the file currently read.
+func (r *followReader) Close() error {
+	return r.f.Close()
+}
+
+// FollowOptions configures what a follow run does when suspects appear.
+type FollowOptions struct {
+	Window     time.Duration
+	Interval   time.Duration
+	Colorize   bool
+	DenyOutput string
+	Deny       DenyOptions
+	// Canary keeps new suspects log-only in CanaryOutput for this long.
+	Canary       time.Duration
+	CanaryOutput string
+	NginxReload  bool
+	NginxBin     string
+	BlockLog     string
+	Notify       NotifyConfig
+	Vhost        string
+	Sampler      *Sampler
+	Telemetry    *Telemetry
+	Problems     *Problems
+	// DeadLetter records buffered entries that allow rules exclude.
+	DeadLetter *DeadLetter
+	// AllowSources refreshes allowlist entries kept outside the config.
+	AllowSources *allowRefresher
+	// ChallengePassed is reread every tick for IPs that solved a challenge.
+	ChallengePassed string
+	// API queues the bans and unbans of the HTTP API and lists the blocked set.
+	API *followAPI
+}
+
+// blockedSuspect is a suspect kept in the deny file until it expires.
+type blockedSuspect struct {
+	Suspicion
+	Expires time.Time
+	// Since is when the suspect was first flagged; Staged is set while it is
+	// still in the canary period.
+	Since  time.Time
+	Staged bool
+}
+
+// Follower re-evaluates a LivePipeline on every tick and maintains the set of
+// blocked IPs. Blocks outlive the sliding window and expire after the deny
+// expiry for their severity.
+type Follower struct {
+	pipeline *LivePipeline
+	opts     FollowOptions
+	run      RunInfo
+	blocked  map[string]blockedSuspect
+	// released maps IPs unbanned through the API to when their scoring resumes.
+	released map[string]time.Time
+	// reload runs after the deny file changes; it defaults to runNginxReload.
+	reload func(binary string) error
+	// excluder applies the allow rules for the dead-letter file; each tick's
+	// analyzer would record every entry again.
+	excluder *Analyzer
+}
+
+func newFollower(cfg Config, geo GeoLookup, run RunInfo, opts FollowOptions) *Follower {
+	follower := &Follower{
+		pipeline: newLivePipeline(cfg, geo, opts.Window, opts.Interval),
+		opts:     opts,
+		run:      run,
+		blocked:  make(map[string]blockedSuspect),
+		released: make(map[string]time.Time),
+		reload:   runNginxReload,
+	}
+	if opts.DeadLetter != nil {
+		follower.excluder = New(cfg, nil)
+	}
+	return follower
+}
+
+// refreshAllowSources reloads the allow sources that are due and, when their
+// entries changed, applies them to the pipeline and the dead-letter excluder.
+func (f *Follower) refreshAllowSources(now time.Time) bool {
+	if f.opts.AllowSources == nil || !f.opts.AllowSources.Refresh(context.Background(), now) {
+		return false
+	}
+	f.opts.AllowSources.Apply(&f.pipeline.cfg)
+	if f.excluder != nil {
+		f.excluder = New(f.pipeline.cfg, nil)
+	}
+	log.Printf("allowlist updated: %d IPs, %d CIDRs", len(f.pipeline.cfg.AllowedIPs), len(f.pipeline.cfg.AllowedCIDRs))
+	return true
+}
+
+// Add buffers an entry unless it is already older than the window or sampled out.
+func (f *Follower) Add(entry Entry, now time.Time) {
+	if entry.Time.Before(now.Add(-f.pipeline.window)) {
+		return
+	}
+	if f.opts.Sampler != nil && !f.opts.Sampler.Sampled(entry) {
+		return
+	}
+	if f.opts.DeadLetter != nil {
+		f.opts.DeadLetter.Record(f.excluder, entry)
+	}
+	f.pipeline.Add(entry)
+}
+
+// Tick evaluates the window, reports new suspects and rewrites the deny file
+// when the blocked set changed.
+func (f *Follower) Tick(now time.Time) (LiveTick, error) {
+	span := f.opts.Telemetry.Start("botdeny.follow.tick", nil)
+	defer span.End()
+
+	if f.opts.DeadLetter != nil {
+		if err := f.opts.DeadLetter.Flush(); err != nil {
+			log.Printf("write dead-letter file: %v", err)
+		}
+	}
+	allowChanged := f.refreshAllowSources(now)
+	if f.opts.ChallengePassed != "" {
+		f.pipeline.cfg.ChallengePassedIPs = loadChallengePassed(f.opts.ChallengePassed, f.opts.Problems)
+	}
+	apiChanged := f.applyAPIActions(now)
+	tick := f.pipeline.Evaluate(now)
+	f.run.observeWindow(tick.Analyzer.Stats())
+	span.SetAttr("botdeny.entries", tick.Entries)
+	span.SetAttr("botdeny.new_suspects", len(tick.New))
+	printLiveTick(os.Stdout, f.opts.Colorize, "", tick)
+
+	changed := apiChanged
+	for ip, block := range f.blocked {
+		switch {
+		case !now.Before(block.Expires):
+			delete(f.blocked, ip)
+			changed = true
+		case allowChanged && tick.Analyzer.allowedBy(block.IP) != "":
+			delete(f.blocked, ip)
+			changed = true
+		case block.Staged && now.Sub(block.Since) >= f.opts.Canary:
+			block.Staged = false
+			f.blocked[ip] = block
+			changed = true
+		}
+	}
+	for _, suspect := range tick.Suspects {
+		if _, released := f.released[suspect.IP]; released {
+			continue
+		}
+		expires := now.Add(expiryFor(suspect.Severity, f.denyTTL(), f.opts.Deny.SeverityTTL))
+		prior, ok := f.blocked[suspect.key()]
+		if !ok || suspect.Severity > prior.Severity {
+			changed = true
+		}
+		if ok && prior.Expires.After(expires) {
+			expires = prior.Expires
+		}
+		block := blockedSuspect{Suspicion: suspect, Expires: expires, Since: now, Staged: f.opts.Canary > 0}
+		if ok {
+			block.Since, block.Staged = prior.Since, prior.Staged
+		}
+		f.blocked[suspect.key()] = block
+	}
+
+	if len(tick.New) > 0 {
+		if f.opts.BlockLog != "" {
+			if err := appendBlockLog(f.opts.BlockLog, f.run, tick.New); err != nil {
+				log.Printf("write block log: %v", err)
+			}
+		}
+		if f.opts.Notify.enabled() {
+			sendNotifications(f.opts.Notify, f.run, f.opts.Vhost, tick.New, f.opts.Problems)
+		}
+	}
+	if len(tick.NewIPSpikes) > 0 && len(f.opts.Notify.Alerts) > 0 {
+		sendNewIPAlert(f.opts.Notify, f.run, f.opts.Vhost, tick.NewIPSpikes, f.opts.Problems)
+	}
+	f.opts.API.publish(f.blocked, now)
+	f.opts.Telemetry.Gauge("botdeny.blocked", "{ip}", float64(len(f.blocked)))
+	flushTelemetry(f.opts.Telemetry)
+
+	if !changed || f.opts.DenyOutput == "" {
+		return tick, nil
+	}
+	suspects := f.Blocked()
+	var canary []Suspicion
+	if f.opts.Canary > 0 {
+		suspects, canary = splitCanary(suspects, f.staged())
+	}
+	outputs := denyOutputs(f.opts.DenyOutput, suspects, f.pipeline.cfg.VhostScopes)
+	paths := denyOutputPaths(f.opts.DenyOutput, outputs)
+	var backup *denyBackup
+	if f.opts.NginxReload {
+		written := paths
+		if f.opts.Canary > 0 {
+			written = append([]string{f.opts.CanaryOutput}, paths...)
+		}
+		var err error
+		if backup, err = backupDenyFiles(written); err != nil {
+			return tick, fmt.Errorf("write deny config: %w", err)
+		}
+	}
+	deny := f.opts.Deny
+	deny.Run = f.run
+	if f.opts.Canary > 0 {
+		if err := writeCanaryFile(f.opts.CanaryOutput, canary, deny); err != nil {
+			return tick, fmt.Errorf("write canary config: %w", err)
+		}
+		log.Printf("wrote canary config to %s (%d log-only entries)", f.opts.CanaryOutput, len(canary))
+	}
+	for _, path := range paths {
+		if err := writeDenyFile(path, outputs[path], deny); err != nil {
+			return tick, fmt.Errorf("write deny config: %w", err)
+		}
+		log.Printf("wrote deny config to %s (%d entries)", path, len(outputs[path]))
+	}
+	if f.opts.NginxReload {
+		err := reloadNginx(f.reload, f.opts.NginxBin, backup)
+		if errors.Is(err, errNginxConfigTest) {
+			// nginx keeps running the previous deny files; report the
+			// rejected ones and try again on the next change.
+			log.Printf("nginx reload: %v", err)
+			f.opts.Problems.Add(ProblemReload, err.Error())
+			sendReloadAlert(f.opts.Notify, f.run, f.opts.Vhost, err, f.opts.Problems)
+		} else if err != nil {
+			return tick, fmt.Errorf("nginx reload: %w", err)
+		}
+	}
+	return tick, nil
+}
+
+// applyAPIActions applies the bans and unbans queued by the API and reports
+// whether the blocked set changed. An unbanned IP is not blocked again until
+// the requests that got it blocked have left the window.
+func (f *Follower) applyAPIActions(now time.Time) bool {
+	for ip, until := range f.released {
+		if !now.Before(until) {
+			delete(f.released, ip)
+		}
+	}
+	changed := false
+	for _, action := range f.opts.API.takePending() {
+		if !action.Ban {
+			for key, block := range f.blocked {
+				if block.IP == action.IP {
+					delete(f.blocked, key)
+					changed = true
+				}
+			}
+			f.released[action.IP] = now.Add(f.pipeline.window)
+			log.Printf("%s unbanned through the API by %s", action.IP, action.Token)
+			continue
+		}
+		ttl := action.TTL
+		if ttl <= 0 {
+			ttl = f.denyTTL()
+		}
+		reason := "banned through the API by " + action.Token
+		if action.Reason != "" {
+			reason += ": " + action.Reason
+		}
+		block := blockedSuspect{
+			Suspicion: Suspicion{IP: action.IP, Severity: SeverityCritical, Reasons: []string{reason}, Stats: &IPStats{IP: action.IP}},
+			Expires:   now.Add(ttl),
+			Since:     now,
+		}
+		if prior, ok := f.blocked[action.IP]; ok && prior.Expires.After(block.Expires) {
+			block.Expires = prior.Expires
+		}
+		delete(f.released, action.IP)
+		f.blocked[action.IP] = block
+		changed = true
+		log.Printf("%s banned through the API by %s", action.IP, action.Token)
+	}
+	return changed
+}
+
+// Blocked lists the currently blocked suspects, highest score first.
+func (f *Follower) Blocked() []Suspicion {
+	suspects := make([]Suspicion, 0, len(f.blocked))
+	for _, block := range f.blocked {
+		suspects = append(suspects, block.Suspicion)
+	}
+	sort.Slice(suspects, func(i, j int) bool {
+		if suspects[i].Score != suspects[j].Score {
+			return suspects[i].Score > suspects[j].Score
+		}
+		return suspects[i].IP < suspects[j].IP
+	})
+	return suspects
+}
+
+// staged returns the blocked IPs still in their canary period.
+func (f *Follower) staged() map[string]bool {
+	staged := make(map[string]bool)
+	for _, block := range f.blocked {
+		if block.Staged {
+			staged[block.IP] = true
+		}
+	}
+	return staged
+}
+
+func (f *Follower) denyTTL() time.Duration {
+	if f.opts.Deny.TTL > 0 {
+		return f.opts.Deny.TTL
+	}
+	return 7 * 24 * time.Hour
+}
+
+// followLog tails path until ctx is cancelled, evaluating the follower every interval.
+func followLog(ctx context.Context, path string, streamOpts StreamOptions, follower *Follower) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	reader := &followReader{f: fh, path: path, poll: defaultFollowPoll, done: ctx.Done()}
+	defer reader.Close()
+	return followStream(path, reader, streamOpts, follower)
+}
+
+// followStream feeds the entries of r, named name in logs, to the follower
+// until r ends, evaluating the follower every interval.
+func followStream(name string, r io.Reader, streamOpts StreamOptions, follower *Follower) error {
+	return followSources(name, []followSource{{r: r}}, streamOpts, follower)
+}
+
+// followSource is one log read by followSources. Its entries without a
+// hostname are attributed to host.
+type followSource struct {
+	r    io.Reader
+	host string
+}
+
+// followSources is followStream for several logs read at once. It returns
+// as soon as one of them ends, so a lost source is not silently ignored.
+func followSources(name string, sources []followSource, streamOpts StreamOptions, follower *Follower) error {
+	// A daemon must not stop on one malformed line; count and report them per tick.
+	var unparsed atomic.Int64
+	var unparsedMu sync.Mutex
+	onUnparsed := streamOpts.OnUnparsed
+	streamOpts.Strict = false
+	// Batches would hold back new lines until enough of them arrive.
+	streamOpts.Workers = 1
+	streamOpts.OnUnparsed = func(line string, err error) {
+		unparsed.Add(1)
+		if onUnparsed != nil {
+			// Sources are parsed concurrently.
+			unparsedMu.Lock()
+			defer unparsedMu.Unlock()
+			onUnparsed(line, err)
+		} else {
+			follower.opts.Problems.Add(ProblemUnparsed, unparsedDetail(line, err))
+		}
+	}
+
+	entries := make(chan Entry)
+	errs := make(chan error, len(sources))
+	done := make(chan struct{})
+	defer close(done)
+	for _, source := range sources {
+		go func(source followSource) {
+			sourceEntries, sourceErrs := StreamWith(source.r, streamOpts)
+			for entry := range sourceEntries {
+				if entry.Hostname == "" {
+					entry.Hostname = source.host
+				}
+				select {
+				case entries <- entry:
+				case <-done:
+					// Drain so the parser goroutine can finish.
+					for range sourceEntries {
+					}
+				}
+			}
+			errs <- <-sourceErrs
+		}(source)
+	}
+	ticker := time.NewTicker(follower.pipeline.interval)
+	defer ticker.Stop()
+
+	log.Printf("following %s (window %s, interval %s)", name, follower.pipeline.window, follower.pipeline.interval)
+	for {
+		select {
+		case entry := <-entries:
+			follower.Add(entry, time.Now())
+		case err := <-errs:
+			return err
+		case now := <-ticker.C:
+			if _, err := follower.Tick(now); err != nil {
+				log.Printf("follow: %v", err)
+			}
+			if skipped := unparsed.Swap(0); skipped > 0 {
+				log.Printf("skipped %d unparsed lines", skipped)
+			}
+		}
+	}
+}
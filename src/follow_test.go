@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scannerEntries(ip string, at time.Time, n int) []Entry {
+	entries := make([]Entry, 0, n)
+	for i := 0; i < n; i++ {
+		entries = append(entries, Entry{ClientIP: ip, Time: at.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/x%d.php", i), Status: 404})
+	}
+	return entries
+}
+
+func TestFollowerKeepsBlocksUntilExpiry(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:      5 * time.Minute,
+		Interval:    time.Minute,
+		DenyOutput:  denyPath,
+		Deny:        DenyOptions{TTL: time.Hour, Minimal: true},
+		NginxReload: true,
+	})
+	reloads := 0
+	follower.reload = func(string) error {
+		reloads++
+		return nil
+	}
+
+	for _, entry := range scannerEntries("192.0.2.1", start, 40) {
+		follower.Add(entry, start)
+	}
+	follower.Add(Entry{ClientIP: "192.0.2.9", Time: start.Add(-time.Hour)}, start)
+	if _, err := follower.Tick(start.Add(time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	data, _ := os.ReadFile(denyPath)
+	if string(data) != "deny 192.0.2.1;\n" || reloads != 1 {
+		t.Fatalf("expected deny file with scanner and one reload, got %q after %d reloads", data, reloads)
+	}
+
+	// The scanner left the window, but its block lasts until the deny expiry.
+	tick, err := follower.Tick(start.Add(30 * time.Minute))
+	if err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	if len(tick.Suspects) != 0 || len(follower.Blocked()) != 1 || reloads != 1 {
+		t.Fatalf("expected block to persist without rewrite, got %d suspects, %d blocked, %d reloads", len(tick.Suspects), len(follower.Blocked()), reloads)
+	}
+
+	if _, err := follower.Tick(start.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	data, _ = os.ReadFile(denyPath)
+	if string(data) != "" || reloads != 2 {
+		t.Fatalf("expected expired block to be removed, got %q after %d reloads", data, reloads)
+	}
+}
+
+func TestFollowerDenyHeaderShowsWindow(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	follower := newFollower(cfg, nil, RunInfo{ID: "run-1"}, FollowOptions{
+		Window:     5 * time.Minute,
+		Interval:   time.Minute,
+		DenyOutput: denyPath,
+		Deny:       DenyOptions{TTL: time.Hour},
+	})
+	for _, entry := range scannerEntries("192.0.2.1", start, 40) {
+		follower.Add(entry, start)
+	}
+	if _, err := follower.Tick(start.Add(time.Minute)); err != nil {
+		t.Fatalf("tick: %v", err)
+	}
+	data, _ := os.ReadFile(denyPath)
+	if want := "# run run-1 window 2025-10-19T12:00:00Z/2025-10-19T12:00:39Z\n"; !strings.Contains(string(data), want) {
+		t.Fatalf("expected header %q, got:\n%s", want, data)
+	}
+}
+
+func TestFollowerRestoresDenyFileRejectedByNginx(t *testing.T) {
+	var alerts []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		alerts = append(alerts, body)
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	if err := os.WriteFile(denyPath, []byte("deny 192.0.2.200;\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	problems := newProblems()
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	follower := newFollower(cfg, nil, RunInfo{ID: "run-3"}, FollowOptions{
+		Window:      5 * time.Minute,
+		Interval:    time.Minute,
+		DenyOutput:  denyPath,
+		Deny:        DenyOptions{TTL: time.Hour, Minimal: true},
+		NginxReload: true,
+		Problems:    problems,
+		Notify: NotifyConfig{
+			Channels: map[string]NotifyChannel{"ops": {Type: notifyWebhook, URL: server.URL}},
+			Alerts:   []string{"ops"},
+		},
+	})
+	follower.reload = func(string) error {
+		return fmt.Errorf("%w: exit status 1\nunknown directive \"deny\"", errNginxConfigTest)
+	}
+
+	for _, entry := range scannerEntries("192.0.2.1", start, 40) {
+		follower.Add(entry, start)
+	}
+	if _, err := follower.Tick(start.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a rejected config not to fail the tick, got %v", err)
+	}
+	if data, _ := os.ReadFile(denyPath); string(data) != "deny 192.0.2.200;\n" {
+		t.Fatalf("expected the previous deny file to be restored, got %q", data)
+	}
+	if problems.Count(ProblemReload) != 1 {
+		t.Fatalf("expected one reload problem, got %d", problems.Count(ProblemReload))
+	}
+	if len(alerts) != 1 || alerts[0]["alert"] != "reload_failed" || alerts[0]["severity"] != "critical" || !strings.Contains(fmt.Sprint(alerts[0]["detail"]), "unknown directive") {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+
+	// Other reload failures leave the new file and fail the tick.
+	follower.reload = func(string) error { return errors.New("nginx -s reload failed") }
+	for _, entry := range scannerEntries("192.0.2.2", start.Add(time.Minute), 40) {
+		follower.Add(entry, start.Add(time.Minute))
+	}
+	if _, err := follower.Tick(start.Add(2 * time.Minute)); err == nil {
+		t.Fatal("expected the reload error to be returned")
+	}
+	if data, _ := os.ReadFile(denyPath); !strings.Contains(string(data), "192.0.2.2") {
+		t.Fatalf("expected the new deny file to stay, got %q", data)
+	}
+}
+
+func TestFollowLogTailsAppendedLines(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	denyPath := filepath.Join(dir, "deny.conf")
+	if err := os.WriteFile(logPath, []byte("not a log line\n"), 0o644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:     time.Hour,
+		Interval:   50 * time.Millisecond,
+		DenyOutput: denyPath,
+		Deny:       DenyOptions{Minimal: true},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- followLog(ctx, logPath, StreamOptions{}, follower) }()
+
+	fh, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(fh, "198.51.100.4 - - [%s] \"GET /x%d.php HTTP/1.1\" 404 12 \"-\" \"zgrab\"\n", now.Add(time.Duration(i-60)*time.Second).Format(timeLayout), i)
+	}
+	fh.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(denyPath)
+		if strings.Contains(string(data), "deny 198.51.100.4;") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deny file never picked up appended attack, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("followLog: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("followLog did not stop after cancel")
+	}
+}
+
+func TestFollowReaderReopensRotatedLogs(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "access.log")
+	appendLines := func(path string, lines ...string) {
+		t.Helper()
+		fh, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatalf("open log: %v", err)
+		}
+		for _, line := range lines {
+			fmt.Fprintln(fh, line)
+		}
+		fh.Close()
+	}
+	appendLines(logPath, "one", "two")
+
+	fh, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	done := make(chan struct{})
+	reader := &followReader{f: fh, path: logPath, poll: 5 * time.Millisecond, done: done}
+	defer reader.Close()
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-lines:
+				if got != w {
+					t.Fatalf("read %q, want %q", got, w)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timed out waiting for %q", w)
+			}
+		}
+	}
+	expect("one", "two")
+
+	// logrotate's default: rename, then the server writes a last line to
+	// the old file before reopening the new one.
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	appendLines(logPath+".1", "three")
+	appendLines(logPath, "four")
+	expect("three", "four")
+
+	// copytruncate: the same file is emptied in place.
+	if err := os.Truncate(logPath, 0); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	appendLines(logPath, "5")
+	expect("5")
+
+	close(done)
+	select {
+	case line, ok := <-lines:
+		if ok {
+			t.Fatalf("unexpected extra line %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader did not stop after done")
+	}
+}
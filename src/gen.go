@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var genProfiles = []string{"scanner", "scraper", "bruteforce"}
+
+var (
+	genBrowserAgents = []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Safari/605.1.15",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Mobile/15E148 Safari/604.1",
+	}
+	genScannerAgents = []string{
+		"Mozilla/5.0 zgrab/0.x",
+		"python-requests/2.31.0",
+		"Mozilla/5.0 (compatible; Nmap Scripting Engine; https://nmap.org/book/nse.html)",
+		"curl/7.88.1",
+	}
+	genScannerPaths = []string{
+		"/wp-login.php", "/xmlrpc.php", "/.env", "/.git/config", "/phpmyadmin/index.php",
+		"/admin.php", "/config.php", "/wp-content/plugins/revslider/temp.php", "/cgi-bin/luci",
+		"/vendor/phpunit/phpunit/src/Util/PHP/eval-stdin.php", "/server-status", "/backup.zip",
+		"/index.php?id=1%27%20OR%20%271%27=%271", "/search?q=1%20UNION%20SELECT%20username,password%20FROM%20users",
+	}
+	genSitePaths = []string{"/", "/about", "/contact", "/blog", "/products", "/cart", "/search?q=shoes"}
+	genAssets    = []string{"/static/app.css?v=3", "/static/app.js?v=3", "/static/logo.png", "/favicon.ico"}
+)
+
+// GenOptions controls synthetic log generation.
+type GenOptions struct {
+	Profile    string
+	IPs        int
+	Background int
+	Duration   time.Duration
+	Start      time.Time
+	Seed       int64
+}
+
+// genRequest is a single synthetic request before formatting.
+type genRequest struct {
+	IP        string
+	Time      time.Time
+	Method    string
+	URI       string
+	Status    int
+	Bytes     int
+	Referer   string
+	UserAgent string
+	Seconds   float64
+}
+
+func (r genRequest) String() string {
+	return fmt.Sprintf("%s - - [%s] \"%s %s HTTP/1.1\" %d %d \"%s\" \"%s\" \"-\" %.3f",
+		r.IP, r.Time.Format(timeLayout), r.Method, r.URI, r.Status, r.Bytes, r.Referer, r.UserAgent, r.Seconds)
+}
+
+// genAddr returns the n-th address of a documentation range (RFC 5737), spilling
+// into 2001:db8::/32 once the IPv4 block is exhausted.
+func genAddr(prefix string, v6Block, n int) string {
+	if n < 254 {
+		return fmt.Sprintf("%s.%d", prefix, n+1)
+	}
+	return fmt.Sprintf("2001:db8:%x::%x", v6Block, n)
+}
+
+// generateLog writes a synthetic access log for the chosen attack profile mixed
+// with benign browsing sessions, ordered by time.
+func generateLog(w io.Writer, opts GenOptions) error {
+	if !containsStringCI(opts.Profile, genProfiles) {
+		return fmt.Errorf("unknown profile %q (want %s)", opts.Profile, strings.Join(genProfiles, ", "))
+	}
+	if opts.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	requests := make([]genRequest, 0)
+
+	for i := 0; i < opts.Background; i++ {
+		requests = append(requests, genBrowsing(rng, genAddr("192.0.2", 1, i), opts)...)
+	}
+	for i := 0; i < opts.IPs; i++ {
+		ip := genAddr("203.0.113", 2, i)
+		switch strings.ToLower(opts.Profile) {
+		case "scanner":
+			requests = append(requests, genScanner(rng, ip, opts)...)
+		case "scraper":
+			requests = append(requests, genScraper(rng, ip, opts)...)
+		case "bruteforce":
+			requests = append(requests, genBruteforce(rng, ip, opts)...)
+		}
+	}
+
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].Time.Before(requests[j].Time) })
+	buf := bufio.NewWriter(w)
+	for _, req := range requests {
+		if _, err := fmt.Fprintln(buf, req.String()); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// genOffset picks a random start within the first part of the generated window.
+func genOffset(rng *rand.Rand, opts GenOptions, share float64) time.Time {
+	return opts.Start.Add(time.Duration(rng.Int63n(int64(float64(opts.Duration)*share) + 1)))
+}
+
+func genBrowsing(rng *rand.Rand, ip string, opts GenOptions) []genRequest {
+	ua := genBrowserAgents[rng.Intn(len(genBrowserAgents))]
+	at := genOffset(rng, opts, 0.9)
+	end := opts.Start.Add(opts.Duration)
+	pages := 3 + rng.Intn(10)
+	requests := make([]genRequest, 0, pages*3)
+	referer := "-"
+	for p := 0; p < pages && at.Before(end); p++ {
+		page := genSitePaths[rng.Intn(len(genSitePaths))]
+		if rng.Intn(3) == 0 {
+			page = fmt.Sprintf("/product/%d", 1000+rng.Intn(500))
+		}
+		status := 200
+		if rng.Intn(40) == 0 {
+			status = 404
+		}
+		requests = append(requests, genRequest{IP: ip, Time: at, Method: "GET", URI: page, Status: status, Bytes: 8000 + rng.Intn(40000), Referer: referer, UserAgent: ua, Seconds: 0.02 + rng.Float64()*0.2})
+		if p == 0 {
+			for _, asset := range genAssets {
+				requests = append(requests, genRequest{IP: ip, Time: at.Add(200 * time.Millisecond), Method: "GET", URI: asset, Status: 200, Bytes: 2000 + rng.Intn(90000), Referer: "https://example.com" + page, UserAgent: ua, Seconds: 0.001})
+			}
+		}
+		referer = "https://example.com" + page
+		at = at.Add(time.Duration(5+rng.Intn(90)) * time.Second)
+	}
+	return requests
+}
+
+func genScanner(rng *rand.Rand, ip string, opts GenOptions) []genRequest {
+	ua := genScannerAgents[rng.Intn(len(genScannerAgents))]
+	at := genOffset(rng, opts, 0.8)
+	count := 60 + rng.Intn(200)
+	requests := make([]genRequest, 0, count)
+	for i := 0; i < count; i++ {
+		uri := genScannerPaths[rng.Intn(len(genScannerPaths))]
+		if rng.Intn(2) == 0 {
+			uri = fmt.Sprintf("/%s.php", randomToken(rng, 6))
+		}
+		status := 404
+		if rng.Intn(10) == 0 {
+			status = 403
+		}
+		requests = append(requests, genRequest{IP: ip, Time: at, Method: "GET", URI: uri, Status: status, Bytes: 150 + rng.Intn(400), Referer: "-", UserAgent: ua, Seconds: 0.001 + rng.Float64()*0.01})
+		at = at.Add(time.Duration(50+rng.Intn(500)) * time.Millisecond)
+	}
+	return requests
+}
+
+func genScraper(rng *rand.Rand, ip string, opts GenOptions) []genRequest {
+	ua := genBrowserAgents[rng.Intn(len(genBrowserAgents))]
+	at := genOffset(rng, opts, 0.5)
+	end := opts.Start.Add(opts.Duration)
+	requests := make([]genRequest, 0)
+	for page := rng.Intn(100); at.Before(end); page++ {
+		uri := fmt.Sprintf("/product/%d", 1000+page)
+		if page%10 == 0 {
+			uri = fmt.Sprintf("/products?page=%d", page/10)
+		}
+		status := 200
+		if rng.Intn(25) == 0 {
+			status = 404
+		}
+		requests = append(requests, genRequest{IP: ip, Time: at, Method: "GET", URI: uri, Status: status, Bytes: 20000 + rng.Intn(60000), Referer: "-", UserAgent: ua, Seconds: 0.1 + rng.Float64()*0.4})
+		// Scrapers fetch with several workers in parallel, so gaps are short.
+		at = at.Add(time.Duration(100+rng.Intn(300)) * time.Millisecond)
+	}
+	return requests
+}
+
+func genBruteforce(rng *rand.Rand, ip string, opts GenOptions) []genRequest {
+	ua := genBrowserAgents[rng.Intn(len(genBrowserAgents))]
+	if rng.Intn(2) == 0 {
+		ua = genScannerAgents[1]
+	}
+	target := []string{"/wp-login.php", "/sign_in", "/admin/login"}[rng.Intn(3)]
+	at := genOffset(rng, opts, 0.7)
+	end := opts.Start.Add(opts.Duration)
+	count := 100 + rng.Intn(400)
+	requests := make([]genRequest, 0, count)
+	for i := 0; i < count && at.Before(end); i++ {
+		requests = append(requests, genRequest{IP: ip, Time: at, Method: "POST", URI: target, Status: 401, Bytes: 1200 + rng.Intn(200), Referer: "-", UserAgent: ua, Seconds: 0.2 + rng.Float64()*0.3})
+		at = at.Add(time.Duration(500+rng.Intn(2500)) * time.Millisecond)
+	}
+	return requests
+}
+
+func randomToken(rng *rand.Rand, n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rng.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func runGen(args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	profile := fs.String("profile", "", "attack profile to generate: scanner, scraper or bruteforce")
+	ips := fs.Int("ips", 50, "number of attacking IPs")
+	background := fs.Int("background", 100, "number of benign browsing sessions mixed in")
+	duration := fs.Duration("duration", time.Hour, "time span covered by the log")
+	startFlag := fs.String("start", "", "RFC3339 timestamp of the first request (default: duration before now)")
+	seed := fs.Int64("seed", 0, "random seed for reproducible output (default: time based)")
+	output := fs.String("out", "", "write the log to this file instead of stdout")
+	fs.Parse(args)
+
+	if *profile == "" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny gen --profile scanner|scraper|bruteforce [--ips 50] [--duration 1h] [--background 100] [--out access.log]")
+		return 2
+	}
+	opts := GenOptions{
+		Profile:    *profile,
+		IPs:        *ips,
+		Background: *background,
+		Duration:   *duration,
+		Start:      time.Now().Add(-*duration).Truncate(time.Second),
+		Seed:       *seed,
+	}
+	if *startFlag != "" {
+		start, err := time.Parse(time.RFC3339, *startFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --start: %v\n", err)
+			return 2
+		}
+		opts.Start = start
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		fh, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create output: %v\n", err)
+			return 1
+		}
+		defer fh.Close()
+		w = fh
+	}
+	if err := generateLog(w, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateLogProfiles(t *testing.T) {
+	for _, profile := range genProfiles {
+		opts := GenOptions{
+			Profile:    profile,
+			IPs:        3,
+			Background: 10,
+			Duration:   time.Hour,
+			Start:      time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC),
+			Seed:       42,
+		}
+		var first, second bytes.Buffer
+		if err := generateLog(&first, opts); err != nil {
+			t.Fatalf("%s: generateLog: %v", profile, err)
+		}
+		generateLog(&second, opts)
+		if first.String() != second.String() {
+			t.Fatalf("%s: expected identical output for the same seed", profile)
+		}
+
+		analyzer := New(DefaultConfig(), nil)
+		for _, line := range strings.Split(strings.TrimSpace(first.String()), "\n") {
+			entry, err := ParseLine(line)
+			if err != nil {
+				t.Fatalf("%s: generated line does not parse: %q: %v", profile, line, err)
+			}
+			analyzer.Process(entry)
+		}
+
+		suspects := analyzer.Suspicious()
+		if len(suspects) != opts.IPs {
+			t.Fatalf("%s: expected %d attackers flagged, got %d", profile, opts.IPs, len(suspects))
+		}
+		for _, suspect := range suspects {
+			if !strings.HasPrefix(suspect.IP, "203.0.113.") {
+				t.Fatalf("%s: benign session flagged: %s", profile, suspect.IP)
+			}
+		}
+	}
+}
+
+func TestGenerateLogRejectsUnknownProfile(t *testing.T) {
+	var out bytes.Buffer
+	if err := generateLog(&out, GenOptions{Profile: "ddos", Duration: time.Hour}); err == nil {
+		t.Fatalf("expected unknown profile to fail")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	geoip2 "github.com/oschwald/geoip2-golang"
+)
+
+// defaultGeoMaxAge is how old the GeoIP database may get before runs warn
+// about it. MaxMind publishes GeoLite2 updates twice a week.
+const defaultGeoMaxAge = 30 * 24 * time.Hour
+
+// GeoDBInfo is the metadata of a country database.
+type GeoDBInfo struct {
+	Path        string
+	Type        string
+	Description string
+	Built       time.Time
+	Languages   []string
+	IPVersion   uint
+	Nodes       uint
+}
+
+// readGeoDBInfo reads the metadata of a MaxMind database.
+func readGeoDBInfo(path string) (GeoDBInfo, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return GeoDBInfo{}, err
+	}
+	defer reader.Close()
+	meta := reader.Metadata()
+	return GeoDBInfo{
+		Path:        path,
+		Type:        meta.DatabaseType,
+		Description: meta.Description["en"],
+		Built:       time.Unix(int64(meta.BuildEpoch), 0).UTC(),
+		Languages:   meta.Languages,
+		IPVersion:   meta.IPVersion,
+		Nodes:       meta.NodeCount,
+	}, nil
+}
+
+// ageDays is how many whole days before now the database was built.
+func (i GeoDBInfo) ageDays(now time.Time) int {
+	return int(now.Sub(i.Built) / (24 * time.Hour))
+}
+
+// staleWarning describes a database built more than maxAge before now, or
+// returns "" when it is recent enough or maxAge is 0.
+func (i GeoDBInfo) staleWarning(now time.Time, maxAge time.Duration) string {
+	if maxAge <= 0 || now.Sub(i.Built) <= maxAge {
+		return ""
+	}
+	return fmt.Sprintf("%s was built on %s, %d days ago (geoip_max_age %s)", i.Path, i.Built.Format("2006-01-02"), i.ageDays(now), maxAge)
+}
+
+func printGeoDBInfo(w io.Writer, info GeoDBInfo, now time.Time) {
+	fmt.Fprintf(w, "path:          %s\n", info.Path)
+	fmt.Fprintf(w, "type:          %s\n", info.Type)
+	if info.Description != "" {
+		fmt.Fprintf(w, "description:   %s\n", info.Description)
+	}
+	fmt.Fprintf(w, "built:         %s (%d days ago)\n", info.Built.Format(time.RFC3339), info.ageDays(now))
+	fmt.Fprintf(w, "languages:     %s\n", strings.Join(info.Languages, ", "))
+	if info.IPVersion > 0 {
+		fmt.Fprintf(w, "ip version:    %d\n", info.IPVersion)
+	}
+	if info.Nodes > 0 {
+		fmt.Fprintf(w, "nodes:         %d\n", info.Nodes)
+	}
+}
+
+// printGeoMarker flags a report made without, or with outdated, country data.
+func printGeoMarker(colorize bool, marker string) {
+	fmt.Println(maybeColor(colorize, ansiYellow, marker))
+}
+
+func runGeoIP(args []string) int {
+	if len(args) == 0 || args[0] != "info" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny geoip info [--config file] [--geo-provider name] [--geoip-db file]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("geoip info", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	geoDB := fs.String("geoip-db", "", "database to describe (default: geoip_db from --config)")
+	geoProvider := fs.String("geo-provider", "", "kind of database: "+strings.Join(geoProviderNames(), ", ")+" (default: geo_provider from --config)")
+	fs.Parse(args[1:])
+
+	_, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *geoDB == "" {
+		*geoDB = defaults.GeoIPDB
+	}
+	if *geoProvider == "" {
+		*geoProvider = defaults.GeoProvider
+	}
+	provider, err := geoProviderFor(*geoProvider)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *geoDB == "" {
+		fmt.Fprintln(os.Stderr, "no GeoIP database: pass --geoip-db or set geoip_db")
+		return 2
+	}
+	info, err := provider.Info(*geoDB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open geoip db: %v\n", err)
+		return 1
+	}
+	now := time.Now()
+	printGeoDBInfo(os.Stdout, info, now)
+	if warning := info.staleWarning(now, defaults.GeoIPMaxAge); warning != "" {
+		fmt.Fprintf(os.Stderr, "stale: %s\n", warning)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeoDBStaleWarning(t *testing.T) {
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	info := GeoDBInfo{Path: "/usr/share/GeoIP/GeoLite2-Country.mmdb", Built: now.Add(-45 * 24 * time.Hour)}
+
+	warning := info.staleWarning(now, defaultGeoMaxAge)
+	if !strings.Contains(warning, "built on 2025-09-04, 45 days ago") {
+		t.Fatalf("unexpected warning %q", warning)
+	}
+	if warning := info.staleWarning(now, 60*24*time.Hour); warning != "" {
+		t.Fatalf("expected no warning within the limit, got %q", warning)
+	}
+	if warning := info.staleWarning(now, 0); warning != "" {
+		t.Fatalf("expected 0 to disable the check, got %q", warning)
+	}
+}
+
+func TestPrintGeoDBInfo(t *testing.T) {
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	info := GeoDBInfo{
+		Path:        "GeoLite2-Country.mmdb",
+		Type:        "GeoLite2-Country",
+		Description: "GeoLite2 Country database",
+		Built:       time.Date(2025, 10, 14, 16, 0, 0, 0, time.UTC),
+		Languages:   []string{"de", "en"},
+		IPVersion:   6,
+		Nodes:       1234,
+	}
+	var out bytes.Buffer
+	printGeoDBInfo(&out, info, now)
+	for _, want := range []string{"type:          GeoLite2-Country\n", "built:         2025-10-14T16:00:00Z (4 days ago)\n", "languages:     de, en\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunGeoIPInfoMissingDatabase(t *testing.T) {
+	if code := runGeoIP(nil); code != 2 {
+		t.Fatalf("expected usage exit code 2, got %d", code)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.mmdb")
+	if code := runGeoIP([]string{"info", "--geoip-db", missing}); code != 1 {
+		t.Fatalf("expected exit code 1 for a missing database, got %d", code)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net"
+	"slices"
+	"strings"
 
 	geoip2 "github.com/oschwald/geoip2-golang"
 )
@@ -13,23 +16,88 @@ type GeoLookup func(ip string) (GeoInfo, bool)
 type GeoInfo struct {
 	CountryISO  string
 	CountryName string
+	// ASN and ASOrg come from an ASN database, see newASNLookup.
+	ASN   uint
+	ASOrg string
 }
 
-// newGeoLookup opens a MaxMind-compatible database and returns a lookup function plus closer.
-func newGeoLookup(path string) (GeoLookup, func() error, error) {
+// defaultGeoLocale is the language of country names when geoip_locale is unset.
+const defaultGeoLocale = "en"
+
+// defaultGeoProvider reads MaxMind databases when geo_provider is unset.
+const defaultGeoProvider = "maxmind"
+
+// GeoProvider reads one kind of country database.
+type GeoProvider struct {
+	// Open returns a lookup function plus closer, as newGeoLookup does.
+	Open func(path, locale string, problems *Problems) (GeoLookup, func() error, error)
+	// Info describes the database for geoip info and the staleness check.
+	Info func(path string) (GeoDBInfo, error)
+}
+
+// geoProviders are the country databases geo_provider can name.
+var geoProviders = map[string]GeoProvider{
+	"maxmind":     {Open: newMaxMindLookup, Info: readGeoDBInfo},
+	"ip2location": {Open: newIP2LocationLookup, Info: readIP2LocationInfo},
+	"csv":         {Open: newGeoRangesLookup, Info: readGeoRangesInfo},
+}
+
+func geoProviderFor(name string) (GeoProvider, error) {
+	if name == "" {
+		name = defaultGeoProvider
+	}
+	provider, ok := geoProviders[name]
+	if !ok {
+		return GeoProvider{}, fmt.Errorf("unknown geo_provider %q (want %s)", name, strings.Join(geoProviderNames(), ", "))
+	}
+	return provider, nil
+}
+
+func geoProviderNames() []string {
+	names := make([]string, 0, len(geoProviders))
+	for name := range geoProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// newGeoLookup opens the country database at path with the named provider.
+// Country names are given in locale, such as "de" or "pt-BR", falling back to
+// English for countries the database does not name in that language.
+// Failed lookups are recorded in problems; an IP missing from the database is not a failure.
+func newGeoLookup(provider, path, locale string, problems *Problems) (GeoLookup, func() error, error) {
+	p, err := geoProviderFor(provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if locale == "" {
+		locale = defaultGeoLocale
+	}
+	return p.Open(path, locale, problems)
+}
+
+// newMaxMindLookup opens a MaxMind-compatible database (GeoIP2 or GeoLite2 Country).
+func newMaxMindLookup(path, locale string, problems *Problems) (GeoLookup, func() error, error) {
 	reader, err := geoip2.Open(path)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := checkGeoLocale(reader.Metadata().Languages, locale); err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
 
 	lookup := func(ip string) (GeoInfo, bool) {
 		parsed := net.ParseIP(ip)
 		if parsed == nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: invalid IP", ip))
 			return GeoInfo{}, false
 		}
 
 		record, err := reader.Country(parsed)
 		if err != nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: %v", ip, err))
 			return GeoInfo{}, false
 		}
 
@@ -38,9 +106,7 @@ func newGeoLookup(path string) (GeoLookup, func() error, error) {
 			if record.Country.IsoCode != "" {
 				info.CountryISO = record.Country.IsoCode
 			}
-			if name, ok := record.Country.Names["en"]; ok {
-				info.CountryName = name
-			}
+			info.CountryName = localizedName(record.Country.Names, locale)
 		}
 		if info.CountryISO == "" && info.CountryName == "" {
 			return GeoInfo{}, false
@@ -54,3 +120,19 @@ func newGeoLookup(path string) (GeoLookup, func() error, error) {
 
 	return lookup, closer, nil
 }
+
+// checkGeoLocale rejects a locale the database has no names for.
+func checkGeoLocale(languages []string, locale string) error {
+	if len(languages) == 0 || slices.Contains(languages, locale) {
+		return nil
+	}
+	return fmt.Errorf("geoip_locale %q: database has names in %s", locale, strings.Join(languages, ", "))
+}
+
+// localizedName picks the name in locale, or the English one.
+func localizedName(names map[string]string, locale string) string {
+	if name, ok := names[locale]; ok {
+		return name
+	}
+	return names[defaultGeoLocale]
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLocalizedName(t *testing.T) {
+	names := map[string]string{"en": "Germany", "de": "Deutschland", "ja": "ドイツ連邦共和国"}
+	cases := map[string]string{
+		"de":    "Deutschland",
+		"ja":    "ドイツ連邦共和国",
+		"pt-BR": "Germany",
+		"en":    "Germany",
+	}
+	for locale, want := range cases {
+		if got := localizedName(names, locale); got != want {
+			t.Errorf("localizedName(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestCheckGeoLocale(t *testing.T) {
+	languages := []string{"de", "en", "es", "fr", "ja", "pt-BR", "ru", "zh-CN"}
+	if err := checkGeoLocale(languages, "pt-BR"); err != nil {
+		t.Fatalf("expected pt-BR to be accepted, got %v", err)
+	}
+	err := checkGeoLocale(languages, "pt")
+	if err == nil || !strings.Contains(err.Error(), "pt-BR") {
+		t.Fatalf("expected the available languages in the error, got %v", err)
+	}
+	if err := checkGeoLocale(nil, "de"); err != nil {
+		t.Fatalf("expected databases without language metadata to accept any locale, got %v", err)
+	}
+}
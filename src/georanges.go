@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// geoRange is one row of a CSV range file.
+type geoRange struct {
+	First, Last netip.Addr
+	CountryISO  string
+	CountryName string
+}
+
+// loadGeoRanges reads a CSV file of first_ip,last_ip,country_code[,country_name]
+// rows, the layout of DB-IP's free country file and of IP2Location's LITE CSV,
+// which gives IPv4 addresses as decimal numbers. Blank lines and lines starting
+// with # are skipped. The ranges are returned sorted by their first address.
+func loadGeoRanges(path string) ([]geoRange, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	reader := csv.NewReader(fh)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	var ranges []geoRange
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 3 {
+			return nil, fmt.Errorf("%s:%d: want first_ip,last_ip,country_code[,country_name]", path, line)
+		}
+		first, err := parseRangeAddr(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		last, err := parseRangeAddr(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if first.Is4() != last.Is4() || last.Less(first) {
+			return nil, fmt.Errorf("%s:%d: %s-%s is not a range", path, line, first, last)
+		}
+		r := geoRange{First: first, Last: last, CountryISO: strings.TrimSpace(record[2])}
+		if len(record) > 3 {
+			r.CountryName = strings.TrimSpace(record[3])
+		}
+		// Reserved and unassigned ranges are listed with "-" or "ZZ".
+		if r.CountryISO == "" || r.CountryISO == "-" || r.CountryISO == "ZZ" {
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	slices.SortFunc(ranges, func(a, b geoRange) int { return a.First.Compare(b.First) })
+	return ranges, nil
+}
+
+// parseRangeAddr parses an IP address or an IPv4 address as a decimal number.
+func parseRangeAddr(value string) (netip.Addr, error) {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap(), nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", value)
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	return netip.AddrFrom4(b), nil
+}
+
+// findGeoRange returns the range holding addr, if any.
+func findGeoRange(ranges []geoRange, addr netip.Addr) (geoRange, bool) {
+	addr = addr.Unmap()
+	// The last range starting at or before addr.
+	i, _ := slices.BinarySearchFunc(ranges, addr, func(r geoRange, addr netip.Addr) int {
+		if r.First.Compare(addr) <= 0 {
+			return -1
+		}
+		return 1
+	})
+	if i == 0 {
+		return geoRange{}, false
+	}
+	r := ranges[i-1]
+	if addr.Is4() != r.First.Is4() || r.Last.Less(addr) {
+		return geoRange{}, false
+	}
+	return r, true
+}
+
+// newGeoRangesLookup reads a CSV range file into memory. Country names come
+// from the file, so locale must be the default; rows without a name report
+// only the code.
+func newGeoRangesLookup(path, locale string, problems *Problems) (GeoLookup, func() error, error) {
+	ranges, err := loadGeoRanges(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkGeoLocale([]string{defaultGeoLocale}, locale); err != nil {
+		return nil, nil, err
+	}
+	lookup := func(ip string) (GeoInfo, bool) {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: invalid IP", ip))
+			return GeoInfo{}, false
+		}
+		r, ok := findGeoRange(ranges, addr)
+		if !ok {
+			return GeoInfo{}, false
+		}
+		return GeoInfo{CountryISO: r.CountryISO, CountryName: r.CountryName}, true
+	}
+	return lookup, func() error { return nil }, nil
+}
+
+// readGeoRangesInfo describes a CSV range file. It has no build date, so the
+// file's modification time stands in for it.
+func readGeoRangesInfo(path string) (GeoDBInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return GeoDBInfo{}, err
+	}
+	return GeoDBInfo{
+		Path:      path,
+		Type:      "CSV ranges",
+		Built:     stat.ModTime().UTC(),
+		Languages: []string{defaultGeoLocale},
+	}, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeoRangesLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "countries.csv")
+	os.WriteFile(path, []byte(`# first_ip,last_ip,country_code,country_name
+198.51.100.0,198.51.100.255,FR,France
+"16777216","16777471","AU","Australia"
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,DE,Germany
+203.0.113.0,203.0.113.255,JP
+192.0.2.0,192.0.2.255,ZZ
+`), 0o644)
+
+	lookup, closer, err := newGeoLookup("csv", path, "", nil)
+	if err != nil {
+		t.Fatalf("newGeoLookup: %v", err)
+	}
+	defer closer()
+	cases := map[string]string{
+		"198.51.100.4":          "FR France",
+		"::ffff:198.51.100.200": "FR France",
+		"1.0.0.9":               "AU Australia",
+		"2001:db8::1":           "DE Germany",
+		"203.0.113.7":           "JP",
+		"192.0.2.1":             "",
+		"198.51.101.0":          "",
+		"10.0.0.1":              "",
+		"2001:db9::1":           "",
+	}
+	for ip, want := range cases {
+		info, ok := lookup(ip)
+		got := strings.TrimSpace(info.CountryISO + " " + info.CountryName)
+		if got != want || ok != (want != "") {
+			t.Errorf("lookup(%s) = %q, %v; want %q", ip, got, ok, want)
+		}
+	}
+}
+
+func TestGeoRangesRejectsBadRows(t *testing.T) {
+	for _, row := range []string{
+		"198.51.100.0,FR",
+		"198.51.100.9,198.51.100.0,FR",
+		"198.51.100.0,2001:db8::,FR",
+		"example.com,198.51.100.0,FR",
+	} {
+		path := filepath.Join(t.TempDir(), "countries.csv")
+		os.WriteFile(path, []byte("192.0.2.0,192.0.2.255,US\n"+row+"\n"), 0o644)
+		if _, _, err := newGeoLookup("csv", path, "", nil); err == nil || !strings.Contains(err.Error(), "countries.csv:2:") {
+			t.Errorf("expected %q to be rejected with its line, got %v", row, err)
+		}
+	}
+}
+
+func TestGeoProviderFor(t *testing.T) {
+	if _, err := geoProviderFor(""); err != nil {
+		t.Fatalf("expected the default provider, got %v", err)
+	}
+	_, err := geoProviderFor("geonames")
+	if err == nil || !strings.Contains(err.Error(), "csv, ip2location, maxmind") {
+		t.Fatalf("expected the known providers in the error, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// haproxyBatch is the number of Runtime API commands sent per connection.
+const haproxyBatch = 100
+
+// renderHAProxyACL writes an HAProxy pattern file for `src -f`. Pattern files
+// treat the whole line as the pattern, so comments go on their own line.
+func renderHAProxyACL(b *strings.Builder, items []denyItem, opts DenyOptions) {
+	for _, item := range items {
+		if item.Comment != "" {
+			fmt.Fprintf(b, "# %s\n", item.Comment)
+		}
+		fmt.Fprintf(b, "%s\n", item.IP)
+	}
+}
+
+// dialHAProxy connects to a Runtime API socket given as a unix socket path or host:port.
+func dialHAProxy(addr string) (net.Conn, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "unix@") {
+		network = "unix"
+		addr = strings.TrimPrefix(addr, "unix@")
+	}
+	return net.DialTimeout(network, addr, 5*time.Second)
+}
+
+// haproxyCommands sends semicolon-separated commands on one connection and
+// returns any non-empty response lines, which the Runtime API uses for errors.
+func haproxyCommands(addr string, commands []string) ([]string, error) {
+	conn, err := dialHAProxy(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if _, err := fmt.Fprintf(conn, "%s\n", strings.Join(commands, ";")); err != nil {
+		return nil, err
+	}
+	var messages []string
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	return messages, scanner.Err()
+}
+
+// pushHAProxyTable marks every valid suspect in a running stick table by
+// setting gpc0, so `http-request deny if { src,table_gpc0(<table>) gt 0 }`
+// blocks it until the table's own expire timer drops the entry.
+func pushHAProxyTable(addr, table string, suspects []Suspicion) (int, error) {
+	commands := make([]string, 0, len(suspects))
+	for _, suspect := range suspects {
+		if !isValidIP(suspect.IP) {
+			continue
+		}
+		commands = append(commands, fmt.Sprintf("set table %s key %s data.gpc0 1", table, suspect.IP))
+	}
+	pushed := 0
+	for start := 0; start < len(commands); start += haproxyBatch {
+		end := start + haproxyBatch
+		if end > len(commands) {
+			end = len(commands)
+		}
+		messages, err := haproxyCommands(addr, commands[start:end])
+		if err != nil {
+			return pushed, fmt.Errorf("haproxy runtime api %s: %w", addr, err)
+		}
+		if len(messages) > 0 {
+			return pushed, fmt.Errorf("haproxy runtime api %s: %s", addr, strings.Join(messages, "; "))
+		}
+		pushed = end
+	}
+	return pushed, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHAProxy serves the Runtime API on a unix socket, recording commands and
+// replying with reply for any command containing fail.
+func fakeHAProxy(t *testing.T, fail, reply string) (string, func() []string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	var commands []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			for _, cmd := range strings.Split(strings.TrimSpace(line), ";") {
+				mu.Lock()
+				commands = append(commands, cmd)
+				mu.Unlock()
+				if fail != "" && strings.Contains(cmd, fail) {
+					conn.Write([]byte(reply + "\n"))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return path, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), commands...)
+	}
+}
+
+func TestPushHAProxyTable(t *testing.T) {
+	addr, commands := fakeHAProxy(t, "", "")
+	suspects := make([]Suspicion, 0, haproxyBatch+2)
+	for i := 0; i < haproxyBatch+1; i++ {
+		suspects = append(suspects, Suspicion{IP: "192.0.2.1"})
+	}
+	suspects = append(suspects, Suspicion{IP: "not-an-ip"})
+
+	pushed, err := pushHAProxyTable(addr, "botdeny", suspects)
+	if err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if pushed != haproxyBatch+1 {
+		t.Fatalf("expected %d pushed, got %d", haproxyBatch+1, pushed)
+	}
+	got := commands()
+	if len(got) != haproxyBatch+1 || got[0] != "set table botdeny key 192.0.2.1 data.gpc0 1" {
+		t.Fatalf("unexpected commands (%d): %v", len(got), got[:1])
+	}
+}
+
+func TestPushHAProxyTableReportsErrors(t *testing.T) {
+	addr, _ := fakeHAProxy(t, "set table", "Unknown table. Please enter ...")
+	_, err := pushHAProxyTable(addr, "missing", []Suspicion{{IP: "192.0.2.1"}})
+	if err == nil || !strings.Contains(err.Error(), "Unknown table") {
+		t.Fatalf("expected runtime api error, got %v", err)
+	}
+}
+
+func TestWriteDenyFileHAProxy(t *testing.T) {
+	out := renderDenyFormat(t, "haproxy", denyFormatSuspects(), false)
+	if !strings.Contains(out, "# use with: http-request deny if { src -f ") {
+		t.Fatalf("missing usage hint:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "# score=4\n192.0.2.1\n# score=2\n2001:db8::1\n") {
+		t.Fatalf("unexpected haproxy acl file:\n%s", out)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// HeaderSet records which optional request headers a log line captures.
+type HeaderSet uint8
+
+const (
+	HeaderAcceptLanguage HeaderSet = 1 << iota
+	HeaderAccept
+	HeaderAcceptEncoding
+)
+
+// Header anomalies counted per IP; the report names the most frequent one.
+const (
+	anomalyEmptyHeaders  = "no Accept headers at all"
+	anomalyNoLanguage    = "browser UA without Accept-Language"
+	anomalyNoAccept      = "browser UA without Accept"
+	anomalyNoCompression = "browser UA without gzip in Accept-Encoding"
+)
+
+// setHeader stores a logged header value; "-" stands for an absent header.
+func (e *Entry) setHeader(header HeaderSet, value string) {
+	if value == "-" {
+		value = ""
+	}
+	switch header {
+	case HeaderAcceptLanguage:
+		e.AcceptLanguage = value
+	case HeaderAccept:
+		e.Accept = value
+	case HeaderAcceptEncoding:
+		e.AcceptEncoding = value
+	}
+	e.LoggedHeaders |= header
+}
+
+// headerAnomaly reports how the logged headers of an entry deviate from what
+// a client of the given class sends. Real browsers always send Accept,
+// Accept-Language and a gzip-capable Accept-Encoding; an empty header set is
+// suspicious whatever the user agent claims, when several headers are logged.
+func (e Entry) headerAnomaly(class UAClass) (string, bool) {
+	if e.LoggedHeaders == 0 {
+		return "", false
+	}
+	if bits.OnesCount8(uint8(e.LoggedHeaders)) > 1 && e.AcceptLanguage == "" && e.Accept == "" && e.AcceptEncoding == "" {
+		return anomalyEmptyHeaders, true
+	}
+	if class != UAClassBrowser {
+		return "", false
+	}
+	switch {
+	case e.LoggedHeaders&HeaderAcceptLanguage != 0 && e.AcceptLanguage == "":
+		return anomalyNoLanguage, true
+	case e.LoggedHeaders&HeaderAccept != 0 && e.Accept == "":
+		return anomalyNoAccept, true
+	case e.LoggedHeaders&HeaderAcceptEncoding != 0 && !strings.Contains(strings.ToLower(e.AcceptEncoding), "gzip"):
+		return anomalyNoCompression, true
+	}
+	return "", false
+}
+
+// recordHeaders counts the header anomalies of an entry for its IP.
+func (s *IPStats) recordHeaders(entry Entry, class UAClass) {
+	if entry.LoggedHeaders == 0 {
+		return
+	}
+	s.HeaderRequests++
+	issue, ok := entry.headerAnomaly(class)
+	if !ok {
+		return
+	}
+	s.HeaderAnomalies++
+	if s.headerIssues == nil {
+		s.headerIssues = make(map[string]int)
+	}
+	s.headerIssues[issue]++
+}
+
+// topHeaderIssue returns the most frequent header anomaly of an IP.
+func (s *IPStats) topHeaderIssue() string {
+	if names := namesByCount(s.headerIssues); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHeaderAnomaly(t *testing.T) {
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36"
+	all := HeaderAcceptLanguage | HeaderAccept | HeaderAcceptEncoding
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{"browser", Entry{UserAgent: chrome, AcceptLanguage: "en-US,en;q=0.9", Accept: "text/html", AcceptEncoding: "gzip, deflate, br", LoggedHeaders: all}, ""},
+		{"not logged", Entry{UserAgent: chrome}, ""},
+		{"empty set", Entry{UserAgent: "curl/8.0", LoggedHeaders: all}, anomalyEmptyHeaders},
+		{"script with accept", Entry{UserAgent: "python-requests/2.32", Accept: "*/*", AcceptEncoding: "gzip, deflate", LoggedHeaders: all}, ""},
+		{"no language", Entry{UserAgent: chrome, Accept: "text/html", AcceptEncoding: "gzip", LoggedHeaders: all}, anomalyNoLanguage},
+		{"no compression", Entry{UserAgent: chrome, AcceptLanguage: "en", Accept: "text/html", AcceptEncoding: "identity", LoggedHeaders: all}, anomalyNoCompression},
+		{"only language logged", Entry{UserAgent: chrome, AcceptLanguage: "en", LoggedHeaders: HeaderAcceptLanguage}, ""},
+	}
+	for _, tt := range tests {
+		got, _ := tt.entry.headerAnomaly(classifyUserAgent(tt.entry.UserAgent))
+		if got != tt.want {
+			t.Errorf("%s: headerAnomaly = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzerFlagsHeaderAnomalies(t *testing.T) {
+	format, err := parseLogFormat(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_accept_language"`)
+	if err != nil {
+		t.Fatalf("parseLogFormat: %v", err)
+	}
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	cfg.ScoreThreshold = 1
+	cfg.MinHeaderAnomalies = 20
+
+	analyzer := New(cfg, nil)
+	for i := 0; i < 30; i++ {
+		for ip, language := range map[string]string{"10.8.8.8": "-", "10.9.9.9": "fr-FR,fr;q=0.9"} {
+			entry, err := format.Parse(fmt.Sprintf(`%s - - [19/Oct/2025:12:%02d:00 +0000] "GET /product/%d HTTP/1.1" 200 5120 "-" "Mozilla/5.0 (X11; Linux x86_64; rv:144.0) Gecko/20100101 Firefox/144.0" "%s"`, ip, i, i, language))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			analyzer.Process(entry)
+		}
+	}
+
+	spoofed, _, _ := analyzer.Explain("10.8.8.8")
+	if !containsStringCI(RuleHeaders, spoofed.Rules) || !strings.Contains(strings.Join(spoofed.Reasons, ";"), "30 requests with anomalous headers (browser UA without Accept-Language)") {
+		t.Fatalf("expected header anomalies to be flagged, got %v", spoofed.Reasons)
+	}
+	browser, _, _ := analyzer.Explain("10.9.9.9")
+	if browser.Stats.HeaderRequests != 30 || browser.Stats.HeaderAnomalies != 0 || containsStringCI(RuleHeaders, browser.Rules) {
+		t.Fatalf("expected the real browser not to be flagged, got %+v", browser.Reasons)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// hoursPerWeek is the number of hour-of-week slots; Sunday 00:00 is slot 0.
+	hoursPerWeek = 7 * 24
+	// hourBaselineAlpha weights the latest run in the per-slot moving average.
+	hourBaselineAlpha = 0.2
+	// hourBaselineMinRuns is how many runs must be recorded before the learned
+	// hour profile is used.
+	hourBaselineMinRuns = 3
+	// minLearnedHourFactor bounds how far a learned profile lowers thresholds
+	// in the quietest hours.
+	minLearnedHourFactor = 0.25
+)
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// HourProfile multiplies the rate and burst thresholds during some hours of
+// some days, e.g. "0-6=0.3" or "sat-sun 10-18=1.5".
+type HourProfile struct {
+	Days   [7]bool
+	Hours  [24]bool
+	Factor float64
+}
+
+// parseHourProfile parses "[days ]hours=factor". Days and hours are single
+// values or inclusive ranges, comma separated; ranges may wrap ("22-5", "fri-mon").
+func parseHourProfile(value string) (HourProfile, error) {
+	spec, factorRaw, ok := strings.Cut(strings.TrimSpace(value), "=")
+	if !ok {
+		return HourProfile{}, fmt.Errorf("invalid hour profile %q, want [days ]hours=factor", value)
+	}
+	factor, err := strconv.ParseFloat(strings.TrimSpace(factorRaw), 64)
+	if err != nil || factor <= 0 {
+		return HourProfile{}, fmt.Errorf("invalid hour profile %q: factor must be a positive number", value)
+	}
+	profile := HourProfile{Factor: factor}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		for day := range profile.Days {
+			profile.Days[day] = true
+		}
+	case 2:
+		if err := parseCyclicRanges(fields[0], 7, parseWeekday, profile.Days[:]); err != nil {
+			return HourProfile{}, fmt.Errorf("invalid hour profile %q: %w", value, err)
+		}
+		fields = fields[1:]
+	default:
+		return HourProfile{}, fmt.Errorf("invalid hour profile %q, want [days ]hours=factor", value)
+	}
+	if err := parseCyclicRanges(fields[0], 24, parseHour, profile.Hours[:]); err != nil {
+		return HourProfile{}, fmt.Errorf("invalid hour profile %q: %w", value, err)
+	}
+	return profile, nil
+}
+
+// parseHourProfiles parses every profile in values.
+func parseHourProfiles(values []string) ([]HourProfile, error) {
+	profiles := make([]HourProfile, 0, len(values))
+	for _, value := range values {
+		profile, err := parseHourProfile(value)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// parseCyclicRanges marks the values listed in spec, such as "mon-fri,sun", in set.
+func parseCyclicRanges(spec string, size int, parse func(string) (int, error), set []bool) error {
+	for _, part := range strings.Split(spec, ",") {
+		fromRaw, toRaw, isRange := strings.Cut(part, "-")
+		from, err := parse(fromRaw)
+		if err != nil {
+			return err
+		}
+		to := from
+		if isRange {
+			if to, err = parse(toRaw); err != nil {
+				return err
+			}
+		}
+		for i := from; ; i = (i + 1) % size {
+			set[i] = true
+			if i == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseWeekday(value string) (int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for i, name := range weekdayNames {
+		if value == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q (want %s)", value, strings.Join(weekdayNames, ", "))
+}
+
+func parseHour(value string) (int, error) {
+	hour, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("invalid hour %q (want 0-23)", value)
+	}
+	return hour, nil
+}
+
+// hourOfWeek returns the slot of t in the time zone it was logged in.
+func hourOfWeek(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// buildHourFactors combines a learned profile with configured profiles, which
+// take precedence; later profiles win where they overlap. It returns nil when
+// thresholds do not vary by hour.
+func buildHourFactors(learned []float64, profiles []HourProfile) []float64 {
+	if len(learned) != hoursPerWeek && len(profiles) == 0 {
+		return nil
+	}
+	factors := make([]float64, hoursPerWeek)
+	for slot := range factors {
+		factors[slot] = 1
+		if len(learned) == hoursPerWeek && learned[slot] > 0 {
+			factors[slot] = learned[slot]
+		}
+	}
+	for _, profile := range profiles {
+		for day, onDay := range profile.Days {
+			for hour, onHour := range profile.Hours {
+				if onDay && onHour {
+					factors[day*24+hour] = profile.Factor
+				}
+			}
+		}
+	}
+	return factors
+}
+
+// hourFactor is the average threshold factor over the hours an IP was active,
+// or 1 when thresholds do not vary by hour.
+func (s *IPStats) hourFactor() float64 {
+	if s.hourFactorSum <= 0 || s.Requests == 0 {
+		return 1
+	}
+	return s.hourFactorSum / float64(s.Requests)
+}
+
+// recordHour counts an entry towards the hour-of-week rates learned in the state DB.
+func (a *Analyzer) recordHour(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	slot := hourOfWeek(t)
+	a.hourRequests[slot]++
+	a.hoursSeen[t.Unix()/3600] = slot
+}
+
+// HourRates returns requests per hour by hour-of-week slot for the slots the
+// analyzed logs cover.
+func (a *Analyzer) HourRates() map[int]float64 {
+	hours := make(map[int]int)
+	for _, slot := range a.hoursSeen {
+		hours[slot]++
+	}
+	rates := make(map[int]float64, len(a.hourRequests))
+	for slot, count := range a.hourRequests {
+		rates[slot] = float64(count) / float64(hours[slot])
+	}
+	return rates
+}
+
+// HourFactors turns the learned hourly rates into threshold factors: each slot
+// gets its rate relative to the average slot, between minLearnedHourFactor and
+// 1, so quiet hours get lower thresholds and busy hours keep the configured
+// ones. It returns nil while fewer than hourBaselineMinRuns runs have been recorded.
+func (db *StateDB) HourFactors() []float64 {
+	if db.HourRuns < hourBaselineMinRuns || len(db.Hours) == 0 {
+		return nil
+	}
+	mean := 0.0
+	for _, rate := range db.Hours {
+		mean += rate
+	}
+	mean /= float64(len(db.Hours))
+	if mean <= 0 {
+		return nil
+	}
+	factors := make([]float64, hoursPerWeek)
+	for slot := range factors {
+		factors[slot] = 1
+		if rate, ok := db.Hours[slot]; ok {
+			factors[slot] = min(1, max(minLearnedHourFactor, rate/mean))
+		}
+	}
+	return factors
+}
+
+// RecordHourRates folds one run's hourly rates into the learned profile. Slots
+// the run did not cover keep their previous rate.
+func (db *StateDB) RecordHourRates(rates map[int]float64) {
+	if len(rates) == 0 {
+		return
+	}
+	if db.Hours == nil {
+		db.Hours = make(map[int]float64)
+	}
+	for slot, rate := range rates {
+		baseline, ok := db.Hours[slot]
+		if !ok {
+			db.Hours[slot] = rate
+			continue
+		}
+		db.Hours[slot] = baseline + hourBaselineAlpha*(rate-baseline)
+	}
+	db.HourRuns++
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseHourProfile(t *testing.T) {
+	profile, err := parseHourProfile("fri-mon 22-1=0.4")
+	if err != nil {
+		t.Fatalf("parseHourProfile: %v", err)
+	}
+	if profile.Factor != 0.4 || !profile.Days[0] || !profile.Days[5] || profile.Days[3] {
+		t.Fatalf("unexpected days %+v", profile.Days)
+	}
+	if !profile.Hours[23] || !profile.Hours[0] || !profile.Hours[1] || profile.Hours[2] || profile.Hours[21] {
+		t.Fatalf("unexpected hours %+v", profile.Hours)
+	}
+	everyDay, err := parseHourProfile("9,12-13=2")
+	if err != nil {
+		t.Fatalf("parseHourProfile: %v", err)
+	}
+	if !everyDay.Days[6] || !everyDay.Hours[9] || everyDay.Hours[10] || !everyDay.Hours[13] {
+		t.Fatalf("unexpected profile %+v", everyDay)
+	}
+	for _, bad := range []string{"0-6", "0-6=0", "0-24=0.5", "weekend 0-6=0.5", "mon 0-6 x=1"} {
+		if _, err := parseHourProfile(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestHourProfileLowersRateThresholdAtNight(t *testing.T) {
+	// Tuesday 04:00, 60 requests per minute for ten minutes.
+	start := time.Date(2025, 11, 25, 4, 0, 0, 0, time.UTC)
+	steady := func(analyzer *Analyzer, ip string) {
+		for i := 0; i < 600; i++ {
+			analyzer.Process(Entry{ClientIP: ip, Time: start.Add(time.Duration(i) * time.Second), URI: "/", Status: 200})
+		}
+	}
+	cfg := DefaultConfig()
+	if suspect, _, _ := explainAfter(cfg, steady); containsStringCI(RuleRate, suspect.Rules) {
+		t.Fatalf("60 rpm should be under the flat threshold: %v", suspect.Reasons)
+	}
+	cfg.HourProfiles = []HourProfile{mustHourProfile(t, "0-6=0.5"), mustHourProfile(t, "sat-sun 0-23=1")}
+	suspect, _, _ := explainAfter(cfg, steady)
+	if !containsStringCI(RuleRate, suspect.Rules) {
+		t.Fatalf("expected the night profile to flag 60 rpm, got %v", suspect.Reasons)
+	}
+	if want := "avg rpm 60.1 > 45.0"; suspect.Reasons[0] != want {
+		t.Fatalf("expected reason %q, got %q", want, suspect.Reasons[0])
+	}
+}
+
+func TestHourProfileLearnedInStateDB(t *testing.T) {
+	db, err := openStateDB(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	monday := time.Date(2025, 11, 24, 0, 0, 0, 0, time.UTC)
+	for run := 0; run < hourBaselineMinRuns; run++ {
+		if db.HourFactors() != nil {
+			t.Fatalf("hour profile must not be used after only %d runs", db.HourRuns)
+		}
+		analyzer := New(DefaultConfig(), nil)
+		for hour := 0; hour < 24; hour++ {
+			requests := 1000
+			if hour < 6 {
+				requests = 50
+			}
+			for i := 0; i < requests; i++ {
+				analyzer.Process(Entry{ClientIP: fmt.Sprintf("198.51.100.%d", i%200), Time: monday.Add(time.Duration(hour)*time.Hour + time.Duration(i)*time.Second), URI: "/", Status: 200})
+			}
+		}
+		db.RecordHourRates(analyzer.HourRates())
+	}
+
+	factors := db.HourFactors()
+	if got := factors[hourOfWeek(monday.Add(3*time.Hour))]; got != minLearnedHourFactor {
+		t.Fatalf("expected quiet hours to be floored at %.2f, got %.2f", minLearnedHourFactor, got)
+	}
+	if got := factors[hourOfWeek(monday.Add(12*time.Hour))]; got != 1 {
+		t.Fatalf("expected busy hours to keep the configured thresholds, got %.2f", got)
+	}
+	if got := factors[hourOfWeek(monday.Add(-time.Hour))]; got != 1 {
+		t.Fatalf("expected unseen slots to stay at 1, got %.2f", got)
+	}
+
+	combined := buildHourFactors(factors, []HourProfile{mustHourProfile(t, "mon 3=0.8")})
+	if got := combined[hourOfWeek(monday.Add(3*time.Hour))]; got != 0.8 {
+		t.Fatalf("expected configured profiles to override learned factors, got %.2f", got)
+	}
+}
+
+func mustHourProfile(t *testing.T, value string) HourProfile {
+	t.Helper()
+	profile, err := parseHourProfile(value)
+	if err != nil {
+		t.Fatalf("parseHourProfile(%q): %v", value, err)
+	}
+	return profile
+}
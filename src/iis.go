@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// iisLogFormat reads W3C extended logs as written by IIS. Columns follow the
+// latest #Fields directive of the stream; before one is seen, the fields IIS
+// logs by default are assumed.
+var iisLogFormat = &LogFormat{Name: "iis", parse: parseIISLine, session: newW3CParser}
+
+// iisDefaultFields is the column list of a fresh IIS site.
+var iisDefaultFields = strings.Fields("date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken")
+
+// w3cVariables maps W3C field names, lowercased, to the nginx variable
+// setLogVariable stores them as.
+var w3cVariables = map[string]string{
+	"c-ip":                "remote_addr",
+	"cs-username":         "remote_user",
+	"cs-method":           "request_method",
+	"cs-version":          "server_protocol",
+	"sc-status":           "status",
+	"sc-bytes":            "body_bytes_sent",
+	"time-taken":          "request_time_ms",
+	"cs-host":             "host",
+	"cs(host)":            "host",
+	"cs(referer)":         "http_referer",
+	"cs(user-agent)":      "http_user_agent",
+	"cs(cookie)":          "http_cookie",
+	"cs(accept)":          "http_accept",
+	"cs(accept-language)": "http_accept_language",
+	"cs(accept-encoding)": "http_accept_encoding",
+	"x-forwarded-for":     "http_x_forwarded_for",
+	"cs(x-forwarded-for)": "http_x_forwarded_for",
+}
+
+// parseIISLine parses a line with the default IIS fields.
+func parseIISLine(line string) (Entry, error) {
+	return newW3CParser()(line)
+}
+
+// newW3CParser returns a parser that follows the #Fields directives it reads.
+func newW3CParser() func(string) (Entry, error) {
+	fields := iisDefaultFields
+	return func(line string) (Entry, error) {
+		if directive, ok := strings.CutPrefix(line, "#"); ok {
+			if names, ok := strings.CutPrefix(directive, "Fields:"); ok {
+				fields = strings.Fields(names)
+			}
+			return Entry{}, nil
+		}
+		return parseW3CLine(fields, line)
+	}
+}
+
+// parseW3CLine maps the space-separated values of line onto fields. W3C logs
+// write "-" for empty values, and IIS replaces spaces inside values with "+".
+func parseW3CLine(fields []string, line string) (Entry, error) {
+	values := strings.Fields(line)
+	if len(values) != len(fields) {
+		return Entry{}, fmt.Errorf("line has %d values for %d W3C fields: %w", len(values), len(fields), ErrUnmatchedLine)
+	}
+	var entry Entry
+	var date, clock, stem, query string
+	for i, field := range fields {
+		name, value := strings.ToLower(field), values[i]
+		switch name {
+		case "date":
+			date = value
+			continue
+		case "time":
+			clock = value
+			continue
+		case "cs-uri-stem":
+			stem = value
+			continue
+		case "cs-uri-query":
+			query = value
+			continue
+		case "cs(user-agent)":
+			value = strings.ReplaceAll(value, "+", " ")
+		}
+		variable, known := w3cVariables[name]
+		if !known {
+			continue
+		}
+		// Request headers keep "-", which marks them as logged but absent.
+		if value == "-" && !strings.HasPrefix(variable, "http_") {
+			continue
+		}
+		if err := entry.setLogVariable(variable, value); err != nil {
+			return Entry{}, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	if date == "" || clock == "" {
+		return Entry{}, fmt.Errorf("W3C fields lack date and time: %w", ErrUnmatchedLine)
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", date+" "+clock)
+	if err != nil {
+		return Entry{}, fmt.Errorf("parse time: %v: %w", err, ErrUnmatchedLine)
+	}
+	entry.Time = t
+	entry.URI = stem
+	if query != "" && query != "-" {
+		entry.URI += "?" + query
+	}
+	if entry.Method == "" || entry.URI == "" || entry.URI == "-" {
+		return Entry{}, fmt.Errorf("W3C entry without method or path: %w", ErrUnmatchedLine)
+	}
+	entry.ClientIP = deriveClientIP(entry.RemoteAddr, entry.ForwardedFor)
+	return entry, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const iisLog = "#Software: Microsoft Internet Information Services 10.0\n" +
+	"#Version: 1.0\n" +
+	"#Date: 2025-10-19 12:00:00\n" +
+	"#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs-version cs(User-Agent) cs(Cookie) cs(Referer) cs-host sc-status sc-substatus sc-win32-status sc-bytes time-taken X-Forwarded-For\n" +
+	"2025-10-19 12:02:35 10.0.0.2 GET /cart id=1 443 - 10.0.0.5 HTTP/2 Mozilla/5.0+(Windows+NT+10.0;+Win64;+x64) - https://example.com/ shop.example.com 404 0 2 512 125 192.0.2.7\n"
+
+func TestIISLogFormat(t *testing.T) {
+	format, err := logFormatFor("iis", "", LogTimes{})
+	if err != nil || format != iisLogFormat {
+		t.Fatalf("expected iis format, got %v, %v", format, err)
+	}
+	stream := format.forStream(nil)
+	lines := strings.Split(strings.TrimSpace(iisLog), "\n")
+	for _, header := range lines[:4] {
+		if entry, err := stream.Parse(header); err != nil || entry.ClientIP != "" {
+			t.Fatalf("expected directive %q to be skipped, got %+v, %v", header, entry, err)
+		}
+	}
+	entry, err := stream.Parse(lines[4])
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:      "192.0.2.7",
+		RemoteAddr:    "10.0.0.5",
+		ForwardedFor:  "192.0.2.7",
+		Time:          time.Date(2025, 10, 19, 12, 2, 35, 0, time.UTC),
+		Method:        "GET",
+		URI:           "/cart?id=1",
+		Protocol:      "HTTP/2",
+		Status:        404,
+		Bytes:         512,
+		Referer:       "https://example.com/",
+		UserAgent:     "Mozilla/5.0 (Windows NT 10.0; Win64; x64)",
+		RequestTime:   0.125,
+		Host:          "shop.example.com",
+		SessionLogged: true,
+	}
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+
+	// Without a #Fields directive the IIS defaults apply.
+	entry, err = iisLogFormat.Parse("2025-10-19 12:02:35 10.0.0.2 POST /login - 443 alice 192.0.2.8 curl/8.0 - 200 0 0 15")
+	if err != nil || entry.ClientIP != "192.0.2.8" || entry.URI != "/login" || entry.UserAuth != "alice" || entry.Status != 200 || entry.RequestTime != 0.015 {
+		t.Fatalf("unexpected default-field entry %+v, %v", entry, err)
+	}
+	if _, err := stream.Parse("2025-10-19 12:02:35 10.0.0.2 GET /"); err == nil {
+		t.Fatal("expected a short line to be rejected")
+	}
+}
+
+func TestStreamDetectsIIS(t *testing.T) {
+	entries, errs := Stream(strings.NewReader(iisLog))
+	var got []Entry
+	for entry := range entries {
+		got = append(got, entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(got) != 1 || got[0].ClientIP != "192.0.2.7" || got[0].Host != "shop.example.com" {
+		t.Fatalf("expected the IIS entry to be read with its #Fields columns, got %+v", got)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	defaultOpsgenieURL  = "https://api.opsgenie.com"
+)
+
+// IncidentConfig opens an incident when a run detects an attack wave and
+// resolves it once a later run is clean.
+type IncidentConfig struct {
+	// MinSuspects opens an incident when at least this many IPs are blocked (0 disables).
+	MinSuspects int `yaml:"min_suspects"`
+	// MinBlockedShare opens an incident when blocked IPs sent at least this
+	// fraction of all requests (0 disables).
+	MinBlockedShare float64 `yaml:"min_blocked_share"`
+	// DedupKey identifies the incident across runs; defaults to botdeny-<hostname>[-<vhost>].
+	DedupKey  string             `yaml:"dedup_key"`
+	PagerDuty *PagerDutyIncident `yaml:"pagerduty"`
+	Opsgenie  *OpsgenieIncident  `yaml:"opsgenie"`
+}
+
+// PagerDutyIncident configures the PagerDuty Events API v2 integration.
+type PagerDutyIncident struct {
+	RoutingKey string `yaml:"routing_key"`
+	URL        string `yaml:"url"`
+}
+
+// OpsgenieIncident configures the Opsgenie Alert API integration.
+type OpsgenieIncident struct {
+	APIKey string `yaml:"api_key"`
+	URL    string `yaml:"url"`
+}
+
+// AttackWave summarizes a run for incident decisions.
+type AttackWave struct {
+	Suspects        []Suspicion
+	BlockedRequests int
+	TotalRequests   int
+}
+
+func (c IncidentConfig) enabled() bool {
+	return c.PagerDuty != nil || c.Opsgenie != nil
+}
+
+func (c IncidentConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.MinSuspects <= 0 && c.MinBlockedShare <= 0 {
+		return fmt.Errorf("incidents: set min_suspects or min_blocked_share")
+	}
+	if c.MinBlockedShare < 0 || c.MinBlockedShare > 1 {
+		return fmt.Errorf("incidents: min_blocked_share must be between 0 and 1")
+	}
+	if c.PagerDuty != nil && c.PagerDuty.RoutingKey == "" {
+		return fmt.Errorf("incidents: pagerduty.routing_key is required")
+	}
+	if c.Opsgenie != nil && c.Opsgenie.APIKey == "" {
+		return fmt.Errorf("incidents: opsgenie.api_key is required")
+	}
+	return nil
+}
+
+func (c IncidentConfig) dedupKey(vhost string) string {
+	if c.DedupKey != "" {
+		return c.DedupKey
+	}
+	host, _ := os.Hostname()
+	key := "botdeny-" + host
+	if vhost != "" {
+		key += "-" + vhost
+	}
+	return key
+}
+
+func newAttackWave(suspects []Suspicion, totalRequests int) AttackWave {
+	wave := AttackWave{Suspects: suspects, TotalRequests: totalRequests}
+	for _, suspect := range suspects {
+		if suspect.Stats != nil {
+			wave.BlockedRequests += suspect.Stats.Requests
+		}
+	}
+	return wave
+}
+
+// BlockedShare returns the fraction of requests sent by blocked IPs.
+func (w AttackWave) BlockedShare() float64 {
+	if w.TotalRequests == 0 {
+		return 0
+	}
+	return float64(w.BlockedRequests) / float64(w.TotalRequests)
+}
+
+func (c IncidentConfig) isWave(wave AttackWave) bool {
+	if c.MinSuspects > 0 && len(wave.Suspects) >= c.MinSuspects {
+		return true
+	}
+	return c.MinBlockedShare > 0 && wave.BlockedShare() >= c.MinBlockedShare
+}
+
+func (w AttackWave) summary(vhost string) string {
+	target := ""
+	if vhost != "" {
+		target = " on " + vhost
+	}
+	return fmt.Sprintf("botdeny: attack wave%s, %d IPs blocked (%.1f%% of requests)", target, len(w.Suspects), w.BlockedShare()*100)
+}
+
+func (w AttackWave) details(run RunInfo) map[string]any {
+	top := make([]string, 0, 10)
+	for i, suspect := range w.Suspects {
+		if i == 10 {
+			break
+		}
+		top = append(top, fmt.Sprintf("%s %s score=%d", suspect.IP, suspect.Severity, suspect.Score))
+	}
+	return map[string]any{
+		"run_id":           run.ID,
+		"window":           run.Window(),
+		"suspects":         len(w.Suspects),
+		"blocked_requests": w.BlockedRequests,
+		"total_requests":   w.TotalRequests,
+		"top_suspects":     top,
+	}
+}
+
+// manageIncidents triggers incidents for an attack wave and resolves them after a
+// clean run. Resolving an incident that is not open is a no-op for both providers,
+// so no state is kept between runs. Failures are logged, not fatal.
+func manageIncidents(cfg IncidentConfig, run RunInfo, vhost string, wave AttackWave) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	key := cfg.dedupKey(vhost)
+	open := cfg.isWave(wave)
+	if cfg.PagerDuty != nil {
+		body := pagerDutyEvent(*cfg.PagerDuty, key, run, vhost, wave, open)
+		if err := postJSON(client, orDefault(cfg.PagerDuty.URL, defaultPagerDutyURL), nil, body); err != nil {
+			log.Printf("pagerduty incident: %v", err)
+		} else if open {
+			log.Printf("pagerduty incident %s triggered", key)
+		}
+	}
+	if cfg.Opsgenie != nil {
+		if err := sendOpsgenie(client, *cfg.Opsgenie, key, run, vhost, wave, open); err != nil {
+			log.Printf("opsgenie incident: %v", err)
+		} else if open {
+			log.Printf("opsgenie incident %s opened", key)
+		}
+	}
+}
+
+func pagerDutyEvent(cfg PagerDutyIncident, key string, run RunInfo, vhost string, wave AttackWave, open bool) []byte {
+	event := map[string]any{
+		"routing_key":  cfg.RoutingKey,
+		"dedup_key":    key,
+		"event_action": "resolve",
+	}
+	if open {
+		source, _ := os.Hostname()
+		event["event_action"] = "trigger"
+		event["payload"] = map[string]any{
+			"summary":        wave.summary(vhost),
+			"source":         source,
+			"severity":       pagerDutySeverity(highestSeverity(wave.Suspects)),
+			"component":      vhost,
+			"custom_details": wave.details(run),
+		}
+	}
+	data, _ := json.Marshal(event)
+	return data
+}
+
+func pagerDutySeverity(severity Severity) string {
+	switch severity {
+	case SeverityCritical:
+		return "critical"
+	case SeverityHigh:
+		return "error"
+	case SeverityMedium:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+func sendOpsgenie(client *http.Client, cfg OpsgenieIncident, alias string, run RunInfo, vhost string, wave AttackWave, open bool) error {
+	base := strings.TrimSuffix(orDefault(cfg.URL, defaultOpsgenieURL), "/")
+	header := http.Header{"Authorization": {"GenieKey " + cfg.APIKey}}
+	if !open {
+		endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", base, url.PathEscape(alias))
+		data, _ := json.Marshal(map[string]string{"source": "botdeny", "note": "run " + run.ID + " was clean"})
+		return postJSON(client, endpoint, header, data)
+	}
+	details := make(map[string]string)
+	for k, v := range wave.details(run) {
+		details[k] = fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(map[string]any{
+		"message":  wave.summary(vhost),
+		"alias":    alias,
+		"source":   "botdeny",
+		"priority": opsgeniePriority(highestSeverity(wave.Suspects)),
+		"details":  details,
+	})
+	return postJSON(client, base+"/v2/alerts", header, data)
+}
+
+func opsgeniePriority(severity Severity) string {
+	switch severity {
+	case SeverityCritical:
+		return "P1"
+	case SeverityHigh:
+		return "P2"
+	case SeverityMedium:
+		return "P3"
+	case SeverityLow:
+		return "P4"
+	default:
+		return "P5"
+	}
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIncidentWaveThresholds(t *testing.T) {
+	suspects := []Suspicion{
+		{IP: "192.0.2.1", Stats: &IPStats{Requests: 30}},
+		{IP: "192.0.2.2", Stats: &IPStats{Requests: 20}},
+	}
+	wave := newAttackWave(suspects, 1000)
+	if wave.BlockedShare() != 0.05 {
+		t.Fatalf("expected 5%% blocked share, got %f", wave.BlockedShare())
+	}
+
+	if !(IncidentConfig{MinSuspects: 2}).isWave(wave) {
+		t.Fatalf("expected suspect count to open incident")
+	}
+	if (IncidentConfig{MinSuspects: 3}).isWave(wave) {
+		t.Fatalf("expected too few suspects to stay quiet")
+	}
+	if !(IncidentConfig{MinSuspects: 3, MinBlockedShare: 0.05}).isWave(wave) {
+		t.Fatalf("expected blocked share to open incident")
+	}
+}
+
+func TestManageIncidentsTriggersAndResolves(t *testing.T) {
+	var events []map[string]any
+	var opsgeniePaths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pd" {
+			var event map[string]any
+			json.NewDecoder(r.Body).Decode(&event)
+			events = append(events, event)
+		} else {
+			if r.Header.Get("Authorization") != "GenieKey og-key" {
+				t.Errorf("missing opsgenie key")
+			}
+			opsgeniePaths = append(opsgeniePaths, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := IncidentConfig{
+		MinSuspects: 1,
+		DedupKey:    "botdeny-web1",
+		PagerDuty:   &PagerDutyIncident{RoutingKey: "pd-key", URL: server.URL + "/pd"},
+		Opsgenie:    &OpsgenieIncident{APIKey: "og-key", URL: server.URL},
+	}
+	attack := newAttackWave([]Suspicion{{IP: "192.0.2.1", Severity: SeverityCritical, Stats: &IPStats{Requests: 10}}}, 100)
+	manageIncidents(cfg, RunInfo{ID: "run-1"}, "", attack)
+	manageIncidents(cfg, RunInfo{ID: "run-2"}, "", newAttackWave(nil, 100))
+
+	if len(events) != 2 || events[0]["event_action"] != "trigger" || events[1]["event_action"] != "resolve" {
+		t.Fatalf("unexpected pagerduty events: %v", events)
+	}
+	if events[1]["dedup_key"] != "botdeny-web1" {
+		t.Fatalf("expected resolve to reuse dedup key, got %v", events[1]["dedup_key"])
+	}
+	payload, _ := events[0]["payload"].(map[string]any)
+	if payload["severity"] != "critical" {
+		t.Fatalf("unexpected pagerduty payload: %v", payload)
+	}
+	if len(opsgeniePaths) != 2 || opsgeniePaths[0] != "/v2/alerts" || opsgeniePaths[1] != "/v2/alerts/botdeny-web1/close" {
+		t.Fatalf("unexpected opsgenie calls: %v", opsgeniePaths)
+	}
+}
+
+func TestIncidentConfigValidate(t *testing.T) {
+	if err := (IncidentConfig{}).validate(); err != nil {
+		t.Fatalf("expected disabled config to validate: %v", err)
+	}
+	if err := (IncidentConfig{PagerDuty: &PagerDutyIncident{RoutingKey: "k"}}).validate(); err == nil {
+		t.Fatalf("expected missing thresholds to fail")
+	}
+	if err := (IncidentConfig{MinSuspects: 5, Opsgenie: &OpsgenieIncident{}}).validate(); err == nil {
+		t.Fatalf("expected missing api key to fail")
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stdinPath is the --file value that reads the log from standard input.
+const stdinPath = "-"
+
+// Magic bytes starting every gzip, bzip2 and zstd stream.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// zstdBin decompresses zstd logs; the standard library has no zstd decoder.
+var zstdBin = "zstd"
+
+// isCompressedLog reports whether head starts a compressed log.
+func isCompressedLog(head []byte) bool {
+	return bytes.HasPrefix(head, gzipMagic) || bytes.HasPrefix(head, bzip2Magic) || bytes.HasPrefix(head, zstdMagic)
+}
+
+// openLog opens an access log for reading; "-" reads standard input.
+// Compressed logs, such as rotated access.log.2.gz, access.log.3.bz2 or
+// access.log.4.zst, are decompressed transparently. Detection uses the magic
+// bytes, not the file name.
+func openLog(path string) (io.ReadCloser, error) {
+	var src io.ReadCloser = io.NopCloser(os.Stdin)
+	if path != stdinPath {
+		fh, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		src = fh
+	}
+	return decompressLog(src)
+}
+
+// logReader reads from a possibly decompressing reader and closes the source.
+type logReader struct {
+	io.Reader
+	close func() error
+}
+
+func (r logReader) Close() error { return r.close() }
+
+// decompressLog wraps src in a decompressing reader when it starts with the
+// magic bytes of gzip, bzip2 or zstd. zstd streams are piped through the zstd
+// command.
+func decompressLog(src io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(src)
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return logReader{Reader: zr, close: func() error {
+			zr.Close()
+			return src.Close()
+		}}, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return logReader{Reader: bzip2Reader{bzip2.NewReader(buffered)}, close: src.Close}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := startZstd(buffered)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return logReader{Reader: zr, close: func() error {
+			zr.Close()
+			return src.Close()
+		}}, nil
+	}
+	return logReader{Reader: buffered, close: src.Close}, nil
+}
+
+// bzip2Reader labels decompression errors like the gzip reader's.
+type bzip2Reader struct {
+	r io.Reader
+}
+
+func (r bzip2Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("bzip2: %w", err)
+	}
+	return n, err
+}
+
+// zstdReader reads the output of a zstd process decompressing its input.
+type zstdReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	done   bool
+	err    error
+}
+
+func startZstd(src io.Reader) (*zstdReader, error) {
+	r := &zstdReader{cmd: exec.Command(zstdBin, "-d", "-c", "-q")}
+	r.cmd.Stdin = src
+	r.cmd.Stderr = &r.stderr
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	r.stdout = stdout
+	if err := r.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%w (install zstd to read .zst logs)", err)
+	}
+	return r, nil
+}
+
+// Read returns the decompressed log; a failed decompression surfaces as an
+// error at the end of the output instead of a silently short log.
+func (r *zstdReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		if werr := r.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (r *zstdReader) wait() error {
+	if !r.done {
+		r.done = true
+		if err := r.cmd.Wait(); err != nil {
+			r.err = fmt.Errorf("zstd: %v: %s", err, strings.TrimSpace(r.stderr.String()))
+		}
+	}
+	return r.err
+}
+
+// Close stops the zstd process when the log was not read to the end.
+func (r *zstdReader) Close() error {
+	if !r.done {
+		r.cmd.Process.Kill()
+		r.wait()
+	}
+	return nil
+}
+
+// stdinIsPiped reports whether standard input is a pipe or file rather than a terminal.
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// expandLogPaths expands glob patterns such as /var/log/nginx/access.log* in
+// sorted order. Plain paths are kept as given, so a missing file still fails
+// when opened; a pattern matching nothing is an error. Duplicates are dropped.
+func expandLogPaths(patterns []string) ([]string, error) {
+	paths := make([]string, 0, len(patterns))
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if pattern != stdinPath && strings.ContainsAny(pattern, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("glob %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no log files match %q", pattern)
+			}
+		}
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// streamLogFile parses every entry of the log at path and hands it to handle.
+func streamLogFile(path string, handle func(Entry)) error {
+	return streamLogFileWith(path, StreamOptions{}, handle)
+}
+
+// streamLogFileWith is streamLogFile with stream options.
+func streamLogFileWith(path string, opts StreamOptions, handle func(Entry)) error {
+	fh, err := openLog(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	entries, errs := StreamWith(fh, opts)
+	for entry := range entries {
+		handle(entry)
+	}
+	return <-errs
+}
+
+// streamLogFiles parses the logs into a single pass. When more than one path
+// is given every entry is tagged with the file it came from.
+func streamLogFiles(paths []string, opts StreamOptions, handle func(Entry)) error {
+	return streamLogFilesWith(paths, opts, openLog, handle)
+}
+
+// streamLogFilesWith is streamLogFiles reading each log through open. Several
+// logs, such as a log and its rotations, are merged in timestamp order so
+// bursts spanning a rotation are seen as they happened; entries with the
+// same time keep the order of paths.
+func streamLogFilesWith(paths []string, opts StreamOptions, open func(path string) (io.ReadCloser, error), handle func(Entry)) error {
+	if len(paths) == 1 {
+		fh, err := open(paths[0])
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		entries, errs := StreamWith(fh, opts)
+		for entry := range entries {
+			handle(entry)
+		}
+		if err := <-errs; err != nil {
+			return fmt.Errorf("%s: %w", paths[0], err)
+		}
+		return nil
+	}
+
+	// Every log is parsed on its own goroutine.
+	if onUnparsed := opts.OnUnparsed; onUnparsed != nil {
+		var mu sync.Mutex
+		opts.OnUnparsed = func(line string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			onUnparsed(line, err)
+		}
+	}
+	streams := make([]*mergeStream, 0, len(paths))
+	// stop closes every log and waits for its parser, after an error.
+	stop := func() {
+		for _, s := range streams {
+			s.fh.Close()
+		}
+		for _, s := range streams {
+			if !s.done {
+				for range s.entries {
+				}
+				<-s.errs
+			}
+		}
+	}
+	for _, path := range paths {
+		fh, err := open(path)
+		if err != nil {
+			stop()
+			return err
+		}
+		entries, errs := StreamWith(fh, opts)
+		streams = append(streams, &mergeStream{path: path, fh: fh, entries: entries, errs: errs})
+	}
+	for _, s := range streams {
+		if err := s.next(); err != nil {
+			stop()
+			return err
+		}
+	}
+	for {
+		var earliest *mergeStream
+		for _, s := range streams {
+			if !s.done && (earliest == nil || s.head.Time.Before(earliest.head.Time)) {
+				earliest = s
+			}
+		}
+		if earliest == nil {
+			return nil
+		}
+		entry := earliest.head
+		entry.Source = earliest.path
+		handle(entry)
+		if err := earliest.next(); err != nil {
+			stop()
+			return err
+		}
+	}
+}
+
+// mergeStream is one log of streamLogFilesWith and its next entry.
+type mergeStream struct {
+	path    string
+	fh      io.ReadCloser
+	entries <-chan Entry
+	errs    <-chan error
+	head    Entry
+	done    bool
+}
+
+// next reads the following entry into head, or marks the stream done at the
+// end of the log.
+func (s *mergeStream) next() error {
+	entry, ok := <-s.entries
+	if ok {
+		s.head = entry
+		return nil
+	}
+	s.done = true
+	err := <-s.errs
+	s.fh.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	return nil
+}
+
+// sourceNames lists the log files an IP appeared in, busiest first.
+func sourceNames(stat *IPStats) []string {
+	return namesByCount(stat.Sources)
+}
+
+// backendNames lists the proxy backends an IP reached, busiest first.
+func backendNames(stat *IPStats) []string {
+	return namesByCount(stat.Backends)
+}
+
+// hostNames lists the syslog hosts that logged an IP, busiest first.
+func hostNames(stat *IPStats) []string {
+	return namesByCount(stat.Hosts)
+}
+
+func namesByCount(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// UnparsedCapture appends lines the parser rejected to a file, building a
+// corpus for format fixes and the ParseLine fuzz target.
+type UnparsedCapture struct {
+	fh *os.File
+	w  *bufio.Writer
+	// Lines counts the lines written; once it reaches Limit, when Limit is
+	// positive, further lines are dropped so a broken log cannot fill the disk.
+	Lines int
+	Limit int
+}
+
+func openUnparsedCapture(path string) (*UnparsedCapture, error) {
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &UnparsedCapture{fh: fh, w: bufio.NewWriter(fh)}, nil
+}
+
+// unparsedDetail describes a rejected line for the problem summary, shortening long lines.
+func unparsedDetail(line string, err error) string {
+	if len(line) > 120 {
+		line = line[:117] + "..."
+	}
+	return fmt.Sprintf("%q: %v", line, err)
+}
+
+// Capture records a rejected line; it matches StreamOptions.OnUnparsed.
+func (c *UnparsedCapture) Capture(line string, _ error) {
+	if c.Limit > 0 && c.Lines >= c.Limit {
+		return
+	}
+	c.w.WriteString(line)
+	c.w.WriteByte('\n')
+	c.Lines++
+}
+
+// Close flushes captured lines to disk.
+func (c *UnparsedCapture) Close() error {
+	if err := c.w.Flush(); err != nil {
+		c.fh.Close()
+		return err
+	}
+	return c.fh.Close()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamLogFilesAttributesSources(t *testing.T) {
+	dir := t.TempDir()
+	edge1 := filepath.Join(dir, "edge1.log")
+	edge2 := filepath.Join(dir, "edge2.log")
+	line := `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n"
+	other := `192.0.2.8 - - [19/Oct/2025:12:02:36 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n"
+	if err := os.WriteFile(edge1, []byte(line+other), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(edge2, []byte(line+line), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	analyzer := New(DefaultConfig(), nil)
+	if err := streamLogFiles([]string{edge1, edge2}, StreamOptions{}, analyzer.Process); err != nil {
+		t.Fatalf("streamLogFiles: %v", err)
+	}
+	stats := make(map[string]*IPStats)
+	for _, stat := range analyzer.Stats() {
+		stats[stat.IP] = stat
+	}
+	if got := sourceNames(stats["192.0.2.7"]); !reflect.DeepEqual(got, []string{edge2, edge1}) {
+		t.Fatalf("expected sources busiest first, got %v", got)
+	}
+	if got := sourceNames(stats["192.0.2.8"]); !reflect.DeepEqual(got, []string{edge1}) {
+		t.Fatalf("unexpected sources for 192.0.2.8: %v", got)
+	}
+
+	single := New(DefaultConfig(), nil)
+	if err := streamLogFiles([]string{edge1}, StreamOptions{}, single.Process); err != nil {
+		t.Fatalf("streamLogFiles: %v", err)
+	}
+	for _, stat := range single.Stats() {
+		if len(stat.Sources) != 0 {
+			t.Fatalf("single-log runs should not tag sources, got %v", stat.Sources)
+		}
+	}
+
+	if err := streamLogFiles([]string{edge1, filepath.Join(dir, "missing.log")}, StreamOptions{}, func(Entry) {}); err == nil {
+		t.Fatal("expected error for missing log")
+	}
+}
+
+func TestStreamLogFilesMergesByTime(t *testing.T) {
+	dir := t.TempDir()
+	current := filepath.Join(dir, "access.log")
+	rotated := filepath.Join(dir, "access.log.1")
+	entry := func(second int) string {
+		return fmt.Sprintf(`192.0.2.7 - - [19/Oct/2025:12:00:%02d +0000] "GET /%d HTTP/1.1" 200 512 "-" "curl/8.0"`+"\n", second, second)
+	}
+	// The burst straddles the rotation, and the current log is listed first.
+	if err := os.WriteFile(rotated, []byte(entry(10)+entry(20)+entry(30)), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(current, []byte(entry(31)+entry(40)+entry(50)), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var uris, sources []string
+	err := streamLogFiles([]string{current, rotated}, StreamOptions{}, func(e Entry) {
+		uris = append(uris, e.URI)
+		sources = append(sources, filepath.Base(e.Source))
+	})
+	if err != nil {
+		t.Fatalf("streamLogFiles: %v", err)
+	}
+	if want := []string{"/10", "/20", "/30", "/31", "/40", "/50"}; !reflect.DeepEqual(uris, want) {
+		t.Fatalf("expected entries in time order, got %v", uris)
+	}
+	if want := []string{"access.log.1", "access.log.1", "access.log.1", "access.log", "access.log", "access.log"}; !reflect.DeepEqual(sources, want) {
+		t.Fatalf("unexpected sources %v", sources)
+	}
+}
+
+func TestStreamLogFilesMergeStopsAtParseError(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.log")
+	bad := filepath.Join(dir, "bad.log")
+	line := `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n"
+	if err := os.WriteFile(good, []byte(strings.Repeat(line, 1000)), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(bad, []byte(line+"garbage\n"+line), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err := streamLogFiles([]string{good, bad}, StreamOptions{Strict: true}, func(Entry) {})
+	if err == nil || !strings.Contains(err.Error(), bad+": line 2:") {
+		t.Fatalf("expected parse error in %s, got %v", bad, err)
+	}
+}
+
+func TestStreamLogFilesReadsStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	saved := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = saved }()
+
+	go func() {
+		w.WriteString(`192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n")
+		w.Close()
+	}()
+	if !stdinIsPiped() {
+		t.Fatal("expected a pipe on stdin to be detected")
+	}
+	var entries []Entry
+	if err := streamLogFiles([]string{stdinPath}, StreamOptions{}, func(entry Entry) { entries = append(entries, entry) }); err != nil {
+		t.Fatalf("streamLogFiles: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ClientIP != "192.0.2.7" {
+		t.Fatalf("expected one entry from stdin, got %+v", entries)
+	}
+}
+
+func TestOpenLogDecompressesGzip(t *testing.T) {
+	dir := t.TempDir()
+	line := `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n"
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(line + line))
+	zw.Close()
+
+	// Detection relies on the content, so a rotated file without the .gz suffix works too.
+	for _, name := range []string{"access.log.2.gz", "access.log.2", "plain.log"} {
+		path := filepath.Join(dir, name)
+		data := compressed.Bytes()
+		if name == "plain.log" {
+			data = []byte(line + line)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		count := 0
+		if err := streamLogFile(path, func(Entry) { count++ }); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if count != 2 {
+			t.Fatalf("%s: expected 2 entries, got %d", name, count)
+		}
+	}
+
+	truncated := filepath.Join(dir, "truncated.gz")
+	if err := os.WriteFile(truncated, compressed.Bytes()[:12], 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := streamLogFile(truncated, func(Entry) {}); err == nil {
+		t.Fatal("expected error for truncated gzip log")
+	}
+}
+
+func TestOpenLogDecompressesBzip2AndZstd(t *testing.T) {
+	for _, name := range []string{"access.log.bz2", "access.log.zst"} {
+		t.Run(name, func(t *testing.T) {
+			if filepath.Ext(name) == ".zst" {
+				if _, err := exec.LookPath(zstdBin); err != nil {
+					t.Skip("zstd not installed")
+				}
+			}
+			data, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			// Rotated names without the suffix are detected by content too.
+			dir := t.TempDir()
+			path := filepath.Join(dir, "access.log.3")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			var entries []Entry
+			if err := streamLogFile(path, func(entry Entry) { entries = append(entries, entry) }); err != nil {
+				t.Fatalf("streamLogFile: %v", err)
+			}
+			if len(entries) != 2 || entries[1].ClientIP != "192.0.2.7" {
+				t.Fatalf("expected 2 entries, got %+v", entries)
+			}
+
+			truncated := filepath.Join(dir, "truncated")
+			if err := os.WriteFile(truncated, data[:len(data)/2], 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := streamLogFile(truncated, func(Entry) {}); err == nil {
+				t.Fatal("expected error for truncated log")
+			}
+		})
+	}
+}
+
+func TestExpandLogPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2.gz", "error.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	got, err := expandLogPaths([]string{filepath.Join(dir, "access.log*"), filepath.Join(dir, "access.log"), stdinPath})
+	if err != nil {
+		t.Fatalf("expandLogPaths: %v", err)
+	}
+	want := []string{filepath.Join(dir, "access.log"), filepath.Join(dir, "access.log.1"), filepath.Join(dir, "access.log.2.gz"), stdinPath}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if _, err := expandLogPaths([]string{filepath.Join(dir, "missing*.log")}); err == nil {
+		t.Fatal("expected error for a pattern matching nothing")
+	}
+}
+
+func TestStreamLogFileReportsParseErrorLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	line := `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"` + "\n"
+	if err := os.WriteFile(path, []byte(line+line+"garbage\n"+line), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	count := 0
+	err := streamLogFileWith(path, StreamOptions{Strict: true}, func(Entry) { count++ })
+	if err == nil || !strings.Contains(err.Error(), "line 3:") {
+		t.Fatalf("expected parse error on line 3, got %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected the 2 entries before the error to be delivered, got %d", count)
+	}
+}
+
+func TestUnparsedCaptureLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "parse-errors.log")
+	capture, err := openUnparsedCapture(path)
+	if err != nil {
+		t.Fatalf("openUnparsedCapture: %v", err)
+	}
+	capture.Limit = 2
+	for _, line := range []string{"first", "second", "third"} {
+		capture.Capture(line, ErrUnmatchedLine)
+	}
+	if err := capture.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if capture.Lines != 2 || string(data) != "first\nsecond\n" {
+		t.Fatalf("expected the first 2 lines, got %d: %q", capture.Lines, data)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+)
+
+// ip2locationHeaderSize is the fixed header of an IP2Location BIN database.
+const ip2locationHeaderSize = 64
+
+// ip2locationDB is an IP2Location BIN database, such as the free DB1 LITE
+// (IP-COUNTRY) or any of the larger DB types, which all start with the country
+// columns. Offsets in the header and rows are 1-based; string pointers are not.
+type ip2locationDB struct {
+	fh          *os.File
+	dbType      byte
+	columns     uint32
+	built       time.Time
+	ipv4Count   uint32
+	ipv4Base    uint32
+	ipv6Count   uint32
+	ipv6Base    uint32
+	ipv4Index   uint32
+	ipv6Index   uint32
+	ipv4RowSize uint32
+	ipv6RowSize uint32
+}
+
+func openIP2Location(path string) (*ip2locationDB, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, ip2locationHeaderSize)
+	if _, err := fh.ReadAt(header, 0); err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("read ip2location header: %w", err)
+	}
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(header[off:]) }
+	db := &ip2locationDB{
+		fh:        fh,
+		dbType:    header[0],
+		columns:   uint32(header[1]),
+		built:     time.Date(2000+int(header[2]), time.Month(header[3]), int(header[4]), 0, 0, 0, 0, time.UTC),
+		ipv4Count: u32(5),
+		ipv4Base:  u32(9),
+		ipv6Count: u32(13),
+		ipv6Base:  u32(17),
+		ipv4Index: u32(21),
+		ipv6Index: u32(25),
+	}
+	// The country pointer is the second column after the range start.
+	if db.dbType == 0 || db.columns < 2 || header[3] < 1 || header[3] > 12 || db.ipv4Count+db.ipv6Count == 0 {
+		fh.Close()
+		return nil, fmt.Errorf("%s is not an IP2Location BIN database", path)
+	}
+	db.ipv4RowSize = db.columns * 4
+	db.ipv6RowSize = db.columns*4 + 12
+	return db, nil
+}
+
+func (db *ip2locationDB) readAt(size int, off uint32) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := db.fh.ReadAt(buf, int64(off)-1); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (db *ip2locationDB) uint32At(off uint32) (uint32, error) {
+	buf, err := db.readAt(4, off)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf), nil
+}
+
+func (db *ip2locationDB) uint128At(off uint32) (*big.Int, error) {
+	buf, err := db.readAt(16, off)
+	if err != nil {
+		return nil, err
+	}
+	// Stored little-endian; big.Int wants big-endian.
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// stringAt reads a length-prefixed string at the 0-based pointer.
+func (db *ip2locationDB) stringAt(ptr uint32) (string, error) {
+	size, err := db.readAt(1, ptr+1)
+	if err != nil {
+		return "", err
+	}
+	value, err := db.readAt(int(size[0]), ptr+2)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// country returns the ISO code and English name of the range holding addr,
+// or "" when no range does.
+func (db *ip2locationDB) country(addr netip.Addr) (string, string, error) {
+	addr = addr.Unmap()
+	var (
+		row   uint32
+		found bool
+		err   error
+	)
+	if addr.Is4() {
+		row, found, err = db.findIPv4(addr)
+	} else {
+		row, found, err = db.findIPv6(addr)
+	}
+	if err != nil || !found {
+		return "", "", err
+	}
+	ptr, err := db.uint32At(row)
+	if err != nil {
+		return "", "", err
+	}
+	code, err := db.stringAt(ptr)
+	if err != nil {
+		return "", "", err
+	}
+	// Reserved and unassigned ranges are listed with "-".
+	if code == "-" {
+		return "", "", nil
+	}
+	name, err := db.stringAt(ptr + 3)
+	if err != nil {
+		return "", "", err
+	}
+	return code, name, nil
+}
+
+// findIPv4 returns the offset of the country column of the row holding addr.
+func (db *ip2locationDB) findIPv4(addr netip.Addr) (uint32, bool, error) {
+	if db.ipv4Count == 0 {
+		return 0, false, nil
+	}
+	b := addr.As4()
+	ip := binary.BigEndian.Uint32(b[:])
+	if ip == ^uint32(0) {
+		ip--
+	}
+	low, high := uint32(0), db.ipv4Count
+	if db.ipv4Index > 0 {
+		var err error
+		index := db.ipv4Index + (ip>>16)<<3
+		if low, err = db.uint32At(index); err != nil {
+			return 0, false, err
+		}
+		if high, err = db.uint32At(index + 4); err != nil {
+			return 0, false, err
+		}
+	}
+	for low <= high {
+		mid := low + (high-low)/2
+		row := db.ipv4Base + mid*db.ipv4RowSize
+		from, err := db.uint32At(row)
+		if err != nil {
+			return 0, false, err
+		}
+		to, err := db.uint32At(row + db.ipv4RowSize)
+		if err != nil {
+			return 0, false, err
+		}
+		switch {
+		case ip < from:
+			if mid == 0 {
+				return 0, false, nil
+			}
+			high = mid - 1
+		case ip >= to:
+			low = mid + 1
+		default:
+			return row + 4, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// findIPv6 is findIPv4 for the 128-bit rows.
+func (db *ip2locationDB) findIPv6(addr netip.Addr) (uint32, bool, error) {
+	if db.ipv6Count == 0 {
+		return 0, false, nil
+	}
+	b := addr.As16()
+	ip := new(big.Int).SetBytes(b[:])
+	low, high := uint32(0), db.ipv6Count
+	if db.ipv6Index > 0 {
+		var err error
+		index := db.ipv6Index + uint32(binary.BigEndian.Uint16(b[:2]))<<3
+		if low, err = db.uint32At(index); err != nil {
+			return 0, false, err
+		}
+		if high, err = db.uint32At(index + 4); err != nil {
+			return 0, false, err
+		}
+	}
+	for low <= high {
+		mid := low + (high-low)/2
+		row := db.ipv6Base + mid*db.ipv6RowSize
+		from, err := db.uint128At(row)
+		if err != nil {
+			return 0, false, err
+		}
+		to, err := db.uint128At(row + db.ipv6RowSize)
+		if err != nil {
+			return 0, false, err
+		}
+		switch {
+		case ip.Cmp(from) < 0:
+			if mid == 0 {
+				return 0, false, nil
+			}
+			high = mid - 1
+		case ip.Cmp(to) >= 0:
+			low = mid + 1
+		default:
+			return row + 16, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// newIP2LocationLookup opens an IP2Location BIN database. IP2Location only
+// names countries in English.
+func newIP2LocationLookup(path, locale string, problems *Problems) (GeoLookup, func() error, error) {
+	db, err := openIP2Location(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkGeoLocale([]string{defaultGeoLocale}, locale); err != nil {
+		db.fh.Close()
+		return nil, nil, err
+	}
+	lookup := func(ip string) (GeoInfo, bool) {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: invalid IP", ip))
+			return GeoInfo{}, false
+		}
+		code, name, err := db.country(addr)
+		if err != nil {
+			problems.Add(ProblemGeoLookup, fmt.Sprintf("%s: %v", ip, err))
+			return GeoInfo{}, false
+		}
+		if code == "" {
+			return GeoInfo{}, false
+		}
+		return GeoInfo{CountryISO: code, CountryName: name}, true
+	}
+	return lookup, db.fh.Close, nil
+}
+
+func readIP2LocationInfo(path string) (GeoDBInfo, error) {
+	db, err := openIP2Location(path)
+	if err != nil {
+		return GeoDBInfo{}, err
+	}
+	defer db.fh.Close()
+	ranges := []string{}
+	ipVersion := uint(4)
+	if db.ipv4Count > 0 {
+		ranges = append(ranges, fmt.Sprintf("%d IPv4", db.ipv4Count))
+	}
+	if db.ipv6Count > 0 {
+		ranges = append(ranges, fmt.Sprintf("%d IPv6", db.ipv6Count))
+		ipVersion = 6
+	}
+	return GeoDBInfo{
+		Path:        path,
+		Type:        fmt.Sprintf("IP2Location DB%d", db.dbType),
+		Description: strings.Join(ranges, " and ") + " ranges",
+		Built:       db.built,
+		Languages:   []string{defaultGeoLocale},
+		IPVersion:   ipVersion,
+	}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeIP2LocationDB1 writes a DB1 (country) BIN file with IPv4 rows that
+// start at the given addresses, ending with the sentinel row the real
+// databases carry. An empty code marks an unassigned range.
+func writeIP2LocationDB1(t *testing.T, starts []uint32, codes, names []string) string {
+	t.Helper()
+	const columns = 2
+	rows := len(starts) + 1
+	base := uint32(ip2locationHeaderSize + 1)
+	poolBase := base + uint32(rows*columns*4)
+
+	buf := make([]byte, ip2locationHeaderSize, int(poolBase)+64*len(codes))
+	buf[0], buf[1] = 1, columns
+	buf[2], buf[3], buf[4] = 25, 9, 1
+	binary.LittleEndian.PutUint32(buf[5:], uint32(rows))
+	binary.LittleEndian.PutUint32(buf[9:], base)
+
+	var pool []byte
+	for i, start := range starts {
+		code, name := codes[i], names[i]
+		if code == "" {
+			code, name = "-", "-"
+		}
+		ptr := poolBase - 1 + uint32(len(pool))
+		buf = binary.LittleEndian.AppendUint32(buf, start)
+		buf = binary.LittleEndian.AppendUint32(buf, ptr)
+		// The long name is found 3 bytes after the 2-letter code.
+		pool = append(pool, byte(len(code)))
+		pool = append(pool, code...)
+		pool = append(pool, byte(len(name)))
+		pool = append(pool, name...)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, ^uint32(0))
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = append(buf, pool...)
+
+	path := filepath.Join(t.TempDir(), "IP2LOCATION-LITE-DB1.BIN")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatalf("write database: %v", err)
+	}
+	return path
+}
+
+func TestIP2LocationLookup(t *testing.T) {
+	path := writeIP2LocationDB1(t,
+		[]uint32{0, 0x01000000, 0x01000100, 0xC6336400, 0xC6336500},
+		[]string{"", "AU", "CN", "FR", ""},
+		[]string{"", "Australia", "China", "France", ""})
+
+	lookup, closer, err := newGeoLookup("ip2location", path, "", nil)
+	if err != nil {
+		t.Fatalf("newGeoLookup: %v", err)
+	}
+	defer closer()
+	cases := map[string]string{
+		"1.0.0.1":               "AU Australia",
+		"1.0.0.255":             "AU Australia",
+		"1.0.1.0":               "CN China",
+		"198.51.100.4":          "FR France",
+		"::ffff:198.51.100.255": "FR France",
+		"198.51.101.0":          "",
+		"255.255.255.255":       "",
+		"0.0.0.1":               "",
+		"2001:db8::1":           "",
+	}
+	for ip, want := range cases {
+		info, ok := lookup(ip)
+		got := strings.TrimSpace(info.CountryISO + " " + info.CountryName)
+		if got != want || ok != (want != "") {
+			t.Errorf("lookup(%s) = %q, %v; want %q", ip, got, ok, want)
+		}
+	}
+
+	if _, _, err := newGeoLookup("ip2location", path, "de", nil); err == nil {
+		t.Fatal("expected a locale other than English to be rejected")
+	}
+	info, err := readIP2LocationInfo(path)
+	if err != nil {
+		t.Fatalf("readIP2LocationInfo: %v", err)
+	}
+	if info.Type != "IP2Location DB1" || !info.Built.Equal(time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected info %+v", info)
+	}
+}
+
+func TestIP2LocationRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	os.WriteFile(path, make([]byte, 128), 0o644)
+	if _, _, err := newGeoLookup("ip2location", path, "", nil); err == nil || !strings.Contains(err.Error(), "not an IP2Location BIN database") {
+		t.Fatalf("expected the file to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// journalctlBin is the journalctl binary read by --journal-unit.
+var journalctlBin = "journalctl"
+
+// commandReader streams the output of a process such as journalctl or ssh.
+// Close waits for the process and reports how it exited.
+type commandReader struct {
+	io.Reader
+	bin    string
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	ctx    context.Context
+}
+
+// startCommand runs bin with args and returns a reader of its output. The
+// process is killed when ctx is done.
+func startCommand(ctx context.Context, bin string, args ...string) (*commandReader, error) {
+	cmd := exec.CommandContext(ctx, bin, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", bin, err)
+	}
+	return &commandReader{Reader: stdout, bin: bin, cmd: cmd, stderr: stderr, ctx: ctx}, nil
+}
+
+// openJournal runs journalctl for the messages of a systemd unit, such as
+// nginx.service, one message per line without journal metadata. With follow
+// set it starts at the end of the journal and keeps waiting for new messages
+// until ctx is done.
+func openJournal(ctx context.Context, unit string, follow bool) (*commandReader, error) {
+	args := []string{"--unit", unit, "--output", "cat", "--no-pager", "--quiet"}
+	if follow {
+		args = append(args, "--follow", "--lines", "0")
+	}
+	return startCommand(ctx, journalctlBin, args...)
+}
+
+// Close waits for the process, killing it first when ctx was canceled. A kill
+// caused by ctx is not an error.
+func (r *commandReader) Close() error {
+	err := r.cmd.Wait()
+	if err == nil || r.ctx.Err() != nil {
+		return nil
+	}
+	if msg := strings.TrimSpace(r.stderr.String()); msg != "" {
+		return fmt.Errorf("%s: %v: %s", r.bin, err, msg)
+	}
+	return fmt.Errorf("%s: %w", r.bin, err)
+}
+
+// Kill stops the process, which may be blocked writing output nobody reads.
+func (r *commandReader) Kill() {
+	r.cmd.Process.Kill()
+}
+
+// streamJournal parses every message the journal holds for unit and hands it
+// to handle.
+func streamJournal(unit string, opts StreamOptions, handle func(Entry)) error {
+	journal, err := openJournal(context.Background(), unit, false)
+	if err != nil {
+		return err
+	}
+	entries, errs := StreamWith(journal, opts)
+	for entry := range entries {
+		handle(entry)
+	}
+	if err := <-errs; err != nil {
+		// journalctl may be blocked writing the rest of the journal.
+		journal.Kill()
+		journal.Close()
+		return err
+	}
+	return journal.Close()
+}
+
+// followJournal is followLog for the journal of a systemd unit.
+func followJournal(ctx context.Context, unit string, streamOpts StreamOptions, follower *Follower) error {
+	journal, err := openJournal(ctx, unit, true)
+	if err != nil {
+		return err
+	}
+	if err := followStream("journal of "+unit, journal, streamOpts, follower); err != nil {
+		journal.Kill()
+		journal.Close()
+		return err
+	}
+	return journal.Close()
+}
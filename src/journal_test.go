@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeJournalctl points journalctlBin at a shell script for the test.
+func fakeJournalctl(t *testing.T, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "journalctl")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write fake journalctl: %v", err)
+	}
+	previous := journalctlBin
+	journalctlBin = bin
+	t.Cleanup(func() { journalctlBin = previous })
+	return dir
+}
+
+func TestStreamJournal(t *testing.T) {
+	dir := fakeJournalctl(t, `echo "$@" > "$(dirname "$0")/args"
+echo '192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET /a HTTP/1.1" 404 0 "-" "curl/8.0"'
+echo '192.0.2.8 - - [19/Oct/2025:12:02:36 +0000] "GET /b HTTP/1.1" 200 0 "-" "curl/8.0"'
+`)
+	var ips []string
+	if err := streamJournal("nginx.service", StreamOptions{}, func(entry Entry) {
+		ips = append(ips, entry.ClientIP)
+	}); err != nil {
+		t.Fatalf("streamJournal: %v", err)
+	}
+	if strings.Join(ips, ",") != "192.0.2.7,192.0.2.8" {
+		t.Fatalf("unexpected entries %v", ips)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if got := strings.TrimSpace(string(args)); got != "--unit nginx.service --output cat --no-pager --quiet" {
+		t.Fatalf("unexpected journalctl arguments %q", got)
+	}
+}
+
+func TestStreamJournalReportsFailure(t *testing.T) {
+	fakeJournalctl(t, "echo 'No journal files were found.' >&2\nexit 1\n")
+	err := streamJournal("nginx.service", StreamOptions{}, func(Entry) {})
+	if err == nil || !strings.Contains(err.Error(), "No journal files were found.") {
+		t.Fatalf("expected journalctl's message, got %v", err)
+	}
+
+	// In strict mode a parse error stops reading even while journalctl has more to write.
+	fakeJournalctl(t, "echo 'not a log line'\nexec yes '192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] \"GET / HTTP/1.1\" 200 0 \"-\" \"-\"'\n")
+	if err := streamJournal("nginx.service", StreamOptions{Strict: true}, func(Entry) {}); err == nil {
+		t.Fatal("expected the parse error")
+	}
+}
+
+func TestFollowJournal(t *testing.T) {
+	var lines strings.Builder
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&lines, "echo '198.51.100.4 - - [%s] \"GET /x%d.php HTTP/1.1\" 404 12 \"-\" \"zgrab\"'\n", now.Add(time.Duration(i-60)*time.Second).Format(timeLayout), i)
+	}
+	fakeJournalctl(t, "case \"$*\" in *'--follow --lines 0'*) ;; *) exit 2 ;; esac\n"+lines.String()+"exec sleep 30\n")
+
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:     time.Hour,
+		Interval:   50 * time.Millisecond,
+		DenyOutput: denyPath,
+		Deny:       DenyOptions{Minimal: true},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- followJournal(ctx, "nginx.service", StreamOptions{}, follower) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(denyPath)
+		if strings.Contains(string(data), "deny 198.51.100.4;") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deny file never picked up the journal's attack, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("followJournal: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("followJournal did not stop after cancel")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsonLogFormat reads nginx logs written with a JSON log_format, such as
+//
+//	log_format json escape=json '{"remote_addr":"$remote_addr","time_iso8601":"$time_iso8601",...}';
+//
+// Keys are the names of the nginx variables they hold, with or without the
+// leading $. Unknown keys and values that are not strings or numbers are ignored.
+var jsonLogFormat = &LogFormat{Name: "json", parse: parseJSONLine}
+
+func parseJSONLine(line string) (Entry, error) {
+	if !strings.HasPrefix(line, "{") {
+		return Entry{}, fmt.Errorf("line is not a JSON object: %w", ErrUnmatchedLine)
+	}
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return Entry{}, fmt.Errorf("parse json: %w", ErrUnmatchedLine)
+	}
+
+	var entry Entry
+	for _, name := range jsonLogKeys(fields) {
+		var value string
+		switch v := fields[name].(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		default:
+			continue
+		}
+		if err := entry.setLogVariable(strings.TrimPrefix(name, "$"), value); err != nil {
+			return Entry{}, err
+		}
+	}
+	switch {
+	case entry.RemoteAddr == "" && entry.ForwardedFor == "":
+		return Entry{}, fmt.Errorf("json entry has no remote_addr: %w", ErrUnmatchedLine)
+	case entry.Time.IsZero():
+		return Entry{}, fmt.Errorf("json entry has no time_local, time_iso8601 or msec: %w", ErrUnmatchedLine)
+	case entry.Status == 0:
+		return Entry{}, fmt.Errorf("json entry has no status: %w", ErrUnmatchedLine)
+	case entry.URI == "":
+		return Entry{}, fmt.Errorf("json entry has no request, request_uri or uri: %w", ErrUnmatchedLine)
+	}
+	entry.ClientIP = deriveClientIP(entry.RemoteAddr, entry.ForwardedFor)
+	return entry, nil
+}
+
+// jsonLogKeys lists the keys of fields in sorted order, so a line always
+// parses the same way; $request_uri then wins over the URI of $request.
+func jsonLogKeys(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
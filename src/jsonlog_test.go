@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONLine(t *testing.T) {
+	line := `{"time_iso8601":"2025-10-19T12:02:35+00:00","remote_addr":"10.0.0.1","http_x_forwarded_for":"198.51.100.7","request":"GET /search?q=1 HTTP/1.1","status":404,"body_bytes_sent":"512","request_time":0.120,"http_user_agent":"curl/8.0","host":"shop.example.com"}`
+	entry, err := parseJSONLine(line)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:     "198.51.100.7",
+		RemoteAddr:   "10.0.0.1",
+		ForwardedFor: "198.51.100.7",
+		Time:         time.Date(2025, 10, 19, 12, 2, 35, 0, time.UTC),
+		Method:       "GET",
+		URI:          "/search?q=1",
+		Protocol:     "HTTP/1.1",
+		Status:       404,
+		Bytes:        512,
+		RequestTime:  0.12,
+		UserAgent:    "curl/8.0",
+		Host:         "shop.example.com",
+	}
+	if !entry.Time.Equal(want.Time) {
+		t.Fatalf("unexpected time %v", entry.Time)
+	}
+	entry.Time = want.Time
+	if entry != want {
+		t.Fatalf("unexpected entry\n got %+v\nwant %+v", entry, want)
+	}
+
+	for _, bad := range []string{
+		`not json`,
+		`{"remote_addr":"10.0.0.1","status":200,"request":"GET / HTTP/1.1"}`,
+		`{"remote_addr":"10.0.0.1","time_iso8601":"2025-10-19T12:02:35Z","request":"GET / HTTP/1.1"}`,
+		`{"ts":1760875355.1,"request":{"remote_ip":"10.0.0.1","uri":"/"},"status":200}`,
+	} {
+		if _, err := parseJSONLine(bad); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestStreamDetectsJSONLogs(t *testing.T) {
+	logs := `{"msec":"1760875355.120","remote_addr":"192.0.2.7","request_method":"POST","request_uri":"/login","status":"401"}` + "\n" +
+		`{"msec":"1760875356.000","remote_addr":"192.0.2.7","request_method":"POST","request_uri":"/login","status":"401"}` + "\n"
+	entries, errs := Stream(strings.NewReader(logs))
+	var got []Entry
+	for entry := range entries {
+		got = append(got, entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(got) != 2 || got[0].Method != "POST" || got[0].URI != "/login" || got[1].Status != 401 {
+		t.Fatalf("expected 2 JSON entries, got %+v", got)
+	}
+}
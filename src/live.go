@@ -0,0 +1,105 @@
+package main
+
+import "time"
+
+const (
+	defaultLiveWindow   = 15 * time.Minute
+	defaultLiveInterval = time.Minute
+)
+
+// LivePipeline keeps a sliding window of recent entries and re-runs the
+// analyzer over it every interval, reporting IPs that newly cross thresholds.
+// Time is driven by the caller: wall-clock time when tailing, log time when replaying.
+type LivePipeline struct {
+	cfg      Config
+	geo      GeoLookup
+	window   time.Duration
+	interval time.Duration
+	entries  []Entry
+	next     time.Time
+	flagged  map[string]struct{}
+	newIPs   *newIPTracker
+}
+
+// LiveTick is the result of one evaluation of the sliding window.
+type LiveTick struct {
+	At       time.Time
+	Entries  int
+	Analyzer *Analyzer
+	Suspects []Suspicion
+	// New lists suspects that were not flagged at the previous tick.
+	New []Suspicion
+	// NewIPSpikes lists spikes of never-seen IPs not reported at earlier ticks.
+	NewIPSpikes []NewIPSpike
+}
+
+func newLivePipeline(cfg Config, geo GeoLookup, window, interval time.Duration) *LivePipeline {
+	if window <= 0 {
+		window = defaultLiveWindow
+	}
+	if interval <= 0 {
+		interval = defaultLiveInterval
+	}
+	return &LivePipeline{
+		cfg:      cfg,
+		geo:      geo,
+		window:   window,
+		interval: interval,
+		flagged:  make(map[string]struct{}),
+		newIPs:   newNewIPTracker(),
+	}
+}
+
+// Add buffers an entry for the next evaluation.
+func (p *LivePipeline) Add(entry Entry) {
+	p.entries = append(p.entries, entry)
+	ip := entry.ClientIP
+	if ip == "" {
+		ip = entry.RemoteAddr
+	}
+	p.newIPs.add(ip, entry.Time)
+}
+
+// Advance evaluates the window when now has reached the next tick.
+func (p *LivePipeline) Advance(now time.Time) (LiveTick, bool) {
+	if p.next.IsZero() {
+		p.next = now.Truncate(p.interval).Add(p.interval)
+		return LiveTick{}, false
+	}
+	if now.Before(p.next) {
+		return LiveTick{}, false
+	}
+	for !p.next.After(now) {
+		p.next = p.next.Add(p.interval)
+	}
+	return p.Evaluate(now), true
+}
+
+// Evaluate drops entries older than the window and analyzes the rest.
+func (p *LivePipeline) Evaluate(now time.Time) LiveTick {
+	cutoff := now.Add(-p.window)
+	kept := p.entries[:0]
+	for _, entry := range p.entries {
+		if !entry.Time.Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	p.entries = kept
+
+	analyzer := New(p.cfg, p.geo)
+	for _, entry := range p.entries {
+		analyzer.Process(entry)
+	}
+	tick := LiveTick{At: now, Entries: len(p.entries), Analyzer: analyzer, Suspects: analyzer.Suspicious()}
+
+	flagged := make(map[string]struct{}, len(tick.Suspects))
+	for _, suspect := range tick.Suspects {
+		flagged[suspect.key()] = struct{}{}
+		if _, ok := p.flagged[suspect.key()]; !ok {
+			tick.New = append(tick.New, suspect)
+		}
+	}
+	p.flagged = flagged
+	tick.NewIPSpikes = p.newIPs.spikes(now, p.window, p.cfg.NewIPSpikeFactor, p.cfg.NewIPSpikeMin)
+	return tick
+}
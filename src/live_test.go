@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLivePipelineSlidesWindow(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	pipeline := newLivePipeline(cfg, nil, 5*time.Minute, time.Minute)
+
+	for i := 0; i < 40; i++ {
+		pipeline.Add(Entry{ClientIP: "192.0.2.1", Time: start.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/x%d.php", i), Status: 404})
+	}
+	tick := pipeline.Evaluate(start.Add(time.Minute))
+	if len(tick.New) != 1 || tick.New[0].IP != "192.0.2.1" {
+		t.Fatalf("expected scanner to be newly flagged, got %+v", tick.New)
+	}
+
+	tick = pipeline.Evaluate(start.Add(2 * time.Minute))
+	if len(tick.Suspects) != 1 || len(tick.New) != 0 {
+		t.Fatalf("expected scanner to stay flagged without a new alert, got %d suspects %d new", len(tick.Suspects), len(tick.New))
+	}
+
+	tick = pipeline.Evaluate(start.Add(10 * time.Minute))
+	if tick.Entries != 0 || len(tick.Suspects) != 0 {
+		t.Fatalf("expected entries to slide out of the window, got %d entries", tick.Entries)
+	}
+}
+
+func TestLivePipelineAdvanceTicksOnInterval(t *testing.T) {
+	start := time.Date(2025, 10, 19, 12, 0, 30, 0, time.UTC)
+	pipeline := newLivePipeline(DefaultConfig(), nil, time.Hour, time.Minute)
+	if _, ok := pipeline.Advance(start); ok {
+		t.Fatalf("expected first advance to only schedule the next tick")
+	}
+	if _, ok := pipeline.Advance(start.Add(20 * time.Second)); ok {
+		t.Fatalf("expected no tick before the interval boundary")
+	}
+	tick, ok := pipeline.Advance(start.Add(40 * time.Second))
+	if !ok || !tick.At.Equal(start.Add(40*time.Second)) {
+		t.Fatalf("expected tick at the interval boundary, got %v %v", tick.At, ok)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogFormat parses lines of a named log format or a custom nginx log_format.
+// A nil LogFormat parses the nginx combined format via ParseLine.
+type LogFormat struct {
+	Name    string
+	pattern *regexp.Regexp
+	// fields names the nginx variable captured by each group of pattern; empty names are ignored.
+	fields []string
+	// parse replaces pattern for formats that are not line templates, such as JSON logs.
+	parse func(line string) (Entry, error)
+	// session, when set, returns a fresh parse func for each stream, for
+	// formats whose header lines define the columns of later lines.
+	session func() func(line string) (Entry, error)
+	// times overrides how timestamps are read.
+	times LogTimes
+	// explicit marks the combined format chosen with --format nginx, which
+	// turns off detection.
+	explicit bool
+}
+
+// LogTimes controls how log timestamps are read.
+type LogTimes struct {
+	// Layout replaces the CLF layout of $time_local, which is also the
+	// bracketed time of the combined and Apache formats.
+	Layout string
+	// UTC converts every parsed timestamp to UTC, so hour-of-day rules and
+	// reports do not depend on the offset each server logs.
+	UTC bool
+}
+
+// logTimeLayoutNames maps log_time_layout shorthands to Go layouts.
+var logTimeLayoutNames = map[string]string{
+	"clf":     timeLayout,
+	"iso8601": time.RFC3339,
+	"rfc3339": time.RFC3339,
+}
+
+// parseLogTimeLayout accepts clf, iso8601 (rfc3339) or a Go layout. An
+// empty value keeps CLF.
+func parseLogTimeLayout(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if layout, ok := logTimeLayoutNames[strings.ToLower(value)]; ok {
+		return layout, nil
+	}
+	probe := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if probe.Format(value) == value {
+		return "", fmt.Errorf("log time layout %q has no time fields (want clf, iso8601 or a Go layout such as \"2006-01-02 15:04:05\")", value)
+	}
+	return value, nil
+}
+
+// withTimes returns f reading timestamps as times says. A nil f, the
+// combined format, becomes a LogFormat of its own when times is set.
+func (f *LogFormat) withTimes(times LogTimes) *LogFormat {
+	if times.Layout == timeLayout {
+		times.Layout = ""
+	}
+	if times == (LogTimes{}) {
+		return f
+	}
+	if f == nil {
+		return &LogFormat{Name: "nginx", times: times}
+	}
+	withTimes := *f
+	withTimes.times = times
+	return &withTimes
+}
+
+// combined reports whether f parses the built-in combined format.
+func (f *LogFormat) combined() bool {
+	return f == nil || (f.pattern == nil && f.parse == nil && f.session == nil)
+}
+
+// logTimes returns the time options f was built with.
+func (f *LogFormat) logTimes() LogTimes {
+	if f == nil {
+		return LogTimes{}
+	}
+	return f.times
+}
+
+// timeLayout is the layout of $time_local.
+func (f *LogFormat) timeLayout() string {
+	if f == nil || f.times.Layout == "" {
+		return timeLayout
+	}
+	return f.times.Layout
+}
+
+// forStream returns the format to parse one stream with, fed the header
+// lines already read. Formats without a session are returned as is.
+func (f *LogFormat) forStream(headers []string) *LogFormat {
+	if f == nil || f.session == nil {
+		return f
+	}
+	stream := *f
+	stream.parse = f.session()
+	for _, header := range headers {
+		stream.parse(header)
+	}
+	return &stream
+}
+
+// stateless reports whether lines parse independently of each other, so
+// they can be parsed in parallel; session formats depend on header lines.
+func (f *LogFormat) stateless() bool {
+	return f == nil || f.session == nil
+}
+
+// apacheLogFormat reads Apache common and combined logs, optionally prefixed
+// with the vhost and port as in Apache's vhost_combined.
+var apacheLogFormat = &LogFormat{
+	Name:    "apache",
+	pattern: regexp.MustCompile(`^(?:(\S+?):(\d+) )?(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\S+)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?$`),
+	fields:  []string{"host", "", "remote_addr", "", "remote_user", "time_local", "request", "status", "body_bytes_sent", "http_referer", "http_user_agent"},
+}
+
+// logFormats lists the formats selectable with --format besides nginx.
+var logFormats = map[string]*LogFormat{
+	"apache":     apacheLogFormat,
+	"alb":        albLogFormat,
+	"caddy":      caddyLogFormat,
+	"cloudfront": cloudfrontLogFormat,
+	"envoy":      envoyLogFormat,
+	"iis":        iisLogFormat,
+	"json":       jsonLogFormat,
+	"traefik":    traefikLogFormat,
+	"varnish":    varnishLogFormat,
+}
+
+// detectedLogFormats are tried in order when the format is detected; the
+// combined format goes first.
+var detectedLogFormats = []*LogFormat{apacheLogFormat, caddyLogFormat, traefikLogFormat, envoyLogFormat, albLogFormat, cloudfrontLogFormat, iisLogFormat, jsonLogFormat}
+
+// logFormatFor resolves --format and --log-format. Without a name (or with
+// auto) the format is detected from the first lines, falling back to nginx
+// combined; naming nginx, which uses template when set, turns detection off.
+// Other formats take no template. A time layout applies to the nginx and
+// Apache formats only.
+func logFormatFor(name, template string, times LogTimes) (*LogFormat, error) {
+	layout, err := parseLogTimeLayout(times.Layout)
+	if err != nil {
+		return nil, err
+	}
+	times.Layout = layout
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "auto" || name == "nginx" {
+		format, err := parseLogFormat(template)
+		if err == nil && format == nil && name == "nginx" {
+			format = &LogFormat{Name: "nginx", explicit: true}
+		}
+		return format.withTimes(times), err
+	}
+	format, ok := logFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q (want %s)", name, strings.Join(logFormatNames(), ", "))
+	}
+	if strings.TrimSpace(template) != "" {
+		return nil, fmt.Errorf("log_format applies to the nginx format, not %s", name)
+	}
+	if layout != "" && layout != timeLayout && format.pattern == nil {
+		return nil, fmt.Errorf("log_time_layout applies to the nginx and apache formats, not %s", name)
+	}
+	return format.withTimes(times), nil
+}
+
+func logFormatNames() []string {
+	names := []string{"auto", "nginx"}
+	for name := range logFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names[2:])
+	return names
+}
+
+// detects reports whether streams of f detect their format: only the
+// combined format with the default time layout, unless chosen explicitly.
+func (f *LogFormat) detects() bool {
+	return f.combined() && f.timeLayout() == timeLayout && (f == nil || !f.explicit)
+}
+
+// logSniffLines is how many leading entries of a stream can change the
+// detected format.
+const logSniffLines = 10
+
+// detectLogFormat picks the format parsing most of lines, the first entries
+// of a stream, or nil to keep the combined format, which wins ties. Another
+// format must parse more than half of the lines, so garbage such as TLS
+// handshakes sent to the HTTP port does not pick a lenient format. Traefik
+// common logs also pass for combined ones with a misread $request_time, and
+// varnishncsa lines for combined ones without the cache handling, so Traefik
+// and Varnish win when they parse as many. headers are the directive lines
+// that preceded the entries, such as W3C #Fields.
+func detectLogFormat(lines, headers []string) *LogFormat {
+	parses := func(format *LogFormat) int {
+		count := 0
+		for _, line := range lines {
+			if _, err := format.Parse(line); err == nil {
+				count++
+			}
+		}
+		return count
+	}
+	combined := parses(nil)
+	if traefik := parses(traefikCommonLog); traefik*2 > len(lines) && traefik >= combined {
+		return traefikLogFormat
+	}
+	if varnish := parses(varnishLogFormat); varnish*2 > len(lines) && varnish >= combined {
+		return varnishLogFormat
+	}
+	var best *LogFormat
+	bestCount := max(combined, len(lines)/2)
+	for _, format := range detectedLogFormats {
+		if count := parses(format.forStream(headers)); count > bestCount {
+			best, bestCount = format, count
+		}
+	}
+	return best
+}
+
+// logFormatVariable matches $name and ${name} in an nginx log_format template.
+var logFormatVariable = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+// parseLogFormat builds a parser from an nginx log_format template such as
+// `$remote_addr - $remote_user [$time_local] "$request" $status ...`. An empty
+// template or "combined" keeps the built-in combined parser and returns nil.
+func parseLogFormat(template string) (*LogFormat, error) {
+	template = strings.TrimSpace(template)
+	if template == "" || template == "combined" {
+		return nil, nil
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	format := &LogFormat{Name: "nginx"}
+	seen := make(map[string]bool)
+	last := 0
+	for _, loc := range logFormatVariable.FindAllStringSubmatchIndex(template, -1) {
+		if loc[0] == last && last > 0 {
+			return nil, fmt.Errorf("log_format %q: variables need a separator between them", template)
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		name := ""
+		if loc[2] >= 0 {
+			name = template[loc[2]:loc[3]]
+		} else {
+			name = template[loc[4]:loc[5]]
+		}
+		// A quoted variable stops at the first unescaped quote, so an
+		// escaped one inside a user agent does not end it early.
+		if strings.HasSuffix(template[:loc[0]], `"`) {
+			pattern.WriteString(`((?:[^"\\]|\\.)*?)`)
+		} else {
+			pattern.WriteString("(.*?)")
+		}
+		format.fields = append(format.fields, name)
+		seen[name] = true
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+
+	switch {
+	case !seen["remote_addr"] && !seen["http_x_forwarded_for"]:
+		return nil, fmt.Errorf("log_format %q: needs $remote_addr or $http_x_forwarded_for", template)
+	case !seen["time_local"] && !seen["time_iso8601"] && !seen["msec"]:
+		return nil, fmt.Errorf("log_format %q: needs $time_local, $time_iso8601 or $msec", template)
+	case !seen["status"]:
+		return nil, fmt.Errorf("log_format %q: needs $status", template)
+	case !seen["request"] && !seen["request_uri"] && !seen["uri"]:
+		return nil, fmt.Errorf("log_format %q: needs $request, $request_uri or $uri", template)
+	}
+
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, fmt.Errorf("log_format %q: %w", template, err)
+	}
+	format.pattern = re
+	return format, nil
+}
+
+// Parse parses one line. Variables the analyzer does not use are matched and
+// ignored, and escaped characters in the values are decoded.
+func (f *LogFormat) Parse(line string) (Entry, error) {
+	entry, err := f.parseLine(line)
+	if err == nil && f != nil && f.times.UTC {
+		entry.Time = entry.Time.UTC()
+	}
+	return entry, err
+}
+
+func (f *LogFormat) parseLine(line string) (Entry, error) {
+	if f.combined() {
+		return parseCombined(line, f.timeLayout())
+	}
+	if f.parse != nil {
+		return f.parse(line)
+	}
+	matches := f.pattern.FindStringSubmatch(line)
+	if matches == nil {
+		return Entry{}, fmt.Errorf("line does not match %s format: %w", f.Name, ErrUnmatchedLine)
+	}
+	var entry Entry
+	for i, name := range f.fields {
+		value := unescapeLogValue(matches[i+1])
+		if name == "time_local" && f.times.Layout != "" {
+			t, err := time.Parse(f.times.Layout, value)
+			if err != nil {
+				return Entry{}, fmt.Errorf("parse time: %w", err)
+			}
+			entry.Time = t
+			continue
+		}
+		if err := entry.setLogVariable(name, value); err != nil {
+			return Entry{}, err
+		}
+	}
+	entry.ClientIP = deriveClientIP(entry.RemoteAddr, entry.ForwardedFor)
+	return entry, nil
+}
+
+// setLogVariable stores the value of an nginx variable in the matching entry field.
+func (e *Entry) setLogVariable(name, value string) error {
+	var err error
+	switch name {
+	case "remote_addr":
+		e.RemoteAddr = value
+	case "remote_user":
+		e.UserAuth = value
+	case "http_x_forwarded_for":
+		e.ForwardedFor = value
+	case "time_local":
+		if e.Time, err = time.Parse(timeLayout, value); err != nil {
+			return fmt.Errorf("parse time: %w", err)
+		}
+	case "time_iso8601":
+		if e.Time, err = time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("parse time: %w", err)
+		}
+	case "msec":
+		secs, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("parse msec: %w", err)
+		}
+		e.Time = time.UnixMilli(int64(secs * 1000)).UTC()
+	case "request":
+		parts := strings.Fields(value)
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("malformed request %q: %w", value, ErrUnmatchedLine)
+		}
+		e.Method, e.URI = parts[0], parts[1]
+		if len(parts) == 3 {
+			e.Protocol = parts[2]
+		}
+	case "request_method":
+		e.Method = value
+	case "request_uri":
+		e.URI = value
+	case "uri":
+		// $request_uri includes the query string, so prefer it when both are logged.
+		if e.URI == "" {
+			e.URI = value
+		}
+	case "server_protocol":
+		e.Protocol = value
+	case "status":
+		if e.Status, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("parse status: %w", err)
+		}
+	case "body_bytes_sent", "bytes_sent":
+		if value != "-" {
+			if e.Bytes, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("parse bytes: %w", err)
+			}
+		}
+	case "http_referer":
+		e.Referer = value
+	case "http_user_agent":
+		e.UserAgent = value
+	case "request_time":
+		if value != "-" {
+			if e.RequestTime, err = strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("parse request time: %w", err)
+			}
+		}
+	case "host", "http_host", "server_name":
+		e.Host = value
+	case "backend":
+		e.Backend = value
+	case "request_time_ms":
+		if e.RequestTime, err = parseDurationMillis(value); err != nil {
+			return err
+		}
+	case "request_time_us":
+		if value != "" {
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse request time: %w", err)
+			}
+			e.RequestTime = float64(us) / 1e6
+		}
+	case "ssl_protocol":
+		e.TLSProtocol = tlsLogValue(value)
+	case "ssl_cipher":
+		e.TLSCipher = tlsLogValue(value)
+	case "http_ssl_ja3", "http_ssl_ja3_hash", "ssl_ja3", "ssl_ja3_hash":
+		e.JA3 = tlsLogValue(value)
+	case "upstream_cache_status":
+		if value != "-" {
+			e.CacheStatus = strings.ToLower(value)
+		}
+	case "http_accept_language":
+		e.setHeader(HeaderAcceptLanguage, value)
+	case "http_accept":
+		e.setHeader(HeaderAccept, value)
+	case "http_accept_encoding":
+		e.setHeader(HeaderAcceptEncoding, value)
+	case "http_cookie":
+		e.SessionLogged = true
+		e.HasSession = value != "" && value != "-"
+	default:
+		// $cookie_<name> logs a single cookie, taken to be the session cookie.
+		if strings.HasPrefix(name, "cookie_") {
+			e.SessionLogged = true
+			e.HasSession = value != "" && value != "-"
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogFormatParsesCustomTemplate(t *testing.T) {
+	format, err := parseLogFormat(`$remote_addr - $remote_user [$time_local] "$host" "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time`)
+	if err != nil {
+		t.Fatalf("parseLogFormat: %v", err)
+	}
+	entry, err := format.Parse(`192.0.2.7 - alice [19/Oct/2025:12:02:35 +0000] "shop.example.com" "GET /cart?id=1 HTTP/2.0" 404 512 "-" "Mozilla/5.0 (X11; Linux)" 0.125`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:    "192.0.2.7",
+		RemoteAddr:  "192.0.2.7",
+		UserAuth:    "alice",
+		Time:        time.Date(2025, 10, 19, 12, 2, 35, 0, time.FixedZone("", 0)),
+		Method:      "GET",
+		URI:         "/cart?id=1",
+		Protocol:    "HTTP/2.0",
+		Status:      404,
+		Bytes:       512,
+		Referer:     "-",
+		UserAgent:   "Mozilla/5.0 (X11; Linux)",
+		RequestTime: 0.125,
+		Host:        "shop.example.com",
+	}
+	if !entry.Time.Equal(want.Time) {
+		t.Fatalf("unexpected time %v", entry.Time)
+	}
+	entry.Time = want.Time
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+
+	if _, err := format.Parse(`192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`); err == nil {
+		t.Fatal("expected a combined line to be rejected by the custom format")
+	}
+
+	escaped, err := format.Parse(`192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "shop.example.com" "GET /cart HTTP/2.0" 200 512 "-" "Mozilla/5.0 \x22X11\x22 \"Linux\"" 0.125`)
+	if err != nil {
+		t.Fatalf("escaped quotes: %v", err)
+	}
+	if escaped.UserAgent != `Mozilla/5.0 "X11" "Linux"` || escaped.RequestTime != 0.125 {
+		t.Fatalf("unexpected escaped entry %+v", escaped)
+	}
+}
+
+func TestParseLogFormatValidation(t *testing.T) {
+	if format, err := parseLogFormat("combined"); err != nil || format != nil {
+		t.Fatalf("expected combined to select the built-in parser, got %v, %v", format, err)
+	}
+	for template, want := range map[string]string{
+		`$remote_addr [$time_local] "$request"`:          "needs $status",
+		`$remote_addr "$request" $status`:                "needs $time_local",
+		`$remote_addr$remote_user [$time_local] $status`: "separator",
+	} {
+		if _, err := parseLogFormat(template); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", template, want, err)
+		}
+	}
+
+	// A nil format parses the combined format.
+	var format *LogFormat
+	if entry, err := format.Parse(`192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`); err != nil || entry.ClientIP != "192.0.2.7" {
+		t.Fatalf("nil format: %+v, %v", entry, err)
+	}
+}
+
+func TestApacheLogFormat(t *testing.T) {
+	format, err := logFormatFor("Apache", "", LogTimes{})
+	if err != nil || format != apacheLogFormat {
+		t.Fatalf("expected apache format, got %v, %v", format, err)
+	}
+	common, err := format.Parse(`192.0.2.7 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`)
+	if err != nil {
+		t.Fatalf("common: %v", err)
+	}
+	if common.ClientIP != "192.0.2.7" || common.UserAuth != "frank" || common.URI != "/apache_pb.gif" || common.Bytes != 2326 || common.UserAgent != "" {
+		t.Fatalf("unexpected common entry %+v", common)
+	}
+	vhost, err := format.Parse(`www.example.com:443 2001:db8::7 - - [10/Oct/2000:13:55:36 -0700] "POST /login HTTP/1.1" 401 - "-" "curl/8.0"`)
+	if err != nil {
+		t.Fatalf("vhost_combined: %v", err)
+	}
+	if vhost.Host != "www.example.com" || vhost.ClientIP != "2001:db8::7" || vhost.Status != 401 || vhost.UserAgent != "curl/8.0" {
+		t.Fatalf("unexpected vhost_combined entry %+v", vhost)
+	}
+
+	escaped, err := format.Parse(`192.0.2.7 - - [10/Oct/2000:13:55:36 -0700] "GET /a\"b HTTP/1.1" 404 - "-" "Mozilla/5.0 \"compatible\""`)
+	if err != nil {
+		t.Fatalf("escaped quotes: %v", err)
+	}
+	if escaped.URI != `/a"b` || escaped.UserAgent != `Mozilla/5.0 "compatible"` {
+		t.Fatalf("unexpected escaped entry %+v", escaped)
+	}
+
+	if _, err := logFormatFor("apache", `$remote_addr [$time_local] "$request" $status`, LogTimes{}); err == nil {
+		t.Fatal("expected log_format to be rejected for the apache format")
+	}
+	if _, err := logFormatFor("lighttpd", "", LogTimes{}); err == nil || !strings.Contains(err.Error(), "apache") {
+		t.Fatalf("expected unknown format error listing formats, got %v", err)
+	}
+}
+
+func TestStreamDetectsApacheCommon(t *testing.T) {
+	logs := strings.NewReader("192.0.2.7 - - [10/Oct/2000:13:55:36 -0700] \"GET / HTTP/1.0\" 200 2326\n192.0.2.8 - - [10/Oct/2000:13:55:37 -0700] \"GET /a HTTP/1.0\" 404 -\n")
+	entries, errs := Stream(logs)
+	count := 0
+	for range entries {
+		count++
+	}
+	if err := <-errs; err != nil || count != 2 {
+		t.Fatalf("expected 2 apache entries, got %d, %v", count, err)
+	}
+}
+
+func TestLogTimeLayout(t *testing.T) {
+	line := `192.0.2.7 - - [2025-10-19T14:02:35+02:00] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`
+	if _, err := ParseLine(line); err == nil {
+		t.Fatal("expected an ISO 8601 time to fail the CLF layout")
+	}
+	format, err := logFormatFor("nginx", "", LogTimes{Layout: "iso8601"})
+	if err != nil {
+		t.Fatalf("logFormatFor: %v", err)
+	}
+	entry, err := format.Parse(line)
+	if err != nil || !entry.Time.Equal(time.Date(2025, 10, 19, 12, 2, 35, 0, time.UTC)) {
+		t.Fatalf("unexpected entry %+v, %v", entry, err)
+	}
+	if _, offset := entry.Time.Zone(); offset != 2*3600 {
+		t.Fatalf("expected the logged offset to be kept, got %v", entry.Time)
+	}
+
+	format, err = logFormatFor("apache", "", LogTimes{Layout: "2006-01-02 15:04:05", UTC: true})
+	if err != nil {
+		t.Fatalf("logFormatFor apache: %v", err)
+	}
+	entry, err = format.Parse(`192.0.2.7 - - [2025-10-19 12:02:35] "GET / HTTP/1.0" 200 2326`)
+	if err != nil || entry.Time != time.Date(2025, 10, 19, 12, 2, 35, 0, time.UTC) {
+		t.Fatalf("unexpected apache entry %+v, %v", entry, err)
+	}
+
+	for _, bad := range []LogTimes{{Layout: "iso"}, {Layout: "iso8601"}} {
+		if _, err := logFormatFor("caddy", "", bad); err == nil {
+			t.Errorf("expected %+v to be rejected for caddy", bad)
+		}
+	}
+	if format, err := logFormatFor("apache", "", LogTimes{Layout: "clf"}); err != nil || format != apacheLogFormat {
+		t.Fatalf("expected clf to keep the apache format, got %v, %v", format, err)
+	}
+}
+
+func TestStreamUTCKeepsDetection(t *testing.T) {
+	format, err := logFormatFor("", "", LogTimes{UTC: true})
+	if err != nil {
+		t.Fatalf("logFormatFor: %v", err)
+	}
+	log := `192.0.2.7 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326` + "\n"
+	entries, errs := StreamWith(strings.NewReader(log), StreamOptions{Format: format})
+	var got []Entry
+	for entry := range entries {
+		got = append(got, entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if len(got) != 1 || got[0].Time != time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC) {
+		t.Fatalf("expected the apache line detected and read in UTC, got %+v", got)
+	}
+}
+
+func TestStreamDetectsFormatPastBrokenFirstLine(t *testing.T) {
+	// A rotated log can start mid-line; later entries correct the detection.
+	logs := "36 -0700] \"GET / HTTP/1.0\" 200 2326\n"
+	for i := 0; i < 3; i++ {
+		logs += fmt.Sprintf("192.0.2.%d - - [10/Oct/2000:13:55:3%d -0700] \"GET / HTTP/1.0\" 200 2326\n", i+1, i)
+	}
+	var unparsed []string
+	entries, errs := StreamWith(strings.NewReader(logs), StreamOptions{OnUnparsed: func(line string, _ error) { unparsed = append(unparsed, line) }})
+	count := 0
+	for range entries {
+		count++
+	}
+	if err := <-errs; err != nil || count != 3 || len(unparsed) != 1 {
+		t.Fatalf("expected 3 apache entries and the broken line rejected, got %d, %q, %v", count, unparsed, err)
+	}
+}
+
+func TestExplicitNginxFormatSkipsDetection(t *testing.T) {
+	format, err := logFormatFor("nginx", "", LogTimes{})
+	if err != nil {
+		t.Fatalf("logFormatFor: %v", err)
+	}
+	if format.detects() {
+		t.Fatal("expected --format nginx to turn detection off")
+	}
+	for _, name := range []string{"", "auto"} {
+		if format, err := logFormatFor(name, "", LogTimes{}); err != nil || !format.detects() {
+			t.Fatalf("expected %q to detect the format, got %v, %v", name, format, err)
+		}
+	}
+	log := `192.0.2.7 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326` + "\n"
+	entries, errs := StreamWith(strings.NewReader(log), StreamOptions{Format: format})
+	for entry := range entries {
+		t.Fatalf("expected the apache line to be rejected by nginx, got %+v", entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+}
@@ -28,22 +28,79 @@ type Entry struct {
 	Bytes        int64
 	Referer      string
 	UserAgent    string
+	// RequestTime is $request_time in seconds, or 0 when the log does not record it.
+	RequestTime float64
+	// Host is $host (or $http_host, $server_name) when a custom log_format records it.
+	Host string
+	// HasSession reports whether the request carried a session cookie.
+	// SessionLogged is false when the log format does not record cookies.
+	SessionLogged bool
+	HasSession    bool
+	// AcceptLanguage, Accept and AcceptEncoding hold the request headers named
+	// in LoggedHeaders, for log formats that record them.
+	AcceptLanguage string
+	Accept         string
+	AcceptEncoding string
+	LoggedHeaders  HeaderSet
+	// Backend is the proxy's router or service that handled the request, for
+	// logs that record it such as Traefik's.
+	Backend string
+	// UpstreamHost is the upstream address that served the request and
+	// ResponseFlags the proxy's response flags, such as Envoy's "NR" or "UF",
+	// for logs that record them.
+	UpstreamHost  string
+	ResponseFlags string
+	// TLSProtocol and TLSCipher are the negotiated $ssl_protocol and
+	// $ssl_cipher, and JA3 the client's JA3 fingerprint from an nginx module,
+	// for logs that record them.
+	TLSProtocol string
+	TLSCipher   string
+	JA3         string
+	// CacheStatus is the cache's handling of the request, lowercased, such
+	// as Varnish's hit, miss or pass or nginx's $upstream_cache_status, for
+	// logs that record it.
+	CacheStatus string
+	// Source names the log file the entry came from when several logs are
+	// analyzed together; it is empty for single-log runs.
+	Source string
+	// Raw is the log line the entry was parsed from, set by Stream.
+	Raw string
+	// Hostname is the sending host of a line shipped through syslog.
+	Hostname string
 }
 
 var (
-	// Combined log format regex.
-	logPattern = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([A-Z]+) ([^" ]+) ([^"]+)" (\d{3}) (\S+) "([^"]*)" "([^"]*)"(?: "([^"]*)")?`)
+	// Combined log format regex with optional trailing X-Forwarded-For and $request_time fields.
+	// Quoted fields may contain backslash escapes such as \" or nginx's \x22.
+	logPattern = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([A-Z]+) ((?:[^"\\ ]|\\.)+) ((?:[^"\\]|\\.)+)" (\d{3}) (\S+) "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"(?: "((?:[^"\\]|\\.)*)")?(?: (\d+(?:\.\d+)?)(?:\s|$))?`)
 	timeLayout = "02/Jan/2006:15:04:05 -0700"
 )
 
 // ParseLine attempts to parse a single access log line.
 func ParseLine(line string) (Entry, error) {
+	return parseCombined(line, timeLayout)
+}
+
+// parseCombined parses a combined format line whose time is written in
+// layout. Only CLF times take the fast path.
+func parseCombined(line, layout string) (Entry, error) {
+	if layout == timeLayout {
+		if entry, ok := parseCombinedFast(line); ok {
+			return entry, nil
+		}
+	}
+	return parseCombinedPattern(line, layout)
+}
+
+// parseCombinedPattern is parseCombined using logPattern, for the lines
+// parseCombinedFast leaves to it.
+func parseCombinedPattern(line, layout string) (Entry, error) {
 	matches := logPattern.FindStringSubmatch(line)
 	if matches == nil {
 		return Entry{}, fmt.Errorf("line does not match expected format: %w", ErrUnmatchedLine)
 	}
 
-	t, err := time.Parse(timeLayout, matches[4])
+	t, err := time.Parse(layout, matches[4])
 	if err != nil {
 		return Entry{}, fmt.Errorf("parse time: %w", err)
 	}
@@ -63,7 +120,15 @@ func ParseLine(line string) (Entry, error) {
 
 	forwarded := ""
 	if len(matches) >= 12 {
-		forwarded = matches[12]
+		forwarded = unescapeLogValue(matches[12])
+	}
+
+	var requestTime float64
+	if len(matches) >= 14 && matches[13] != "" {
+		requestTime, err = strconv.ParseFloat(matches[13], 64)
+		if err != nil {
+			return Entry{}, fmt.Errorf("parse request time: %w", err)
+		}
 	}
 
 	clientIP := deriveClientIP(matches[1], forwarded)
@@ -76,20 +141,77 @@ func ParseLine(line string) (Entry, error) {
 		UserAuth:     matches[3],
 		Time:         t,
 		Method:       matches[5],
-		URI:          matches[6],
-		Protocol:     matches[7],
+		URI:          unescapeLogValue(matches[6]),
+		Protocol:     unescapeLogValue(matches[7]),
 		Status:       status,
 		Bytes:        bytes,
-		Referer:      matches[10],
-		UserAgent:    matches[11],
+		Referer:      unescapeLogValue(matches[10]),
+		UserAgent:    unescapeLogValue(matches[11]),
+		RequestTime:  requestTime,
 	}, nil
 }
 
+// unescapeLogValue decodes the escapes nginx (escape=default) and Apache write
+// in logged values: \xHH for quotes, backslashes and bytes outside printable
+// ASCII, and \" and \\. Other backslashes are kept as they are.
+func unescapeLogValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; {
+		case next == '"' || next == '\\':
+			b.WriteByte(next)
+			i++
+		case next == 'x' && i+3 < len(s):
+			if v, ok := hexValue(s[i+2 : i+4]); ok {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+			b.WriteByte('\\')
+		default:
+			b.WriteByte('\\')
+		}
+	}
+	return b.String()
+}
+
 // ErrUnmatchedLine signals that a log line could not be parsed using the known pattern.
 var ErrUnmatchedLine = errors.New("unmatched line")
 
+// StreamOptions tunes how Stream handles its input.
+type StreamOptions struct {
+	// OnUnparsed receives the lines the parser rejects, which are skipped so
+	// one malformed line does not discard the rest of the log.
+	OnUnparsed func(line string, err error)
+	// Strict instead stops the stream with an error at the first rejected line.
+	Strict bool
+	// Workers parse lines on this many goroutines when above 1. Entries are
+	// still delivered in log order.
+	Workers int
+	// Format parses each line. When nil the combined format is used, unless
+	// the first line only parses as another known format such as Apache common.
+	Format *LogFormat
+	// Since and Until skip entries logged before Since or at or after Until;
+	// zero times leave that side open.
+	Since time.Time
+	Until time.Time
+}
+
 // Stream parses entries from a reader, yielding them via a channel until EOF or context cancellation.
 func Stream(r io.Reader) (<-chan Entry, <-chan error) {
+	return StreamWith(r, StreamOptions{})
+}
+
+// StreamWith is Stream with options.
+func StreamWith(r io.Reader, opts StreamOptions) (<-chan Entry, <-chan error) {
 	entries := make(chan Entry)
 	errs := make(chan error, 1)
 
@@ -101,26 +223,126 @@ func Stream(r io.Reader) (<-chan Entry, <-chan error) {
 		buf := make([]byte, 0, 1024*1024)
 		scanner.Buffer(buf, 1024*1024)
 
+		// emit delivers parsed lines in log order; it returns an error only
+		// for a rejected line in strict mode.
+		emit := func(parsed streamLine) error {
+			if parsed.err != nil {
+				if opts.Strict {
+					return fmt.Errorf("line %d: %w", parsed.no, parsed.err)
+				}
+				if opts.OnUnparsed != nil {
+					opts.OnUnparsed(parsed.line, parsed.err)
+				}
+				return nil
+			}
+			if parsed.keep {
+				entries <- parsed.entry
+			}
+			return nil
+		}
+
+		format := opts.Format.forStream(nil)
+		// Detection keeps the UTC option; a custom time layout means the
+		// format is known.
+		detect := format.detects()
+		// headers holds the directive lines read before the first entry and
+		// sniffed the first entries, which may still change the format.
+		var headers, sniffed []string
+		var detected *LogFormat
+		// pending holds sniffed lines the format rejected, which a later
+		// change of format may still parse.
+		var pending []streamLine
+		settle := func(final bool) error {
+			kept := pending[:0]
+			for _, line := range pending {
+				parsed := parseStreamLine(format, opts, line.no, line.line)
+				if parsed.err != nil && !final {
+					kept = append(kept, parsed)
+					continue
+				}
+				if err := emit(parsed); err != nil {
+					return err
+				}
+			}
+			pending = kept
+			return nil
+		}
+		var pool *parsePool
+		lineNo := 0
 		for scanner.Scan() {
+			lineNo++
 			line := strings.TrimSpace(scanner.Text())
 			if line == "" {
 				continue
 			}
-
-			entry, err := ParseLine(line)
-			if err != nil {
+			// W3C logs such as CloudFront's open with #Version and #Fields
+			// directives; detection starts at the first entry.
+			if detect && len(sniffed) == 0 && strings.HasPrefix(line, "#") {
+				headers = append(headers, line)
+				continue
+			}
+			// The first entry picks the format. Until logSniffLines entries
+			// were read, an entry the format rejects picks it again from all
+			// of them, so a truncated first line does not decide it. Rejected
+			// entries wait until then in case a later format parses them.
+			if detect {
+				body, _ := stripSyslogEnvelope(line)
+				sniffed = append(sniffed, body)
+				if _, err := format.Parse(body); len(sniffed) == 1 || err != nil {
+					if choice := detectLogFormat(sniffed, headers); choice != detected {
+						detected = choice
+						format = opts.Format.forStream(nil)
+						if choice != nil {
+							format = choice.withTimes(opts.Format.logTimes()).forStream(headers)
+							log.Printf("detected %s log format", format.Name)
+						}
+						if err := settle(false); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}
+				detect = len(sniffed) < logSniffLines
+				parsed := parseStreamLine(format, opts, lineNo, line)
+				if parsed.err != nil && detect {
+					pending = append(pending, parsed)
+					continue
+				}
+				if err := settle(true); err != nil {
+					errs <- err
+					return
+				}
+				if err := emit(parsed); err != nil {
+					errs <- err
+					return
+				}
+				continue
+			}
+			if pool == nil && !detect && opts.Workers > 1 && format.stateless() {
+				pool = startParsePool(format, opts, emit)
+			}
+			if pool != nil {
+				if !pool.Add(lineNo, line) {
+					break
+				}
+				continue
+			}
+			if err := emit(parseStreamLine(format, opts, lineNo, line)); err != nil {
 				errs <- err
 				return
 			}
+		}
 
-			// Skip entries with invalid/empty client IP
-			if entry.ClientIP == "" {
-				continue
+		if pool != nil {
+			if err := pool.Close(); err != nil {
+				errs <- err
+				return
 			}
-
-			entries <- entry
 		}
-
+		if err := settle(true); err != nil {
+			errs <- err
+			return
+		}
 		if err := scanner.Err(); err != nil {
 			errs <- err
 			return
@@ -132,6 +354,40 @@ func Stream(r io.Reader) (<-chan Entry, <-chan error) {
 	return entries, errs
 }
 
+// streamLine is the outcome of parsing one log line.
+type streamLine struct {
+	no    int
+	line  string
+	err   error
+	entry Entry
+	// keep is set when entry passed the stream's filters.
+	keep bool
+}
+
+// parseStreamLine parses line and applies the client IP and time filters of opts.
+func parseStreamLine(format *LogFormat, opts StreamOptions, no int, line string) streamLine {
+	body, hostname := stripSyslogEnvelope(line)
+	entry, err := format.Parse(body)
+	parsed := streamLine{no: no, line: line, err: err}
+	if err != nil {
+		return parsed
+	}
+	// Skip entries with invalid/empty client IP
+	if entry.ClientIP == "" {
+		return parsed
+	}
+	if !opts.Since.IsZero() && entry.Time.Before(opts.Since) {
+		return parsed
+	}
+	if !opts.Until.IsZero() && !entry.Time.Before(opts.Until) {
+		return parsed
+	}
+	entry.Raw = line
+	entry.Hostname = hostname
+	parsed.entry, parsed.keep = entry, true
+	return parsed
+}
+
 func isValidIPAddress(ipStr string) bool {
 	parsed := net.ParseIP(ipStr)
 	return parsed != nil
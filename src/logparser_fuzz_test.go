@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// addLineSeeds seeds a fuzz target with known good lines and the lines captured
+// by --capture-unparsed into testdata/unparsed.
+func addLineSeeds(f *testing.F) {
+	f.Add(`35.191.50.44 - - [19/Oct/2025:00:00:07 +0200] "GET /files/colors/5405.jpg HTTP/1.1" 304 0 "https://www.wordans.at/" "Mozilla/5.0"`)
+	f.Add(`10.0.0.1 - alice [19/Oct/2025:00:00:07 +0200] "POST /login HTTP/2.0" 401 12 "-" "curl/8.4" "203.0.113.5, 10.0.0.1" 0.153`)
+	f.Add(`2001:db8::1 - - [19/Oct/2025:00:00:07 +0000] "GET /?q=%27 HTTP/1.1" 200 - "-" "-" "-"`)
+
+	paths, _ := filepath.Glob(filepath.Join("testdata", "unparsed", "*.log"))
+	for _, path := range paths {
+		fh, err := os.Open(path)
+		if err != nil {
+			f.Fatalf("open corpus %s: %v", path, err)
+		}
+		scanner := bufio.NewScanner(fh)
+		for scanner.Scan() {
+			f.Add(scanner.Text())
+		}
+		fh.Close()
+	}
+}
+
+func FuzzParseLine(f *testing.F) {
+	addLineSeeds(f)
+	f.Fuzz(func(t *testing.T, line string) {
+		entry, err := ParseLine(line)
+		if err != nil {
+			return
+		}
+		if entry.Status < 0 || entry.Status > 999 {
+			t.Fatalf("status out of range: %d", entry.Status)
+		}
+		if entry.Method == "" || entry.URI == "" || strings.ContainsAny(entry.URI, " \"") {
+			t.Fatalf("malformed request fields: %q %q", entry.Method, entry.URI)
+		}
+		if entry.Bytes < 0 || entry.RequestTime < 0 {
+			t.Fatalf("negative size or duration: %d %f", entry.Bytes, entry.RequestTime)
+		}
+		if entry.ClientIP != "" && net.ParseIP(entry.ClientIP) == nil {
+			t.Fatalf("invalid client ip %q", entry.ClientIP)
+		}
+	})
+}
+
+func FuzzParseCombinedFast(f *testing.F) {
+	addLineSeeds(f)
+	f.Fuzz(func(t *testing.T, line string) {
+		fast, ok := parseCombinedFast(line)
+		if !ok {
+			return
+		}
+		want, err := parseCombinedPattern(line, timeLayout)
+		if err != nil {
+			t.Fatalf("tokenizer parsed a line logPattern rejects: %v", err)
+		}
+		// Each parse gets its own fixed zone, so compare instants and offsets.
+		_, fastOffset := fast.Time.Zone()
+		_, wantOffset := want.Time.Zone()
+		if !fast.Time.Equal(want.Time) || fastOffset != wantOffset {
+			t.Fatalf("tokenizer and logPattern disagree on time: got %v, want %v", fast.Time, want.Time)
+		}
+		fast.Time, want.Time = time.Time{}, time.Time{}
+		if fast != want {
+			t.Fatalf("tokenizer and logPattern disagree:\n got %+v\nwant %+v", fast, want)
+		}
+	})
+}
+
+func FuzzStreamWith(f *testing.F) {
+	addLineSeeds(f)
+	f.Fuzz(func(t *testing.T, input string) {
+		if !utf8.ValidString(input) {
+			return
+		}
+		unparsed := 0
+		entries, errs := StreamWith(strings.NewReader(input), StreamOptions{
+			OnUnparsed: func(string, error) { unparsed++ },
+		})
+		parsed := 0
+		for range entries {
+			parsed++
+		}
+		if err := <-errs; err != nil && !strings.Contains(err.Error(), "token too long") {
+			t.Fatalf("tolerant stream failed: %v", err)
+		}
+		if lines := strings.Count(input, "\n") + 1; parsed+unparsed > lines {
+			t.Fatalf("%d entries and %d rejects from %d lines", parsed, unparsed, lines)
+		}
+	})
+}
+
+// customLogFormat is the log_format template FuzzStreamFormats runs as "custom".
+const customLogFormat = `$remote_addr - $remote_user [$time_local] "$host" "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time`
+
+// formatSeeds holds a well-formed stream for every format FuzzStreamFormats
+// covers: the registered --format names, nginx combined and a custom log_format.
+var formatSeeds = map[string]string{
+	"nginx":      `35.191.50.44 - - [19/Oct/2025:00:00:07 +0200] "GET /files/colors/5405.jpg HTTP/1.1" 304 0 "https://www.wordans.at/" "Mozilla/5.0"`,
+	"custom":     `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "shop.example.com" "GET /cart?id=1 HTTP/1.1" 404 512 "-" "curl/8.0" 0.125`,
+	"apache":     `shop.example.com:443 192.0.2.7 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "-" "curl/8.0"`,
+	"alb":        albAccessLine,
+	"caddy":      caddyAccessLine,
+	"cloudfront": cloudfrontLog,
+	"envoy":      envoyDefaultLine + "\n" + istioDefaultLine,
+	"iis":        iisLog,
+	"json":       `{"time_iso8601":"2025-10-19T12:02:35+00:00","remote_addr":"10.0.0.1","request":"GET /search?q=1 HTTP/1.1","status":404,"body_bytes_sent":"512","http_user_agent":"curl/8.0","host":"shop.example.com"}`,
+	"traefik":    traefikCommonLine,
+	"varnish":    varnishLine,
+}
+
+func FuzzStreamFormats(f *testing.F) {
+	custom, err := parseLogFormat(customLogFormat)
+	if err != nil {
+		f.Fatalf("parse custom log_format: %v", err)
+	}
+	formats := map[string]*LogFormat{"nginx": nil, "custom": custom}
+	for name, format := range logFormats {
+		formats[name] = format
+	}
+	for name, format := range formats {
+		seed, ok := formatSeeds[name]
+		if !ok {
+			f.Fatalf("no seed stream for format %s", name)
+		}
+		entries, errs := StreamWith(strings.NewReader(seed), StreamOptions{Format: format})
+		parsed := 0
+		for range entries {
+			parsed++
+		}
+		if err := <-errs; err != nil || parsed == 0 {
+			f.Fatalf("seed for format %s does not parse: %v", name, err)
+		}
+		f.Add(name, seed)
+		// Every format also sees the other formats' lines.
+		for _, other := range formatSeeds {
+			f.Add(name, other)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, name, input string) {
+		format, ok := formats[name]
+		if !ok || !utf8.ValidString(input) {
+			return
+		}
+		unparsed := 0
+		entries, errs := StreamWith(strings.NewReader(input), StreamOptions{
+			Format:     format,
+			OnUnparsed: func(string, error) { unparsed++ },
+		})
+		parsed := 0
+		for entry := range entries {
+			parsed++
+			if entry.Status < 0 || entry.Status > 999 {
+				t.Fatalf("%s: status out of range: %d", name, entry.Status)
+			}
+			if entry.Bytes < 0 || entry.RequestTime < 0 {
+				t.Fatalf("%s: negative size or duration: %d %f", name, entry.Bytes, entry.RequestTime)
+			}
+		}
+		if err := <-errs; err != nil && !strings.Contains(err.Error(), "token too long") {
+			t.Fatalf("%s: tolerant stream failed: %v", name, err)
+		}
+		if lines := strings.Count(input, "\n") + 1; parsed+unparsed > lines {
+			t.Fatalf("%s: %d entries and %d rejects from %d lines", name, parsed, unparsed, lines)
+		}
+	})
+}
+
+func TestCapturedSamplesAreRejected(t *testing.T) {
+	fh, err := os.Open(filepath.Join("testdata", "unparsed", "samples.log"))
+	if err != nil {
+		t.Fatalf("open samples: %v", err)
+	}
+	defer fh.Close()
+
+	capturePath := filepath.Join(t.TempDir(), "unparsed.log")
+	capture, err := openUnparsedCapture(capturePath)
+	if err != nil {
+		t.Fatalf("openUnparsedCapture: %v", err)
+	}
+	entries, errs := StreamWith(fh, StreamOptions{OnUnparsed: capture.Capture})
+	for entry := range entries {
+		t.Errorf("expected sample to be rejected, parsed %+v", entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if err := capture.Close(); err != nil {
+		t.Fatalf("close capture: %v", err)
+	}
+
+	data, _ := os.ReadFile(capturePath)
+	if capture.Lines != 4 || strings.Count(string(data), "\n") != 4 {
+		t.Fatalf("expected 4 captured lines, got %d:\n%s", capture.Lines, data)
+	}
+}
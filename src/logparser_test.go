@@ -64,7 +64,7 @@ func TestParseLineInvalid(t *testing.T) {
 func TestStreamStopsOnParseError(t *testing.T) {
     logs := strings.NewReader("192.0.2.10 - - [19/Oct/2025:00:00:07 +0200] \"GET / HTTP/1.1\" 200 0 \"-\" \"agent\"\ninvalid line")
 
-    entries, errs := Stream(logs)
+    entries, errs := StreamWith(logs, StreamOptions{Strict: true})
     // Drain first entry which should fail to parse due to bad IP token.
     for range entries {
     }
@@ -72,3 +72,158 @@ func TestStreamStopsOnParseError(t *testing.T) {
         t.Fatalf("expected error from stream")
     }
 }
+
+func TestStreamSkipsUnparsedLines(t *testing.T) {
+    good := "192.0.2.10 - - [19/Oct/2025:00:00:07 +0200] \"GET / HTTP/1.1\" 200 0 \"-\" \"agent\"\n"
+    logs := strings.NewReader(good + "invalid line\n\x16\x03\x01\x02\x00\n" + good)
+
+    var rejected []string
+    entries, errs := StreamWith(logs, StreamOptions{OnUnparsed: func(line string, _ error) {
+        rejected = append(rejected, line)
+    }})
+    count := 0
+    for range entries {
+        count++
+    }
+    if err := <-errs; err != nil {
+        t.Fatalf("stream: %v", err)
+    }
+    if count != 2 || len(rejected) != 2 || rejected[0] != "invalid line" {
+        t.Fatalf("expected 2 entries and 2 rejected lines, got %d and %q", count, rejected)
+    }
+}
+
+func TestParseLineWithRequestTime(t *testing.T) {
+    line := "203.0.113.10 - - [19/Oct/2025:00:01:00 +0000] \"GET /search?q=x HTTP/1.1\" 200 1024 \"-\" \"UA\" \"-\" 2.504"
+
+    entry, err := ParseLine(line)
+    if err != nil {
+        t.Fatalf("ParseLine returned error: %v", err)
+    }
+
+    if entry.RequestTime != 2.504 {
+        t.Fatalf("expected request time 2.504, got %v", entry.RequestTime)
+    }
+    if entry.ClientIP != "203.0.113.10" {
+        t.Fatalf("unexpected client ip: %s", entry.ClientIP)
+    }
+}
+
+func TestParseLineEscapedQuotes(t *testing.T) {
+    line := `198.51.100.4 - - [19/Oct/2025:00:02:00 +0000] "GET /search?q=\x22a\x22 HTTP/1.1" 200 512 "https://example.com/?q=\"x\"" "Mozilla/5.0 \"Gecko\" \xE2\x82\xAC \\ bot" "-" 0.010`
+
+    entry, err := ParseLine(line)
+    if err != nil {
+        t.Fatalf("ParseLine returned error: %v", err)
+    }
+
+    if entry.URI != `/search?q="a"` {
+        t.Fatalf("unexpected uri: %s", entry.URI)
+    }
+    if entry.Referer != `https://example.com/?q="x"` {
+        t.Fatalf("unexpected referer: %s", entry.Referer)
+    }
+    if entry.UserAgent != `Mozilla/5.0 "Gecko" € \ bot` {
+        t.Fatalf("unexpected user agent: %s", entry.UserAgent)
+    }
+    if entry.RequestTime != 0.010 {
+        t.Fatalf("expected request time 0.010, got %v", entry.RequestTime)
+    }
+}
+
+func TestUnescapeLogValue(t *testing.T) {
+    tests := map[string]string{
+        `plain`:          `plain`,
+        `a\x22b\x5Cc`:    `a"b\c`,
+        `a\"b\\c`:        `a"b\c`,
+        `C:\windows\x2`:  `C:\windows\x2`,
+        `\xzz trailing\`: `\xzz trailing\`,
+    }
+    for in, want := range tests {
+        if got := unescapeLogValue(in); got != want {
+            t.Errorf("unescapeLogValue(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestStreamSkipsEntriesOutsideWindow(t *testing.T) {
+    var lines strings.Builder
+    for _, ts := range []string{"19/Oct/2025:05:59:59 +0000", "19/Oct/2025:06:00:00 +0000", "19/Oct/2025:06:30:00 +0000", "19/Oct/2025:07:00:00 +0000"} {
+        lines.WriteString("203.0.113.10 - - [" + ts + "] \"GET / HTTP/1.1\" 200 0 \"-\" \"UA\"\n")
+    }
+
+    entries, errs := StreamWith(strings.NewReader(lines.String()), StreamOptions{
+        Since: time.Date(2025, 10, 19, 6, 0, 0, 0, time.UTC),
+        Until: time.Date(2025, 10, 19, 7, 0, 0, 0, time.UTC),
+    })
+    var got []string
+    for entry := range entries {
+        got = append(got, entry.Time.Format("15:04:05"))
+    }
+    if err := <-errs; err != nil {
+        t.Fatalf("stream: %v", err)
+    }
+    if strings.Join(got, ",") != "06:00:00,06:30:00" {
+        t.Fatalf("expected entries from 06:00 up to 07:00, got %v", got)
+    }
+}
+
+func TestParseCombinedFastMatchesPattern(t *testing.T) {
+    lines := []string{
+        `35.191.50.44 - - [19/Oct/2025:00:00:07 +0200] "GET /files/colors/5405.jpg HTTP/1.1" 304 0 "https://www.wordans.at/" "Mozilla/5.0"`,
+        `10.0.0.1 - alice [19/Oct/2025:00:00:07 +0200] "POST /login HTTP/2.0" 401 12 "-" "curl/8.4" "203.0.113.5, 10.0.0.1" 0.153`,
+        `2001:db8::1 - - [19/Oct/2025:00:00:07 +0000] "GET /?q=%27 HTTP/1.1" 200 - "-" "-" "-"`,
+        `203.0.113.10 - - [19/Oct/2025:00:01:00 +0000] "GET /search?q=x HTTP/1.1" 200 1024 "-" "UA" "-" 2.504`,
+        `203.0.113.10 - - [19/Oct/2025:00:01:00 +0000] "GET /a b HTTP/1.1" 200 1024 "-" "UA" 2.504ms`,
+        `198.51.100.4 - - [19/Oct/2025:00:02:00 +0000] "GET /search?q=\x22a\x22 HTTP/1.1" 200 512 "https://example.com/?q=\"x\"" "Mozilla/5.0 \"Gecko\" \xE2\x82\xAC \\ bot" "-" 0.010`,
+        `198.51.100.4 - - [19/Oct/2025:00:02:00 +0000] "GET / HTTP/1.1" 200 512 "-" "agent" "unterminated`,
+    }
+    for _, line := range lines {
+        fast, ok := parseCombinedFast(line)
+        if !ok {
+            t.Errorf("tokenizer left a well-formed line to the pattern: %s", line)
+            continue
+        }
+        want, err := parseCombinedPattern(line, timeLayout)
+        if err != nil {
+            t.Fatalf("pattern rejected %s: %v", line, err)
+        }
+        if !fast.Time.Equal(want.Time) {
+            t.Errorf("time %v, want %v", fast.Time, want.Time)
+        }
+        fast.Time, want.Time = time.Time{}, time.Time{}
+        if fast != want {
+            t.Errorf("tokenizer and pattern disagree on %s:\n got %+v\nwant %+v", line, fast, want)
+        }
+    }
+
+    // Lines the tokenizer does not handle still go through the pattern.
+    for _, line := range []string{"invalid line", `192.0.2.1 - - [19/Oct/2025:00:00:07 +0200] "GET / HTTP/1.1" 200 12x "-" "-"`} {
+        if _, ok := parseCombinedFast(line); ok {
+            t.Errorf("expected the tokenizer to leave %q to the pattern", line)
+        }
+        if _, err := ParseLine(line); err == nil {
+            t.Errorf("expected %q to be rejected", line)
+        }
+    }
+}
+
+func BenchmarkParseLine(b *testing.B) {
+    line := `203.0.113.5 - - [19/Oct/2025:00:00:07 +0200] "GET /files/colors/5405.jpg?v=3 HTTP/1.1" 200 5120 "https://www.example.com/" "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36" "-" 0.012`
+    b.Run("tokenizer", func(b *testing.B) {
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            if _, err := ParseLine(line); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+    b.Run("pattern", func(b *testing.B) {
+        b.ReportAllocs()
+        for i := 0; i < b.N; i++ {
+            if _, err := parseCombinedPattern(line, timeLayout); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+}
@@ -3,14 +3,20 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
+	"slices"
 	"sort"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
 )
 
@@ -24,7 +30,35 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify-bot":
+			os.Exit(runVerifyBot(os.Args[2:]))
+		case "evidence":
+			os.Exit(runEvidence(os.Args[2:]))
+		case "report":
+			os.Exit(runReport(os.Args[2:]))
+		case "peer":
+			os.Exit(runPeer(os.Args[2:]))
+		case "tune":
+			os.Exit(runTune(os.Args[2:]))
+		case "replay":
+			os.Exit(runReplay(os.Args[2:]))
+		case "gen":
+			os.Exit(runGen(os.Args[2:]))
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		case "challenge":
+			os.Exit(runChallenge(os.Args[2:]))
+		case "geoip":
+			os.Exit(runGeoIP(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		}
+	}
+
 	configPath := detectConfigPath(os.Args[1:])
+	profileName := detectProfileName(os.Args[1:])
 	var fileCfg FileConfig
 	if configPath != "" {
 		cfgFromFile, err := loadFileConfig(configPath)
@@ -32,6 +66,15 @@ func main() {
 			log.Fatalf("load config %s: %v", configPath, err)
 		}
 		fileCfg = cfgFromFile
+		if warning := configKeyWarning(configPath); warning != "" {
+			log.Print(warning)
+		}
+	} else if profileName != "" {
+		log.Fatal("--profile-name requires --config")
+	}
+	fileCfg, err := fileCfg.withProfile(profileName)
+	if err != nil {
+		log.Fatalf("load config %s: %v", configPath, err)
 	}
 
 	cfg := DefaultConfig()
@@ -44,16 +87,82 @@ func main() {
 		log.Fatalf("config defaults: %v", err)
 	}
 
-	filePath := flag.String("file", defaults.File, "path to Nginx access log")
+	var filePaths []string
+	flag.Func("file", "path or glob of Nginx access logs, - for stdin (can repeat to analyze several logs together, default "+defaults.File+")", func(val string) error {
+		filePaths = append(filePaths, val)
+		return nil
+	})
+	var remoteSpecs []string
+	flag.Func("remote", "read the access log over ssh from [user@]host:/path instead of --file (can repeat; entries are attributed to the host)", func(val string) error {
+		remoteSpecs = append(remoteSpecs, val)
+		return nil
+	})
+	var syslogListen, syslogAllow []string
+	flag.Func("syslog-listen", "with --follow, receive access lines as syslog on udp://host:port or tcp://host:port instead of reading --file (can repeat)", func(val string) error {
+		syslogListen = append(syslogListen, val)
+		return nil
+	})
+	flag.Func("syslog-allow", "IP or CIDR allowed to send to --syslog-listen (can repeat; required unless --syslog-listen binds a loopback address)", func(val string) error {
+		syslogAllow = append(syslogAllow, val)
+		return nil
+	})
+	journalUnit := flag.String("journal-unit", defaults.JournalUnit, "read the access log from the systemd journal of this unit, e.g. nginx.service, instead of --file")
 	topN := flag.Int("top", defaults.Top, "maximum suspicious IPs to print")
+	timeFormat := flag.String("time-format", defaults.TimeFormat, "First/Last column format: kitchen, rfc3339, datetime, stamp or a Go layout (default kitchen)")
+	timezone := flag.String("timezone", defaults.Timezone, "IANA timezone, Local or UTC for displayed times (default: the log's own offset)")
+	formatFlag := flag.String("format", defaults.Format, "access log format: auto, nginx, apache, caddy, traefik, envoy, alb, cloudfront, iis, json or varnish (default auto, which detects it from the first lines and falls back to nginx)")
+	logFormatFlag := flag.String("log-format", defaults.LogFormat, "nginx log_format template the access log was written with (default combined)")
+	logTimeLayout := flag.String("log-time-layout", defaults.LogTimes.Layout, "layout of $time_local in nginx and apache logs: clf, iso8601 or a Go layout (default clf)")
+	utcTimes := flag.Bool("utc", defaults.LogTimes.UTC, "convert log timestamps to UTC for analysis and reporting")
 	colorize := flag.Bool("color", defaults.Color, "enable ANSI color output")
-	geoDB := flag.String("geoip-db", defaults.GeoIPDB, "path to MaxMind GeoIP2/GeoLite2 Country database")
+	geoDB := flag.String("geoip-db", defaults.GeoIPDB, "path to the country database read by --geo-provider")
+	geoProvider := flag.String("geo-provider", defaults.GeoProvider, "kind of --geoip-db: maxmind (GeoIP2/GeoLite2 Country MMDB), ip2location (BIN) or csv (IP ranges)")
+	geoMaxAge := flag.Duration("geoip-max-age", defaults.GeoIPMaxAge, "warn when the --geoip-db build is older than this (0 disables)")
+	geoLocale := flag.String("geoip-locale", defaults.GeoIPLocale, "language of country names from --geoip-db, such as de, fr or pt-BR")
 	denyOutput := flag.String("deny-output", defaults.DenyOutput, "path to write Nginx deny config (optional)")
 	denyExpiry := flag.Duration("deny-expiry", defaults.DenyExpiry, "lifetime for deny entries used in expiration comments (e.g. 168h)")
 	nginxReload := flag.Bool("nginx-reload", defaults.NginxReload, "after writing deny file run 'nginx -t' then 'nginx -s reload'")
 	nginxBin := flag.String("nginx-bin", defaults.NginxBin, "path to nginx binary")
+	denyTemplate := flag.String("deny-comment-template", defaults.DenyCommentTemplate, "Go template for deny entry comments (fields: .IP .RunID .Expiry .Score .Severity .Reasons .Country .CountryName .Requests .Errors .ErrorPercent)")
+	denyMinimal := flag.Bool("deny-minimal", defaults.DenyMinimal, "write bare deny directives without header or comments")
+	denyIPv6Prefix := flag.Int("deny-ipv6-prefix", defaults.DenyIPv6Prefix, "deny the covering IPv6 prefix of this length, such as 64, instead of the single address (default 0: off)")
+	denyFormat := flag.String("deny-format", defaults.DenyFormat, "deny output syntax: "+strings.Join(denyFormatNames(), ", ")+" (default nginx)")
+	haproxySocket := flag.String("haproxy-socket", defaults.HAProxySocket, "HAProxy Runtime API socket (unix path or host:port) to push suspects into a stick table (optional)")
+	asnDB := flag.String("asn-db", defaults.ASNDB, "path to a MaxMind GeoLite2 ASN database; enables the per-ASN report")
+	asnPrefixes := flag.String("asn-prefixes", defaults.ASNPrefixes, "file of \"ASN CIDR\" lines listing announced prefixes, used by --asn-block")
+	asnMinIPs := flag.Int("asn-min-ips", defaults.ASNMinIPs, "report ASNs with at least this many suspect IPs")
+	slowEndpointsN := flag.Int("slow-endpoints", defaults.SlowEndpoints, "list this many endpoints where suspects consumed the most request time (0 disables)")
+	asnBlock := flag.Bool("asn-block", defaults.ASNBlock, "add the announced prefixes of reported ASNs to the deny file")
+	haproxyTable := flag.String("haproxy-table", defaults.HAProxyTable, "stick table receiving suspects via --haproxy-socket; entries get gpc0=1")
+	canary := flag.Duration("canary", defaults.Canary, "keep new suspects log-only in --canary-output for this long before denying them (e.g. 6h; requires --state-db outside follow mode)")
+	annotationsPath := flag.String("annotations", defaults.Annotations, "file of \"IP-or-CIDR label\" lines naming known clients, shown with matching suspects (optional)")
+	canaryOutput := flag.String("canary-output", defaults.CanaryOutput, "path to write the nginx geo map marking suspects still in the canary period")
 	blockLog := flag.String("block-log", defaults.BlockLog, "path to append block report log (optional)")
 	configFlag := flag.String("config", configPath, "path to YAML config file")
+	flag.String("profile-name", profileName, "named profile from the config's profiles section, with its own thresholds, outputs and state")
+	peerSecret := flag.String("peer-secret", defaults.PeerSecret, "shared secret for exchanging suspect lists with peers")
+	peerExport := flag.String("peer-export", defaults.PeerExport, "path to write this run's suspects for 'botdeny peer serve' (optional)")
+	captureUnparsed := flag.String("capture-unparsed", defaults.CaptureUnparsed, "append lines the parser rejects to this file (optional)")
+	captureLimit := flag.Int("capture-unparsed-limit", defaults.CaptureUnparsedLimit, "append at most this many rejected lines per run to --capture-unparsed (0 = all)")
+	deadLetterPath := flag.String("dead-letter", defaults.DeadLetter, "append entries excluded by allow rules to this file with the rule that matched, for auditing allowlists (optional)")
+	apiListen := flag.String("api-listen", defaults.API.Listen, "with --follow, serve the HTTP API for the tokens in the config's api section on this address, e.g. 127.0.0.1:8090")
+	workers := flag.Int("workers", defaults.Workers, "parse log lines on this many goroutines; entries keep their log order")
+	strictParsing := flag.Bool("strict-parsing", defaults.StrictParsing, "stop at the first line the parser rejects instead of skipping it, and report partial results")
+	suggestAllow := flag.Bool("suggest-allowlist", false, "list near-threshold IPs with steady, error-free or monitoring traffic as allowlist candidates")
+	stateDB := flag.String("state-db", defaults.StateDB, "path to the JSON state DB remembering bans between runs (optional)")
+	resume := flag.Bool("resume", defaults.Resume, "only analyze lines appended to each log since the last run, remembered in --state-db")
+	importBlockLog := flag.String("import-block-log", defaults.ImportBlockLog, "seed an empty --state-db with the bans recorded in this block log")
+	learnHours := flag.Bool("learn-hour-profile", defaults.LearnHourProfile, "learn hourly traffic in the state DB and lower rate and burst thresholds in usually quiet hours")
+	otlpEndpoint := flag.String("otlp-endpoint", defaults.OTLPEndpoint, "OTLP/HTTP collector base URL receiving run spans and metrics, e.g. http://localhost:4318 (optional)")
+	vhost := flag.String("vhost", defaults.Vhost, "name of the virtual host this log belongs to, matched by notify route vhosts")
+	follow := flag.Bool("follow", false, "keep reading the log like tail -f, re-analyzing a sliding window and updating the deny file as suspects appear")
+	followWindow := flag.Duration("follow-window", defaultLiveWindow, "sliding window of recent entries analyzed in follow mode")
+	followInterval := flag.Duration("follow-interval", defaultLiveInterval, "how often follow mode re-runs the analyzer")
+	since := flag.String("since", defaults.Since, "only analyze entries logged since this time: a duration before now such as 2h, or a time such as 2025-10-19T06:00 (optional)")
+	until := flag.String("until", defaults.Until, "only analyze entries logged before this time, in the same forms as --since (optional)")
+	sampleFlag := flag.String("sample", defaults.Sample, "analyze a deterministic fraction of entries such as 1/10, scaling count thresholds to match (optional)")
+	sampleBy := flag.String("sample-by", defaults.SampleBy, "unit --sample picks: request (a fraction of every IP's requests) or ip (every request of a fraction of the IPs)")
+	failOn := flag.String("fail-on", "", "exit with code 10+severity when a suspect reaches this severity (info, low, medium, high, critical)")
 
 	additionalWhitelist := make([]string, 0)
 	penalizedCountries := make([]string, 0)
@@ -62,6 +171,8 @@ func main() {
 	allowIPFiles := append([]string{}, defaults.AllowIPFiles...)
 	allowURIsFromFlags := make([]string, 0)
 	sensitiveURLLimitsFromFlags := make([]PathLimit, 0)
+	honeytokensFromFlags := make([]string, 0)
+	peers := append([]string{}, defaults.Peers...)
 	flag.IntVar(&cfg.MinRequests, "min-requests", cfg.MinRequests, "minimum requests before considering an IP")
 	flag.Float64Var(&cfg.MaxAverageRPM, "max-rpm", cfg.MaxAverageRPM, "flag if average requests per minute exceeds this value")
 	flag.IntVar(&cfg.MaxBurstRequests, "burst", cfg.MaxBurstRequests, "flag if number of requests within burst window exceeds this value")
@@ -72,13 +183,53 @@ func main() {
 	flag.IntVar(&cfg.MinPHP404s, "php404", cfg.MinPHP404s, "flag if number of 404 responses for .php URIs exceeds this value")
 	flag.IntVar(&cfg.MinSQLInjections, "sql-injections", cfg.MinSQLInjections, "flag if number of SQL injection attempts exceeds this value")
 	flag.IntVar(&cfg.ScoreThreshold, "score-threshold", cfg.ScoreThreshold, "minimum score before an IP is reported")
+	flag.DurationVar(&cfg.AccountTravelWindow, "account-travel-window", cfg.AccountTravelWindow, "window for detecting authenticated users seen from several countries")
+	flag.IntVar(&cfg.AccountMaxCountries, "account-max-countries", cfg.AccountMaxCountries, "flag authenticated users seen from more countries than this within the travel window (0 disables)")
+	flag.IntVar(&cfg.AccountMaxASNs, "account-max-asns", cfg.AccountMaxASNs, "flag authenticated users seen from more ASNs than this within the travel window; requires --asn-db (0 disables)")
+	flag.IntVar(&cfg.AccountMinRequests, "account-min-requests", cfg.AccountMinRequests, "minimum requests before per-account rate and error thresholds apply")
+	flag.Float64Var(&cfg.AccountMaxAverageRPM, "account-max-rpm", cfg.AccountMaxAverageRPM, "flag authenticated users whose average requests per minute exceeds this value (0 disables)")
+	flag.Float64Var(&cfg.AccountMinErrorRatio, "account-error-ratio", cfg.AccountMinErrorRatio, "flag authenticated users whose error ratio meets or exceeds this value (0 disables)")
+	flag.IntVar(&cfg.MinCacheBusters, "cache-busters", cfg.MinCacheBusters, "flag if distinct random query strings on static assets meets or exceeds this value (0 disables)")
+	flag.IntVar(&cfg.MinHeaderAnomalies, "header-anomalies", cfg.MinHeaderAnomalies, "flag IPs with this many requests whose Accept headers are empty or inconsistent with a browser UA, when the log format records them (0 disables)")
+	flag.IntVar(&cfg.MinHostHeaders, "host-headers", cfg.MinHostHeaders, "flag IPs sending this many distinct Host headers, as virtual-host scanners do, when the log format records $host (0 disables)")
+	flag.IntVar(&cfg.MinQueryVariants, "query-variants", cfg.MinQueryVariants, "flag IPs sending this many distinct query strings to a single path, as parameter fuzzers do (0 disables)")
+	flag.IntVar(&cfg.RawLines, "raw-lines", cfg.RawLines, "keep the first and last this many raw log lines of each IP and show them for suspects (0 disables)")
+	flag.IntVar(&cfg.MinLegacyTLS, "legacy-tls", cfg.MinLegacyTLS, "flag IPs with this many requests over SSLv3, TLSv1 or TLSv1.1, when the log format records $ssl_protocol (0 disables)")
+	flag.IntVar(&cfg.MinSingleCipher, "single-cipher", cfg.MinSingleCipher, "flag IPs with this many TLS requests that all negotiated one cipher and JA3 fingerprint, when the log format records $ssl_cipher and JA3 (0 disables)")
+	flag.IntVar(&cfg.MinCacheMisses, "cache-misses", cfg.MinCacheMisses, "flag IPs with this many requests served past the cache, when nearly all of their requests miss and the log format records the cache status (0 disables)")
+	flag.IntVar(&cfg.MinCookielessPages, "cookieless-pages", cfg.MinCookielessPages, "flag IPs requesting this many pages without ever sending a session cookie, when the log format records cookies (0 disables)")
+	flag.Float64Var(&cfg.MaxUpstreamSeconds, "max-upstream-seconds", cfg.MaxUpstreamSeconds, "score IPs by total $request_time consumed, one point per multiple of this many seconds (0 disables)")
+	flag.Float64Var(&cfg.CountrySpikeFactor, "country-spike-factor", cfg.CountrySpikeFactor, "flag countries sending this many times their learned baseline (needs --state-db and --geoip-db, 0 disables)")
+	flag.Func("ignore-window", "start/end period (e.g. 2025-11-28T00:00/2025-11-29T00:00) during which blocking is disabled or relaxed (can repeat)", func(val string) error {
+		window, err := parseTimeWindow(val)
+		if err != nil {
+			return err
+		}
+		cfg.IgnoreWindows = append(cfg.IgnoreWindows, window)
+		return nil
+	})
+	flag.Float64Var(&cfg.IgnoreWindowRelax, "ignore-window-relax", cfg.IgnoreWindowRelax, "inside ignore windows multiply count and rate thresholds by this factor instead of disabling blocking (0 disables blocking)")
+	flag.Func("hour-profile", "[days ]hours=factor multiplying rate and burst thresholds at those times, e.g. 0-6=0.3 or sat-sun 10-18=1.5 (can repeat)", func(val string) error {
+		profile, err := parseHourProfile(val)
+		if err != nil {
+			return err
+		}
+		cfg.HourProfiles = append(cfg.HourProfiles, profile)
+		return nil
+	})
+	flag.IntVar(&cfg.CountrySpikeMinRequests, "country-spike-min-requests", cfg.CountrySpikeMinRequests, "ignore country spikes with fewer requests than this")
+	flag.Float64Var(&cfg.NewIPSpikeFactor, "new-ip-spike-factor", cfg.NewIPSpikeFactor, "report a suspected distributed attack when never-seen IPs appear this many times faster than usual (0 disables)")
+	flag.IntVar(&cfg.NewIPSpikeMin, "new-ip-spike-min", cfg.NewIPSpikeMin, "ignore minutes in which fewer IPs than this appeared for the first time")
+	flag.Int64Var(&cfg.MinBytesServed, "min-bytes-served", cfg.MinBytesServed, "do not block IPs whose largest response is smaller than this many bytes (0 disables)")
 	flag.Float64Var(&cfg.MaxErrorPercent, "max-error-percent", cfg.MaxErrorPercent, "do not block if overall error percentage is below this threshold")
+	flag.BoolVar(&cfg.AllowMonitors, "allow-monitors", cfg.AllowMonitors, "skip requests with a monitor_agents user agent that come from monitor_cidrs")
 	flag.Func("allow-agent", "user agent substring to treat as trusted (can repeat)", func(val string) error {
 		if val != "" {
 			additionalWhitelist = append(additionalWhitelist, val)
 		}
 		return nil
 	})
+	flag.Float64Var(&cfg.WhitelistMinShare, "allow-agents-min-share", cfg.WhitelistMinShare, "exempt an IP only if at least this share of its requests carry a trusted user agent")
 	flag.Func("bot-country", "ISO country code to penalise as bot-heavy (can repeat)", func(val string) error {
 		if val != "" {
 			penalizedCountries = append(penalizedCountries, val)
@@ -109,6 +260,18 @@ func main() {
 		}
 		return nil
 	})
+	flag.Func("honeytoken", "URI substring that flags any requesting IP instantly (can repeat)", func(val string) error {
+		if val != "" {
+			honeytokensFromFlags = append(honeytokensFromFlags, val)
+		}
+		return nil
+	})
+	flag.Func("peer", "base URL of a peer botdeny instance whose suspects are greylisted (can repeat)", func(val string) error {
+		if val != "" {
+			peers = append(peers, val)
+		}
+		return nil
+	})
 	flag.Func("sensitive-url", "URI prefix and hit threshold to block, formatted as /path=COUNT (can repeat)", func(val string) error {
 		parts := strings.SplitN(val, "=", 2)
 		if len(parts) != 2 {
@@ -130,11 +293,57 @@ func main() {
 	})
 	flag.Parse()
 
+	if _, err := parseDenyCommentTemplate(*denyTemplate); err != nil {
+		log.Fatalf("deny-comment-template: %v", err)
+	}
+	timeDisplay, err := parseTimeDisplay(*timeFormat, *timezone)
+	if err != nil {
+		log.Fatalf("time display: %v", err)
+	}
+	logFormat, err := logFormatFor(*formatFlag, *logFormatFlag, LogTimes{Layout: *logTimeLayout, UTC: *utcTimes})
+	if err != nil {
+		log.Fatal(err)
+	}
+	windowStart, windowEnd, err := parseTimeBounds(*since, *until, time.Now(), timeDisplay.Location)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := denyFormatFor(*denyFormat); err != nil {
+		log.Fatalf("deny-format: %v", err)
+	}
+	if *resume && *stateDB == "" {
+		log.Fatal("--resume requires --state-db to remember how far each log was read")
+	}
+	if *importBlockLog != "" && *follow {
+		log.Fatal("--import-block-log applies to one-shot runs; follow mode does not use the state DB")
+	}
+	if *nginxReload && *denyFormat != "" && !strings.HasPrefix(strings.ToLower(*denyFormat), "nginx") {
+		log.Fatalf("--nginx-reload requires --deny-format nginx, nginx-challenge or nginx-canary")
+	}
+	if *canary < 0 {
+		log.Fatal("--canary must not be negative")
+	}
+	if *canary > 0 && (*denyOutput == "" || *canaryOutput == "") {
+		log.Fatal("--canary requires --deny-output and --canary-output")
+	}
+
+	failOnSeverity := SeverityCritical + 1
+	if *failOn != "" {
+		parsed, err := parseSeverity(*failOn)
+		if err != nil {
+			log.Fatalf("fail-on: %v", err)
+		}
+		failOnSeverity = parsed
+	}
+
 	if *configFlag != configPath && *configFlag != "" {
 		cfgFromFile, err := loadFileConfig(*configFlag)
 		if err != nil {
 			log.Fatalf("load config %s: %v", *configFlag, err)
 		}
+		if cfgFromFile, err = cfgFromFile.withProfile(profileName); err != nil {
+			log.Fatalf("load config %s: %v", *configFlag, err)
+		}
 		if err := applyConfigDefaults(&cfg, cfgFromFile); err != nil {
 			log.Fatalf("apply config defaults: %v", err)
 		}
@@ -158,15 +367,18 @@ func main() {
 	if len(allowURIsFromFlags) > 0 {
 		cfg.AllowedURIs = dedupeStrings(append(cfg.AllowedURIs, allowURIsFromFlags...))
 	}
+	if len(honeytokensFromFlags) > 0 {
+		cfg.Honeytokens = dedupeStrings(append(cfg.Honeytokens, honeytokensFromFlags...))
+	}
 	if len(sensitiveURLLimitsFromFlags) > 0 {
 		cfg.SensitiveURLLimits = append(cfg.SensitiveURLLimits, sensitiveURLLimitsFromFlags...)
 	}
 
+	problems := newProblems()
+	defer problems.Print(os.Stderr)
+
 	if len(allowIPFiles) > 0 {
-		ips, cidrs, err := loadAllowIPsFromFiles(allowIPFiles)
-		if err != nil {
-			log.Fatalf("load allow ip files: %v", err)
-		}
+		ips, cidrs := loadAllowIPsFromFiles(allowIPFiles, problems)
 		if len(ips) > 0 {
 			cfg.AllowedIPs = dedupeStrings(append(cfg.AllowedIPs, ips...))
 		}
@@ -174,46 +386,463 @@ func main() {
 			cfg.AllowedCIDRs = dedupeStrings(append(cfg.AllowedCIDRs, cidrs...))
 		}
 	}
+	var allowSources *allowRefresher
+	if len(defaults.AllowSources) > 0 {
+		if allowSources, err = newAllowRefresher(defaults.AllowSources, cfg.AllowedIPs, cfg.AllowedCIDRs, problems); err != nil {
+			log.Fatal(err)
+		}
+		allowSources.Refresh(context.Background(), time.Now())
+		allowSources.Apply(&cfg)
+	}
+	if defaults.ChallengePassed != "" {
+		cfg.ChallengePassedIPs = loadChallengePassed(defaults.ChallengePassed, problems)
+	}
+
+	if *annotationsPath != "" {
+		if cfg.Annotations, err = loadAnnotations(*annotationsPath); err != nil {
+			log.Fatalf("load annotations: %v", err)
+		}
+	}
+
+	// The state DB is loaded before scoring because it supplies country and hour baselines.
+	var db *StateDB
+	if *stateDB != "" {
+		if db, err = openStateDB(*stateDB); err != nil {
+			log.Fatalf("open state db: %v", err)
+		}
+		if *learnHours {
+			cfg.HourBaselines = db.HourFactors()
+		}
+		if *importBlockLog != "" {
+			importBans(db, *importBlockLog)
+		}
+	} else if *importBlockLog != "" {
+		log.Fatal("--import-block-log requires --state-db")
+	} else if *learnHours {
+		log.Fatal("--learn-hour-profile requires --state-db")
+	} else if *canary > 0 && !*follow {
+		log.Fatal("--canary requires --state-db to remember when suspects were first flagged")
+	}
+
+	var sampler *Sampler
+	if *sampleFlag != "" {
+		if sampler, err = parseSampleRate(*sampleFlag); err != nil {
+			log.Fatalf("sample: %v", err)
+		}
+		if err := checkSampleBy(*sampleBy); err != nil {
+			log.Fatalf("sample-by: %v", err)
+		}
+		sampler.By = *sampleBy
+		if sampler.By == SampleByIP {
+			log.Printf("sampling %d/%d of IPs; only their requests are analyzed and reported", sampler.Keep, sampler.Of)
+		} else {
+			log.Printf("sampling %d/%d of entries; thresholds scaled and reported counts cover the sample only", sampler.Keep, sampler.Of)
+		}
+	}
+
+	if len(peers) > 0 {
+		if *peerSecret == "" {
+			log.Fatal("peer exchange requires --peer-secret")
+		}
+		cfg.PeerReports = fetchPeerReports(dedupeStrings(peers), *peerSecret, 10*time.Second)
+		log.Printf("greylisted %d IPs reported by %d peer(s)", len(cfg.PeerReports), len(peers))
+	}
 
 	var (
 		geoLookup GeoLookup
 		geoCloser func() error
 	)
+	provider, err := geoProviderFor(*geoProvider)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// geoMarker flags reports made without, or with outdated, country data.
+	geoMarker := ""
 	if *geoDB != "" {
 		var err error
-		geoLookup, geoCloser, err = newGeoLookup(*geoDB)
+		geoLookup, geoCloser, err = newGeoLookup(*geoProvider, *geoDB, *geoLocale, problems)
 		if err != nil {
-			log.Fatalf("open geoip db: %v", err)
-		}
-		defer func() {
-			if err := geoCloser(); err != nil {
-				log.Printf("close geoip db: %v", err)
+			// A missing or broken database costs the country rules, not the run.
+			problems.Add(ProblemGeoDB, err.Error())
+			log.Printf("open geoip db: %v; continuing without country data", err)
+			geoMarker = "NO COUNTRY DATA: GeoIP database unavailable; country rules, country baselines and account travel checks were skipped"
+		} else {
+			defer func() {
+				if err := geoCloser(); err != nil {
+					log.Printf("close geoip db: %v", err)
+				}
+			}()
+			if info, err := provider.Info(*geoDB); err == nil {
+				if warning := info.staleWarning(time.Now(), *geoMaxAge); warning != "" {
+					problems.Add(ProblemGeoDB, warning)
+					log.Printf("stale geoip db: %s", warning)
+					geoMarker = fmt.Sprintf("STALE COUNTRY DATA: GeoIP database built %d days ago", info.ageDays(time.Now()))
+				}
 			}
-		}()
+		}
+	}
+	// hasCountries is false without the database even once ASN data joins the lookup.
+	hasCountries := geoLookup != nil
+	if db != nil && hasCountries {
+		cfg.CountryBaselines = db.CountryBaselines()
+	}
+	if sampler != nil {
+		// After loading baselines, which are scaled with the thresholds.
+		sampler.ScaleConfig(&cfg)
+	}
+	if *asnDB != "" {
+		asnLookup, asnCloser, err := newASNLookup(*asnDB, problems)
+		if err != nil {
+			log.Fatalf("open asn db: %v", err)
+		}
+		defer asnCloser()
+		geoLookup = mergeGeoLookups(geoLookup, asnLookup)
+	}
+	var prefixes map[uint][]string
+	if *asnBlock {
+		if *asnDB == "" || *asnPrefixes == "" {
+			log.Fatal("--asn-block requires --asn-db and --asn-prefixes")
+		}
+		if prefixes, err = loadASNPrefixes(*asnPrefixes); err != nil {
+			log.Fatalf("load asn prefixes: %v", err)
+		}
 	}
 
-	fh, err := os.Open(*filePath)
+	if len(remoteSpecs) == 0 {
+		remoteSpecs = defaults.Remotes
+	}
+	var remotes []remoteLog
+	for _, spec := range remoteSpecs {
+		remote, err := parseRemoteLog(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		remotes = append(remotes, remote)
+	}
+	if len(syslogListen) == 0 {
+		syslogListen = defaults.SyslogListen
+	}
+	if len(syslogAllow) == 0 {
+		syslogAllow = defaults.SyslogAllow
+	}
+	syslogSenders, err := parseSyslogAllow(syslogAllow)
 	if err != nil {
-		log.Fatalf("open log: %v", err)
+		log.Fatal(err)
+	}
+	if len(syslogListen) > 0 {
+		if len(filePaths) > 0 || *journalUnit != "" || len(remotes) > 0 {
+			log.Fatal("--syslog-listen, --file, --journal-unit and --remote are mutually exclusive")
+		}
+		if !*follow {
+			log.Fatal("--syslog-listen receives lines as they are sent and requires --follow")
+		}
+	} else if len(remotes) > 0 {
+		if len(filePaths) > 0 || *journalUnit != "" {
+			log.Fatal("--remote, --file and --journal-unit are mutually exclusive")
+		}
+	} else if *journalUnit != "" {
+		if len(filePaths) > 0 {
+			log.Fatal("--journal-unit and --file are mutually exclusive")
+		}
+	} else if len(filePaths) == 0 {
+		filePaths = []string{defaults.File}
+		// Without --file or a configured file, piped input is the log: zcat access.log.2.gz | botdeny
+		if fileCfg.File == "" && stdinIsPiped() {
+			filePaths = []string{stdinPath}
+		}
+	}
+	if filePaths, err = expandLogPaths(filePaths); err != nil {
+		log.Fatalf("file: %v", err)
+	}
+	if *resume && (*journalUnit != "" || len(remotes) > 0 || *follow || slices.Contains(filePaths, stdinPath)) {
+		log.Fatal("--resume applies to log files analyzed in one-shot runs, not to standard input, the journal, --remote or --follow")
+	}
+	apiCfg := defaults.API
+	apiCfg.Listen = *apiListen
+	if apiCfg.Listen != "" && !*follow {
+		log.Fatal("--api-listen serves the blocked set of a follow run and requires --follow")
+	}
+	if err := apiCfg.validate(); err != nil {
+		log.Fatal(err)
 	}
-	defer fh.Close()
 
-	analyzer := New(cfg, geoLookup)
-	entries, errs := Stream(fh)
+	run := newRunInfo()
+	telemetry := newTelemetry(*otlpEndpoint)
+	defer flushTelemetry(telemetry)
+
+	if *captureLimit < 0 {
+		log.Fatal("--capture-unparsed-limit must not be negative")
+	}
+	if *workers < 1 {
+		log.Fatal("--workers must be at least 1")
+	}
+	if err := checkIPv6Prefix(*denyIPv6Prefix); err != nil {
+		log.Fatalf("--deny-ipv6-prefix: %v", err)
+	}
+	streamOpts := StreamOptions{Format: logFormat, Since: windowStart, Until: windowEnd, Strict: *strictParsing, Workers: *workers}
+	var capture *UnparsedCapture
+	if *captureUnparsed != "" {
+		capture, err = openUnparsedCapture(*captureUnparsed)
+		if err != nil {
+			log.Fatalf("open capture file: %v", err)
+		}
+		capture.Limit = *captureLimit
+	}
+	var deadLetter *DeadLetter
+	if *deadLetterPath != "" {
+		if deadLetter, err = openDeadLetter(*deadLetterPath); err != nil {
+			log.Fatalf("open dead-letter file: %v", err)
+		}
+	}
+	unparsed := 0
+	streamOpts.OnUnparsed = func(line string, err error) {
+		unparsed++
+		problems.Add(ProblemUnparsed, unparsedDetail(line, err))
+		if capture != nil {
+			capture.Capture(line, err)
+		}
+	}
+	denyOpts := DenyOptions{
+		TTL:             *denyExpiry,
+		SeverityTTL:     defaults.SeverityExpiry,
+		CommentTemplate: *denyTemplate,
+		Minimal:         *denyMinimal,
+		Format:          *denyFormat,
+		IPv6Prefix:      *denyIPv6Prefix,
+		Run:             run,
+	}
 
-	for entry := range entries {
+	if *follow {
+		if !windowEnd.IsZero() {
+			log.Fatal("--until does not apply to --follow, which keeps reading new entries")
+		}
+		if *strictParsing {
+			log.Fatal("--strict-parsing does not apply to --follow, which skips rejected lines")
+		}
+		if *journalUnit == "" && len(remotes) == 0 && len(syslogListen) == 0 && (len(filePaths) > 1 || filePaths[0] == stdinPath) {
+			log.Fatal("--follow takes a single --file naming a regular file")
+		}
+		if capture != nil {
+			defer capture.Close()
+		}
+		if deadLetter != nil {
+			defer deadLetter.Close()
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		var api *followAPI
+		if apiCfg.Listen != "" {
+			api = newFollowAPI(apiCfg)
+			if err := serveFollowAPI(ctx, apiCfg, api); err != nil {
+				log.Fatal(err)
+			}
+		}
+		follower := newFollower(cfg, geoLookup, run, FollowOptions{
+			Window:          *followWindow,
+			Interval:        *followInterval,
+			Colorize:        *colorize,
+			DenyOutput:      *denyOutput,
+			Deny:            denyOpts,
+			Canary:          *canary,
+			CanaryOutput:    *canaryOutput,
+			NginxReload:     *nginxReload,
+			NginxBin:        *nginxBin,
+			BlockLog:        *blockLog,
+			Notify:          defaults.Notify,
+			Vhost:           *vhost,
+			Sampler:         sampler,
+			Telemetry:       telemetry,
+			Problems:        problems,
+			DeadLetter:      deadLetter,
+			AllowSources:    allowSources,
+			ChallengePassed: defaults.ChallengePassed,
+			API:             api,
+		})
+		if *journalUnit != "" {
+			if err := followJournal(ctx, *journalUnit, streamOpts, follower); err != nil {
+				problems.Print(os.Stderr)
+				log.Fatalf("follow journal of %s: %v", *journalUnit, err)
+			}
+			return
+		}
+		if len(syslogListen) > 0 {
+			if err := followSyslog(ctx, syslogListen, syslogSenders, streamOpts, follower); err != nil {
+				problems.Print(os.Stderr)
+				log.Fatalf("syslog listener: %v", err)
+			}
+			return
+		}
+		if len(remotes) > 0 {
+			if err := followRemoteLogs(ctx, remotes, streamOpts, follower); err != nil {
+				problems.Print(os.Stderr)
+				log.Fatalf("follow remote logs: %v", err)
+			}
+			return
+		}
+		if err := followLog(ctx, filePaths[0], streamOpts, follower); err != nil {
+			problems.Print(os.Stderr)
+			log.Fatalf("follow %s: %v", filePaths[0], err)
+		}
+		return
+	}
+
+	runSpan := telemetry.Start("botdeny.run", nil)
+	runSpan.SetAttr("botdeny.run_id", run.ID)
+	runSpan.SetAttr("botdeny.vhost", *vhost)
+	defer runSpan.End()
+
+	analyzer := New(cfg, geoLookup)
+	// Parsing and processing overlap, so both are covered by the ingest span.
+	ingestSpan := telemetry.Start("botdeny.ingest", runSpan)
+	parsed := 0
+	sampled := 0
+	ingest := func(entry Entry) {
+		parsed++
+		if sampler != nil && !sampler.Sampled(entry) {
+			return
+		}
+		if deadLetter != nil {
+			deadLetter.Record(analyzer, entry)
+		}
 		analyzer.Process(entry)
+		sampled++
+	}
+	resumer := &logResumer{}
+	switch {
+	case *journalUnit != "":
+		err = streamJournal(*journalUnit, streamOpts, ingest)
+	case len(remotes) > 0:
+		err = streamRemoteLogs(remotes, streamOpts, ingest)
+	case *resume:
+		resumer.previous = db.Checkpoints
+		err = streamLogFilesWith(filePaths, streamOpts, resumer.open, ingest)
+	default:
+		err = streamLogFiles(filePaths, streamOpts, ingest)
+	}
+	// A parse error stops ingestion, but the entries read so far are still
+	// reported, marked as partial, instead of discarding the work.
+	parseErr := err
+	if parseErr != nil {
+		log.Printf("parse log: %v", parseErr)
+		ingestSpan.SetAttr("botdeny.partial", true)
+	}
+	ingestSpan.SetAttr("botdeny.files", len(filePaths))
+	if sampler != nil {
+		ingestSpan.SetAttr("botdeny.sampled_entries", sampled)
+		log.Printf("sampled %d of %d entries", sampled, parsed)
+	}
+	ingestSpan.SetAttr("botdeny.entries", parsed)
+	ingestSpan.End()
+	telemetry.Count("botdeny.entries", "{entry}", int64(parsed))
+	if capture != nil {
+		if err := capture.Close(); err != nil {
+			log.Printf("write capture file: %v", err)
+		}
+	}
+	if unparsed > 0 {
+		if capture != nil {
+			log.Printf("skipped %d unparsed lines, %d appended to %s", unparsed, capture.Lines, *captureUnparsed)
+		} else {
+			log.Printf("skipped %d unparsed lines", unparsed)
+		}
+	}
+	telemetry.Count("botdeny.unparsed_lines", "{line}", int64(unparsed))
+	if deadLetter != nil {
+		if err := deadLetter.Close(); err != nil {
+			log.Printf("write dead-letter file: %v", err)
+		}
+		if deadLetter.Entries > 0 {
+			log.Printf("%d entries excluded by allow rules, appended to %s", deadLetter.Entries, *deadLetterPath)
+		}
 	}
 
-	if err := <-errs; err != nil {
-		log.Fatalf("parse log: %v", err)
+	run.observeWindow(analyzer.Stats())
+	// denyOpts was set up before the log was read; give it the observed window.
+	denyOpts.Run = run
+	log.Printf("run %s analyzed window %s", run.ID, run.Window())
+	if parseErr != nil {
+		printPartialMarker(*colorize, parsed, parseErr)
 	}
+	if geoMarker != "" {
+		printGeoMarker(*colorize, geoMarker)
+	}
+	printClassSummary(*colorize, analyzer.ClassTotals())
 
+	scoreSpan := telemetry.Start("botdeny.score", runSpan)
+	throttles := analyzer.ThrottledCrawlers()
+	anomalies := analyzer.AccountAnomalies()
 	suspects := analyzer.Suspicious()
+	scoreSpan.SetAttr("botdeny.ips", len(analyzer.Stats()))
+	scoreSpan.SetAttr("botdeny.suspects", len(suspects))
+	scoreSpan.End()
+	recordSuspectMetrics(telemetry, len(analyzer.Stats()), suspects)
 	if len(suspects) == 0 {
 		fmt.Println("no suspicious IPs detected with current thresholds")
-		return
+	} else {
+		displaySuspects := suspects
+		if *topN > 0 && len(displaySuspects) > *topN {
+			displaySuspects = displaySuspects[:*topN]
+		}
+		printSuspects(*colorize, timeDisplay.ForWindow(run.WindowEnd.Sub(run.WindowStart)), displaySuspects)
+	}
+	printCrawlerThrottles(*colorize, throttles)
+	printAccountAnomalies(*colorize, anomalies)
+	printCountrySpikes(*colorize, analyzer.CountrySpikes())
+	newIPSpikes := analyzer.NewIPSpikes()
+	printNewIPSpikes(*colorize, newIPSpikes)
+	printSlowEndpoints(*colorize, slowEndpoints(suspects, analyzer.Stats(), *slowEndpointsN))
+	var asnGroups []ASNGroup
+	if *asnDB != "" {
+		asnGroups = groupSuspectsByASN(suspects, *asnMinIPs, prefixes)
+		printASNGroups(*colorize, asnGroups)
+	}
+	if *suggestAllow {
+		printAllowlistSuggestions(*colorize, analyzer.AllowlistSuggestions())
+	}
+
+	if parseErr != nil {
+		// Outputs act on the whole log, so a partial analysis writes none of them.
+		printPartialMarker(*colorize, parsed, parseErr)
+		log.Print("partial results: skipped state db, peer export, incidents, block log, notifications, haproxy push and deny file")
+		problems.Print(os.Stderr)
+		runSpan.End()
+		flushTelemetry(telemetry)
+		os.Exit(1)
 	}
+
+	outputSpan := telemetry.Start("botdeny.output", runSpan)
+	defer outputSpan.End()
+
+	// staged lists the suspects still in their canary period.
+	var staged map[string]bool
+	if db != nil {
+		printRotationFindings(*colorize, analyzer.RotationFindings(db.Bans))
+		db.Record(run, suspects)
+		// Sampled runs see a fraction of the traffic and would drag baselines down.
+		if hasCountries && sampler == nil {
+			db.RecordCountryRates(analyzer.CountryRates())
+		}
+		if *learnHours && sampler == nil {
+			db.RecordHourRates(analyzer.HourRates())
+		}
+		if *canary > 0 {
+			staged = db.StageCanary(suspects, *canary, time.Now())
+		}
+		if *resume {
+			db.Checkpoints = resumer.next
+		}
+		db.Prune(defaults.StateRetention)
+		if err := db.Save(); err != nil {
+			log.Printf("save state db: %v", err)
+		}
+	}
+
+	if *peerExport != "" {
+		if err := writePeerList(*peerExport, run, suspects); err != nil {
+			log.Printf("write peer list: %v", err)
+		}
+	}
+
 	totalRequests := 0
 	totalErrors := 0
 	for _, stat := range analyzer.Stats() {
@@ -224,20 +853,132 @@ func main() {
 			}
 		}
 	}
+
+	if defaults.Incidents.enabled() {
+		manageIncidents(defaults.Incidents, run, *vhost, newAttackWave(suspects, totalRequests))
+	}
+	if len(newIPSpikes) > 0 && len(defaults.Notify.Alerts) > 0 {
+		sendNewIPAlert(defaults.Notify, run, *vhost, newIPSpikes, problems)
+	}
+
+	if len(suspects) == 0 {
+		return
+	}
 	errorPercent := 0.0
 	if totalRequests > 0 {
 		errorPercent = (float64(totalErrors) / float64(totalRequests)) * 100
 	}
 
-	displaySuspects := suspects
-	if *topN > 0 && len(displaySuspects) > *topN {
-		displaySuspects = displaySuspects[:*topN]
+	if *blockLog != "" {
+		if err := appendBlockLog(*blockLog, run, suspects); err != nil {
+			log.Printf("write block log: %v", err)
+		}
+	}
+
+	if defaults.Notify.enabled() {
+		sendNotifications(defaults.Notify, run, *vhost, suspects, problems)
+	}
+
+	skipDeny := errorPercent > cfg.MaxErrorPercent
+	if *haproxySocket != "" && !skipDeny {
+		pushed, err := pushHAProxyTable(*haproxySocket, *haproxyTable, suspects)
+		if err != nil {
+			log.Printf("push haproxy stick table (%d entries pushed): %v", pushed, err)
+		} else {
+			log.Printf("pushed %d entries to haproxy table %s", pushed, *haproxyTable)
+		}
+	}
+
+	if *denyOutput != "" {
+		if skipDeny {
+			log.Printf("skip deny config: error rate %.2f%% exceeds max %.2f%%", errorPercent, cfg.MaxErrorPercent)
+		} else {
+			denied := suspects
+			if *asnBlock {
+				denied = append(append([]Suspicion{}, suspects...), asnDenyEntries(asnGroups)...)
+			}
+			var canaried []Suspicion
+			if *canary > 0 {
+				denied, canaried = splitCanary(denied, staged)
+			}
+			outputs := denyOutputs(*denyOutput, denied, cfg.VhostScopes)
+			paths := denyOutputPaths(*denyOutput, outputs)
+			var backup *denyBackup
+			if *nginxReload {
+				written := paths
+				if *canary > 0 {
+					written = append([]string{*canaryOutput}, paths...)
+				}
+				if backup, err = backupDenyFiles(written); err != nil {
+					log.Fatalf("write deny config: %v", err)
+				}
+			}
+			if *canary > 0 {
+				if err := writeCanaryFile(*canaryOutput, canaried, denyOpts); err != nil {
+					log.Fatalf("write canary config: %v", err)
+				}
+				log.Printf("wrote canary config to %s (%d log-only entries)", *canaryOutput, len(canaried))
+			}
+			for _, path := range paths {
+				if err := writeDenyFile(path, outputs[path], denyOpts); err != nil {
+					log.Fatalf("write deny config: %v", err)
+				}
+				log.Printf("wrote deny config to %s (%d entries, error rate %.2f%%)", path, len(outputs[path]), errorPercent)
+			}
+			outputSpan.SetAttr("botdeny.deny_entries", len(denied))
+
+			if *nginxReload {
+				err := reloadNginx(runNginxReload, *nginxBin, backup)
+				switch {
+				case errors.Is(err, errNginxConfigTest):
+					log.Printf("nginx reload: %v", err)
+					problems.Add(ProblemReload, err.Error())
+					sendReloadAlert(defaults.Notify, run, *vhost, err, problems)
+				case err != nil:
+					log.Fatalf("nginx reload: %v", err)
+				default:
+					log.Print("nginx reloaded successfully")
+				}
+			}
+		}
+	}
+
+	if code := severityExitCode(suspects, failOnSeverity); code != 0 {
+		problems.Print(os.Stderr)
+		outputSpan.End()
+		runSpan.End()
+		flushTelemetry(telemetry)
+		os.Exit(code)
 	}
+}
 
-	header := fmt.Sprintf("%-16s %-8s %-6s %-12s %-12s %-8s %-8s %s", "IP", "Country", "Score", "Requests", "Errors", "First", "Last", "Reasons")
-	fmt.Println(maybeColor(*colorize, ansiBold, header))
-	fmt.Println(maybeColor(*colorize, ansiDim, strings.Repeat("-", len(header))))
-	for _, suspect := range displaySuspects {
+// parseInterspersed parses flags that may appear before or after positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// printPartialMarker flags a report that covers only the entries read before a parse error.
+func printPartialMarker(colorize bool, entries int, err error) {
+	fmt.Println(maybeColor(colorize, ansiRed, fmt.Sprintf("PARTIAL RESULTS: parsing stopped after %d entries (%v)", entries, err)))
+}
+
+func printSuspects(colorize bool, display TimeDisplay, suspects []Suspicion) {
+	width := display.Width()
+	header := fmt.Sprintf("%-16s %-8s %-6s %-9s %-12s %-12s %-*s %-*s %-7s %s", "IP", "Country", "Score", "Severity", "Requests", "Errors", width, "First", width, "Last", "Active", "Reasons")
+	fmt.Println(maybeColor(colorize, ansiBold, header))
+	fmt.Println(maybeColor(colorize, ansiDim, strings.Repeat("-", len(header))))
+	for _, suspect := range suspects {
 		errors := 0
 		for status, count := range suspect.Stats.StatusCounts {
 			if status >= 400 {
@@ -252,19 +993,62 @@ func main() {
 			country = suspect.Stats.CountryName
 		}
 
-		line := fmt.Sprintf("%-16s %-8s %-6d %-12d %-12d %-8s %-8s %s",
+		line := fmt.Sprintf("%-16s %-8s %-6d %-9s %-12d %-12d %-*s %-*s %-7s %s",
 			suspect.IP,
 			country,
 			suspect.Score,
+			suspect.Severity,
 			suspect.Stats.Requests,
 			errors,
-			suspect.Stats.FirstSeen.Format(time.Kitchen),
-			suspect.Stats.LastSeen.Format(time.Kitchen),
+			width, display.Format(suspect.Stats.FirstSeen),
+			width, display.Format(suspect.Stats.LastSeen),
+			formatActive(suspect.Stats.LastSeen.Sub(suspect.Stats.FirstSeen)),
 			strings.Join(suspect.Reasons, "; "))
-		fmt.Println(maybeColor(*colorize, colorForScore(suspect.Score), line))
+		fmt.Println(maybeColor(colorize, colorForSeverity(suspect.Severity), line))
+		if suspect.Stats.Annotation != "" {
+			fmt.Printf("    note: %s\n", suspect.Stats.Annotation)
+		}
 
 		uaLine := fmt.Sprintf("    user-agents: %s", topUserAgents(suspect.Stats))
-		fmt.Println(maybeColor(*colorize, ansiDim, uaLine))
+		fmt.Println(maybeColor(colorize, ansiDim, uaLine))
+		if len(suspect.Stats.Sources) > 0 {
+			sources := make([]string, 0, len(suspect.Stats.Sources))
+			for _, name := range sourceNames(suspect.Stats) {
+				sources = append(sources, fmt.Sprintf("%s (%d)", name, suspect.Stats.Sources[name]))
+			}
+			sourceLine := fmt.Sprintf("    sources: %s", strings.Join(sources, "; "))
+			fmt.Println(maybeColor(colorize, ansiDim, sourceLine))
+		}
+		if suspect.Stats.Vhost != "" {
+			fmt.Println(maybeColor(colorize, ansiDim, "    vhost scope: "+suspect.Stats.Vhost))
+		}
+		if len(suspect.Stats.Backends) > 0 {
+			backends := make([]string, 0, len(suspect.Stats.Backends))
+			for _, name := range backendNames(suspect.Stats) {
+				backends = append(backends, fmt.Sprintf("%s (%d)", name, suspect.Stats.Backends[name]))
+			}
+			backendLine := fmt.Sprintf("    backends: %s", strings.Join(backends, "; "))
+			fmt.Println(maybeColor(colorize, ansiDim, backendLine))
+		}
+		if len(suspect.Stats.ResponseFlags) > 0 {
+			flags := make([]string, 0, len(suspect.Stats.ResponseFlags))
+			for _, name := range namesByCount(suspect.Stats.ResponseFlags) {
+				flags = append(flags, fmt.Sprintf("%s (%d)", name, suspect.Stats.ResponseFlags[name]))
+			}
+			flagLine := fmt.Sprintf("    response flags: %s", strings.Join(flags, "; "))
+			fmt.Println(maybeColor(colorize, ansiDim, flagLine))
+		}
+		if len(suspect.Stats.HostHeaders) > 1 {
+			fmt.Println(maybeColor(colorize, ansiDim, "    host headers: "+formatHostHeaders(suspect.Stats)))
+		}
+		if len(suspect.Stats.Hosts) > 0 {
+			hosts := make([]string, 0, len(suspect.Stats.Hosts))
+			for _, name := range hostNames(suspect.Stats) {
+				hosts = append(hosts, fmt.Sprintf("%s (%d)", name, suspect.Stats.Hosts[name]))
+			}
+			hostLine := fmt.Sprintf("    hosts: %s", strings.Join(hosts, "; "))
+			fmt.Println(maybeColor(colorize, ansiDim, hostLine))
+		}
 		if suspect.Stats.CountryISO != "" || suspect.Stats.CountryName != "" {
 			iso := suspect.Stats.CountryISO
 			if iso == "" {
@@ -275,37 +1059,182 @@ func main() {
 				name = "-"
 			}
 			geoLine := fmt.Sprintf("    geo: %s (%s)", iso, name)
-			fmt.Println(maybeColor(*colorize, ansiDim, geoLine))
+			fmt.Println(maybeColor(colorize, ansiDim, geoLine))
 		}
 		if paths := TopPaths(suspect.Stats, 5); len(paths) > 0 {
 			pathLine := fmt.Sprintf("    paths: %s", strings.Join(paths, "; "))
-			fmt.Println(maybeColor(*colorize, ansiDim, pathLine))
+			fmt.Println(maybeColor(colorize, ansiDim, pathLine))
 		}
+		printRawLines(colorize, suspect.Stats)
 	}
+}
 
-	if *blockLog != "" {
-		if err := appendBlockLog(*blockLog, suspects); err != nil {
-			log.Printf("write block log: %v", err)
+// printRawLines shows the raw log lines sampled for an IP with --raw-lines.
+func printRawLines(colorize bool, stat *IPStats) {
+	first, last := stat.FirstLines(), stat.LastLines()
+	if len(first) == 0 {
+		return
+	}
+	fmt.Println(maybeColor(colorize, ansiDim, "    lines:"))
+	for _, line := range first {
+		fmt.Println(maybeColor(colorize, ansiDim, "      "+line))
+	}
+	if skipped := stat.SkippedLines(); skipped > 0 {
+		fmt.Println(maybeColor(colorize, ansiDim, fmt.Sprintf("      ... %d more ...", skipped)))
+	}
+	for _, line := range last {
+		fmt.Println(maybeColor(colorize, ansiDim, "      "+line))
+	}
+}
+
+func printClassSummary(colorize bool, totals map[UAClass]int) {
+	total := 0
+	for _, count := range totals {
+		total += count
+	}
+	if total == 0 {
+		return
+	}
+
+	parts := make([]string, 0, len(uaClasses))
+	for _, class := range uaClasses {
+		count := totals[class]
+		parts = append(parts, fmt.Sprintf("%s=%d (%.1f%%)", class, count, float64(count)/float64(total)*100))
+	}
+	fmt.Println(maybeColor(colorize, ansiDim, fmt.Sprintf("traffic by user-agent class: %s", strings.Join(parts, ", "))))
+}
+
+func printCrawlerThrottles(colorize bool, throttles []CrawlerThrottle) {
+	if len(throttles) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Whitelisted crawlers exceeding thresholds"))
+	for _, throttle := range throttles {
+		line := fmt.Sprintf("%-20s %d requests from %d IPs; %s",
+			throttle.Agent,
+			throttle.Stats.Requests,
+			len(throttle.Stats.IPs),
+			strings.Join(throttle.Reasons, "; "))
+		fmt.Println(maybeColor(colorize, ansiYellow, line))
+		suggestion := fmt.Sprintf("    suggest: robots.txt \"Crawl-delay: %d\" or nginx limit_req rate=%s for this agent", throttle.CrawlDelay, throttle.RateLimit)
+		fmt.Println(maybeColor(colorize, ansiDim, suggestion))
+	}
+}
+
+func printAccountAnomalies(colorize bool, anomalies []AccountAnomaly) {
+	if len(anomalies) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Account anomalies"))
+	for _, anomaly := range anomalies {
+		line := fmt.Sprintf("%-20s %d requests (%d errors) from %d IPs; %s",
+			anomaly.User,
+			anomaly.Stats.Requests,
+			anomaly.Stats.Errors,
+			len(anomaly.Stats.IPs),
+			strings.Join(anomaly.Reasons, "; "))
+		fmt.Println(maybeColor(colorize, ansiRed, line))
+	}
+}
+
+func printAllowlistSuggestions(colorize bool, suggestions []AllowSuggestion) {
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Allowlist suggestions (review before adding to the config)"))
+	if len(suggestions) == 0 {
+		fmt.Println(maybeColor(colorize, ansiDim, "# no near-threshold IPs with consistently benign behavior"))
+		return
+	}
+
+	fmt.Println("allow_ips:")
+	agents := make([]string, 0)
+	for _, suggestion := range suggestions {
+		line := fmt.Sprintf("  - %-39s # %d requests, score %d; %s",
+			suggestion.IP,
+			suggestion.Requests,
+			suggestion.Score,
+			strings.Join(suggestion.Reasons, ", "))
+		fmt.Println(maybeColor(colorize, ansiGreen, line))
+		if suggestion.Agent != "" {
+			agents = append(agents, suggestion.Agent)
+		}
+	}
+	if agents = dedupeStrings(agents); len(agents) > 0 {
+		fmt.Println("allow_agents:")
+		for _, agent := range agents {
+			fmt.Println(maybeColor(colorize, ansiGreen, fmt.Sprintf("  - %q", agent)))
 		}
 	}
+}
 
-	if *denyOutput != "" {
-		skipDeny := errorPercent > cfg.MaxErrorPercent
-		if skipDeny {
-			log.Printf("skip deny config: error rate %.2f%% exceeds max %.2f%%", errorPercent, cfg.MaxErrorPercent)
-		} else {
-			if err := writeDenyFile(*denyOutput, suspects, *denyExpiry); err != nil {
-				log.Fatalf("write deny config: %v", err)
-			}
-			log.Printf("wrote deny config to %s (%d entries, error rate %.2f%%)", *denyOutput, len(suspects), errorPercent)
+func printASNGroups(colorize bool, groups []ASNGroup) {
+	if len(groups) == 0 {
+		return
+	}
 
-			if *nginxReload {
-				if err := runNginxReload(*nginxBin); err != nil {
-					log.Fatalf("nginx reload: %v", err)
-				}
-				log.Print("nginx reloaded successfully")
-			}
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Networks with many suspects (by ASN)"))
+	for _, group := range groups {
+		line := fmt.Sprintf("AS%-10d %-30s %4d IPs %8d requests, max severity %s", group.ASN, group.Org, len(group.IPs), group.Requests, group.Severity)
+		if len(group.Prefixes) > 0 {
+			line += fmt.Sprintf(", %d prefixes", len(group.Prefixes))
+		}
+		fmt.Println(maybeColor(colorize, ansiRed, line))
+	}
+}
+
+func printCountrySpikes(colorize bool, spikes []CountrySpike) {
+	if len(spikes) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Country spikes (traffic far above the learned baseline)"))
+	for _, spike := range spikes {
+		line := fmt.Sprintf("%-8s %8.0f req/h vs baseline %.1f; %d requests from %d IPs", spike.Country, spike.Rate, spike.Baseline, spike.Requests, spike.IPs)
+		fmt.Println(maybeColor(colorize, ansiRed, line))
+	}
+}
+
+func printNewIPSpikes(colorize bool, spikes []NewIPSpike) {
+	if len(spikes) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Distributed attack suspected (new IPs far above the usual rate)"))
+	for _, spike := range spikes {
+		line := fmt.Sprintf("%s  %6d new IPs vs baseline %.1f/min", spike.Minute.UTC().Format("2006-01-02 15:04"), spike.NewIPs, spike.Baseline)
+		fmt.Println(maybeColor(colorize, ansiRed, line))
+	}
+}
+
+func printRotationFindings(colorize bool, findings []RotationFinding) {
+	if len(findings) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Same actor, new IP (fingerprint matches a prior ban)"))
+	for _, finding := range findings {
+		status := "below thresholds"
+		color := ansiYellow
+		if finding.Flagged {
+			status = "flagged"
+			color = ansiRed
 		}
+		line := fmt.Sprintf("%-40s %s; matches %s banned %s (run %s, score %d), %.0f%% path overlap",
+			finding.IP,
+			status,
+			finding.Prior.IP,
+			finding.Prior.BannedAt.UTC().Format(time.RFC3339),
+			finding.Prior.RunID,
+			finding.Prior.Score,
+			finding.Overlap*100)
+		fmt.Println(maybeColor(colorize, color, line))
 	}
 }
 
@@ -344,13 +1273,13 @@ func maybeColor(enabled bool, code, text string) string {
 	return code + text + ansiReset
 }
 
-func colorForScore(score int) string {
+func colorForSeverity(severity Severity) string {
 	switch {
-	case score >= 4:
+	case severity >= SeverityHigh:
 		return ansiRed
-	case score >= 3:
+	case severity >= SeverityMedium:
 		return ansiYellow
-	case score >= 2:
+	case severity >= SeverityLow:
 		return ansiGreen
 	default:
 		return ""
@@ -362,61 +1291,182 @@ func isValidIP(ipStr string) bool {
 	return parsed != nil
 }
 
-func writeDenyFile(path string, suspects []Suspicion, ttl time.Duration) error {
+func isValidCIDR(cidr string) bool {
+	_, _, err := net.ParseCIDR(cidr)
+	return err == nil
+}
+
+// DenyOptions controls how deny entries are rendered.
+type DenyOptions struct {
+	// TTL is the default lifetime used for expiration comments.
+	TTL time.Duration
+	// SeverityTTL overrides TTL for specific severities.
+	SeverityTTL map[Severity]time.Duration
+	// CommentTemplate is a text/template rendering the trailing comment of each entry.
+	CommentTemplate string
+	// Minimal omits the header and all comments.
+	Minimal bool
+	// Format selects the output syntax: nginx (default), pf, netsh, powershell, lua, varnish, haproxy, caddy, aws-waf, nginx-challenge or nginx-canary.
+	Format string
+	// Run identifies the run recorded in the header and available to templates.
+	Run RunInfo
+	// IPv6Prefix, when set, denies the covering prefix of IPv6 suspects,
+	// such as their /64, instead of the single address.
+	IPv6Prefix int
+}
+
+// defaultDenyCommentTemplate renders the historical deny comment format.
+const defaultDenyCommentTemplate = `expires {{.Expiry}}; errors={{.Errors}} ({{printf "%.1f" .ErrorPercent}}%); country={{.Country}} ({{.CountryName}}){{if .Reasons}}; {{.Reasons}}{{end}}`
+
+// DenyCommentData is the data available to deny comment templates.
+type DenyCommentData struct {
+	IP           string
+	RunID        string
+	Expiry       string
+	ExpiresAt    time.Time
+	Score        int
+	Severity     string
+	Reasons      string
+	Country      string
+	CountryName  string
+	Requests     int
+	Errors       int
+	ErrorPercent float64
+}
+
+func parseDenyCommentTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultDenyCommentTemplate
+	}
+	return template.New("deny_comment").Parse(text)
+}
+
+func writeDenyFile(path string, suspects []Suspicion, opts DenyOptions) error {
+	format, err := denyFormatFor(opts.Format)
+	if err != nil {
+		return err
+	}
+	ttl := opts.TTL
 	if ttl <= 0 {
 		ttl = 7 * 24 * time.Hour
 	}
 	now := time.Now().UTC()
-	expiry := now.Add(ttl)
+
+	tmpl, err := parseDenyCommentTemplate(opts.CommentTemplate)
+	if err != nil {
+		return fmt.Errorf("parse deny comment template: %w", err)
+	}
+
+	// Managed formats rewrite only the block between the BEGIN and END
+	// markers. Minimal files get markers once the existing file has them.
+	var existing managedDenyFile
+	if format.Managed {
+		if existing, err = readManagedDenyFile(path); err != nil {
+			return fmt.Errorf("read deny file: %w", err)
+		}
+	}
+	marked := format.Managed && (!opts.Minimal || existing.Marked)
 
 	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("# generated by botdeny on %s UTC\n", now.Format(time.RFC3339)))
-	if len(suspects) == 0 {
-		builder.WriteString("# no suspicious IPs detected with current thresholds\n")
-	} else {
-		skipped := 0
-		for _, suspect := range suspects {
-			// Skip IPs that fail validation
-			if !isValidIP(suspect.IP) {
-				log.Printf("warning: skipping invalid IP in deny file: %q", suspect.IP)
-				skipped++
-				continue
-			}
+	if marked {
+		builder.WriteString(existing.Before)
+		builder.WriteString(denyBlockBegin + "\n")
+	}
+	withComments := !opts.Minimal && !format.NoComments
+	if withComments {
+		builder.WriteString(format.comment(fmt.Sprintf("generated by botdeny on %s UTC", now.Format(time.RFC3339))))
+		if opts.Run.ID != "" {
+			builder.WriteString(format.comment(fmt.Sprintf("run %s window %s", opts.Run.ID, opts.Run.Window())))
+		}
+		if format.Usage != "" {
+			builder.WriteString(format.comment(fmt.Sprintf(format.Usage, path)))
+		}
+	}
+	// Hand-added lines tagged "# manual" are carried over ahead of the
+	// generated entries, which skip the targets already denied by hand.
+	for _, line := range existing.Manual {
+		builder.WriteString(line + "\n")
+	}
+	if len(suspects) == 0 && withComments {
+		builder.WriteString(format.comment("no suspicious IPs detected with current thresholds"))
+	}
 
-			reasons := strings.Join(suspect.Reasons, "; ")
-			reasons = strings.ReplaceAll(reasons, "\n", " ")
-			errors := 0
-			for status, count := range suspect.Stats.StatusCounts {
-				if status >= 400 {
-					errors += count
-				}
-			}
-			errorPercent := 0.0
-			if suspect.Stats.Requests > 0 {
-				errorPercent = (float64(errors) / float64(suspect.Stats.Requests)) * 100
-			}
-			iso := suspect.Stats.CountryISO
-			if iso == "" {
-				iso = "-"
-			}
-			name := suspect.Stats.CountryName
-			if name == "" {
-				name = "-"
-			}
-			comment := fmt.Sprintf("expires %s; errors=%d (%.1f%%); country=%s (%s)", expiry.Format("2006-01-02"), errors, errorPercent, iso, name)
-			if reasons != "" {
-				comment = fmt.Sprintf("%s; %s", comment, reasons)
-			}
-			builder.WriteString(fmt.Sprintf("deny %s; # %s\n", suspect.IP, comment))
+	items := make([]denyItem, 0, len(suspects))
+	// written dedups suspects that share a widened IPv6 prefix; the first,
+	// highest ranked one gives the entry its comment.
+	written := make(map[string]bool, len(suspects))
+	skipped := 0
+	for _, suspect := range suspects {
+		// Skip IPs that fail validation; CIDR ranges come from ASN blocking
+		if !isValidIP(suspect.IP) && !isValidCIDR(suspect.IP) {
+			log.Printf("warning: skipping invalid IP in deny file: %q", suspect.IP)
+			skipped++
+			continue
 		}
-		if skipped > 0 {
-			log.Printf("skipped %d invalid IP(s) from deny file", skipped)
+		target := widenIPv6(suspect.IP, opts.IPv6Prefix)
+		if existing.Targets[target] || existing.Targets[suspect.IP] || written[target] {
+			continue
+		}
+		written[target] = true
+		item := denyItem{IP: target, Expires: now.Add(expiryFor(suspect.Severity, ttl, opts.SeverityTTL))}
+		if withComments {
+			data := denyCommentData(suspect, item.Expires)
+			data.RunID = opts.Run.ID
+			var comment strings.Builder
+			if err := tmpl.Execute(&comment, data); err != nil {
+				return fmt.Errorf("render deny comment for %s: %w", suspect.IP, err)
+			}
+			item.Comment = stripControl(comment.String())
 		}
+		items = append(items, item)
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d invalid IP(s) from deny file", skipped)
+	}
+	format.Render(&builder, items, opts)
+	if marked {
+		builder.WriteString(denyBlockEnd + "\n")
+		builder.WriteString(existing.After)
 	}
 
 	return os.WriteFile(path, []byte(builder.String()), 0o644)
 }
 
+func denyCommentData(suspect Suspicion, expiry time.Time) DenyCommentData {
+	reasons := stripControl(strings.Join(suspect.Reasons, "; "))
+	errors := 0
+	for status, count := range suspect.Stats.StatusCounts {
+		if status >= 400 {
+			errors += count
+		}
+	}
+	errorPercent := 0.0
+	if suspect.Stats.Requests > 0 {
+		errorPercent = (float64(errors) / float64(suspect.Stats.Requests)) * 100
+	}
+	iso := suspect.Stats.CountryISO
+	if iso == "" {
+		iso = "-"
+	}
+	name := suspect.Stats.CountryName
+	if name == "" {
+		name = "-"
+	}
+	return DenyCommentData{
+		IP:           suspect.IP,
+		Expiry:       expiry.Format("2006-01-02"),
+		ExpiresAt:    expiry,
+		Score:        suspect.Score,
+		Severity:     suspect.Severity.String(),
+		Reasons:      reasons,
+		Country:      iso,
+		CountryName:  name,
+		Requests:     suspect.Stats.Requests,
+		Errors:       errors,
+		ErrorPercent: errorPercent,
+	}
+}
+
 func runNginxReload(binary string) error {
 	if binary == "" {
 		binary = "nginx"
@@ -427,7 +1477,7 @@ func runNginxReload(binary string) error {
 	testCmd.Stdout = &testOut
 	testCmd.Stderr = &testOut
 	if err := testCmd.Run(); err != nil {
-		return fmt.Errorf("nginx -t failed: %w\n%s", err, testOut.String())
+		return fmt.Errorf("%w: %w\n%s", errNginxConfigTest, err, testOut.String())
 	}
 
 	reloadCmd := exec.Command(binary, "-s", "reload")
@@ -448,14 +1498,27 @@ func runNginxReload(binary string) error {
 	return nil
 }
 
-func appendBlockLog(path string, suspects []Suspicion) error {
+// importBans replays a block log into a state DB that has no ban history
+// yet, so the option can stay set after the first run.
+func importBans(db *StateDB, path string) {
+	if len(db.Bans) > 0 {
+		return
+	}
+	bans, err := readBlockLog(path)
+	if err != nil {
+		log.Fatalf("import block log: %v", err)
+	}
+	log.Printf("imported %d banned IPs from %s", db.ImportBans(bans), path)
+}
+
+func appendBlockLog(path string, run RunInfo, suspects []Suspicion) error {
 	if path == "" {
 		return nil
 	}
 
 	now := time.Now().UTC()
 	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("%s total=%d\n", now.Format(time.RFC3339), len(suspects)))
+	builder.WriteString(fmt.Sprintf("%s run=%s window=%s total=%d\n", now.Format(time.RFC3339), run.ID, run.Window(), len(suspects)))
 	if len(suspects) == 0 {
 		builder.WriteString("  none\n\n")
 	} else {
@@ -467,12 +1530,26 @@ func appendBlockLog(path string, suspects []Suspicion) error {
 			if country == "" {
 				country = "-"
 			}
-			reasons := strings.Join(suspect.Reasons, "; ")
-			reasons = strings.ReplaceAll(reasons, "\n", " ")
-			builder.WriteString(fmt.Sprintf("  %s score=%d country=%s reasons=%s\n",
+			reasons := stripControl(strings.Join(suspect.Reasons, "; "))
+			sources := ""
+			if len(suspect.Stats.Sources) > 0 {
+				sources = " sources=" + strings.Join(sourceNames(suspect.Stats), ",")
+			}
+			if len(suspect.Stats.Backends) > 0 {
+				sources += " backends=" + strings.Join(backendNames(suspect.Stats), ",")
+			}
+			if len(suspect.Stats.Hosts) > 0 {
+				sources += " hosts=" + strings.Join(hostNames(suspect.Stats), ",")
+			}
+			if suspect.Stats.Annotation != "" {
+				sources += fmt.Sprintf(" note=%q", suspect.Stats.Annotation)
+			}
+			builder.WriteString(fmt.Sprintf("  %s score=%d severity=%s country=%s%s reasons=%s\n",
 				suspect.IP,
 				suspect.Score,
+				suspect.Severity,
 				country,
+				stripControl(sources),
 				reasons))
 		}
 		builder.WriteString("\n")
@@ -491,9 +1568,11 @@ func appendBlockLog(path string, suspects []Suspicion) error {
 	return nil
 }
 
-func loadAllowIPsFromFiles(paths []string) ([]string, []string, error) {
+// loadAllowIPsFromFiles collects set_real_ip_from addresses. Unreadable files
+// are recorded in problems and skipped so the rest of the allowlist still applies.
+func loadAllowIPsFromFiles(paths []string, problems *Problems) ([]string, []string) {
 	if len(paths) == 0 {
-		return nil, nil, nil
+		return nil, nil
 	}
 
 	ips := make([]string, 0)
@@ -506,7 +1585,8 @@ func loadAllowIPsFromFiles(paths []string) ([]string, []string, error) {
 		}
 		file, err := os.Open(path)
 		if err != nil {
-			return nil, nil, fmt.Errorf("open %s: %w", path, err)
+			problems.Add(ProblemAllowFile, err.Error())
+			continue
 		}
 		scanner := bufio.NewScanner(file)
 		for scanner.Scan() {
@@ -534,11 +1614,10 @@ func loadAllowIPsFromFiles(paths []string) ([]string, []string, error) {
 			}
 		}
 		if err := scanner.Err(); err != nil {
-			file.Close()
-			return nil, nil, fmt.Errorf("scan %s: %w", path, err)
+			problems.Add(ProblemAllowFile, fmt.Sprintf("scan %s: %v", path, err))
 		}
 		file.Close()
 	}
 
-	return ips, cidrs, nil
+	return ips, cidrs
 }
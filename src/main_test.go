@@ -3,7 +3,9 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadAllowIPsFromFiles(t *testing.T) {
@@ -18,9 +20,10 @@ real_ip_header CF-Connecting-IP;
 		t.Fatalf("write file: %v", err)
 	}
 
-	ips, cidrs, err := loadAllowIPsFromFiles([]string{filePath})
-	if err != nil {
-		t.Fatalf("loadAllowIPsFromFiles: %v", err)
+	problems := newProblems()
+	ips, cidrs := loadAllowIPsFromFiles([]string{filePath, filepath.Join(dir, "missing.conf")}, problems)
+	if problems.Count(ProblemAllowFile) != 1 {
+		t.Fatalf("expected the missing allow file to be recorded, got %d", problems.Count(ProblemAllowFile))
 	}
 	if len(cidrs) != 1 || cidrs[0] != "173.245.48.0/20" {
 		t.Fatalf("unexpected cidrs: %v", cidrs)
@@ -50,3 +53,99 @@ func TestApplyConfigDefaultsSensitiveURLs(t *testing.T) {
 		t.Fatalf("unexpected first sensitive url limit: %+v", cfg.SensitiveURLLimits[0])
 	}
 }
+
+func TestApplyConfigDefaultsMonitorOverrides(t *testing.T) {
+	cfg := DefaultConfig()
+	fc := FileConfig{
+		MonitorAgents: []string{"HetrixTools"},
+		MonitorCIDRs:  []string{},
+	}
+
+	if err := applyConfigDefaults(&cfg, fc); err != nil {
+		t.Fatalf("applyConfigDefaults: %v", err)
+	}
+
+	if len(cfg.MonitorAgents) != 1 || cfg.MonitorAgents[0] != "HetrixTools" {
+		t.Fatalf("expected monitor agents to be replaced, got %v", cfg.MonitorAgents)
+	}
+	if len(cfg.MonitorCIDRs) != 0 {
+		t.Fatalf("expected monitor cidrs to be cleared, got %v", cfg.MonitorCIDRs)
+	}
+}
+
+func TestWriteDenyFileCommentTemplate(t *testing.T) {
+	suspects := []Suspicion{{
+		IP:       "192.0.2.1",
+		Score:    4,
+		Severity: SeverityHigh,
+		Reasons:  []string{"burst 300 req in 1m0s"},
+		Stats: &IPStats{
+			Requests:     10,
+			StatusCounts: map[int]int{404: 5, 200: 5},
+			CountryISO:   "GB",
+			CountryName:  "United Kingdom",
+		},
+	}}
+	dir := t.TempDir()
+
+	defaultPath := filepath.Join(dir, "default.conf")
+	if err := writeDenyFile(defaultPath, suspects, DenyOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ := os.ReadFile(defaultPath)
+	if !strings.Contains(string(data), "deny 192.0.2.1; # expires ") || !strings.Contains(string(data), "errors=5 (50.0%); country=GB (United Kingdom); burst 300 req in 1m0s\n") {
+		t.Fatalf("unexpected default deny output:\n%s", data)
+	}
+
+	customPath := filepath.Join(dir, "custom.conf")
+	opts := DenyOptions{TTL: time.Hour, CommentTemplate: "{{.Severity}} score={{.Score}}"}
+	if err := writeDenyFile(customPath, suspects, opts); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ = os.ReadFile(customPath)
+	if !strings.HasSuffix(string(data), "deny 192.0.2.1; # high score=4\n# END botdeny\n") {
+		t.Fatalf("unexpected templated deny output:\n%s", data)
+	}
+
+	minimalPath := filepath.Join(dir, "minimal.conf")
+	if err := writeDenyFile(minimalPath, suspects, DenyOptions{Minimal: true}); err != nil {
+		t.Fatalf("writeDenyFile: %v", err)
+	}
+	data, _ = os.ReadFile(minimalPath)
+	if string(data) != "deny 192.0.2.1;\n" {
+		t.Fatalf("unexpected minimal deny output: %q", data)
+	}
+}
+
+func TestAppendBlockLogRecordsRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.log")
+	start := time.Date(2025, 10, 19, 6, 0, 0, 0, time.UTC)
+	run := RunInfo{ID: newUUID(), WindowStart: start, WindowEnd: start.Add(time.Hour)}
+	suspects := []Suspicion{{IP: "192.0.2.1", Score: 3, Severity: SeverityMedium, Stats: &IPStats{}}}
+
+	if err := appendBlockLog(path, run, suspects); err != nil {
+		t.Fatalf("appendBlockLog: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "run=" + run.ID + " window=2025-10-19T06:00:00Z/2025-10-19T07:00:00Z total=1"
+	if !strings.Contains(string(data), want) {
+		t.Fatalf("expected %q in block log, got:\n%s", want, data)
+	}
+	if len(run.ID) != 36 || run.ID[14] != '4' {
+		t.Fatalf("expected version 4 UUID, got %s", run.ID)
+	}
+}
+
+func TestAppendBlockLogListsSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocked.log")
+	stats := &IPStats{Sources: map[string]int{"edge1.log": 3, "edge2.log": 9}}
+	suspects := []Suspicion{{IP: "192.0.2.1", Score: 3, Severity: SeverityMedium, Stats: stats}}
+
+	if err := appendBlockLog(path, newRunInfo(), suspects); err != nil {
+		t.Fatalf("appendBlockLog: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "country=- sources=edge2.log,edge1.log reasons=") {
+		t.Fatalf("expected sources in block log, got:\n%s", data)
+	}
+}
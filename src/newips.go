@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// newIPWarmup skips the first minutes of a log or follow session, where
+	// every IP that was already active looks new.
+	newIPWarmup = 5 * time.Minute
+	// newIPBaselineMinutes is how many preceding minutes the usual rate of
+	// new IPs is taken from.
+	newIPBaselineMinutes = 60
+	// newIPMemory is how long follow mode remembers an idle IP as seen.
+	newIPMemory = 24 * time.Hour
+)
+
+// NewIPSpike is a minute in which far more never-before-seen IPs appeared
+// than usual, a sign of a distributed attack spreading its requests thin
+// enough to stay below the per-IP thresholds.
+type NewIPSpike struct {
+	Minute time.Time
+	NewIPs int
+	// Baseline is the median of new IPs per minute over the preceding hour.
+	Baseline float64
+}
+
+// describe renders the spike for reports and notifications.
+func (s NewIPSpike) describe() string {
+	return fmt.Sprintf("%d new IPs in the minute from %s vs baseline %.1f/min", s.NewIPs, s.Minute.UTC().Format("2006-01-02 15:04"), s.Baseline)
+}
+
+// NewIPSpikes lists the minutes in which at least NewIPSpikeMin IPs made
+// their first request, and at least NewIPSpikeFactor times the usual number,
+// in chronological order.
+func (a *Analyzer) NewIPSpikes() []NewIPSpike {
+	if a.cfg.NewIPSpikeFactor <= 0 {
+		return nil
+	}
+	firstSeen := make(map[string]time.Time, len(a.stats))
+	for _, stat := range a.stats {
+		if first, ok := firstSeen[stat.IP]; !ok || stat.FirstSeen.Before(first) {
+			firstSeen[stat.IP] = stat.FirstSeen
+		}
+	}
+	counts := make(map[time.Time]int)
+	var start, end time.Time
+	for _, first := range firstSeen {
+		minute := first.Truncate(time.Minute)
+		counts[minute]++
+		if start.IsZero() || minute.Before(start) {
+			start = minute
+		}
+		if minute.After(end) {
+			end = minute
+		}
+	}
+	return newIPSpikes(counts, start, start, end, a.cfg.NewIPSpikeFactor, a.cfg.NewIPSpikeMin)
+}
+
+// newIPSpikes checks the minutes from from to end of counts, which holds the
+// IPs first seen in each minute since start.
+func newIPSpikes(counts map[time.Time]int, start, from, end time.Time, factor float64, minNew int) []NewIPSpike {
+	if factor <= 0 || start.IsZero() {
+		return nil
+	}
+	if warm := start.Add(newIPWarmup); from.Before(warm) {
+		from = warm
+	}
+	var spikes []NewIPSpike
+	for minute := from.Truncate(time.Minute); !minute.After(end); minute = minute.Add(time.Minute) {
+		count := counts[minute]
+		if count < minNew {
+			continue
+		}
+		history := make([]int, 0, newIPBaselineMinutes)
+		for prev := minute.Add(-time.Minute); !prev.Before(start) && len(history) < newIPBaselineMinutes; prev = prev.Add(-time.Minute) {
+			history = append(history, counts[prev])
+		}
+		baseline := medianInt(history)
+		if float64(count) < factor*max(baseline, 1) {
+			continue
+		}
+		spikes = append(spikes, NewIPSpike{Minute: minute, NewIPs: count, Baseline: baseline})
+	}
+	return spikes
+}
+
+func medianInt(values []int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return float64(sorted[mid])
+	}
+	return float64(sorted[mid-1]+sorted[mid]) / 2
+}
+
+// newIPTracker remembers the IPs seen across follow-mode evaluations, whose
+// sliding window forgets them, and counts first appearances per minute.
+type newIPTracker struct {
+	start    time.Time
+	lastSeen map[string]time.Time
+	counts   map[time.Time]int
+	// reported is the latest spike minute already returned by spikes.
+	reported time.Time
+}
+
+func newNewIPTracker() *newIPTracker {
+	return &newIPTracker{
+		lastSeen: make(map[string]time.Time),
+		counts:   make(map[time.Time]int),
+	}
+}
+
+func (t *newIPTracker) add(ip string, at time.Time) {
+	if ip == "" {
+		return
+	}
+	if t.start.IsZero() || at.Before(t.start) {
+		t.start = at.Truncate(time.Minute)
+	}
+	last, ok := t.lastSeen[ip]
+	if !ok {
+		t.counts[at.Truncate(time.Minute)]++
+	}
+	if !ok || at.After(last) {
+		t.lastSeen[ip] = at
+	}
+}
+
+// spikes returns the spikes up to now not returned before and forgets IPs
+// idle for newIPMemory and counts older than the baseline needs.
+func (t *newIPTracker) spikes(now time.Time, window time.Duration, factor float64, minNew int) []NewIPSpike {
+	for ip, last := range t.lastSeen {
+		if now.Sub(last) > newIPMemory {
+			delete(t.lastSeen, ip)
+		}
+	}
+	horizon := now.Add(-window - newIPBaselineMinutes*time.Minute)
+	for minute := range t.counts {
+		if minute.Before(horizon) {
+			delete(t.counts, minute)
+		}
+	}
+
+	from := now.Add(-window)
+	if next := t.reported.Add(time.Minute); from.Before(next) {
+		from = next
+	}
+	spikes := newIPSpikes(t.counts, t.start, from, now.Truncate(time.Minute), factor, minNew)
+	if len(spikes) > 0 {
+		t.reported = spikes[len(spikes)-1].Minute
+	}
+	return spikes
+}
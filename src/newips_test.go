@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newIPEntries has perMinute IPs make their first request in each of
+// minutes minutes from start, and keeps the earlier IPs returning.
+func newIPEntries(start time.Time, minutes int, perMinute func(minute int) int) []Entry {
+	var entries []Entry
+	next := 0
+	for m := 0; m < minutes; m++ {
+		at := start.Add(time.Duration(m) * time.Minute)
+		for i := 0; i < perMinute(m); i++ {
+			entries = append(entries, Entry{ClientIP: fmt.Sprintf("10.%d.%d.%d", next>>16&255, next>>8&255, next&255), Time: at, URI: "/", Status: 200})
+			next++
+		}
+		entries = append(entries, Entry{ClientIP: "10.0.0.0", Time: at.Add(30 * time.Second), URI: "/", Status: 200})
+	}
+	return entries
+}
+
+func TestNewIPSpikesFlagsMinuteAboveBaseline(t *testing.T) {
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	entries := newIPEntries(start, 30, func(minute int) int {
+		switch minute {
+		case 0:
+			return 400 // IPs already active when the log starts
+		case 20:
+			return 120
+		}
+		return 5
+	})
+
+	analyzer := New(DefaultConfig(), nil)
+	for _, entry := range entries {
+		analyzer.Process(entry)
+	}
+	spikes := analyzer.NewIPSpikes()
+	if len(spikes) != 1 {
+		t.Fatalf("expected one spike, got %+v", spikes)
+	}
+	spike := spikes[0]
+	if !spike.Minute.Equal(start.Add(20*time.Minute)) || spike.NewIPs != 120 || spike.Baseline != 5 {
+		t.Fatalf("unexpected spike %+v", spike)
+	}
+
+	cfg := DefaultConfig()
+	cfg.NewIPSpikeMin = 200
+	analyzer = New(cfg, nil)
+	for _, entry := range entries {
+		analyzer.Process(entry)
+	}
+	if spikes := analyzer.NewIPSpikes(); len(spikes) != 0 {
+		t.Fatalf("expected spikes below new_ip_spike_min to be ignored, got %+v", spikes)
+	}
+}
+
+func TestLivePipelineReportsNewIPSpikeOnce(t *testing.T) {
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	pipeline := newLivePipeline(DefaultConfig(), nil, 5*time.Minute, time.Minute)
+	entries := newIPEntries(start, 30, func(minute int) int {
+		if minute == 20 {
+			return 100
+		}
+		return 3
+	})
+
+	reported := 0
+	i := 0
+	for m := 1; m <= 30; m++ {
+		now := start.Add(time.Duration(m) * time.Minute)
+		for ; i < len(entries) && entries[i].Time.Before(now); i++ {
+			pipeline.Add(entries[i])
+		}
+		tick := pipeline.Evaluate(now)
+		for _, spike := range tick.NewIPSpikes {
+			if !spike.Minute.Equal(start.Add(20 * time.Minute)) {
+				t.Fatalf("unexpected spike %+v at %s", spike, now)
+			}
+			reported++
+		}
+	}
+	if reported != 1 {
+		t.Fatalf("expected the spike to be reported once, got %d", reported)
+	}
+
+	// An IP the window forgot is not new when it returns.
+	pipeline.Add(Entry{ClientIP: "10.0.0.1", Time: start.Add(31 * time.Minute)})
+	if counts := pipeline.newIPs.counts[start.Add(31*time.Minute)]; counts != 0 {
+		t.Fatalf("expected a returning IP not to count as new, got %d", counts)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// errNginxConfigTest marks reload errors where nginx -t rejected the
+// configuration, so nginx is still running the previous one.
+var errNginxConfigTest = errors.New("nginx -t failed")
+
+// denyBackup holds deny files as they were before botdeny rewrote them, so a
+// configuration nginx rejects can be rolled back.
+type denyBackup struct {
+	files map[string][]byte
+	// missing lists the files that did not exist yet.
+	missing map[string]bool
+}
+
+// backupDenyFiles reads the current contents of paths.
+func backupDenyFiles(paths []string) (*denyBackup, error) {
+	backup := &denyBackup{files: make(map[string][]byte), missing: make(map[string]bool)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			backup.missing[path] = true
+		case err != nil:
+			return nil, fmt.Errorf("back up %s: %w", path, err)
+		default:
+			backup.files[path] = data
+		}
+	}
+	return backup, nil
+}
+
+// restore puts every backed up file back and removes those that did not
+// exist before.
+func (b *denyBackup) restore() error {
+	var errs []error
+	for path, data := range b.files {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for path := range b.missing {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reloadNginx runs reload after the deny files were written. When nginx -t
+// rejects the configuration, the files are restored from backup instead of
+// leaving a broken include in place, and the returned error still wraps
+// errNginxConfigTest.
+func reloadNginx(reload func(binary string) error, binary string, backup *denyBackup) error {
+	err := reload(binary)
+	if err == nil || !errors.Is(err, errNginxConfigTest) {
+		return err
+	}
+	if restoreErr := backup.restore(); restoreErr != nil {
+		return fmt.Errorf("%w\nrestoring the previous deny files failed: %v", err, restoreErr)
+	}
+	return fmt.Errorf("%w\nrestored the previous deny files and skipped the reload", err)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// escapeControl percent-encodes the control characters in s, such as the CR
+// normalizeURI decodes from %0d, so a logged value quoted in a reason cannot
+// break the line of a deny file comment or the block log.
+func escapeControl(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			fmt.Fprintf(&b, "%%%02X", r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// stripControl replaces control characters, CR and LF included, with spaces
+// so free text stays on one line where reasons and comments are written.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// maxURIDecodes bounds how many layers of percent-encoding normalizeURI
+// peels, enough for the double and triple encoding scanners use.
+const maxURIDecodes = 3
+
+// normalizeURI undoes the encodings scanners use to slip payloads past
+// substring signatures, so rules see "../" for "%2e%2e%2f", "%252e%252e%252f",
+// "%u002e%u002e/", "%c0%ae%c0%ae/" or fullwidth "．．／". "+" in the query
+// string becomes a space and backslashes become slashes, as most servers
+// treat them. The result is only used for matching and, through
+// normalizePath, for path counts; raw lines keep the URI as logged.
+func normalizeURI(uri string) string {
+	if isPlainURI(uri) {
+		return uri
+	}
+	if path, query, ok := strings.Cut(uri, "?"); ok {
+		uri = path + "?" + strings.ReplaceAll(query, "+", " ")
+	}
+	for i := 0; i < maxURIDecodes && strings.Contains(uri, "%"); i++ {
+		decoded := percentDecode(uri)
+		if decoded == uri {
+			break
+		}
+		uri = decoded
+	}
+	return foldURIRunes(uri)
+}
+
+// isPlainURI reports whether uri is printable ASCII without anything
+// normalizeURI would rewrite, which is the case for most requests.
+func isPlainURI(uri string) bool {
+	query := false
+	for i := 0; i < len(uri); i++ {
+		switch c := uri[i]; {
+		case c == '%' || c == '\\' || c >= utf8.RuneSelf:
+			return false
+		case c == '?':
+			query = true
+		case c == '+' && query:
+			return false
+		}
+	}
+	return true
+}
+
+// percentDecode decodes %XX and IIS-style %uXXXX escapes, leaving malformed
+// ones as they are.
+func percentDecode(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+5 < len(s) && (s[i+1] == 'u' || s[i+1] == 'U') {
+			if r, ok := hexValue(s[i+2 : i+6]); ok {
+				b.WriteRune(rune(r))
+				i += 5
+				continue
+			}
+		}
+		if i+2 < len(s) {
+			if v, ok := hexValue(s[i+1 : i+3]); ok {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte('%')
+	}
+	return b.String()
+}
+
+func hexValue(s string) (int, bool) {
+	v := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			v = v<<4 | int(c-'0')
+		case c >= 'a' && c <= 'f':
+			v = v<<4 | int(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			v = v<<4 | int(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return v, true
+}
+
+// foldURIRunes maps overlong UTF-8 encodings of ASCII and fullwidth forms to
+// plain ASCII, drops zero-width characters and turns backslashes into slashes.
+func foldURIRunes(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		c := s[i]
+		// Overlong two-byte sequences such as 0xC0 0xAE for "." are invalid
+		// UTF-8 that some decoders still accept.
+		if (c == 0xC0 || c == 0xC1) && i+1 < len(s) && s[i+1]&0xC0 == 0x80 {
+			b.WriteByte((c&0x1F)<<6 | s[i+1]&0x3F)
+			i += 2
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteByte(c)
+		case r >= 0xFF01 && r <= 0xFF5E:
+			b.WriteByte(byte(r - 0xFEE0))
+		case r == 0x3000:
+			b.WriteByte(' ')
+		case r == 0x200B || r == 0x200C || r == 0x200D || r == 0xFEFF || r == 0xAD:
+			// Zero-width characters and soft hyphens are dropped.
+		case r == '\\':
+			b.WriteByte('/')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sessionParams are query and path parameters carrying a session ID, which
+// make every visit to an endpoint look like a new path.
+var sessionParams = map[string]struct{}{
+	"jsessionid":   {},
+	"phpsessid":    {},
+	"aspsessionid": {},
+	"sessionid":    {},
+	"session_id":   {},
+	"sid":          {},
+	"cfid":         {},
+	"cftoken":      {},
+}
+
+// normalizePath keys a URI in UniquePaths and PathCounts: decoded as by
+// normalizeURI, with duplicate slashes collapsed, the path lowercased and
+// session ID parameters dropped, so an endpoint probed under many encodings
+// or sessions counts once.
+func normalizePath(uri string) string {
+	path, query, hasQuery := strings.Cut(normalizeURI(uri), "?")
+	// Servlet containers append the session as a path parameter.
+	if i := strings.Index(strings.ToLower(path), ";jsessionid="); i >= 0 {
+		path = path[:i]
+	}
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	path = strings.ToLower(path)
+	if !hasQuery {
+		return path
+	}
+	params := strings.Split(query, "&")
+	kept := params[:0]
+	for _, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if _, ok := sessionParams[strings.ToLower(name)]; ok || param == "" {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if len(kept) == 0 {
+		return path
+	}
+	return path + "?" + strings.Join(kept, "&")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"/products?page=2", "/products?page=2"},
+		{"/static/%2e%2e%2f%2e%2e%2fetc/passwd", "/static/../../etc/passwd"},
+		{"/static/%252e%252e%252fetc/passwd", "/static/../etc/passwd"},
+		{"/static/%25252e%25252e/", "/static/../"},
+		{"/static/%u002e%u002e%u2215", "/static/..∕"},
+		{"/static/%c0%ae%c0%ae%c0%afetc", "/static/../etc"},
+		{"/static/．．／etc", "/static/../etc"},
+		{"/wp-​login.php", "/wp-login.php"},
+		{"/static/..\\..\\windows\\win.ini", "/static/../../windows/win.ini"},
+		{"/page?id=1+UNION+SELECT+1", "/page?id=1 UNION SELECT 1"},
+		{"/c++/guide", "/c++/guide"},
+		{"/search?q=100%zz%", "/search?q=100%zz%"},
+		{"/%E2%82%AC", "/€"},
+	}
+	for _, tt := range tests {
+		if got := normalizeURI(tt.uri); got != tt.want {
+			t.Errorf("normalizeURI(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzerMatchesEncodedPayloads(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinSQLInjections = 2
+	cfg.Honeytokens = []string{"trap=7f3a9c"}
+
+	a := New(cfg, nil)
+	for _, uri := range []string{
+		"/page?id=1%2520UNION%2520SELECT%2520password",
+		"/page?id=1+union+all+select+1",
+		"/products?trap%3D7f3a9c",
+	} {
+		a.Process(Entry{
+			Time:       time.Now(),
+			ClientIP:   "1.2.3.4",
+			RemoteAddr: "1.2.3.4",
+			Status:     403,
+			URI:        uri,
+		})
+	}
+
+	suspects := a.Suspicious()
+	if len(suspects) != 1 {
+		t.Fatalf("expected 1 suspect, got %d", len(suspects))
+	}
+	stat := suspects[0].Stats
+	if stat.SQLInjections != 2 {
+		t.Errorf("expected 2 SQL injections, got %d", stat.SQLInjections)
+	}
+	if stat.Honeytokens != 1 {
+		t.Errorf("expected 1 honeytoken hit, got %d", stat.Honeytokens)
+	}
+	if _, ok := stat.PathCounts["/products?trap=7f3a9c"]; !ok {
+		t.Errorf("expected paths to be counted decoded, got %v", stat.PathCounts)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"/Products?page=2", "/products?page=2"},
+		{"//static///%2e%2e%2fAdmin", "/static/../admin"},
+		{"/cart;jsessionid=0A1B2C?item=4", "/cart?item=4"},
+		{"/account?PHPSESSID=abc123&tab=orders", "/account?tab=orders"},
+		{"/login?sid=9f&&", "/login"},
+		{"/search?q=Shoes", "/search?q=Shoes"},
+	}
+	for _, tt := range tests {
+		if got := normalizePath(tt.uri); got != tt.want {
+			t.Errorf("normalizePath(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzerCountsEncodedPathsOnce(t *testing.T) {
+	a := New(DefaultConfig(), nil)
+	for _, uri := range []string{
+		"/wp-login.php",
+		"/WP-LOGIN.PHP",
+		"//wp-login.php",
+		"/wp%2dlogin.php",
+		"/wp-login.php?PHPSESSID=1f2e3d",
+	} {
+		a.Process(Entry{
+			Time:       time.Now(),
+			ClientIP:   "1.2.3.4",
+			RemoteAddr: "1.2.3.4",
+			Status:     404,
+			URI:        uri,
+		})
+	}
+	stat := a.stats["1.2.3.4"]
+	if len(stat.UniquePaths) != 1 || stat.PathCounts["/wp-login.php"] != 5 {
+		t.Fatalf("expected one path counted 5 times, got %v", stat.PathCounts)
+	}
+}
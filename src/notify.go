@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	notifySlack   = "slack"
+	notifyWebhook = "webhook"
+
+	// notifyMaxLines caps the suspects listed in a single chat message.
+	notifyMaxLines = 20
+)
+
+var knownRuleCodes = []string{
+	RuleSensitivePath, RuleHoneytoken, RuleRate, RuleBurst, RuleErrors, RuleErrorRatio,
+	RuleUniquePaths, RulePHP404, RuleSQLInjection, RuleCacheBusting, RuleCacheMiss, RuleUpstreamTime,
+	RulePeer, RuleCountry, RuleCountrySpike, RuleNoSession,
+	RuleHeaders, RuleLegacyTLS, RuleSingleCipher, RuleVhostScan, RuleStatus, RuleQueryFuzzing, RuleSequence,
+}
+
+// NotifyConfig routes blocked suspects to notification channels.
+type NotifyConfig struct {
+	Channels map[string]NotifyChannel `yaml:"channels"`
+	Routes   []NotifyRoute            `yaml:"routes"`
+	// Alerts lists the channels told about events that concern the whole
+	// site rather than blocked suspects: suspected distributed attacks and
+	// deny files rejected by nginx.
+	Alerts []string `yaml:"alerts"`
+}
+
+// NotifyChannel is a destination for notifications.
+type NotifyChannel struct {
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+}
+
+// NotifyRoute sends suspects matching every set condition to its channels.
+// Empty conditions match everything.
+type NotifyRoute struct {
+	MinSeverity *Severity `yaml:"min_severity"`
+	MaxSeverity *Severity `yaml:"max_severity"`
+	Countries   []string  `yaml:"countries"`
+	Rules       []string  `yaml:"rules"`
+	Vhosts      []string  `yaml:"vhosts"`
+	Channels    []string  `yaml:"channels"`
+}
+
+// NotifyPayload is the JSON body posted to webhook channels.
+type NotifyPayload struct {
+	RunID    string            `json:"run_id"`
+	Window   string            `json:"window"`
+	Vhost    string            `json:"vhost,omitempty"`
+	Channel  string            `json:"channel"`
+	Suspects []NotifySuspicion `json:"suspects"`
+}
+
+// NotifySuspicion is a single suspect included in a notification.
+type NotifySuspicion struct {
+	IP       string   `json:"ip"`
+	Score    int      `json:"score"`
+	Severity Severity `json:"severity"`
+	Country  string   `json:"country,omitempty"`
+	Rules    []string `json:"rules"`
+	Reasons  []string `json:"reasons"`
+	Sources  []string `json:"sources,omitempty"`
+	Backends []string `json:"backends,omitempty"`
+	Hosts    []string `json:"hosts,omitempty"`
+	// Annotation is the label the annotations file gives the IP.
+	Annotation string `json:"annotation,omitempty"`
+	// FirstLines and LastLines sample the raw log lines when raw_lines is set.
+	FirstLines []string `json:"first_lines,omitempty"`
+	LastLines  []string `json:"last_lines,omitempty"`
+}
+
+// NotifyAlert is the JSON body posted to webhook channels when a
+// distributed attack is suspected ("distributed_attack", with Spikes) or
+// nginx rejected the deny files ("reload_failed", with Detail).
+type NotifyAlert struct {
+	RunID    string         `json:"run_id"`
+	Window   string         `json:"window"`
+	Vhost    string         `json:"vhost,omitempty"`
+	Channel  string         `json:"channel"`
+	Alert    string         `json:"alert"`
+	Severity Severity       `json:"severity,omitempty"`
+	Spikes   []NotifyNewIPs `json:"spikes,omitempty"`
+	Detail   string         `json:"detail,omitempty"`
+}
+
+// NotifyNewIPs is a minute with a spike of new IPs included in an alert.
+type NotifyNewIPs struct {
+	Minute   time.Time `json:"minute"`
+	NewIPs   int       `json:"new_ips"`
+	Baseline float64   `json:"baseline"`
+}
+
+func (n NotifyConfig) enabled() bool {
+	return len(n.Routes) > 0
+}
+
+func (n NotifyConfig) validate() error {
+	for name, channel := range n.Channels {
+		switch channel.Type {
+		case notifySlack, notifyWebhook:
+		default:
+			return fmt.Errorf("notify channel %q: unknown type %q (want slack or webhook)", name, channel.Type)
+		}
+		if channel.URL == "" {
+			return fmt.Errorf("notify channel %q: url is required", name)
+		}
+	}
+	for i, route := range n.Routes {
+		if len(route.Channels) == 0 {
+			return fmt.Errorf("notify route %d: no channels", i+1)
+		}
+		for _, name := range route.Channels {
+			if _, ok := n.Channels[name]; !ok {
+				return fmt.Errorf("notify route %d: unknown channel %q", i+1, name)
+			}
+		}
+		for _, rule := range route.Rules {
+			if !containsStringCI(rule, knownRuleCodes) {
+				return fmt.Errorf("notify route %d: unknown rule %q (want one of %s)", i+1, rule, strings.Join(knownRuleCodes, ", "))
+			}
+		}
+		if route.MinSeverity != nil && route.MaxSeverity != nil && *route.MinSeverity > *route.MaxSeverity {
+			return fmt.Errorf("notify route %d: min_severity above max_severity", i+1)
+		}
+	}
+	for _, name := range n.Alerts {
+		if _, ok := n.Channels[name]; !ok {
+			return fmt.Errorf("notify alerts: unknown channel %q", name)
+		}
+	}
+	return nil
+}
+
+func (r NotifyRoute) matches(suspect Suspicion, vhost string) bool {
+	if r.MinSeverity != nil && suspect.Severity < *r.MinSeverity {
+		return false
+	}
+	if r.MaxSeverity != nil && suspect.Severity > *r.MaxSeverity {
+		return false
+	}
+	if len(r.Countries) > 0 {
+		country := ""
+		if suspect.Stats != nil {
+			country = suspect.Stats.CountryISO
+		}
+		if country == "" || !containsStringCI(country, r.Countries) {
+			return false
+		}
+	}
+	if len(r.Rules) > 0 {
+		matched := false
+		for _, rule := range suspect.Rules {
+			if containsStringCI(rule, r.Rules) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Vhosts) > 0 && (vhost == "" || !containsStringCI(vhost, r.Vhosts)) {
+		return false
+	}
+	return true
+}
+
+// routeNotifications groups suspects by the channels of every route they match.
+func routeNotifications(cfg NotifyConfig, suspects []Suspicion, vhost string) map[string][]Suspicion {
+	routed := make(map[string][]Suspicion)
+	for _, suspect := range suspects {
+		seen := make(map[string]bool)
+		for _, route := range cfg.Routes {
+			if !route.matches(suspect, vhost) {
+				continue
+			}
+			for _, name := range route.Channels {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				routed[name] = append(routed[name], suspect)
+			}
+		}
+	}
+	return routed
+}
+
+// sendNotifications delivers routed suspects; delivery failures are recorded in problems, not fatal.
+func sendNotifications(cfg NotifyConfig, run RunInfo, vhost string, suspects []Suspicion, problems *Problems) {
+	routed := routeNotifications(cfg, suspects, vhost)
+	names := make([]string, 0, len(routed))
+	for name := range routed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, name := range names {
+		channel := cfg.Channels[name]
+		body, err := notificationBody(channel, name, run, vhost, routed[name])
+		if err != nil {
+			problems.Add(ProblemNotify, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if err := postJSON(client, channel.URL, nil, body); err != nil {
+			problems.Add(ProblemNotify, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		log.Printf("notified %s of %d suspects", name, len(routed[name]))
+	}
+}
+
+// sendNewIPAlert tells the alert channels about spikes of new IPs; delivery
+// failures are recorded in problems, not fatal.
+func sendNewIPAlert(cfg NotifyConfig, run RunInfo, vhost string, spikes []NewIPSpike, problems *Problems) {
+	sendAlert(cfg, "a suspected distributed attack", problems, func(channel NotifyChannel, name string) ([]byte, error) {
+		return alertBody(channel, name, run, vhost, spikes)
+	})
+}
+
+// sendReloadAlert tells the alert channels that nginx rejected the deny
+// files, which were restored; delivery failures are recorded in problems.
+func sendReloadAlert(cfg NotifyConfig, run RunInfo, vhost string, reloadErr error, problems *Problems) {
+	sendAlert(cfg, "a failed nginx reload", problems, func(channel NotifyChannel, name string) ([]byte, error) {
+		return reloadAlertBody(channel, name, run, vhost, reloadErr)
+	})
+}
+
+// sendAlert posts the body built for each alert channel.
+func sendAlert(cfg NotifyConfig, what string, problems *Problems, body func(channel NotifyChannel, name string) ([]byte, error)) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, name := range cfg.Alerts {
+		data, err := body(cfg.Channels[name], name)
+		if err != nil {
+			problems.Add(ProblemNotify, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if err := postJSON(client, cfg.Channels[name].URL, nil, data); err != nil {
+			problems.Add(ProblemNotify, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		log.Printf("notified %s of %s", name, what)
+	}
+}
+
+func alertBody(channel NotifyChannel, name string, run RunInfo, vhost string, spikes []NewIPSpike) ([]byte, error) {
+	if channel.Type == notifySlack {
+		var b strings.Builder
+		fmt.Fprintf(&b, "botdeny run %s: distributed attack suspected", run.ID)
+		if vhost != "" {
+			fmt.Fprintf(&b, " on %s", vhost)
+		}
+		for _, spike := range spikes {
+			fmt.Fprintf(&b, "\n• %s", spike.describe())
+		}
+		return json.Marshal(map[string]string{"text": b.String()})
+	}
+	payload := NotifyAlert{
+		RunID:   run.ID,
+		Window:  run.Window(),
+		Vhost:   vhost,
+		Channel: name,
+		Alert:   "distributed_attack",
+		Spikes:  make([]NotifyNewIPs, 0, len(spikes)),
+	}
+	for _, spike := range spikes {
+		payload.Spikes = append(payload.Spikes, NotifyNewIPs{Minute: spike.Minute.UTC(), NewIPs: spike.NewIPs, Baseline: spike.Baseline})
+	}
+	return json.Marshal(payload)
+}
+
+func reloadAlertBody(channel NotifyChannel, name string, run RunInfo, vhost string, reloadErr error) ([]byte, error) {
+	if channel.Type == notifySlack {
+		var b strings.Builder
+		fmt.Fprintf(&b, "botdeny run %s: CRITICAL nginx rejected the deny file", run.ID)
+		if vhost != "" {
+			fmt.Fprintf(&b, " on %s", vhost)
+		}
+		fmt.Fprintf(&b, "\n```%s```", reloadErr)
+		return json.Marshal(map[string]string{"text": b.String()})
+	}
+	return json.Marshal(NotifyAlert{
+		RunID:    run.ID,
+		Window:   run.Window(),
+		Vhost:    vhost,
+		Channel:  name,
+		Alert:    "reload_failed",
+		Severity: SeverityCritical,
+		Detail:   reloadErr.Error(),
+	})
+}
+
+func notificationBody(channel NotifyChannel, name string, run RunInfo, vhost string, suspects []Suspicion) ([]byte, error) {
+	if channel.Type == notifySlack {
+		return json.Marshal(map[string]string{"text": slackText(run, vhost, suspects)})
+	}
+	payload := NotifyPayload{
+		RunID:    run.ID,
+		Window:   run.Window(),
+		Vhost:    vhost,
+		Channel:  name,
+		Suspects: make([]NotifySuspicion, 0, len(suspects)),
+	}
+	for _, suspect := range suspects {
+		entry := NotifySuspicion{
+			IP:       suspect.IP,
+			Score:    suspect.Score,
+			Severity: suspect.Severity,
+			Rules:    suspect.Rules,
+			Reasons:  suspect.Reasons,
+		}
+		if suspect.Stats != nil {
+			entry.Country = suspect.Stats.CountryISO
+			if len(suspect.Stats.Sources) > 0 {
+				entry.Sources = sourceNames(suspect.Stats)
+			}
+			if len(suspect.Stats.Backends) > 0 {
+				entry.Backends = backendNames(suspect.Stats)
+			}
+			if len(suspect.Stats.Hosts) > 0 {
+				entry.Hosts = hostNames(suspect.Stats)
+			}
+			entry.Annotation = suspect.Stats.Annotation
+			entry.FirstLines = suspect.Stats.FirstLines()
+			entry.LastLines = suspect.Stats.LastLines()
+		}
+		payload.Suspects = append(payload.Suspects, entry)
+	}
+	return json.Marshal(payload)
+}
+
+func slackText(run RunInfo, vhost string, suspects []Suspicion) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "botdeny run %s blocked %d IPs", run.ID, len(suspects))
+	if vhost != "" {
+		fmt.Fprintf(&b, " on %s", vhost)
+	}
+	fmt.Fprintf(&b, " (window %s)", run.Window())
+	for i, suspect := range suspects {
+		if i == notifyMaxLines {
+			fmt.Fprintf(&b, "\n… and %d more", len(suspects)-i)
+			break
+		}
+		country := "-"
+		if suspect.Stats != nil && suspect.Stats.CountryISO != "" {
+			country = suspect.Stats.CountryISO
+		}
+		fmt.Fprintf(&b, "\n• %s %s score=%d country=%s: %s", suspect.IP, suspect.Severity, suspect.Score, country, strings.Join(suspect.Reasons, "; "))
+	}
+	return b.String()
+}
+
+func postJSON(client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const notifyYAML = `
+channels:
+  pager:
+    type: webhook
+    url: http://pager.invalid
+  chat:
+    type: slack
+    url: http://chat.invalid
+routes:
+  - min_severity: critical
+    channels: [pager]
+  - min_severity: medium
+    max_severity: high
+    channels: [chat]
+  - rules: [honeytoken]
+    countries: [CN]
+    channels: [pager, chat]
+`
+
+func TestRouteNotifications(t *testing.T) {
+	var cfg NotifyConfig
+	if err := yaml.Unmarshal([]byte(notifyYAML), &cfg); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	suspects := []Suspicion{
+		{IP: "192.0.2.1", Severity: SeverityCritical, Stats: &IPStats{}},
+		{IP: "192.0.2.2", Severity: SeverityMedium, Stats: &IPStats{}},
+		{IP: "192.0.2.3", Severity: SeverityLow, Stats: &IPStats{}},
+		{IP: "192.0.2.4", Severity: SeverityLow, Rules: []string{RuleHoneytoken}, Stats: &IPStats{CountryISO: "CN"}},
+	}
+	routed := routeNotifications(cfg, suspects, "")
+
+	ips := func(list []Suspicion) string {
+		out := make([]string, 0, len(list))
+		for _, s := range list {
+			out = append(out, s.IP)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := ips(routed["pager"]); got != "192.0.2.1,192.0.2.4" {
+		t.Fatalf("unexpected pager suspects: %s", got)
+	}
+	if got := ips(routed["chat"]); got != "192.0.2.2,192.0.2.4" {
+		t.Fatalf("unexpected chat suspects: %s", got)
+	}
+}
+
+func TestNotifyRouteMatchesVhost(t *testing.T) {
+	route := NotifyRoute{Vhosts: []string{"shop.example.com"}, Channels: []string{"chat"}}
+	suspect := Suspicion{IP: "192.0.2.1"}
+	if route.matches(suspect, "") || route.matches(suspect, "blog.example.com") {
+		t.Fatalf("expected vhost condition to reject other vhosts")
+	}
+	if !route.matches(suspect, "Shop.example.com") {
+		t.Fatalf("expected vhost condition to match case-insensitively")
+	}
+}
+
+func TestNotifyConfigValidate(t *testing.T) {
+	cases := map[string]NotifyConfig{
+		"unknown channel": {Routes: []NotifyRoute{{Channels: []string{"missing"}}}},
+		"unknown type":    {Channels: map[string]NotifyChannel{"x": {Type: "email", URL: "http://x"}}},
+		"missing url":     {Channels: map[string]NotifyChannel{"x": {Type: "slack"}}},
+		"unknown rule": {
+			Channels: map[string]NotifyChannel{"x": {Type: "slack", URL: "http://x"}},
+			Routes:   []NotifyRoute{{Rules: []string{"bogus"}, Channels: []string{"x"}}},
+		},
+		"unknown alert channel": {Alerts: []string{"missing"}},
+	}
+	for name, cfg := range cases {
+		if err := cfg.validate(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
+
+func TestSendNotificationsPostsPayloads(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies = make(map[string]map[string]any)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := NotifyConfig{
+		Channels: map[string]NotifyChannel{
+			"hook": {Type: notifyWebhook, URL: server.URL + "/hook"},
+			"chat": {Type: notifySlack, URL: server.URL + "/chat"},
+		},
+		Routes: []NotifyRoute{{Channels: []string{"hook", "chat"}}},
+	}
+	now := time.Now()
+	run := RunInfo{ID: "run-7", WindowStart: now, WindowEnd: now}
+	suspects := []Suspicion{{IP: "192.0.2.9", Score: 6, Severity: SeverityCritical, Rules: []string{RuleBurst}, Reasons: []string{"burst 90 req in 1m0s"}}}
+	sendNotifications(cfg, run, "shop", suspects, nil)
+
+	hook := bodies["/hook"]
+	if hook["run_id"] != "run-7" || hook["vhost"] != "shop" {
+		t.Fatalf("unexpected webhook payload: %v", hook)
+	}
+	entries, _ := hook["suspects"].([]any)
+	if len(entries) != 1 || entries[0].(map[string]any)["severity"] != "critical" {
+		t.Fatalf("unexpected webhook suspects: %v", hook["suspects"])
+	}
+	text, _ := bodies["/chat"]["text"].(string)
+	if !strings.Contains(text, "run-7") || !strings.Contains(text, "192.0.2.9 critical") {
+		t.Fatalf("unexpected slack text: %q", text)
+	}
+}
+
+func TestSendNewIPAlertPostsPayloads(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies = make(map[string]map[string]any)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		bodies[r.URL.Path] = body
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := NotifyConfig{
+		Channels: map[string]NotifyChannel{
+			"hook":  {Type: notifyWebhook, URL: server.URL + "/hook"},
+			"chat":  {Type: notifySlack, URL: server.URL + "/chat"},
+			"quiet": {Type: notifySlack, URL: server.URL + "/quiet"},
+		},
+		Alerts: []string{"hook", "chat"},
+	}
+	minute := time.Date(2025, 10, 19, 12, 4, 0, 0, time.UTC)
+	sendNewIPAlert(cfg, RunInfo{ID: "run-8"}, "shop", []NewIPSpike{{Minute: minute, NewIPs: 340, Baseline: 12}}, nil)
+
+	hook := bodies["/hook"]
+	spikes, _ := hook["spikes"].([]any)
+	if hook["alert"] != "distributed_attack" || hook["vhost"] != "shop" || len(spikes) != 1 || spikes[0].(map[string]any)["new_ips"] != 340.0 {
+		t.Fatalf("unexpected webhook payload: %v", hook)
+	}
+	text, _ := bodies["/chat"]["text"].(string)
+	if !strings.Contains(text, "distributed attack suspected on shop") || !strings.Contains(text, "340 new IPs in the minute from 2025-10-19 12:04") {
+		t.Fatalf("unexpected slack text: %q", text)
+	}
+	if _, ok := bodies["/quiet"]; ok {
+		t.Fatal("expected only the alert channels to be notified")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import "sync"
+
+// parseBatchLines is how many lines a parse worker takes at a time, so that
+// channel overhead stays small next to the regex work.
+const parseBatchLines = 256
+
+// parsePool parses the lines of one stream on several goroutines and hands
+// the results to emit in log order. Each batch's result channel is queued in
+// pending as the batch is read, and the merger waits on them in that order.
+type parsePool struct {
+	batch   []streamLine
+	jobs    chan parseJob
+	pending chan chan []streamLine
+	// done is closed when emit fails and the merger stops early.
+	done    chan struct{}
+	merged  chan struct{}
+	err     error
+	workers sync.WaitGroup
+}
+
+type parseJob struct {
+	lines  []streamLine
+	result chan []streamLine
+}
+
+func startParsePool(format *LogFormat, opts StreamOptions, emit func(streamLine) error) *parsePool {
+	p := &parsePool{
+		batch:   make([]streamLine, 0, parseBatchLines),
+		jobs:    make(chan parseJob, opts.Workers),
+		pending: make(chan chan []streamLine, 2*opts.Workers),
+		done:    make(chan struct{}),
+		merged:  make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				for i, line := range job.lines {
+					job.lines[i] = parseStreamLine(format, opts, line.no, line.line)
+				}
+				job.result <- job.lines
+			}
+		}()
+	}
+	go p.merge(emit)
+	return p
+}
+
+func (p *parsePool) merge(emit func(streamLine) error) {
+	defer close(p.merged)
+	for result := range p.pending {
+		for _, parsed := range <-result {
+			if err := emit(parsed); err != nil {
+				p.err = err
+				close(p.done)
+				return
+			}
+		}
+	}
+}
+
+// Add queues a line for parsing. It returns false once the merger stopped,
+// after which the stream should stop reading.
+func (p *parsePool) Add(no int, line string) bool {
+	p.batch = append(p.batch, streamLine{no: no, line: line})
+	if len(p.batch) < parseBatchLines {
+		return true
+	}
+	return p.flush()
+}
+
+func (p *parsePool) flush() bool {
+	job := parseJob{lines: p.batch, result: make(chan []streamLine, 1)}
+	p.batch = make([]streamLine, 0, parseBatchLines)
+	select {
+	case p.pending <- job.result:
+	case <-p.done:
+		return false
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// Close parses the lines still queued, waits for them to be emitted and
+// returns the error that stopped the merger, if any.
+func (p *parsePool) Close() error {
+	if len(p.batch) > 0 {
+		p.flush()
+	}
+	close(p.pending)
+	close(p.jobs)
+	<-p.merged
+	p.workers.Wait()
+	return p.err
+}
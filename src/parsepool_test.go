@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamAll collects what StreamWith delivers for input.
+func streamAll(t *testing.T, input string, opts StreamOptions) ([]Entry, []string, error) {
+	t.Helper()
+	var rejected []string
+	opts.OnUnparsed = func(line string, _ error) { rejected = append(rejected, line) }
+	entries, errs := StreamWith(strings.NewReader(input), opts)
+	var got []Entry
+	for entry := range entries {
+		got = append(got, entry)
+	}
+	return got, rejected, <-errs
+}
+
+func TestParallelStreamKeepsLogOrder(t *testing.T) {
+	var lines strings.Builder
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5*parseBatchLines+17; i++ {
+		if i%97 == 0 {
+			fmt.Fprintf(&lines, "garbage %d\n", i)
+			continue
+		}
+		fmt.Fprintf(&lines, "192.0.2.%d - - [%s] \"GET /page/%d HTTP/1.1\" 200 512 \"-\" \"agent\"\n", i%250+1, start.Add(time.Duration(i)*time.Second).Format(timeLayout), i)
+	}
+
+	want, wantRejected, err := streamAll(t, lines.String(), StreamOptions{})
+	if err != nil {
+		t.Fatalf("sequential stream: %v", err)
+	}
+	got, gotRejected, err := streamAll(t, lines.String(), StreamOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("parallel stream: %v", err)
+	}
+	if len(got) != len(want) || len(gotRejected) != len(wantRejected) {
+		t.Fatalf("expected %d entries and %d rejects, got %d and %d", len(want), len(wantRejected), len(got), len(gotRejected))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("entry %d differs:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+	for i := range wantRejected {
+		if gotRejected[i] != wantRejected[i] {
+			t.Fatalf("reject %d differs: got %q, want %q", i, gotRejected[i], wantRejected[i])
+		}
+	}
+}
+
+func TestParallelStreamStopsAtFirstRejectedLine(t *testing.T) {
+	line := "192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] \"GET / HTTP/1.1\" 200 0 \"-\" \"agent\"\n"
+	input := strings.Repeat(line, 3*parseBatchLines) + "garbage\n" + strings.Repeat(line, 3*parseBatchLines)
+
+	got, _, err := streamAll(t, input, StreamOptions{Workers: 4, Strict: true})
+	if want := fmt.Sprintf("line %d:", 3*parseBatchLines+1); err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("expected an error starting with %q, got %v", want, err)
+	}
+	if len(got) != 3*parseBatchLines {
+		t.Fatalf("expected the %d entries before the rejected line, got %d", 3*parseBatchLines, len(got))
+	}
+}
+
+func TestParallelStreamParsesSessionFormatsInOrder(t *testing.T) {
+	got, rejected, err := streamAll(t, iisLog, StreamOptions{Workers: 4})
+	if err != nil || len(rejected) != 0 {
+		t.Fatalf("stream: %v, rejected %q", err, rejected)
+	}
+	if len(got) != 1 || got[0].Host != "shop.example.com" {
+		t.Fatalf("expected the IIS entry with its #Fields columns, got %+v", got)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	peerPath            = "/v1/suspects"
+	peerSignatureHeader = "X-Botdeny-Signature"
+	peerTimestampHeader = "X-Botdeny-Timestamp"
+	peerMaxClockSkew    = 5 * time.Minute
+)
+
+// PeerList is the suspect list exchanged between botdeny instances.
+type PeerList struct {
+	Node        string          `json:"node"`
+	RunID       string          `json:"run_id"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Suspects    []PeerSuspicion `json:"suspects"`
+}
+
+// PeerSuspicion is a single suspect shared with peers.
+type PeerSuspicion struct {
+	IP       string   `json:"ip"`
+	Score    int      `json:"score"`
+	Severity Severity `json:"severity"`
+	Reasons  []string `json:"reasons"`
+	Sources  []string `json:"sources,omitempty"`
+}
+
+func newPeerList(run RunInfo, suspects []Suspicion) PeerList {
+	node, _ := os.Hostname()
+	list := PeerList{
+		Node:        node,
+		RunID:       run.ID,
+		GeneratedAt: time.Now().UTC(),
+		Suspects:    make([]PeerSuspicion, 0, len(suspects)),
+	}
+	for _, suspect := range suspects {
+		entry := PeerSuspicion{
+			IP:       suspect.IP,
+			Score:    suspect.Score,
+			Severity: suspect.Severity,
+			Reasons:  suspect.Reasons,
+		}
+		if suspect.Stats != nil && len(suspect.Stats.Sources) > 0 {
+			entry.Sources = sourceNames(suspect.Stats)
+		}
+		list.Suspects = append(list.Suspects, entry)
+	}
+	return list
+}
+
+// writePeerList stores the suspects of a run for `botdeny peer serve` to publish.
+func writePeerList(path string, run RunInfo, suspects []Suspicion) error {
+	data, err := json.MarshalIndent(newPeerList(run, suspects), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func signPeerPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// peerResponsePayload is what a peer signs in its response: the request
+// timestamp and the body, so a captured list cannot be replayed to a later
+// request.
+func peerResponsePayload(timestamp string, body []byte) []byte {
+	return append([]byte(timestamp+"\n"), body...)
+}
+
+func verifyPeerPayload(secret string, payload []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// peerHandler serves the peer list file to requests signed with the shared secret.
+func peerHandler(listPath, secret string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(peerPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		timestamp := r.Header.Get(peerTimestampHeader)
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(unix, 0)).Abs() > peerMaxClockSkew {
+			http.Error(w, "stale or missing timestamp", http.StatusUnauthorized)
+			return
+		}
+		if !verifyPeerPayload(secret, []byte(timestamp), r.Header.Get(peerSignatureHeader)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		data, err := os.ReadFile(listPath)
+		if errors.Is(err, os.ErrNotExist) {
+			data, _ = json.Marshal(PeerList{Suspects: []PeerSuspicion{}})
+		} else if err != nil {
+			http.Error(w, "peer list unavailable", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(peerSignatureHeader, signPeerPayload(secret, peerResponsePayload(timestamp, data)))
+		w.Write(data)
+	})
+	return mux
+}
+
+// fetchPeerList downloads and authenticates the suspect list published by a peer.
+func fetchPeerList(ctx context.Context, client *http.Client, baseURL, secret string) (PeerList, error) {
+	var list PeerList
+	endpoint, err := url.JoinPath(baseURL, peerPath)
+	if err != nil {
+		return list, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return list, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(peerTimestampHeader, timestamp)
+	req.Header.Set(peerSignatureHeader, signPeerPayload(secret, []byte(timestamp)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return list, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return list, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return list, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	if !verifyPeerPayload(secret, peerResponsePayload(timestamp, body), resp.Header.Get(peerSignatureHeader)) {
+		return list, errors.New("peer response signature mismatch")
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return list, fmt.Errorf("decode peer list: %w", err)
+	}
+	return list, nil
+}
+
+// fetchPeerReports collects suspect IPs from all peers, keyed by IP with the reporting peer as value.
+// Unreachable peers are logged and skipped so one broken node cannot stall a run.
+func fetchPeerReports(peers []string, secret string, timeout time.Duration) map[string]string {
+	reports := make(map[string]string)
+	client := &http.Client{Timeout: timeout}
+	for _, peer := range peers {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		list, err := fetchPeerList(ctx, client, peer, secret)
+		cancel()
+		if err != nil {
+			log.Printf("fetch peer %s: %v", peer, err)
+			continue
+		}
+		source := list.Node
+		if source == "" {
+			source = peer
+		}
+		for _, suspect := range list.Suspects {
+			if !isValidIP(suspect.IP) {
+				continue
+			}
+			if _, ok := reports[suspect.IP]; !ok {
+				reports[suspect.IP] = source
+			}
+		}
+	}
+	return reports
+}
+
+// runPeer implements `botdeny peer serve`.
+func runPeer(args []string) int {
+	if len(args) == 0 || args[0] != "serve" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny peer serve --list peer.json --secret SECRET [--listen :8443] (--tls-cert cert.pem --tls-key key.pem | --insecure-http)")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("peer serve", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	listen := fs.String("listen", ":8443", "address to listen on")
+	listPath := fs.String("list", "", "peer list written by --peer-export")
+	secret := fs.String("secret", "", "shared secret used to sign requests and responses")
+	certFile := fs.String("tls-cert", "", "TLS certificate (PEM)")
+	keyFile := fs.String("tls-key", "", "TLS private key (PEM)")
+	insecureHTTP := fs.Bool("insecure-http", false, "serve plain HTTP without --tls-cert and --tls-key, e.g. behind a TLS proxy")
+	fs.Parse(args[1:])
+
+	_, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *listPath == "" {
+		*listPath = defaults.PeerExport
+	}
+	if *secret == "" {
+		*secret = defaults.PeerSecret
+	}
+	if *listPath == "" || *secret == "" {
+		fmt.Fprintln(os.Stderr, "peer serve requires --list and --secret (or peer_export and peer_secret in the config)")
+		return 2
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		fmt.Fprintln(os.Stderr, "peer serve requires both --tls-cert and --tls-key")
+		return 2
+	}
+	if *certFile == "" && !*insecureHTTP {
+		fmt.Fprintln(os.Stderr, "peer serve requires --tls-cert and --tls-key; pass --insecure-http to serve plain HTTP")
+		return 2
+	}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           peerHandler(*listPath, *secret),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("serving peer list %s on %s", *listPath, *listen)
+	if *certFile != "" {
+		err = server.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		log.Print("warning: serving peer list without TLS")
+		err = server.ListenAndServe()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "peer serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
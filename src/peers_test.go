@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeerExchangeRoundTrip(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "peer.json")
+	suspects := []Suspicion{{IP: "192.0.2.44", Score: 5, Severity: SeverityHigh, Reasons: []string{"burst"}}}
+	if err := writePeerList(listPath, RunInfo{ID: "run-1"}, suspects); err != nil {
+		t.Fatalf("writePeerList: %v", err)
+	}
+
+	server := httptest.NewServer(peerHandler(listPath, "s3cret"))
+	defer server.Close()
+
+	list, err := fetchPeerList(context.Background(), server.Client(), server.URL, "s3cret")
+	if err != nil {
+		t.Fatalf("fetchPeerList: %v", err)
+	}
+	if len(list.Suspects) != 1 || list.Suspects[0].IP != "192.0.2.44" || list.RunID != "run-1" {
+		t.Fatalf("unexpected peer list: %+v", list)
+	}
+
+	if _, err := fetchPeerList(context.Background(), server.Client(), server.URL, "wrong"); err == nil {
+		t.Fatalf("expected wrong secret to be rejected")
+	}
+
+	reports := fetchPeerReports([]string{server.URL}, "s3cret", time.Second)
+	if reports["192.0.2.44"] == "" {
+		t.Fatalf("expected peer report for suspect, got %v", reports)
+	}
+}
+
+func TestFetchPeerListRejectsReplayedResponses(t *testing.T) {
+	// A response signed for another request, as a replay would be.
+	body := []byte(`{"suspects":[{"ip":"192.0.2.44"}]}`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(peerSignatureHeader, signPeerPayload("s3cret", peerResponsePayload("1700000000", body)))
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	if _, err := fetchPeerList(context.Background(), server.Client(), server.URL, "s3cret"); err == nil {
+		t.Fatal("expected a response signed for another timestamp to be rejected")
+	}
+}
+
+func TestRunPeerRequiresTLS(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "peer.json")
+	if code := runPeer([]string{"serve", "--list", list, "--secret", "s3cret", "--listen", "127.0.0.1:0"}); code != 2 {
+		t.Fatalf("expected peer serve without TLS to be refused, got exit %d", code)
+	}
+}
+
+func TestPeerHandlerRejectsUnsignedRequests(t *testing.T) {
+	server := httptest.NewServer(peerHandler(filepath.Join(t.TempDir(), "missing.json"), "s3cret"))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + peerPath)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+}
+
+func TestAnalyzerGreylistsPeerReports(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.PeerReports = map[string]string{"192.0.2.44": "edge-2"}
+
+	analyzer := New(cfg, nil)
+	analyzer.Process(Entry{ClientIP: "192.0.2.44", Time: time.Now(), URI: "/", Status: 200})
+
+	suspect, _, _ := analyzer.Explain("192.0.2.44")
+	if suspect.Score != 1 || suspect.Reasons[0] != "reported by peer edge-2" {
+		t.Fatalf("expected peer greylist point, got %d %v", suspect.Score, suspect.Reasons)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+)
+
+// ProblemKind groups non-fatal problems in the end-of-run summary.
+type ProblemKind string
+
+const (
+	ProblemUnparsed  ProblemKind = "unparsed lines"
+	ProblemGeoLookup ProblemKind = "geo lookups"
+	ProblemGeoDB     ProblemKind = "geoip database"
+	ProblemAllowFile ProblemKind = "allow files"
+	ProblemAllowList ProblemKind = "allow sources"
+	ProblemNotify    ProblemKind = "notifications"
+	ProblemSyslog    ProblemKind = "syslog senders"
+	ProblemReload    ProblemKind = "nginx reload"
+)
+
+// maxProblemExamples bounds how many details are kept per kind.
+const maxProblemExamples = 3
+
+// Problems collects non-fatal problems of a run so they are reported once,
+// with counts, instead of as scattered log lines. It is safe for concurrent
+// use. A nil Problems logs each problem as it happens.
+type Problems struct {
+	mu       sync.Mutex
+	counts   map[ProblemKind]int
+	examples map[ProblemKind][]string
+}
+
+func newProblems() *Problems {
+	return &Problems{
+		counts:   make(map[ProblemKind]int),
+		examples: make(map[ProblemKind][]string),
+	}
+}
+
+// Add records one problem of the given kind.
+func (p *Problems) Add(kind ProblemKind, detail string) {
+	if p == nil {
+		log.Printf("%s: %s", kind, detail)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[kind]++
+	if len(p.examples[kind]) < maxProblemExamples {
+		p.examples[kind] = append(p.examples[kind], detail)
+	}
+}
+
+// Count returns how many problems of kind were recorded.
+func (p *Problems) Count(kind ProblemKind) int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.counts[kind]
+}
+
+// Print writes the summary, one kind per line followed by its first examples.
+// Nothing is written when no problems were recorded.
+func (p *Problems) Print(w io.Writer) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.counts) == 0 {
+		return
+	}
+	kinds := make([]ProblemKind, 0, len(p.counts))
+	for kind := range p.counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	fmt.Fprintln(w, "non-fatal problems:")
+	for _, kind := range kinds {
+		fmt.Fprintf(w, "  %-16s %d\n", kind, p.counts[kind])
+		for _, example := range p.examples[kind] {
+			fmt.Fprintf(w, "    %s\n", example)
+		}
+		if more := p.counts[kind] - len(p.examples[kind]); more > 0 {
+			fmt.Fprintf(w, "    ... and %d more\n", more)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProblemsSummary(t *testing.T) {
+	problems := newProblems()
+	var empty bytes.Buffer
+	problems.Print(&empty)
+	if empty.Len() != 0 {
+		t.Fatalf("expected no output without problems, got %q", empty.String())
+	}
+
+	for i := 0; i < 5; i++ {
+		problems.Add(ProblemUnparsed, fmt.Sprintf("line %d", i))
+	}
+	problems.Add(ProblemNotify, "hook: 500 Internal Server Error")
+
+	var out bytes.Buffer
+	problems.Print(&out)
+	want := `non-fatal problems:
+  notifications    1
+    hook: 500 Internal Server Error
+  unparsed lines   5
+    line 0
+    line 1
+    line 2
+    ... and 2 more
+`
+	if out.String() != want {
+		t.Fatalf("unexpected summary:\n%s", out.String())
+	}
+	if !strings.Contains(unparsedDetail(strings.Repeat("x", 500), fmt.Errorf("bad")), "...") {
+		t.Fatal("expected long unparsed lines to be shortened")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// withProfile overlays the named entry of the profiles section onto the base
+// config. Output and state paths the profile inherits from the base are
+// suffixed with the profile name so profiles sharing a host never share files.
+func (fc FileConfig) withProfile(name string) (FileConfig, error) {
+	if name == "" {
+		return fc, nil
+	}
+	node, ok := fc.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(fc.Profiles))
+		for defined := range fc.Profiles {
+			names = append(names, defined)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fc, fmt.Errorf("unknown profile %q: config has no profiles section", name)
+		}
+		return fc, fmt.Errorf("unknown profile %q (defined: %s)", name, strings.Join(names, ", "))
+	}
+
+	var own FileConfig
+	if err := node.Decode(&own); err != nil {
+		return fc, fmt.Errorf("profile %s: %w", name, err)
+	}
+	merged := fc
+	if err := node.Decode(&merged); err != nil {
+		return fc, fmt.Errorf("profile %s: %w", name, err)
+	}
+	merged.Profiles = nil
+
+	inherited := []struct {
+		own    string
+		target *string
+	}{
+		{own.StateDB, &merged.StateDB},
+		{own.DenyOutput, &merged.DenyOutput},
+		{own.BlockLog, &merged.BlockLog},
+		{own.PeerExport, &merged.PeerExport},
+		{own.CaptureUnparsed, &merged.CaptureUnparsed},
+		{own.DeadLetter, &merged.DeadLetter},
+		{own.CanaryOutput, &merged.CanaryOutput},
+	}
+	for _, path := range inherited {
+		if path.own == "" && *path.target != "" {
+			*path.target = profilePath(*path.target, name)
+		}
+	}
+	if merged.Vhost == "" {
+		merged.Vhost = name
+	}
+	return merged, nil
+}
+
+// profilePath inserts the profile name before the extension: state.json becomes state-blog.json.
+func profilePath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesYAML = `
+min_requests: 50
+state_db: /var/lib/botdeny/state.json
+deny_output: /etc/nginx/botdeny.conf
+block_log: /var/log/botdeny/blocked.log
+profiles:
+  blog:
+    file: /var/log/nginx/blog.log
+    min_requests: 20
+  api:
+    file: /var/log/nginx/api.log
+    vhost: api.example.com
+    deny_output: /etc/nginx/api-deny.conf
+`
+
+func TestLoadConfigForProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(profilesYAML), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, defaults, err := loadConfigForCommand(path, "blog")
+	if err != nil {
+		t.Fatalf("load blog: %v", err)
+	}
+	if cfg.MinRequests != 20 || defaults.File != "/var/log/nginx/blog.log" {
+		t.Fatalf("profile overrides not applied: min_requests=%d file=%s", cfg.MinRequests, defaults.File)
+	}
+	if defaults.StateDB != "/var/lib/botdeny/state-blog.json" || defaults.DenyOutput != "/etc/nginx/botdeny-blog.conf" || defaults.BlockLog != "/var/log/botdeny/blocked-blog.log" {
+		t.Fatalf("inherited paths not namespaced: %s %s %s", defaults.StateDB, defaults.DenyOutput, defaults.BlockLog)
+	}
+	if defaults.Vhost != "blog" {
+		t.Fatalf("expected vhost to default to profile name, got %q", defaults.Vhost)
+	}
+
+	cfg, defaults, err = loadConfigForCommand(path, "api")
+	if err != nil {
+		t.Fatalf("load api: %v", err)
+	}
+	if cfg.MinRequests != 50 || defaults.DenyOutput != "/etc/nginx/api-deny.conf" || defaults.Vhost != "api.example.com" {
+		t.Fatalf("unexpected api profile: min_requests=%d deny=%s vhost=%s", cfg.MinRequests, defaults.DenyOutput, defaults.Vhost)
+	}
+
+	_, defaults, err = loadConfigForCommand(path, "")
+	if err != nil {
+		t.Fatalf("load base: %v", err)
+	}
+	if defaults.StateDB != "/var/lib/botdeny/state.json" || defaults.File != "access.log" {
+		t.Fatalf("base config changed without profile: %s %s", defaults.StateDB, defaults.File)
+	}
+
+	if _, _, err := loadConfigForCommand(path, "shop"); err == nil || !strings.Contains(err.Error(), "api, blog") {
+		t.Fatalf("expected unknown profile error listing profiles, got %v", err)
+	}
+	if _, _, err := loadConfigForCommand("", "blog"); err == nil {
+		t.Fatal("expected error for profile without config")
+	}
+}
+
+func TestDetectProfileName(t *testing.T) {
+	cases := map[string][]string{
+		"blog": {"--config", "c.yaml", "--profile-name", "blog"},
+		"api":  {"--profile-name=api"},
+		"":     {"--config", "c.yaml"},
+	}
+	for want, args := range cases {
+		if got := detectProfileName(args); got != want {
+			t.Fatalf("detectProfileName(%v) = %q, want %q", args, got, want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import "strings"
+
+// maxQueryPaths bounds the paths whose query strings are tracked per IP and
+// maxQueryVariants the distinct query strings kept per path, so a fuzzer
+// cannot grow IPStats without limit.
+const (
+	maxQueryPaths    = 100
+	maxQueryVariants = 1000
+)
+
+// recordQuery counts the distinct query strings an IP sends to a path. key
+// is the request as keyed by normalizePath, so encodings of one query and
+// session IDs do not make new variants.
+func (s *IPStats) recordQuery(key string) {
+	path, query, ok := strings.Cut(key, "?")
+	if !ok || query == "" {
+		return
+	}
+	if s.queryVariants == nil {
+		s.queryVariants = make(map[string]map[string]struct{})
+	}
+	variants, ok := s.queryVariants[path]
+	if !ok {
+		if len(s.queryVariants) >= maxQueryPaths {
+			return
+		}
+		variants = make(map[string]struct{})
+		s.queryVariants[path] = variants
+	}
+	if len(variants) < maxQueryVariants {
+		variants[query] = struct{}{}
+	}
+}
+
+// fuzzedPath returns the path the IP sent the most distinct query strings
+// to, and how many.
+func (s *IPStats) fuzzedPath() (string, int) {
+	best, most := "", 0
+	for path, variants := range s.queryVariants {
+		if n := len(variants); n > most || (n == most && path < best) {
+			best, most = path, n
+		}
+	}
+	return best, most
+}
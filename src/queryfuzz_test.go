@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzerFlagsQueryFuzzing(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinQueryVariants = 50
+	a := New(cfg, nil)
+	now := time.Now()
+
+	// A fuzzer guessing parameter names on one endpoint, always on the same path.
+	for i := 0; i < 60; i++ {
+		a.Process(Entry{Time: now, ClientIP: "198.51.100.9", RemoteAddr: "198.51.100.9", Status: 400, URI: fmt.Sprintf("/api/report?p%d=1", i)})
+	}
+	// The same query under other encodings and sessions counts once.
+	for _, uri := range []string{"/API/report?p0=1", "/api/report?p0=1&PHPSESSID=f00", "/api/report?p%30=1"} {
+		a.Process(Entry{Time: now, ClientIP: "198.51.100.9", RemoteAddr: "198.51.100.9", Status: 400, URI: uri})
+	}
+	// A cache buster varying queries on a static asset is left to its own rule.
+	for i := 0; i < 60; i++ {
+		a.Process(Entry{Time: now, ClientIP: "192.0.2.10", RemoteAddr: "192.0.2.10", Status: 404, URI: fmt.Sprintf("/app.js?v=%d", 1000000+i)})
+	}
+
+	suspect, seen, _ := a.Explain("198.51.100.9")
+	if !seen || !strings.Contains(strings.Join(suspect.Rules, ","), RuleQueryFuzzing) {
+		t.Fatalf("expected the %s rule, got %+v", RuleQueryFuzzing, suspect)
+	}
+	if want := "60 query strings on /api/report"; !strings.Contains(strings.Join(suspect.Reasons, "; "), want) {
+		t.Fatalf("expected reason %q, got %v", want, suspect.Reasons)
+	}
+	if buster, _, _ := a.Explain("192.0.2.10"); strings.Contains(strings.Join(buster.Rules, ","), RuleQueryFuzzing) {
+		t.Fatalf("expected static assets to be skipped, got %v", buster.Rules)
+	}
+}
+
+func TestQueryFuzzingReasonEscapesControlCharacters(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinQueryVariants = 50
+	a := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		a.Process(Entry{Time: now, ClientIP: "198.51.100.9", Status: 404, URI: fmt.Sprintf("/a%%0dwrite-host%%20pwned%%0d?q=%d", i)})
+	}
+	suspect, _, _ := a.Explain("198.51.100.9")
+	reasons := strings.Join(suspect.Reasons, "; ")
+	if strings.ContainsAny(reasons, "\r\n") || !strings.Contains(reasons, "60 query strings on /a%0Dwrite-host pwned%0D") {
+		t.Fatalf("expected the CR to be escaped, got %q", reasons)
+	}
+}
+
+func TestRecordQueryIsBounded(t *testing.T) {
+	stat := &IPStats{}
+	for i := 0; i < maxQueryPaths+5; i++ {
+		stat.recordQuery(fmt.Sprintf("/p%d?a=1", i))
+	}
+	for i := 0; i < maxQueryVariants+5; i++ {
+		stat.recordQuery(fmt.Sprintf("/p0?a=%d", i))
+	}
+	stat.recordQuery("/p0")
+	if len(stat.queryVariants) != maxQueryPaths {
+		t.Fatalf("expected %d tracked paths, got %d", maxQueryPaths, len(stat.queryVariants))
+	}
+	if path, variants := stat.fuzzedPath(); path != "/p0" || variants != maxQueryVariants {
+		t.Fatalf("unexpected fuzzed path %s (%d)", path, variants)
+	}
+}
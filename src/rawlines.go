@@ -0,0 +1,40 @@
+package main
+
+// recordRawLine keeps the first k raw lines of an IP and, in a ring, the last
+// k of the ones after them, so both ends of long sessions stay visible.
+func (s *IPStats) recordRawLine(line string, k int) {
+	if k <= 0 || line == "" {
+		return
+	}
+	defer func() { s.rawLines++ }()
+	if len(s.firstLines) < k {
+		s.firstLines = append(s.firstLines, line)
+		return
+	}
+	if len(s.lastLines) < k {
+		s.lastLines = append(s.lastLines, line)
+		return
+	}
+	s.lastLines[(s.rawLines-k)%k] = line
+}
+
+// FirstLines returns the first raw log lines kept for the IP.
+func (s *IPStats) FirstLines() []string {
+	return s.firstLines
+}
+
+// LastLines returns the last raw log lines kept for the IP, oldest first,
+// excluding any already in FirstLines.
+func (s *IPStats) LastLines() []string {
+	written := s.rawLines - len(s.firstLines)
+	if written <= len(s.lastLines) {
+		return s.lastLines
+	}
+	start := written % len(s.lastLines)
+	return append(append([]string{}, s.lastLines[start:]...), s.lastLines[:start]...)
+}
+
+// SkippedLines counts the raw lines between FirstLines and LastLines.
+func (s *IPStats) SkippedLines() int {
+	return s.rawLines - len(s.firstLines) - len(s.lastLines)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordRawLine(t *testing.T) {
+	tests := []struct {
+		lines       int
+		first, last []string
+		skipped     int
+	}{
+		{1, []string{"l0"}, nil, 0},
+		{3, []string{"l0", "l1"}, []string{"l2"}, 0},
+		{4, []string{"l0", "l1"}, []string{"l2", "l3"}, 0},
+		{7, []string{"l0", "l1"}, []string{"l5", "l6"}, 3},
+		{8, []string{"l0", "l1"}, []string{"l6", "l7"}, 4},
+	}
+	for _, tt := range tests {
+		var stat IPStats
+		for i := 0; i < tt.lines; i++ {
+			stat.recordRawLine(fmt.Sprintf("l%d", i), 2)
+		}
+		if !reflect.DeepEqual(stat.FirstLines(), tt.first) || !reflect.DeepEqual(stat.LastLines(), tt.last) || stat.SkippedLines() != tt.skipped {
+			t.Errorf("%d lines: got first %v, last %v, skipped %d", tt.lines, stat.FirstLines(), stat.LastLines(), stat.SkippedLines())
+		}
+	}
+}
+
+func TestAnalyzerKeepsRawLines(t *testing.T) {
+	var log strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&log, "192.0.2.3 - - [19/Oct/2025:12:00:%02d +0000] \"GET /p%d HTTP/1.1\" 404 0 \"-\" \"curl/8.0\"\n", i, i)
+	}
+	for _, rawLines := range []int{0, 1} {
+		cfg := DefaultConfig()
+		cfg.RawLines = rawLines
+		analyzer := New(cfg, nil)
+		entries, errs := Stream(strings.NewReader(log.String()))
+		for entry := range entries {
+			analyzer.Process(entry)
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		stat := analyzer.stats["192.0.2.3"]
+		if rawLines == 0 {
+			if stat.FirstLines() != nil || stat.LastLines() != nil {
+				t.Fatalf("expected no lines by default, got %v %v", stat.FirstLines(), stat.LastLines())
+			}
+			continue
+		}
+		if first := stat.FirstLines(); len(first) != 1 || !strings.Contains(first[0], "GET /p0 ") {
+			t.Fatalf("unexpected first lines %v", first)
+		}
+		if last := stat.LastLines(); len(last) != 1 || !strings.Contains(last[0], "GET /p4 ") || stat.SkippedLines() != 3 {
+			t.Fatalf("unexpected last lines %v (%d skipped)", last, stat.SkippedLines())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// sshBin is the ssh client that reads --remote logs.
+var sshBin = "ssh"
+
+// remoteLog is a log file on another host, given as [user@]host:/path. Host
+// may be an alias from ~/.ssh/config.
+type remoteLog struct {
+	Target string
+	Path   string
+}
+
+func parseRemoteLog(spec string) (remoteLog, error) {
+	target, path, ok := strings.Cut(spec, ":")
+	if !ok || target == "" || path == "" || strings.HasPrefix(target, "-") {
+		return remoteLog{}, fmt.Errorf("remote %q: want [user@]host:/path/to/access.log", spec)
+	}
+	return remoteLog{Target: target, Path: path}, nil
+}
+
+// Host is the target without the user, used to attribute entries.
+func (r remoteLog) Host() string {
+	if _, host, ok := strings.Cut(r.Target, "@"); ok {
+		return host
+	}
+	return r.Target
+}
+
+func (r remoteLog) String() string {
+	return r.Target + ":" + r.Path
+}
+
+// openRemoteLog runs cat on the remote host over ssh, or with follow set
+// tail -F, which reads the log from its start and keeps following it across
+// rotations. ssh runs in batch mode, so hosts must accept a key without a
+// passphrase prompt.
+func openRemoteLog(ctx context.Context, remote remoteLog, follow bool) (*commandReader, error) {
+	command := "cat -- " + shellQuote(remote.Path)
+	if follow {
+		command = "tail -n +1 -F -- " + shellQuote(remote.Path)
+	}
+	return startCommand(ctx, sshBin, "-o", "BatchMode=yes", "--", remote.Target, command)
+}
+
+// shellQuote quotes s for the remote shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// streamRemoteLogs reads each remote log in turn. Entries are attributed to
+// the remote host and, when there are several remotes, tagged with the log
+// they came from.
+func streamRemoteLogs(remotes []remoteLog, opts StreamOptions, handle func(Entry)) error {
+	tag := len(remotes) > 1
+	for _, remote := range remotes {
+		err := streamRemoteLog(remote, opts, func(entry Entry) {
+			if entry.Hostname == "" {
+				entry.Hostname = remote.Host()
+			}
+			if tag {
+				entry.Source = remote.String()
+			}
+			handle(entry)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", remote, err)
+		}
+	}
+	return nil
+}
+
+func streamRemoteLog(remote remoteLog, opts StreamOptions, handle func(Entry)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out, err := openRemoteLog(ctx, remote, false)
+	if err != nil {
+		return err
+	}
+	// ssh may be blocked writing the rest of the log, so stopping early
+	// kills it before waiting for it.
+	abort := logReader{Reader: out, close: func() error {
+		cancel()
+		return out.Close()
+	}}
+	r, err := decompressLog(abort)
+	if err != nil {
+		return err
+	}
+	entries, errs := StreamWith(r, opts)
+	for entry := range entries {
+		handle(entry)
+	}
+	if err := <-errs; err != nil {
+		abort.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// followRemoteLogs is followLog for remote logs, read at the same time.
+func followRemoteLogs(ctx context.Context, remotes []remoteLog, streamOpts StreamOptions, follower *Follower) error {
+	sources := make([]followSource, 0, len(remotes))
+	readers := make([]*commandReader, 0, len(remotes))
+	names := make([]string, 0, len(remotes))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, remote := range remotes {
+		out, err := openRemoteLog(ctx, remote, true)
+		if err != nil {
+			cancel()
+			for _, started := range readers {
+				started.Close()
+			}
+			return err
+		}
+		readers = append(readers, out)
+		sources = append(sources, followSource{r: out, host: remote.Host()})
+		names = append(names, remote.String())
+	}
+	err := followSources(strings.Join(names, ", "), sources, streamOpts, follower)
+	// The first remote to end stops the others; report why it ended.
+	for _, out := range readers {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		cancel()
+	}
+	return err
+}
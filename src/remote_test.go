@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSH points sshBin at a shell script for the test.
+func fakeSSH(t *testing.T, script string) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write fake ssh: %v", err)
+	}
+	previous := sshBin
+	sshBin = bin
+	t.Cleanup(func() { sshBin = previous })
+	return dir
+}
+
+func TestParseRemoteLog(t *testing.T) {
+	remote, err := parseRemoteLog("deploy@edge1.example.com:/var/log/nginx/access.log")
+	if err != nil {
+		t.Fatalf("parseRemoteLog: %v", err)
+	}
+	if remote.Target != "deploy@edge1.example.com" || remote.Path != "/var/log/nginx/access.log" || remote.Host() != "edge1.example.com" {
+		t.Fatalf("unexpected remote %+v, host %q", remote, remote.Host())
+	}
+	for _, spec := range []string{"edge1", "edge1:", ":/var/log/nginx/access.log", "-oProxyCommand=x:/log"} {
+		if _, err := parseRemoteLog(spec); err == nil {
+			t.Fatalf("expected %q to be rejected", spec)
+		}
+	}
+	if got := shellQuote("/logs/it's.log"); got != `'/logs/it'\''s.log'` {
+		t.Fatalf("unexpected quoting %s", got)
+	}
+}
+
+func TestStreamRemoteLogsAttributesHosts(t *testing.T) {
+	dir := fakeSSH(t, `echo "$@" >> "$(dirname "$0")/args"
+case "$4" in
+edge1) echo '192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET /a HTTP/1.1" 404 0 "-" "curl/8.0"' ;;
+*) echo '192.0.2.8 - - [19/Oct/2025:12:02:36 +0000] "GET /b HTTP/1.1" 200 0 "-" "curl/8.0"' ;;
+esac
+`)
+	remotes := []remoteLog{
+		{Target: "edge1", Path: "/var/log/nginx/access.log"},
+		{Target: "deploy@edge2", Path: "/var/log/nginx/access.log"},
+	}
+	var got []string
+	if err := streamRemoteLogs(remotes, StreamOptions{}, func(entry Entry) {
+		got = append(got, entry.ClientIP+"@"+entry.Hostname+" from "+entry.Source)
+	}); err != nil {
+		t.Fatalf("streamRemoteLogs: %v", err)
+	}
+	want := "192.0.2.7@edge1 from edge1:/var/log/nginx/access.log," +
+		"192.0.2.8@edge2 from deploy@edge2:/var/log/nginx/access.log"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("unexpected entries %v", got)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if first, _, _ := strings.Cut(string(args), "\n"); first != "-o BatchMode=yes -- edge1 cat -- '/var/log/nginx/access.log'" {
+		t.Fatalf("unexpected ssh arguments %q", first)
+	}
+}
+
+func TestStreamRemoteLogsReportsFailure(t *testing.T) {
+	fakeSSH(t, "echo 'ssh: connect to host edge1 port 22: Connection refused' >&2\nexit 255\n")
+	err := streamRemoteLogs([]remoteLog{{Target: "edge1", Path: "/var/log/nginx/access.log"}}, StreamOptions{}, func(Entry) {})
+	if err == nil || !strings.Contains(err.Error(), "edge1:/var/log/nginx/access.log") || !strings.Contains(err.Error(), "Connection refused") {
+		t.Fatalf("expected the remote and ssh's message, got %v", err)
+	}
+}
+
+func TestFollowRemoteLogs(t *testing.T) {
+	var lines strings.Builder
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&lines, "echo '198.51.100.4 - - [%s] \"GET /x%d.php HTTP/1.1\" 404 12 \"-\" \"zgrab\"'\n", now.Add(time.Duration(i-60)*time.Second).Format(timeLayout), i)
+	}
+	fakeSSH(t, "case \"$*\" in *'tail -n +1 -F'*) ;; *) exit 2 ;; esac\ncase \"$4\" in edge1) "+strings.ReplaceAll(lines.String(), "\n", "; ")+" ;; esac\nexec sleep 30\n")
+
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:     time.Hour,
+		Interval:   50 * time.Millisecond,
+		DenyOutput: denyPath,
+		Deny:       DenyOptions{Minimal: true},
+	})
+	remotes := []remoteLog{{Target: "edge1", Path: "/var/log/nginx/access.log"}, {Target: "edge2", Path: "/var/log/nginx/access.log"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- followRemoteLogs(ctx, remotes, StreamOptions{}, follower) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(denyPath)
+		if strings.Contains(string(data), "deny 198.51.100.4;") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deny file never picked up the remote attack, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("followRemoteLogs: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("followRemoteLogs did not stop after cancel")
+	}
+}
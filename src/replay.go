@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseSpeed accepts "60x", "60" or "max" (no delays).
+func parseSpeed(value string) (float64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed %q, want e.g. 60x or max", value)
+	}
+	return speed, nil
+}
+
+// Replayer feeds historical entries through a LivePipeline, sleeping between
+// entries for their timestamp gap divided by speed.
+type Replayer struct {
+	pipeline *LivePipeline
+	speed    float64
+	sleep    func(time.Duration)
+	onTick   func(elapsed time.Duration, tick LiveTick)
+
+	elapsed  time.Duration
+	last     time.Time
+	Entries  int
+	Ticks    int
+	Alerts   int
+	LogStart time.Time
+}
+
+// Add replays one entry, waiting for its compressed timestamp and evaluating due ticks.
+func (r *Replayer) Add(entry Entry) {
+	if r.Entries == 0 {
+		r.LogStart = entry.Time
+	}
+	if !r.last.IsZero() && entry.Time.After(r.last) && r.speed > 0 {
+		delay := time.Duration(float64(entry.Time.Sub(r.last)) / r.speed)
+		r.sleep(delay)
+		r.elapsed += delay
+	}
+	if entry.Time.After(r.last) {
+		r.last = entry.Time
+	}
+	r.Entries++
+
+	if tick, ok := r.pipeline.Advance(r.last); ok {
+		r.report(tick)
+	}
+	r.pipeline.Add(entry)
+}
+
+// Finish evaluates the remaining window at the last log timestamp.
+func (r *Replayer) Finish() {
+	if r.Entries == 0 {
+		return
+	}
+	r.report(r.pipeline.Evaluate(r.last))
+}
+
+func (r *Replayer) report(tick LiveTick) {
+	r.Ticks++
+	r.Alerts += len(tick.New)
+	if r.onTick != nil {
+		r.onTick(r.elapsed, tick)
+	}
+}
+
+func printReplayTick(w io.Writer, colorize bool, elapsed time.Duration, tick LiveTick) {
+	printLiveTick(w, colorize, fmt.Sprintf("+%-10s ", elapsed.Round(time.Millisecond)), tick)
+}
+
+// printLiveTick prints the suspects and new IP spikes that are new at this tick;
+// label follows the timestamp.
+func printLiveTick(w io.Writer, colorize bool, label string, tick LiveTick) {
+	for _, spike := range tick.NewIPSpikes {
+		fmt.Fprintln(w, maybeColor(colorize, ansiRed, fmt.Sprintf("%s %sdistributed attack suspected: %s",
+			tick.At.UTC().Format(time.RFC3339), label, spike.describe())))
+	}
+	if len(tick.New) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s %swindow=%d entries suspects=%d new=%d\n",
+		tick.At.UTC().Format(time.RFC3339), label, tick.Entries, len(tick.Suspects), len(tick.New))
+	for _, suspect := range tick.New {
+		line := fmt.Sprintf("    new %-40s %-8s score=%d %s", suspect.IP, suspect.Severity, suspect.Score, strings.Join(suspect.Reasons, "; "))
+		fmt.Fprintln(w, maybeColor(colorize, colorForSeverity(suspect.Severity), line))
+		if suspect.Stats != nil && suspect.Stats.Annotation != "" {
+			fmt.Fprintf(w, "        note: %s\n", suspect.Stats.Annotation)
+		}
+	}
+}
+
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	filePath := fs.String("file", "", "path to the historical access log (defaults to config file or access.log)")
+	speedFlag := fs.String("speed", "60x", "time compression factor, e.g. 60x replays an hour in a minute; max disables delays")
+	window := fs.Duration("window", defaultLiveWindow, "sliding window of log history analyzed at each tick")
+	interval := fs.Duration("interval", defaultLiveInterval, "log time between analyzer runs")
+	notify := fs.Bool("notify", false, "deliver new suspects through the configured notify routes, to test alert routing")
+	colorize := fs.Bool("color", false, "enable ANSI color output")
+	fs.Parse(args)
+
+	speed, err := parseSpeed(*speedFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	cfg, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *filePath == "" {
+		*filePath = defaults.File
+	}
+
+	logFormat, err := logFormatFor(defaults.Format, defaults.LogFormat, defaults.LogTimes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var geoLookup GeoLookup
+	if defaults.GeoIPDB != "" {
+		lookup, closer, err := newGeoLookup(defaults.GeoProvider, defaults.GeoIPDB, defaults.GeoIPLocale, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open geoip db: %v\n", err)
+			return 1
+		}
+		defer closer()
+		geoLookup = lookup
+	}
+
+	run := newRunInfo()
+	replayer := &Replayer{
+		pipeline: newLivePipeline(cfg, geoLookup, *window, *interval),
+		speed:    speed,
+		sleep:    time.Sleep,
+		onTick: func(elapsed time.Duration, tick LiveTick) {
+			printReplayTick(os.Stdout, *colorize, elapsed, tick)
+			if *notify && len(tick.New) > 0 && defaults.Notify.enabled() {
+				sendNotifications(defaults.Notify, run, defaults.Vhost, tick.New, nil)
+			}
+			if *notify && len(tick.NewIPSpikes) > 0 && len(defaults.Notify.Alerts) > 0 {
+				sendNewIPAlert(defaults.Notify, run, defaults.Vhost, tick.NewIPSpikes, nil)
+			}
+		},
+	}
+	started := time.Now()
+	if err := streamLogFileWith(*filePath, StreamOptions{Format: logFormat}, replayer.Add); err != nil {
+		fmt.Fprintf(os.Stderr, "parse log: %v\n", err)
+		return 1
+	}
+	replayer.Finish()
+
+	fmt.Printf("replayed %d entries spanning %s in %s (%d ticks, %d new suspects)\n",
+		replayer.Entries, replayer.last.Sub(replayer.LogStart).Round(time.Second),
+		time.Since(started).Round(time.Millisecond), replayer.Ticks, replayer.Alerts)
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseSpeed(t *testing.T) {
+	for input, want := range map[string]float64{"60x": 60, "2.5": 2.5, "max": 0} {
+		got, err := parseSpeed(input)
+		if err != nil || got != want {
+			t.Fatalf("parseSpeed(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := parseSpeed("0x"); err == nil {
+		t.Fatalf("expected zero speed to fail")
+	}
+}
+
+func TestReplayerCompressesTime(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	var slept time.Duration
+	var alerts []time.Time
+	replayer := &Replayer{
+		pipeline: newLivePipeline(cfg, nil, 10*time.Minute, time.Minute),
+		speed:    60,
+		sleep:    func(d time.Duration) { slept += d },
+		onTick: func(_ time.Duration, tick LiveTick) {
+			if len(tick.New) > 0 {
+				alerts = append(alerts, tick.At)
+			}
+		},
+	}
+	for i := 0; i < 60; i++ {
+		replayer.Add(Entry{ClientIP: "192.0.2.1", Time: start.Add(time.Duration(i) * 5 * time.Second), URI: fmt.Sprintf("/x%d.php", i), Status: 404})
+	}
+	replayer.Finish()
+
+	if diff := slept - 295*time.Second/60; diff > time.Millisecond || diff < -time.Millisecond {
+		t.Fatalf("expected 295s of log time compressed 60x, slept %s", slept)
+	}
+	if len(alerts) != 1 || replayer.Alerts != 1 {
+		t.Fatalf("expected a single alert, got %v", alerts)
+	}
+	if alerts[0].After(start.Add(3 * time.Minute)) {
+		t.Fatalf("expected alert within the first ticks, got %s", alerts[0])
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Talker aggregates raw traffic for an IP regardless of allowlists or suspicion.
+type Talker struct {
+	IP       string
+	Requests int
+	Bytes    int64
+	Errors   int
+	Score    int
+	Flagged  bool
+}
+
+var talkerOrders = map[string]func(a, b Talker) bool{
+	"requests": func(a, b Talker) bool { return a.Requests > b.Requests },
+	"bytes":    func(a, b Talker) bool { return a.Bytes > b.Bytes },
+	"errors":   func(a, b Talker) bool { return a.Errors > b.Errors },
+}
+
+// TalkerCounter accumulates per-IP totals for the top talkers report.
+type TalkerCounter struct {
+	talkers map[string]*Talker
+}
+
+func newTalkerCounter() *TalkerCounter {
+	return &TalkerCounter{talkers: make(map[string]*Talker)}
+}
+
+// Add counts a single entry.
+func (c *TalkerCounter) Add(entry Entry) {
+	ip := entry.ClientIP
+	if ip == "" {
+		ip = entry.RemoteAddr
+	}
+	talker, ok := c.talkers[ip]
+	if !ok {
+		talker = &Talker{IP: ip}
+		c.talkers[ip] = talker
+	}
+	talker.Requests++
+	talker.Bytes += entry.Bytes
+	if entry.Status >= 400 {
+		talker.Errors++
+	}
+}
+
+// Top returns the heaviest talkers ordered by the given metric, annotated with the analyzer verdict.
+func (c *TalkerCounter) Top(by string, limit int, analyzer *Analyzer) ([]Talker, error) {
+	less, ok := talkerOrders[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q (want requests, bytes or errors)", by)
+	}
+
+	talkers := make([]Talker, 0, len(c.talkers))
+	for _, talker := range c.talkers {
+		t := *talker
+		if analyzer != nil {
+			if suspect, seen, blocked := analyzer.Explain(t.IP); seen {
+				t.Score = suspect.Score
+				t.Flagged = blocked
+			}
+		}
+		talkers = append(talkers, t)
+	}
+
+	sort.Slice(talkers, func(i, j int) bool {
+		if less(talkers[i], talkers[j]) {
+			return true
+		}
+		if less(talkers[j], talkers[i]) {
+			return false
+		}
+		return talkers[i].IP < talkers[j].IP
+	})
+	if limit > 0 && len(talkers) > limit {
+		talkers = talkers[:limit]
+	}
+	return talkers, nil
+}
+
+func printTalkers(w io.Writer, talkers []Talker) {
+	fmt.Fprintf(w, "%-40s %-10s %-14s %-8s %-6s %s\n", "IP", "Requests", "Bytes", "Errors", "Score", "Flagged")
+	for _, t := range talkers {
+		flagged := "no"
+		if t.Flagged {
+			flagged = "yes"
+		}
+		fmt.Fprintf(w, "%-40s %-10d %-14d %-8d %-6d %s\n", t.IP, t.Requests, t.Bytes, t.Errors, t.Score, flagged)
+	}
+}
+
+// runReport implements `botdeny report top --by requests|bytes|errors`.
+func runReport(args []string) int {
+	if len(args) > 0 && args[0] == "efficacy" {
+		return runReportEfficacy(args[1:])
+	}
+	if len(args) == 0 || args[0] != "top" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny report top [--by requests|bytes|errors] [--limit N] [--file access.log]")
+		fmt.Fprintln(os.Stderr, "       botdeny report efficacy [--deny botdeny.conf] [--file access.log] [--since RFC3339]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("report top", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	filePath := fs.String("file", "", "path to Nginx access log (defaults to config file or access.log)")
+	by := fs.String("by", "requests", "metric to rank by: requests, bytes or errors")
+	limit := fs.Int("limit", 20, "number of clients to list (0 for all)")
+	fs.Parse(args[1:])
+
+	if _, ok := talkerOrders[*by]; !ok {
+		fmt.Fprintf(os.Stderr, "unknown --by %q (want requests, bytes or errors)\n", *by)
+		return 2
+	}
+
+	cfg, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *filePath == "" {
+		*filePath = defaults.File
+	}
+
+	counter := newTalkerCounter()
+	analyzer := New(cfg, nil)
+	logFormat, err := logFormatFor(defaults.Format, defaults.LogFormat, defaults.LogTimes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	err = streamLogFileWith(*filePath, StreamOptions{Format: logFormat}, func(entry Entry) {
+		counter.Add(entry)
+		analyzer.Process(entry)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse log: %v\n", err)
+		return 1
+	}
+
+	talkers, err := counter.Top(*by, *limit, analyzer)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	printTalkers(os.Stdout, talkers)
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTalkerCounterTop(t *testing.T) {
+	counter := newTalkerCounter()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		counter.Add(Entry{ClientIP: "192.0.2.1", Time: now, Status: 200, Bytes: 10})
+	}
+	for i := 0; i < 2; i++ {
+		counter.Add(Entry{ClientIP: "192.0.2.2", Time: now, Status: 404, Bytes: 5000})
+	}
+	counter.Add(Entry{ClientIP: "192.0.2.3", Time: now, Status: 500, Bytes: 1})
+
+	byRequests, err := counter.Top("requests", 1, nil)
+	if err != nil {
+		t.Fatalf("Top: %v", err)
+	}
+	if len(byRequests) != 1 || byRequests[0].IP != "192.0.2.1" {
+		t.Fatalf("unexpected top by requests: %+v", byRequests)
+	}
+
+	byBytes, _ := counter.Top("bytes", 0, nil)
+	if byBytes[0].IP != "192.0.2.2" || len(byBytes) != 3 {
+		t.Fatalf("unexpected top by bytes: %+v", byBytes)
+	}
+
+	byErrors, _ := counter.Top("errors", 2, nil)
+	if byErrors[0].IP != "192.0.2.2" || byErrors[1].IP != "192.0.2.3" {
+		t.Fatalf("unexpected top by errors: %+v", byErrors)
+	}
+
+	if _, err := counter.Top("latency", 5, nil); err == nil {
+		t.Fatalf("expected error for unknown metric")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// RunInfo identifies a single botdeny run and the log window it analyzed.
+type RunInfo struct {
+	ID          string
+	Started     time.Time
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+// newRunInfo starts a run with a fresh random (version 4) UUID.
+func newRunInfo() RunInfo {
+	return RunInfo{ID: newUUID(), Started: time.Now().UTC()}
+}
+
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on supported platforms; fall back to a time-derived ID just in case.
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Window formats the analyzed log window, or "-" when no entries were seen.
+func (r RunInfo) Window() string {
+	if r.WindowStart.IsZero() || r.WindowEnd.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%s/%s", r.WindowStart.UTC().Format(time.RFC3339), r.WindowEnd.UTC().Format(time.RFC3339))
+}
+
+// observeWindow widens the run window to cover every IP's activity.
+func (r *RunInfo) observeWindow(stats []*IPStats) {
+	for _, stat := range stats {
+		if stat.FirstSeen.IsZero() {
+			continue
+		}
+		if r.WindowStart.IsZero() || stat.FirstSeen.Before(r.WindowStart) {
+			r.WindowStart = stat.FirstSeen
+		}
+		if stat.LastSeen.After(r.WindowEnd) {
+			r.WindowEnd = stat.LastSeen
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Sample units: SampleByRequest keeps a fraction of every IP's requests,
+// SampleByIP keeps every request of a fraction of the IPs.
+const (
+	SampleByRequest = "request"
+	SampleByIP      = "ip"
+)
+
+// Sampler keeps a deterministic fraction of entries. By default the decision
+// hashes the request itself, so every IP is sampled at the same rate and
+// per-IP ratios such as the error ratio stay valid, and repeated runs keep the
+// same entries. With By set to SampleByIP it hashes the client IP instead, so
+// the kept IPs are seen whole and their counts need no scaling.
+type Sampler struct {
+	Keep, Of uint64
+	By       string
+}
+
+// parseSampleRate accepts "1/10" style fractions.
+func parseSampleRate(value string) (*Sampler, error) {
+	keep, of, ok := strings.Cut(strings.TrimSpace(value), "/")
+	k, errK := strconv.ParseUint(strings.TrimSpace(keep), 10, 64)
+	o, errO := strconv.ParseUint(strings.TrimSpace(of), 10, 64)
+	if !ok || errK != nil || errO != nil || k == 0 || o == 0 || k > o {
+		return nil, fmt.Errorf("invalid sample rate %q, want e.g. 1/10", value)
+	}
+	return &Sampler{Keep: k, Of: o, By: SampleByRequest}, nil
+}
+
+// checkSampleBy rejects an unknown sample_by unit.
+func checkSampleBy(by string) error {
+	if by != SampleByRequest && by != SampleByIP {
+		return fmt.Errorf("invalid sample unit %q, want %s or %s", by, SampleByRequest, SampleByIP)
+	}
+	return nil
+}
+
+// Rate is the kept fraction of entries.
+func (s *Sampler) Rate() float64 {
+	return float64(s.Keep) / float64(s.Of)
+}
+
+// Sampled reports whether entry belongs to the sample.
+func (s *Sampler) Sampled(entry Entry) bool {
+	h := fnv.New64a()
+	if s.By == SampleByIP {
+		h.Write([]byte(entry.ClientIP))
+		return h.Sum64()%s.Of < s.Keep
+	}
+	fmt.Fprintf(h, "%s|%d|%s|%s|%d|%d", entry.ClientIP, entry.Time.UnixNano(), entry.Method, entry.URI, entry.Status, entry.Bytes)
+	return h.Sum64()%s.Of < s.Keep
+}
+
+// ScaleConfig adjusts cfg to the sample: per-request samples scale the count
+// and rate thresholds, per-IP samples only the thresholds that add up traffic
+// across IPs.
+func (s *Sampler) ScaleConfig(cfg *Config) {
+	if s.By == SampleByIP {
+		scaleConfigForIPSample(cfg, s.Rate())
+		return
+	}
+	scaleConfigForSample(cfg, s.Rate())
+}
+
+// scaleConfigForIPSample scales the country and new IP spike thresholds,
+// which add up all IPs; per-IP thresholds see whole IPs.
+func scaleConfigForIPSample(cfg *Config, rate float64) {
+	if cfg.NewIPSpikeMin > 0 {
+		cfg.NewIPSpikeMin = max(1, int(math.Round(float64(cfg.NewIPSpikeMin)*rate)))
+	}
+	if cfg.CountrySpikeMinRequests > 0 {
+		cfg.CountrySpikeMinRequests = max(1, int(math.Round(float64(cfg.CountrySpikeMinRequests)*rate)))
+	}
+	if cfg.CountryBaselines != nil {
+		baselines := make(map[string]float64, len(cfg.CountryBaselines))
+		for country, baseline := range cfg.CountryBaselines {
+			baselines[country] = baseline * rate
+		}
+		cfg.CountryBaselines = baselines
+	}
+}
+
+// scaleConfigForSample lowers count and rate thresholds to the sample rate so
+// a sampled run flags roughly the IPs a full run would. Ratios, score
+// thresholds and per-response limits are unchanged.
+func scaleConfigForSample(cfg *Config, rate float64) {
+	scale := func(v int) int {
+		if v <= 0 {
+			return v
+		}
+		return max(1, int(math.Round(float64(v)*rate)))
+	}
+	cfg.MinRequests = scale(cfg.MinRequests)
+	cfg.MaxAverageRPM *= rate
+	cfg.MaxBurstRequests = scale(cfg.MaxBurstRequests)
+	cfg.Min404Errors = scale(cfg.Min404Errors)
+	cfg.MinUniquePaths = scale(cfg.MinUniquePaths)
+	cfg.MinPHP404s = scale(cfg.MinPHP404s)
+	cfg.MinSQLInjections = scale(cfg.MinSQLInjections)
+	cfg.MinCacheBusters = scale(cfg.MinCacheBusters)
+	cfg.MinCookielessPages = scale(cfg.MinCookielessPages)
+	cfg.MinCacheMisses = scale(cfg.MinCacheMisses)
+	cfg.MinLegacyTLS = scale(cfg.MinLegacyTLS)
+	cfg.MinSingleCipher = scale(cfg.MinSingleCipher)
+	cfg.MinHeaderAnomalies = scale(cfg.MinHeaderAnomalies)
+	cfg.MinHostHeaders = scale(cfg.MinHostHeaders)
+	cfg.MinQueryVariants = scale(cfg.MinQueryVariants)
+	cfg.MaxUpstreamSeconds *= rate
+	cfg.AccountMinRequests = scale(cfg.AccountMinRequests)
+	cfg.AccountMaxAverageRPM *= rate
+	scaleConfigForIPSample(cfg, rate)
+
+	limits := make([]PathLimit, len(cfg.SensitiveURLLimits))
+	for i, limit := range cfg.SensitiveURLLimits {
+		limits[i] = PathLimit{Prefix: limit.Prefix, Threshold: scale(limit.Threshold)}
+	}
+	cfg.SensitiveURLLimits = limits
+
+	statusRules := make([]StatusRule, len(cfg.StatusRules))
+	for i, rule := range cfg.StatusRules {
+		rule.MinCount = scale(rule.MinCount)
+		statusRules[i] = rule
+	}
+	cfg.StatusRules = statusRules
+
+	sequenceRules := make([]SequenceRule, len(cfg.SequenceRules))
+	for i, rule := range cfg.SequenceRules {
+		rule.MinCount = scale(rule.MinCount)
+		sequenceRules[i] = rule
+	}
+	cfg.SequenceRules = sequenceRules
+
+	classes := make(map[UAClass]ClassLimit, len(cfg.ClassLimits))
+	for class, limit := range cfg.ClassLimits {
+		limit.MinRequests = scale(limit.MinRequests)
+		limit.MaxAverageRPM *= rate
+		classes[class] = limit
+	}
+	cfg.ClassLimits = classes
+
+	scopes := make(map[string]VhostScope, len(cfg.VhostScopes))
+	for name, scope := range cfg.VhostScopes {
+		scope.MinRequests = scale(scope.MinRequests)
+		scope.MaxAverageRPM *= rate
+		scope.MaxBurstRequests = scale(scope.MaxBurstRequests)
+		scopes[name] = scope
+	}
+	cfg.VhostScopes = scopes
+}
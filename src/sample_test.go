@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseSampleRate(t *testing.T) {
+	s, err := parseSampleRate("1/10")
+	if err != nil || s.Keep != 1 || s.Of != 10 || s.Rate() != 0.1 {
+		t.Fatalf("unexpected sampler %+v, %v", s, err)
+	}
+	for _, bad := range []string{"10", "0/10", "3/2", "1/0", "a/b", "10%"} {
+		if _, err := parseSampleRate(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestSamplerIsDeterministicAndUniform(t *testing.T) {
+	s := &Sampler{Keep: 1, Of: 10}
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	kept := 0
+	for i := 0; i < 20000; i++ {
+		entry := Entry{ClientIP: "192.0.2.1", Time: start.Add(time.Duration(i) * time.Second), Method: "GET", URI: fmt.Sprintf("/p/%d", i), Status: 200}
+		if s.Sampled(entry) {
+			kept++
+		}
+		if s.Sampled(entry) != s.Sampled(entry) {
+			t.Fatal("sampling must be deterministic")
+		}
+	}
+	if kept < 1800 || kept > 2200 {
+		t.Fatalf("expected about 10%% of entries, kept %d of 20000", kept)
+	}
+}
+
+func TestScaleConfigForSample(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SensitiveURLLimits = []PathLimit{{Prefix: "/login", Threshold: 30}}
+	cfg.ClassLimits = map[UAClass]ClassLimit{UAClassBot: {MinRequests: 20, MaxAverageRPM: 30, ScoreThreshold: 1}}
+	cfg.VhostScopes = map[string]VhostScope{"api": {MinRequests: 200, MaxAverageRPM: 600, MaxBurstRequests: 100, ScoreThreshold: 3}}
+	scaleConfigForSample(&cfg, 0.1)
+
+	if cfg.MinRequests != 5 || cfg.MaxAverageRPM != 9 || cfg.MaxBurstRequests != 8 || cfg.MinPHP404s != 1 {
+		t.Fatalf("count thresholds not scaled: %+v", cfg)
+	}
+	if cfg.MinErrorRatio != 0.5 || cfg.ScoreThreshold != 2 {
+		t.Fatalf("ratios must not be scaled: ratio=%v score=%d", cfg.MinErrorRatio, cfg.ScoreThreshold)
+	}
+	if cfg.SensitiveURLLimits[0].Threshold != 3 || cfg.ClassLimits[UAClassBot].MinRequests != 2 || cfg.ClassLimits[UAClassBot].ScoreThreshold != 1 {
+		t.Fatalf("nested limits not scaled: %+v %+v", cfg.SensitiveURLLimits, cfg.ClassLimits)
+	}
+	if api := cfg.VhostScopes["api"]; api.MinRequests != 20 || api.MaxAverageRPM != 60 || api.MaxBurstRequests != 10 || api.ScoreThreshold != 3 {
+		t.Fatalf("vhost scope thresholds not scaled: %+v", api)
+	}
+}
+
+func TestSampledRunStillFlagsAttackers(t *testing.T) {
+	data, err := selftestFixtures.ReadFile("fixtures/bruteforce.log")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	sampler := &Sampler{Keep: 1, Of: 4}
+	cfg := DefaultConfig()
+	scaleConfigForSample(&cfg, sampler.Rate())
+	full, sampled := New(DefaultConfig(), nil), New(cfg, nil)
+
+	entries, errs := Stream(bytes.NewReader(data))
+	for entry := range entries {
+		full.Process(entry)
+		if sampler.Sampled(entry) {
+			sampled.Process(entry)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want, got := len(full.Suspicious()), len(sampled.Suspicious())
+	if want == 0 || got < want*3/4 {
+		t.Fatalf("sampled run flagged %d of %d suspects", got, want)
+	}
+}
+
+func TestSamplerByIPKeepsWholeIPs(t *testing.T) {
+	s := &Sampler{Keep: 1, Of: 4, By: SampleByIP}
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	keptIPs := 0
+	for ip := 0; ip < 2000; ip++ {
+		kept := 0
+		for i := 0; i < 20; i++ {
+			entry := Entry{ClientIP: fmt.Sprintf("10.0.%d.%d", ip/256, ip%256), Time: start.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/p/%d", i)}
+			if s.Sampled(entry) {
+				kept++
+			}
+		}
+		if kept != 0 && kept != 20 {
+			t.Fatalf("expected all or none of an IP's requests, kept %d of 20", kept)
+		}
+		if kept == 20 {
+			keptIPs++
+		}
+	}
+	if keptIPs < 400 || keptIPs > 600 {
+		t.Fatalf("expected about 25%% of IPs, kept %d of 2000", keptIPs)
+	}
+}
+
+func TestScaleConfigForIPSample(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CountryBaselines = map[string]float64{"FR": 400}
+	s := &Sampler{Keep: 1, Of: 10, By: SampleByIP}
+	s.ScaleConfig(&cfg)
+
+	if cfg.MinRequests != DefaultConfig().MinRequests || cfg.MaxAverageRPM != DefaultConfig().MaxAverageRPM {
+		t.Fatalf("per-IP thresholds must not be scaled: %+v", cfg)
+	}
+	if cfg.CountryBaselines["FR"] != 40 || cfg.CountrySpikeMinRequests != max(1, DefaultConfig().CountrySpikeMinRequests/10) {
+		t.Fatalf("country thresholds not scaled: %v, %d", cfg.CountryBaselines, cfg.CountrySpikeMinRequests)
+	}
+	if err := checkSampleBy("host"); err == nil {
+		t.Fatal("expected an unknown unit to be rejected")
+	}
+}
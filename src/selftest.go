@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// selftestFixtures are small logs produced by `botdeny gen` with fixed seeds.
+// Attackers use 203.0.113.0/24 and benign sessions 192.0.2.0/24.
+//
+//go:embed fixtures/*.log
+var selftestFixtures embed.FS
+
+const selftestAttackerPrefix = "203.0.113."
+
+// SelftestResult is the outcome of running the configuration against one fixture.
+type SelftestResult struct {
+	Fixture   string
+	Attack    bool
+	Attackers int
+	Flagged   int
+	// FalsePositives counts flagged IPs outside the attacker range.
+	FalsePositives int
+	Rules          []string
+}
+
+// Status is ok, partial (some attackers missed) or FAIL.
+func (r SelftestResult) Status() string {
+	switch {
+	case r.FalsePositives > 0:
+		return "FAIL"
+	case !r.Attack:
+		return "ok"
+	case r.Flagged == 0:
+		return "FAIL"
+	case r.Flagged < r.Attackers:
+		return "partial"
+	default:
+		return "ok"
+	}
+}
+
+func runSelftestFixture(cfg Config, name string, data []byte) (SelftestResult, error) {
+	result := SelftestResult{Fixture: name, Attack: !strings.HasPrefix(name, "benign")}
+	analyzer := New(cfg, nil)
+	attackers := make(map[string]struct{})
+
+	entries, errs := Stream(bytes.NewReader(data))
+	for entry := range entries {
+		if strings.HasPrefix(entry.ClientIP, selftestAttackerPrefix) {
+			attackers[entry.ClientIP] = struct{}{}
+		}
+		analyzer.Process(entry)
+	}
+	if err := <-errs; err != nil {
+		return result, fmt.Errorf("parse fixture %s: %w", name, err)
+	}
+	result.Attackers = len(attackers)
+
+	rules := make(map[string]struct{})
+	for _, suspect := range analyzer.Suspicious() {
+		if _, ok := attackers[suspect.IP]; !ok {
+			result.FalsePositives++
+			continue
+		}
+		result.Flagged++
+		for _, rule := range suspect.Rules {
+			rules[rule] = struct{}{}
+		}
+	}
+	for rule := range rules {
+		result.Rules = append(result.Rules, rule)
+	}
+	sort.Strings(result.Rules)
+	return result, nil
+}
+
+func runSelftestFixtures(cfg Config) ([]SelftestResult, error) {
+	names, err := selftestFixtures.ReadDir("fixtures")
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SelftestResult, 0, len(names))
+	for _, entry := range names {
+		data, err := selftestFixtures.ReadFile(path.Join("fixtures", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result, err := runSelftestFixture(cfg, entry.Name(), data)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func printSelftest(w io.Writer, results []SelftestResult) {
+	fmt.Fprintf(w, "%-16s %-8s %-10s %-8s %s\n", "Fixture", "Expect", "Flagged", "Result", "Rules fired")
+	for _, r := range results {
+		expect := "attack"
+		flagged := fmt.Sprintf("%d/%d", r.Flagged, r.Attackers)
+		if !r.Attack {
+			expect = "benign"
+			flagged = "0"
+		}
+		if r.FalsePositives > 0 {
+			flagged = fmt.Sprintf("%s +%d FP", flagged, r.FalsePositives)
+		}
+		rules := "-"
+		if len(r.Rules) > 0 {
+			rules = strings.Join(r.Rules, ", ")
+		}
+		fmt.Fprintf(w, "%-16s %-8s %-10s %-8s %s\n", r.Fixture, expect, flagged, r.Status(), rules)
+	}
+}
+
+func runSelftest(args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file to test")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	fs.Parse(args)
+
+	cfg, _, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	results, err := runSelftestFixtures(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printSelftest(os.Stdout, results)
+
+	failed := 0
+	for _, r := range results {
+		if r.Status() == "FAIL" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d fixture(s) failed: the configuration misses an attack or blocks benign traffic\n", failed)
+		return 1
+	}
+	return 0
+}
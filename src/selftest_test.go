@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSelftestDefaultConfigPasses(t *testing.T) {
+	results, err := runSelftestFixtures(DefaultConfig())
+	if err != nil {
+		t.Fatalf("runSelftestFixtures: %v", err)
+	}
+	if len(results) < 4 {
+		t.Fatalf("expected bundled fixtures, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Status() != "ok" {
+			t.Fatalf("default config should pass %s, got %+v", r.Fixture, r)
+		}
+	}
+}
+
+func TestSelftestCatchesDisabledDetection(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ScoreThreshold = 50
+	results, err := runSelftestFixtures(cfg)
+	if err != nil {
+		t.Fatalf("runSelftestFixtures: %v", err)
+	}
+	for _, r := range results {
+		if r.Attack && r.Status() != "FAIL" {
+			t.Fatalf("expected %s to fail with score_threshold 50, got %s", r.Fixture, r.Status())
+		}
+	}
+}
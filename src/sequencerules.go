@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SequenceRule scores IPs that send many requests without the one a browser
+// always sends first, such as posting a login form they never loaded.
+type SequenceRule struct {
+	// Name labels the rule in reasons; it defaults to Request.
+	Name string `yaml:"name"`
+	// Request is the method and path prefix of the requests counted, such
+	// as "POST /login"; a path alone matches every method.
+	Request string `yaml:"request"`
+	// Statuses optionally limits Request to responses with these codes and
+	// classes, such as [401] for failed logins.
+	Statuses []string `yaml:"statuses"`
+	// After is the request that must come first; it defaults to a GET of
+	// the path of Request.
+	After string `yaml:"after"`
+	// Within is how long an After request covers the requests that follow
+	// it; empty covers the rest of the log.
+	Within string `yaml:"within"`
+	// MinCount is how many requests without a preceding After fire the rule.
+	MinCount int `yaml:"min_count"`
+	// Score is added when the rule fires, 1 when unset.
+	Score int `yaml:"score"`
+}
+
+// requestPattern matches requests by method and path prefix; an empty
+// method matches any.
+type requestPattern struct {
+	method string
+	prefix string
+}
+
+func parseRequestPattern(value string) (requestPattern, error) {
+	fields := strings.Fields(value)
+	var p requestPattern
+	switch len(fields) {
+	case 1:
+		p.prefix = fields[0]
+	case 2:
+		p.method, p.prefix = strings.ToUpper(fields[0]), fields[1]
+	default:
+		return p, fmt.Errorf("invalid request %q (want a method and path such as \"POST /login\")", value)
+	}
+	if p.method == "*" {
+		p.method = ""
+	}
+	if !strings.HasPrefix(p.prefix, "/") {
+		return p, fmt.Errorf("invalid request %q: the path must start with /", value)
+	}
+	p.prefix = strings.ToLower(p.prefix)
+	return p, nil
+}
+
+func (p requestPattern) matches(method, path string) bool {
+	return (p.method == "" || strings.EqualFold(method, p.method)) && strings.HasPrefix(path, p.prefix)
+}
+
+// sequenceMatcher is a validated SequenceRule ready to match entries.
+type sequenceMatcher struct {
+	rule     SequenceRule
+	request  requestPattern
+	after    requestPattern
+	statuses [][2]int
+	within   time.Duration
+}
+
+// compile checks the rule, fills in the name, after and score defaults and
+// returns its matcher.
+func (r *SequenceRule) compile() (sequenceMatcher, error) {
+	var m sequenceMatcher
+	request, err := parseRequestPattern(r.Request)
+	if err != nil {
+		return m, err
+	}
+	if r.After == "" {
+		fields := strings.Fields(r.Request)
+		r.After = "GET " + fields[len(fields)-1]
+	}
+	after, err := parseRequestPattern(r.After)
+	if err != nil {
+		return m, fmt.Errorf("after: %w", err)
+	}
+	for _, status := range r.Statuses {
+		low, high, err := statusRange(status)
+		if err != nil {
+			return m, err
+		}
+		m.statuses = append(m.statuses, [2]int{low, high})
+	}
+	if r.Within != "" {
+		within, err := time.ParseDuration(r.Within)
+		if err != nil || within <= 0 {
+			return m, fmt.Errorf("within: invalid duration %q", r.Within)
+		}
+		m.within = within
+	}
+	if r.MinCount <= 0 {
+		return m, fmt.Errorf("min_count must be positive")
+	}
+	if r.Score < 0 {
+		return m, fmt.Errorf("score must not be negative")
+	}
+	if r.Score == 0 {
+		r.Score = 1
+	}
+	if r.Name == "" {
+		r.Name = r.Request
+	}
+	m.rule, m.request, m.after = *r, request, after
+	return m, nil
+}
+
+// validate checks the rule and fills in its defaults.
+func (r *SequenceRule) validate() error {
+	_, err := r.compile()
+	return err
+}
+
+func (m sequenceMatcher) matchesStatus(status int) bool {
+	if len(m.statuses) == 0 {
+		return true
+	}
+	for _, r := range m.statuses {
+		if status >= r[0] && status <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceState is an IP's progress on one sequence rule.
+type sequenceState struct {
+	// lastAfter is when the IP last sent the rule's After request.
+	lastAfter time.Time
+	// skipped counts the matching requests without an After before them.
+	skipped int
+}
+
+// recordSequences updates the IP's sequence rule state with entry, whose
+// path is already normalized.
+func (s *IPStats) recordSequences(matchers []sequenceMatcher, entry Entry, path string) {
+	if len(matchers) == 0 {
+		return
+	}
+	if s.sequences == nil {
+		s.sequences = make([]sequenceState, len(matchers))
+	}
+	path, _, _ = strings.Cut(path, "?")
+	for i, m := range matchers {
+		state := &s.sequences[i]
+		if m.request.matches(entry.Method, path) && m.matchesStatus(entry.Status) {
+			covered := !state.lastAfter.IsZero() && (m.within == 0 || entry.Time.Sub(state.lastAfter) <= m.within)
+			if !covered {
+				state.skipped++
+			}
+		}
+		if m.after.matches(entry.Method, path) && entry.Time.After(state.lastAfter) {
+			state.lastAfter = entry.Time
+		}
+	}
+}
+
+// sequenceRuleReasons evaluates the sequence rules against stat and returns
+// the score they add and their reasons.
+func (a *Analyzer) sequenceRuleReasons(stat *IPStats) (int, []string) {
+	score := 0
+	var reasons []string
+	for i, m := range a.sequences {
+		if i >= len(stat.sequences) || stat.sequences[i].skipped < m.rule.MinCount {
+			continue
+		}
+		score += m.rule.Score
+		reasons = append(reasons, fmt.Sprintf("%s: %d requests without a prior %s", m.rule.Name, stat.sequences[i].skipped, m.rule.After))
+	}
+	return score, reasons
+}
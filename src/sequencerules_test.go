@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSequenceRulesConfig(t *testing.T) {
+	var fc FileConfig
+	data := `
+sequence_rules:
+  - name: login without form
+    request: POST /login
+    min_count: 20
+    score: 2
+  - request: POST /api/comments
+    after: GET /posts/
+    within: 30m
+    statuses: [2xx]
+    min_count: 10
+`
+	if err := yaml.Unmarshal([]byte(data), &fc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	cfg := DefaultConfig()
+	if err := applyConfigDefaults(&cfg, fc); err != nil {
+		t.Fatalf("applyConfigDefaults: %v", err)
+	}
+	if len(cfg.SequenceRules) != 2 || cfg.SequenceRules[0].After != "GET /login" {
+		t.Fatalf("unexpected rules %+v", cfg.SequenceRules)
+	}
+	if rule := cfg.SequenceRules[1]; rule.Name != "POST /api/comments" || rule.Score != 1 {
+		t.Fatalf("unexpected defaults %+v", rule)
+	}
+
+	for _, bad := range []SequenceRule{
+		{MinCount: 1},
+		{Request: "POST login", MinCount: 1},
+		{Request: "POST /login now", MinCount: 1},
+		{Request: "POST /login"},
+		{Request: "POST /login", Statuses: []string{"6xx"}, MinCount: 1},
+		{Request: "POST /login", Within: "soon", MinCount: 1},
+	} {
+		if err := applyConfigDefaults(&cfg, FileConfig{SequenceRules: []SequenceRule{bad}}); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestAnalyzerSequenceRules(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 2
+	// Leave the generic error rules out of the way.
+	cfg.Min404Errors = 1000
+	cfg.MinErrorRatio = 1.1
+	cfg.SequenceRules = []SequenceRule{
+		{Name: "login without form", Request: "POST /login", Within: "30m", MinCount: 20, Score: 2},
+	}
+	a := New(cfg, nil)
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		// A stuffer posts straight to the form handler.
+		a.Process(Entry{Time: at, ClientIP: "198.51.100.4", Method: "POST", Status: 401, URI: "/login"})
+		// A person loads the form before each attempt.
+		a.Process(Entry{Time: at, ClientIP: "192.0.2.7", Method: "GET", Status: 200, URI: "/login?next=/account"})
+		a.Process(Entry{Time: at, ClientIP: "192.0.2.7", Method: "POST", Status: 401, URI: "/Login"})
+	}
+	// An office behind one IP loaded the form once, long ago.
+	a.Process(Entry{Time: start.Add(-time.Hour), ClientIP: "203.0.113.9", Method: "GET", Status: 200, URI: "/login"})
+	for i := 0; i < 30; i++ {
+		a.Process(Entry{Time: start.Add(time.Duration(i) * time.Second), ClientIP: "203.0.113.9", Method: "POST", Status: 401, URI: "/login"})
+	}
+
+	suspects := a.Suspicious()
+	if len(suspects) != 2 || suspects[0].IP == "192.0.2.7" || suspects[1].IP == "192.0.2.7" {
+		t.Fatalf("expected the IPs posting without a recent form load to be flagged, got %+v", suspects)
+	}
+	for _, suspect := range suspects {
+		if suspect.Score != 2 || !strings.Contains(strings.Join(suspect.Reasons, "; "), "login without form: 30 requests without a prior GET /login") {
+			t.Fatalf("unexpected score %d and reasons %v", suspect.Score, suspect.Reasons)
+		}
+		if !strings.Contains(strings.Join(suspect.Rules, ","), RuleSequence) {
+			t.Fatalf("expected the %s rule, got %v", RuleSequence, suspect.Rules)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Severity is a named band of suspicion scores.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"info", "low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < SeverityInfo || s > SeverityCritical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// parseSeverity converts a severity name such as "high" into a Severity.
+func parseSeverity(value string) (Severity, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for i, name := range severityNames {
+		if name == value {
+			return Severity(i), nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q (want %s)", value, strings.Join(severityNames, ", "))
+}
+
+// UnmarshalText lets severities be used as YAML map keys and values.
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := parseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// MarshalText renders severities by name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SeverityBoundaries holds the minimum score for each severity above info.
+type SeverityBoundaries struct {
+	Low      int `yaml:"low"`
+	Medium   int `yaml:"medium"`
+	High     int `yaml:"high"`
+	Critical int `yaml:"critical"`
+}
+
+// DefaultSeverityBoundaries mirrors the score bands historically used for coloring.
+func DefaultSeverityBoundaries() SeverityBoundaries {
+	return SeverityBoundaries{Low: 2, Medium: 3, High: 4, Critical: 6}
+}
+
+// Classify maps a score to its severity.
+func (b SeverityBoundaries) Classify(score int) Severity {
+	switch {
+	case score >= b.Critical:
+		return SeverityCritical
+	case score >= b.High:
+		return SeverityHigh
+	case score >= b.Medium:
+		return SeverityMedium
+	case score >= b.Low:
+		return SeverityLow
+	default:
+		return SeverityInfo
+	}
+}
+
+func (b SeverityBoundaries) validate() error {
+	if b.Low > b.Medium || b.Medium > b.High || b.High > b.Critical {
+		return fmt.Errorf("severity boundaries must be ascending (low=%d medium=%d high=%d critical=%d)", b.Low, b.Medium, b.High, b.Critical)
+	}
+	return nil
+}
+
+// highestSeverity returns the most severe level among suspects.
+func highestSeverity(suspects []Suspicion) Severity {
+	highest := SeverityInfo
+	for _, suspect := range suspects {
+		if suspect.Severity > highest {
+			highest = suspect.Severity
+		}
+	}
+	return highest
+}
+
+// severityExitCode returns the process exit code for a run: 10 plus the highest
+// severity when it reaches failOn, otherwise 0.
+func severityExitCode(suspects []Suspicion, failOn Severity) int {
+	if len(suspects) == 0 {
+		return 0
+	}
+	highest := highestSeverity(suspects)
+	if highest < failOn {
+		return 0
+	}
+	return 10 + int(highest)
+}
+
+// expiryFor returns the deny lifetime for a severity, falling back to the default ttl.
+func expiryFor(severity Severity, ttl time.Duration, bySeverity map[Severity]time.Duration) time.Duration {
+	if d, ok := bySeverity[severity]; ok && d > 0 {
+		return d
+	}
+	return ttl
+}
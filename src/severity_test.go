@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSeverityBoundariesClassify(t *testing.T) {
+	b := DefaultSeverityBoundaries()
+	tests := []struct {
+		score int
+		want  Severity
+	}{
+		{0, SeverityInfo},
+		{2, SeverityLow},
+		{3, SeverityMedium},
+		{5, SeverityHigh},
+		{9, SeverityCritical},
+	}
+	for _, tt := range tests {
+		if got := b.Classify(tt.score); got != tt.want {
+			t.Errorf("Classify(%d) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestSeverityExitCode(t *testing.T) {
+	suspects := []Suspicion{{Severity: SeverityMedium}, {Severity: SeverityHigh}}
+	if code := severityExitCode(suspects, SeverityCritical); code != 0 {
+		t.Fatalf("expected 0 below fail-on severity, got %d", code)
+	}
+	if code := severityExitCode(suspects, SeverityMedium); code != 13 {
+		t.Fatalf("expected 13 for high severity, got %d", code)
+	}
+}
+
+func TestSeverityConfigFromYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `severity:
+  low: 1
+  medium: 2
+  high: 3
+  critical: 5
+severity_expiry:
+  critical: 720h
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, defaults, err := loadConfigForCommand(path, "")
+	if err != nil {
+		t.Fatalf("loadConfigForCommand: %v", err)
+	}
+	if cfg.Severity.Classify(5) != SeverityCritical {
+		t.Fatalf("expected custom boundaries, got %+v", cfg.Severity)
+	}
+	if defaults.SeverityExpiry[SeverityCritical] != 720*time.Hour {
+		t.Fatalf("unexpected severity expiry: %v", defaults.SeverityExpiry)
+	}
+	if got := expiryFor(SeverityLow, time.Hour, defaults.SeverityExpiry); got != time.Hour {
+		t.Fatalf("expected fallback ttl for low severity, got %s", got)
+	}
+}
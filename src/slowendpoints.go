@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxEndpointTimes bounds the endpoints tracked per IP, like PathCounts.
+const maxEndpointTimes = 500
+
+// EndpointTime is the request time one IP spent on one endpoint.
+type EndpointTime struct {
+	Requests int
+	Seconds  float64
+}
+
+// endpointOf groups a URI into the route it hits: the path without its query
+// string, with all-digit segments replaced by {n} so /item/17 and /item/18
+// add up.
+func endpointOf(uri string) string {
+	path, _, _ := strings.Cut(uri, "?")
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && isDigits(segment) {
+			segments[i] = "{n}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *IPStats) recordEndpointTime(uri string, seconds float64) {
+	endpoint := endpointOf(uri)
+	if s.EndpointTimes == nil {
+		s.EndpointTimes = make(map[string]EndpointTime)
+	}
+	t, ok := s.EndpointTimes[endpoint]
+	if !ok && len(s.EndpointTimes) >= maxEndpointTimes {
+		return
+	}
+	t.Requests++
+	t.Seconds += seconds
+	s.EndpointTimes[endpoint] = t
+}
+
+// SlowEndpoint is an endpoint where suspects consumed upstream time.
+type SlowEndpoint struct {
+	Endpoint string
+	// Seconds and Requests are the suspects' share; Total is the request
+	// time of every client on the endpoint.
+	Seconds  float64
+	Requests int
+	IPs      int
+	Total    float64
+}
+
+// Share is the fraction of the endpoint's request time spent on suspects.
+func (e SlowEndpoint) Share() float64 {
+	if e.Total <= 0 {
+		return 0
+	}
+	return e.Seconds / e.Total
+}
+
+// slowEndpoints returns up to limit endpoints on which the suspects spent the
+// most request time, most seconds first. It is empty when the log records no
+// request time.
+func slowEndpoints(suspects []Suspicion, stats []*IPStats, limit int) []SlowEndpoint {
+	if limit <= 0 {
+		return nil
+	}
+	byEndpoint := make(map[string]*SlowEndpoint)
+	for _, suspect := range suspects {
+		if suspect.Stats == nil {
+			continue
+		}
+		for endpoint, t := range suspect.Stats.EndpointTimes {
+			slow, ok := byEndpoint[endpoint]
+			if !ok {
+				slow = &SlowEndpoint{Endpoint: endpoint}
+				byEndpoint[endpoint] = slow
+			}
+			slow.Seconds += t.Seconds
+			slow.Requests += t.Requests
+			slow.IPs++
+		}
+	}
+	if len(byEndpoint) == 0 {
+		return nil
+	}
+	for _, stat := range stats {
+		for endpoint, t := range stat.EndpointTimes {
+			if slow, ok := byEndpoint[endpoint]; ok {
+				slow.Total += t.Seconds
+			}
+		}
+	}
+
+	endpoints := make([]SlowEndpoint, 0, len(byEndpoint))
+	for _, slow := range byEndpoint {
+		endpoints = append(endpoints, *slow)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Seconds != endpoints[j].Seconds {
+			return endpoints[i].Seconds > endpoints[j].Seconds
+		}
+		return endpoints[i].Endpoint < endpoints[j].Endpoint
+	})
+	if len(endpoints) > limit {
+		endpoints = endpoints[:limit]
+	}
+	return endpoints
+}
+
+func printSlowEndpoints(colorize bool, endpoints []SlowEndpoint) {
+	if len(endpoints) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(maybeColor(colorize, ansiBold, "Slow endpoints (request time consumed by suspects)"))
+	for _, endpoint := range endpoints {
+		line := fmt.Sprintf("%-40s %9.1fs %4.0f%% of its time; %d requests from %d IPs", endpoint.Endpoint, endpoint.Seconds, endpoint.Share()*100, endpoint.Requests, endpoint.IPs)
+		fmt.Println(maybeColor(colorize, ansiYellow, line))
+	}
+}
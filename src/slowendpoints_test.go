@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEndpointOf(t *testing.T) {
+	cases := map[string]string{
+		"/search?q=shoes":       "/search",
+		"/item/17":              "/item/{n}",
+		"/api/v2/orders/42/pay": "/api/v2/orders/{n}/pay",
+		"/2025/10/post-title":   "/{n}/{n}/post-title",
+		"?x=1":                  "/",
+		"/":                     "/",
+	}
+	for uri, want := range cases {
+		if got := endpointOf(uri); got != want {
+			t.Errorf("endpointOf(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
+
+func TestSlowEndpoints(t *testing.T) {
+	analyzer := New(DefaultConfig(), nil)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		at := now.Add(time.Duration(i) * 10 * time.Second)
+		analyzer.Process(Entry{ClientIP: "192.0.2.7", Time: at, URI: "/search?q=" + string(rune('a'+i%26)), Status: 200, RequestTime: 2})
+		analyzer.Process(Entry{ClientIP: "192.0.2.8", Time: at, URI: "/item/" + string(rune('0'+i%10)), Status: 200, RequestTime: 1})
+	}
+	// A regular visitor shares the search endpoint.
+	for i := 0; i < 5; i++ {
+		analyzer.Process(Entry{ClientIP: "198.51.100.4", Time: now.Add(time.Duration(i) * time.Minute), URI: "/search?q=boots", Status: 200, RequestTime: 10})
+	}
+
+	var suspects []Suspicion
+	for _, ip := range []string{"192.0.2.7", "192.0.2.8"} {
+		suspect, _, _ := analyzer.Explain(ip)
+		suspects = append(suspects, suspect)
+	}
+	endpoints := slowEndpoints(suspects, analyzer.Stats(), 10)
+	if len(endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %+v", endpoints)
+	}
+	search, item := endpoints[0], endpoints[1]
+	if search.Endpoint != "/search" || search.Seconds != 200 || search.Requests != 100 || search.IPs != 1 || math.Abs(search.Share()-0.8) > 1e-9 {
+		t.Fatalf("unexpected search endpoint %+v (share %.2f)", search, search.Share())
+	}
+	if item.Endpoint != "/item/{n}" || item.Seconds != 100 || item.Share() != 1 {
+		t.Fatalf("unexpected item endpoint %+v", item)
+	}
+
+	if got := slowEndpoints(suspects, analyzer.Stats(), 1); len(got) != 1 || got[0].Endpoint != "/search" {
+		t.Fatalf("expected the limit to keep the slowest endpoint, got %+v", got)
+	}
+	if got := slowEndpoints(suspects, analyzer.Stats(), 0); got != nil {
+		t.Fatalf("expected 0 to disable the report, got %+v", got)
+	}
+}
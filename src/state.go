@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultStateRetention is how long ban records are kept in the state DB.
+const defaultStateRetention = 30 * 24 * time.Hour
+
+// StateDB persists ban history between runs as a JSON file.
+type StateDB struct {
+	path string
+	Bans []BanRecord `json:"bans"`
+	// Countries holds per-country request baselines learned from CountryRuns runs.
+	Countries   map[string]CountryBaseline `json:"countries,omitempty"`
+	CountryRuns int                        `json:"country_runs,omitempty"`
+	// Hours holds requests per hour by hour-of-week slot learned from HourRuns runs.
+	Hours    map[int]float64 `json:"hours,omitempty"`
+	HourRuns int             `json:"hour_runs,omitempty"`
+	// Canary holds when each IP was first flagged, for staged blocking.
+	Canary map[string]time.Time `json:"canary,omitempty"`
+	// Checkpoints record how far each log was analyzed, for --resume.
+	Checkpoints []LogCheckpoint `json:"checkpoints,omitempty"`
+}
+
+// BanRecord is a flagged IP remembered across runs.
+type BanRecord struct {
+	IP          string      `json:"ip"`
+	RunID       string      `json:"run_id"`
+	BannedAt    time.Time   `json:"banned_at"`
+	Score       int         `json:"score"`
+	Severity    Severity    `json:"severity"`
+	Reasons     []string    `json:"reasons"`
+	Fingerprint Fingerprint `json:"fingerprint"`
+}
+
+// openStateDB loads the state DB at path; a missing file yields an empty DB.
+func openStateDB(path string) (*StateDB, error) {
+	db := &StateDB{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Record stores the suspects of a run, replacing older records for the same IP.
+func (db *StateDB) Record(run RunInfo, suspects []Suspicion) {
+	index := make(map[string]int, len(db.Bans))
+	for i, ban := range db.Bans {
+		index[ban.IP] = i
+	}
+	now := time.Now().UTC()
+	for _, suspect := range suspects {
+		record := BanRecord{
+			IP:       suspect.IP,
+			RunID:    run.ID,
+			BannedAt: now,
+			Score:    suspect.Score,
+			Severity: suspect.Severity,
+			Reasons:  suspect.Reasons,
+		}
+		if suspect.Stats != nil {
+			record.Fingerprint = fingerprintFor(suspect.Stats)
+		}
+		if i, ok := index[suspect.IP]; ok {
+			db.Bans[i] = record
+			continue
+		}
+		index[suspect.IP] = len(db.Bans)
+		db.Bans = append(db.Bans, record)
+	}
+}
+
+// ImportBans seeds the ban history with records read from a block log,
+// keeping the latest per IP and leaving IPs already in the DB alone. Imported
+// IPs also count as flagged since their ban for the canary period, so past
+// offenders are not staged again. It returns the number of IPs imported.
+func (db *StateDB) ImportBans(bans []BanRecord) int {
+	known := make(map[string]struct{}, len(db.Bans))
+	for _, ban := range db.Bans {
+		known[ban.IP] = struct{}{}
+	}
+	latest := make(map[string]BanRecord)
+	for _, ban := range bans {
+		if _, ok := known[ban.IP]; ok {
+			continue
+		}
+		if prev, ok := latest[ban.IP]; ok && !ban.BannedAt.After(prev.BannedAt) {
+			continue
+		}
+		latest[ban.IP] = ban
+	}
+	if db.Canary == nil {
+		db.Canary = make(map[string]time.Time)
+	}
+	for ip, ban := range latest {
+		db.Bans = append(db.Bans, ban)
+		if first, ok := db.Canary[ip]; !ok || ban.BannedAt.Before(first) {
+			db.Canary[ip] = ban.BannedAt
+		}
+	}
+	return len(latest)
+}
+
+// Prune drops ban records older than retention.
+func (db *StateDB) Prune(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-retention)
+	kept := db.Bans[:0]
+	for _, ban := range db.Bans {
+		if ban.BannedAt.After(cutoff) {
+			kept = append(kept, ban)
+		}
+	}
+	db.Bans = kept
+	for ip, first := range db.Canary {
+		if !first.After(cutoff) {
+			delete(db.Canary, ip)
+		}
+	}
+}
+
+// Save writes the state DB atomically.
+func (db *StateDB) Save() error {
+	sort.Slice(db.Bans, func(i, j int) bool { return db.Bans[i].BannedAt.Before(db.Bans[j].BannedAt) })
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(db.path), 0o755); err != nil {
+		return err
+	}
+	tmp := db.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, db.path)
+}
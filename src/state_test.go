@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateDBRecordPruneAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "botdeny.json")
+	db, err := openStateDB(path)
+	if err != nil {
+		t.Fatalf("open missing state db: %v", err)
+	}
+
+	stat := &IPStats{IP: "192.0.2.5", Requests: 3, UserAgents: map[string]int{"curl/8": 3}, PathCounts: map[string]int{"/wp-login.php": 3}}
+	db.Bans = append(db.Bans, BanRecord{IP: "192.0.2.99", BannedAt: time.Now().Add(-48 * time.Hour)})
+	db.Record(RunInfo{ID: "run-1"}, []Suspicion{{IP: "192.0.2.5", Score: 4, Stats: stat}})
+	db.Record(RunInfo{ID: "run-2"}, []Suspicion{{IP: "192.0.2.5", Score: 6, Stats: stat}})
+	db.Prune(24 * time.Hour)
+	if err := db.Save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	reloaded, err := openStateDB(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if len(reloaded.Bans) != 1 {
+		t.Fatalf("expected one ban after prune and dedupe, got %+v", reloaded.Bans)
+	}
+	ban := reloaded.Bans[0]
+	if ban.RunID != "run-2" || ban.Score != 6 || ban.Fingerprint.UserAgent != "curl/8" {
+		t.Fatalf("unexpected ban record %+v", ban)
+	}
+}
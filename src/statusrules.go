@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatusRule scores IPs by the share of their responses in a status class,
+// so a wall of 403s from a WAF, 404 probing, 429 rate limiting and 5xx
+// errors can each be weighed on their own.
+type StatusRule struct {
+	// Name labels the rule in reasons; it defaults to the statuses.
+	Name string `yaml:"name"`
+	// Statuses lists codes such as 403 and classes such as 5xx.
+	Statuses []string `yaml:"statuses"`
+	// MinCount and MinRatio must both be reached; a zero MinRatio
+	// only requires the count.
+	MinCount int     `yaml:"min_count"`
+	MinRatio float64 `yaml:"min_ratio"`
+	// Score is added when the rule fires, 1 when unset.
+	Score int `yaml:"score"`
+}
+
+// validate checks the statuses and fills in the name and score defaults.
+func (r *StatusRule) validate() error {
+	if len(r.Statuses) == 0 {
+		return fmt.Errorf("needs statuses, such as [403] or [5xx]")
+	}
+	for _, status := range r.Statuses {
+		if _, _, err := statusRange(status); err != nil {
+			return err
+		}
+	}
+	if r.MinCount <= 0 {
+		return fmt.Errorf("min_count must be positive")
+	}
+	if r.MinRatio < 0 || r.MinRatio > 1 {
+		return fmt.Errorf("min_ratio %.2f is outside 0-1", r.MinRatio)
+	}
+	if r.Score < 0 {
+		return fmt.Errorf("score must not be negative")
+	}
+	if r.Score == 0 {
+		r.Score = 1
+	}
+	if r.Name == "" {
+		r.Name = strings.Join(r.Statuses, "/")
+	}
+	return nil
+}
+
+// statusRange parses a status code such as 429 or a class such as 4xx into
+// the inclusive range of codes it covers.
+func statusRange(status string) (int, int, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+		low := int(status[0]-'0') * 100
+		return low, low + 99, nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("invalid status %q (want a code such as 403 or a class such as 5xx)", status)
+	}
+	return code, code, nil
+}
+
+// count returns how many responses in counts the rule covers.
+func (r StatusRule) count(counts map[int]int) int {
+	total := 0
+	for code, n := range counts {
+		for _, status := range r.Statuses {
+			if low, high, err := statusRange(status); err == nil && code >= low && code <= high {
+				total += n
+				break
+			}
+		}
+	}
+	return total
+}
+
+// statusRuleReasons evaluates the status rules against stat and returns the
+// score they add and their reasons.
+func (a *Analyzer) statusRuleReasons(stat *IPStats) (int, []string) {
+	score := 0
+	var reasons []string
+	for _, rule := range a.cfg.StatusRules {
+		count := rule.count(stat.StatusCounts)
+		if count < rule.MinCount || stat.Requests == 0 {
+			continue
+		}
+		ratio := float64(count) / float64(stat.Requests)
+		if ratio < rule.MinRatio {
+			continue
+		}
+		score += rule.Score
+		reasons = append(reasons, fmt.Sprintf("%d %s responses (%.0f%%)", count, rule.Name, ratio*100))
+	}
+	return score, reasons
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStatusRulesConfig(t *testing.T) {
+	var fc FileConfig
+	data := `
+status_rules:
+  - name: waf wall
+    statuses: [403]
+    min_count: 20
+    min_ratio: 0.8
+    score: 2
+  - statuses: [5xx, 429]
+    min_count: 10
+`
+	if err := yaml.Unmarshal([]byte(data), &fc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	cfg := DefaultConfig()
+	if err := applyConfigDefaults(&cfg, fc); err != nil {
+		t.Fatalf("applyConfigDefaults: %v", err)
+	}
+	if len(cfg.StatusRules) != 2 || cfg.StatusRules[1].Name != "5xx/429" || cfg.StatusRules[1].Score != 1 {
+		t.Fatalf("unexpected rules %+v", cfg.StatusRules)
+	}
+
+	for _, bad := range []StatusRule{
+		{MinCount: 1},
+		{Statuses: []string{"6xx"}, MinCount: 1},
+		{Statuses: []string{"forbidden"}, MinCount: 1},
+		{Statuses: []string{"403"}},
+		{Statuses: []string{"403"}, MinCount: 1, MinRatio: 1.5},
+	} {
+		if err := applyConfigDefaults(&cfg, FileConfig{StatusRules: []StatusRule{bad}}); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestAnalyzerStatusRules(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 2
+	// Leave the generic error rules out of the way.
+	cfg.Min404Errors = 1000
+	cfg.MinErrorRatio = 1.1
+	cfg.StatusRules = []StatusRule{
+		{Name: "WAF 403", Statuses: []string{"403"}, MinCount: 20, MinRatio: 0.8, Score: 2},
+		{Name: "404", Statuses: []string{"404"}, MinCount: 20, MinRatio: 0.8, Score: 1},
+	}
+	a := New(cfg, nil)
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		a.Process(Entry{Time: now, ClientIP: "198.51.100.4", RemoteAddr: "198.51.100.4", Status: 403, URI: "/"})
+		a.Process(Entry{Time: now, ClientIP: "192.0.2.7", RemoteAddr: "192.0.2.7", Status: 404, URI: "/"})
+	}
+
+	suspects := a.Suspicious()
+	if len(suspects) != 1 || suspects[0].IP != "198.51.100.4" {
+		t.Fatalf("expected only the IP hitting the WAF to be flagged, got %+v", suspects)
+	}
+	if suspects[0].Score != 2 || !strings.Contains(strings.Join(suspects[0].Reasons, "; "), "30 WAF 403 responses (100%)") {
+		t.Fatalf("unexpected score %d and reasons %v", suspects[0].Score, suspects[0].Reasons)
+	}
+	if !strings.Contains(strings.Join(suspects[0].Rules, ","), RuleStatus) {
+		t.Fatalf("expected the %s rule, got %v", RuleStatus, suspects[0].Rules)
+	}
+}
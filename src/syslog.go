@@ -0,0 +1,37 @@
+package main
+
+import "regexp"
+
+var (
+	// syslogBSD matches an RFC 3164 header such as
+	// "<190>Oct 19 12:02:35 web1 nginx: ", as sent by nginx's syslog: target.
+	// The priority is optional since rsyslog drops it when writing files, and
+	// so is the hostname, which nginx omits with nohostname. The tag must start
+	// with a letter and be followed by ": ", so a leading IPv6 address is not
+	// mistaken for one.
+	syslogBSD = regexp.MustCompile(`^(?:<\d{1,3}>)?[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} (?:(\S+) )?[A-Za-z][^\s:\[]*(?:\[\d+\])?: `)
+	// syslogISO matches the same header with an RFC 3339 timestamp, as
+	// written by rsyslog's RSYSLOG_FileFormat template.
+	syslogISO = regexp.MustCompile(`^(?:<\d{1,3}>)?\d{4}-\d{2}-\d{2}T\S+ (?:(\S+) )?[A-Za-z][^\s:\[]*(?:\[\d+\])?: `)
+	// syslog5424 matches an RFC 5424 header: version, timestamp, hostname,
+	// app name, process ID, message ID and structured data.
+	syslog5424 = regexp.MustCompile(`^<\d{1,3}>\d{1,2} \S+ (\S+) \S+ \S+ \S+ (?:-|(?:\[(?:[^\]\\]|\\.)*\])+) ?(?:\x{FEFF})?`)
+)
+
+// stripSyslogEnvelope removes the syslog header from an access log line
+// shipped through syslog and returns the body and the sending hostname.
+// Lines without a header are returned unchanged with an empty hostname.
+func stripSyslogEnvelope(line string) (string, string) {
+	for _, envelope := range []*regexp.Regexp{syslog5424, syslogBSD, syslogISO} {
+		loc := envelope.FindStringSubmatchIndex(line)
+		if loc == nil {
+			continue
+		}
+		host := ""
+		if loc[2] >= 0 && line[loc[2]:loc[3]] != "-" {
+			host = line[loc[2]:loc[3]]
+		}
+		return line[loc[1]:], host
+	}
+	return line, ""
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripSyslogEnvelope(t *testing.T) {
+	const body = `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET /cart HTTP/1.1" 404 512 "-" "curl/8.0"`
+	tests := []struct {
+		line string
+		host string
+	}{
+		{"<190>Oct 19 12:02:35 web1 nginx: " + body, "web1"},
+		{"<190>Oct  9 12:02:35 nginx: " + body, ""},
+		{"Oct 19 12:02:35 web2 nginx[812]: " + body, "web2"},
+		{"2025-10-19T12:02:35.123456+00:00 web3 nginx: " + body, "web3"},
+		{"<190>1 2025-10-19T12:02:35.123Z web4 nginx - - - " + body, "web4"},
+		{`<190>1 2025-10-19T12:02:35Z web5 nginx 812 access [meta sequenceId="1"] ` + body, "web5"},
+		{"<190>1 2025-10-19T12:02:35Z - nginx - - - " + body, ""},
+		{body, ""},
+	}
+	for _, tt := range tests {
+		got, host := stripSyslogEnvelope(tt.line)
+		if got != body || host != tt.host {
+			t.Errorf("stripSyslogEnvelope(%q) = %q, %q; want body and host %q", tt.line, got, host, tt.host)
+		}
+	}
+
+	// Lines of other formats that start with a timestamp are left alone.
+	elb := "2025-10-19T12:02:35.123456Z my-elb fe80::1:51234 10.0.0.1:80 0.000 0.001 0.000 200 200 0 512 \"GET https://example.com:443/ HTTP/1.1\" \"curl/8.0\" - -"
+	if got, host := stripSyslogEnvelope(elb); got != elb || host != "" {
+		t.Errorf("expected the ELB line to be kept, got %q, %q", got, host)
+	}
+}
+
+func TestStreamAttributesSyslogHosts(t *testing.T) {
+	log := "<190>Oct 19 12:02:35 web1 nginx: 192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] \"GET /a HTTP/1.1\" 404 0 \"-\" \"curl/8.0\"\n" +
+		"<190>Oct 19 12:02:36 web2 nginx: 192.0.2.7 - - [19/Oct/2025:12:02:36 +0000] \"GET /b HTTP/1.1\" 404 0 \"-\" \"curl/8.0\"\n" +
+		"<190>Oct 19 12:02:37 web2 nginx: 192.0.2.7 - - [19/Oct/2025:12:02:37 +0000] \"GET /c HTTP/1.1\" 404 0 \"-\" \"curl/8.0\"\n"
+	entries, errs := Stream(strings.NewReader(log))
+	analyzer := New(DefaultConfig(), nil)
+	for entry := range entries {
+		analyzer.Process(entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	stat := analyzer.stats["192.0.2.7"]
+	if stat == nil || stat.Requests != 3 || strings.Join(hostNames(stat), ",") != "web2,web1" {
+		t.Fatalf("expected requests attributed to both hosts, got %+v", stat)
+	}
+}
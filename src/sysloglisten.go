@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxSyslogMessage bounds one syslog message. Longer TCP lines are cut there
+// and the rest is read as the next message.
+const maxSyslogMessage = 64 << 10
+
+// parseSyslogListen splits a --syslog-listen address such as udp://:514 or
+// tcp://0.0.0.0:1514 into its network and address.
+func parseSyslogListen(spec string) (string, string, error) {
+	network, addr, ok := strings.Cut(spec, "://")
+	if !ok || (network != "udp" && network != "tcp") || addr == "" {
+		return "", "", fmt.Errorf("syslog listen %q: want udp://host:port or tcp://host:port", spec)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", fmt.Errorf("syslog listen %q: %w", spec, err)
+	}
+	return network, addr, nil
+}
+
+// loopbackListen reports whether addr, a host:port, only accepts local
+// senders. An empty host listens on every interface.
+func loopbackListen(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// parseSyslogAllow parses the CIDRs or single IPs allowed to send syslog.
+func parseSyslogAllow(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("syslog allow %q: want an IP or CIDR", value)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// syslogListener receives syslog messages over UDP and TCP, as sent by
+// nginx's access_log syslog:server= target or relayed by rsyslog, and reads
+// them as log lines, one message per line. The syslog header is left in
+// place for StreamWith to strip. Messages from senders outside allow, when
+// set, are dropped and recorded in problems.
+type syslogListener struct {
+	messages chan string
+	done     <-chan struct{}
+	pending  []byte
+	allow    []netip.Prefix
+	problems *Problems
+	addrs    []string
+
+	mu      sync.Mutex
+	closed  bool
+	closers map[io.Closer]bool
+	wg      sync.WaitGroup
+}
+
+// listenSyslog starts listening on every spec until ctx is done. Without
+// allow it only listens on loopback addresses, since any sender that can
+// reach the port can get addresses denied.
+func listenSyslog(ctx context.Context, specs []string, allow []netip.Prefix, problems *Problems) (*syslogListener, error) {
+	l := &syslogListener{
+		messages: make(chan string, 1024),
+		done:     ctx.Done(),
+		allow:    allow,
+		problems: problems,
+		closers:  make(map[io.Closer]bool),
+	}
+	for _, spec := range specs {
+		network, addr, err := parseSyslogListen(spec)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if len(allow) == 0 && !loopbackListen(addr) {
+			l.Close()
+			return nil, fmt.Errorf("syslog listen %q: listening beyond loopback requires syslog_allow (--syslog-allow)", spec)
+		}
+		if network == "udp" {
+			conn, err := net.ListenPacket("udp", addr)
+			if err != nil {
+				l.Close()
+				return nil, err
+			}
+			l.track(conn)
+			l.addrs = append(l.addrs, "udp://"+conn.LocalAddr().String())
+			l.wg.Add(1)
+			go l.serveUDP(conn)
+			continue
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.track(ln)
+		l.addrs = append(l.addrs, "tcp://"+ln.Addr().String())
+		l.wg.Add(1)
+		go l.serveTCP(ln)
+	}
+	// Unblock the network reads once ctx is done.
+	go func() {
+		<-l.done
+		l.Close()
+	}()
+	return l, nil
+}
+
+// Addrs lists the bound addresses, with the ports picked for ":0".
+func (l *syslogListener) Addrs() []string {
+	return l.addrs
+}
+
+// track registers c to be closed by Close. It reports false, closing c,
+// when the listener is already closed.
+func (l *syslogListener) track(c io.Closer) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		c.Close()
+		return false
+	}
+	l.closers[c] = true
+	return true
+}
+
+func (l *syslogListener) untrack(c io.Closer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.closers, c)
+}
+
+// Read returns the received messages as newline-terminated lines until ctx
+// is done, then io.EOF.
+func (l *syslogListener) Read(p []byte) (int, error) {
+	for len(l.pending) == 0 {
+		select {
+		case msg := <-l.messages:
+			l.pending = append(append(l.pending[:0], msg...), '\n')
+		case <-l.done:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, l.pending)
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+// Close stops listening, closes open TCP connections and waits for the
+// receiving goroutines.
+func (l *syslogListener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	closers := l.closers
+	l.closers = make(map[io.Closer]bool)
+	l.mu.Unlock()
+	for c := range closers {
+		c.Close()
+	}
+	l.wg.Wait()
+	return nil
+}
+
+func (l *syslogListener) allowed(addr net.Addr) bool {
+	if len(l.allow) == 0 {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	for _, prefix := range l.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	l.problems.Add(ProblemSyslog, fmt.Sprintf("%s: sender not in syslog_allow", ip))
+	return false
+}
+
+// deliver queues the lines of one message. It reports false once ctx is done.
+func (l *syslogListener) deliver(msg []byte) bool {
+	for _, line := range bytes.Split(msg, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r\x00")
+		if len(line) == 0 {
+			continue
+		}
+		select {
+		case l.messages <- string(line):
+		case <-l.done:
+			return false
+		}
+	}
+	return true
+}
+
+func (l *syslogListener) serveUDP(conn net.PacketConn) {
+	defer l.wg.Done()
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog udp: %v", err)
+			}
+			return
+		}
+		if l.allowed(addr) && !l.deliver(buf[:n]) {
+			return
+		}
+	}
+}
+
+func (l *syslogListener) serveTCP(ln net.Listener) {
+	defer l.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog tcp: %v", err)
+			}
+			return
+		}
+		if !l.allowed(conn.RemoteAddr()) {
+			conn.Close()
+			continue
+		}
+		if !l.track(conn) {
+			return
+		}
+		l.wg.Add(1)
+		go l.serveConn(conn)
+	}
+}
+
+func (l *syslogListener) serveConn(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.untrack(conn)
+		conn.Close()
+	}()
+	r := bufio.NewReaderSize(conn, maxSyslogMessage)
+	for {
+		msg, err := readSyslogFrame(r)
+		if len(msg) > 0 && !l.deliver(msg) {
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("syslog tcp %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads one message from a TCP syslog stream framed either by
+// octet counting ("LEN <PRI>...", RFC 6587) or by a trailing newline. Lines
+// sent without a syslog header may start with digits too, such as an IPv4
+// address; a prefix that is not a length is kept as the start of a line.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	var prefix []byte
+	if first, err := r.Peek(1); err != nil {
+		return nil, err
+	} else if isDigit(first[0]) {
+		word, err := r.ReadSlice(' ')
+		if err != nil {
+			return bytes.Clone(word), err
+		}
+		size, err := strconv.Atoi(string(word[:len(word)-1]))
+		if err == nil && size > 0 && size <= maxSyslogMessage {
+			msg := make([]byte, size)
+			_, err = io.ReadFull(r, msg)
+			return msg, err
+		}
+		prefix = bytes.Clone(word)
+	}
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		err = nil
+	}
+	return append(prefix, line...), err
+}
+
+// followSyslog listens on specs and feeds the received access lines to the
+// follower until ctx is done.
+func followSyslog(ctx context.Context, specs []string, allow []netip.Prefix, streamOpts StreamOptions, follower *Follower) error {
+	listener, err := listenSyslog(ctx, specs, allow, follower.opts.Problems)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	return followStream(strings.Join(listener.Addrs(), ", "), listener, streamOpts, follower)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogListen(t *testing.T) {
+	network, addr, err := parseSyslogListen("udp://:514")
+	if err != nil || network != "udp" || addr != ":514" {
+		t.Fatalf("unexpected %q %q %v", network, addr, err)
+	}
+	for _, spec := range []string{":514", "unix:///dev/log", "tcp://", "tcp://localhost"} {
+		if _, _, err := parseSyslogListen(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+	if _, err := parseSyslogAllow([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"}); err != nil {
+		t.Fatalf("parseSyslogAllow: %v", err)
+	}
+	if _, err := parseSyslogAllow([]string{"web1"}); err == nil {
+		t.Fatal("expected a hostname to be rejected")
+	}
+}
+
+func TestListenSyslogRequiresAllowBeyondLoopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := listenSyslog(ctx, []string{"udp://:0"}, nil, nil); err == nil || !strings.Contains(err.Error(), "syslog_allow") {
+		t.Fatalf("expected an open listener without syslog_allow to be refused, got %v", err)
+	}
+	allow, _ := parseSyslogAllow([]string{"127.0.0.1"})
+	listener, err := listenSyslog(ctx, []string{"udp://:0"}, allow, nil)
+	if err != nil {
+		t.Fatalf("listenSyslog: %v", err)
+	}
+	listener.Close()
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	stream := "<190>Oct 19 12:02:35 web1 nginx: first\n" +
+		"29 <190>1 - web2 nginx - - - two" +
+		"192.0.2.7 - - raw line\n"
+	r := bufio.NewReader(strings.NewReader(stream))
+	want := []string{
+		"<190>Oct 19 12:02:35 web1 nginx: first\n",
+		"<190>1 - web2 nginx - - - two",
+		"192.0.2.7 - - raw line\n",
+	}
+	for i, w := range want {
+		msg, err := readSyslogFrame(r)
+		if err != nil || string(msg) != w {
+			t.Fatalf("frame %d: got %q, %v; want %q", i, msg, err, w)
+		}
+	}
+}
+
+// syslogLine is an access line as nginx's syslog: target sends it.
+func syslogLine(host string, ip string, at time.Time, uri string) string {
+	return fmt.Sprintf("<190>%s %s nginx: %s - - [%s] \"GET %s HTTP/1.1\" 404 12 \"-\" \"zgrab\"", at.Format(time.Stamp), host, ip, at.Format(timeLayout), uri)
+}
+
+func TestSyslogListenerReceivesUDPAndTCP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener, err := listenSyslog(ctx, []string{"udp://127.0.0.1:0", "tcp://127.0.0.1:0"}, nil, newProblems())
+	if err != nil {
+		t.Fatalf("listenSyslog: %v", err)
+	}
+	defer listener.Close()
+	addrs := listener.Addrs()
+
+	now := time.Now()
+	udp, err := net.Dial("udp", strings.TrimPrefix(addrs[0], "udp://"))
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, syslogLine("web1", "198.51.100.4", now, "/udp"))
+
+	tcp, err := net.Dial("tcp", strings.TrimPrefix(addrs[1], "tcp://"))
+	if err != nil {
+		t.Fatalf("dial tcp: %v", err)
+	}
+	defer tcp.Close()
+	fmt.Fprintf(tcp, "%s\n", syslogLine("web2", "198.51.100.5", now, "/tcp"))
+
+	entries, errs := StreamWith(listener, StreamOptions{})
+	hosts := map[string]string{}
+	for entry := range entries {
+		hosts[entry.URI] = entry.Hostname
+		if len(hosts) == 2 {
+			cancel()
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if hosts["/udp"] != "web1" || hosts["/tcp"] != "web2" {
+		t.Fatalf("expected both lines attributed to their senders, got %v", hosts)
+	}
+}
+
+func TestSyslogListenerDropsOtherSenders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	problems := newProblems()
+	allow := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	listener, err := listenSyslog(ctx, []string{"udp://127.0.0.1:0"}, allow, problems)
+	if err != nil {
+		t.Fatalf("listenSyslog: %v", err)
+	}
+	defer listener.Close()
+	conn, err := net.Dial("udp", strings.TrimPrefix(listener.Addrs()[0], "udp://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, syslogLine("web1", "198.51.100.4", time.Now(), "/"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for problems.Count(ProblemSyslog) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the sender outside syslog_allow was never recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case msg := <-listener.messages:
+		t.Fatalf("expected the message to be dropped, got %q", msg)
+	default:
+	}
+}
+
+func TestFollowSyslog(t *testing.T) {
+	denyPath := filepath.Join(t.TempDir(), "deny.conf")
+	cfg := DefaultConfig()
+	cfg.MinRequests = 10
+	follower := newFollower(cfg, nil, RunInfo{}, FollowOptions{
+		Window:     time.Hour,
+		Interval:   50 * time.Millisecond,
+		DenyOutput: denyPath,
+		Deny:       DenyOptions{Minimal: true},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	listener, err := listenSyslog(ctx, []string{"udp://127.0.0.1:0"}, nil, nil)
+	if err != nil {
+		t.Fatalf("listenSyslog: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer listener.Close()
+		done <- followStream("syslog", listener, StreamOptions{}, follower)
+	}()
+
+	conn, err := net.Dial("udp", strings.TrimPrefix(listener.Addrs()[0], "udp://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	now := time.Now()
+	for i := 0; i < 40; i++ {
+		fmt.Fprint(conn, syslogLine("web1", "198.51.100.4", now.Add(time.Duration(i-60)*time.Second), fmt.Sprintf("/x%d.php", i)))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(denyPath)
+		if strings.Contains(string(data), "deny 198.51.100.4;") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deny file never picked up the syslog attack, got %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("follow: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("follow did not stop after cancel")
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telemetry records OpenTelemetry spans and metrics for a run and exports them
+// with OTLP/HTTP JSON. A nil *Telemetry is valid and records nothing.
+type Telemetry struct {
+	endpoint string
+	service  string
+	headers  http.Header
+	client   *http.Client
+
+	mu      sync.Mutex
+	traceID string
+	spans   []*Span
+	metrics []otlpMetric
+	started time.Time
+}
+
+// Span is a timed pipeline stage.
+type Span struct {
+	id       string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []otlpAttribute
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpMetric struct {
+	Name  string         `json:"name"`
+	Unit  string         `json:"unit,omitempty"`
+	Sum   map[string]any `json:"sum,omitempty"`
+	Gauge map[string]any `json:"gauge,omitempty"`
+}
+
+// newTelemetry returns nil when endpoint is empty. The service name and extra
+// headers follow the standard OTEL_SERVICE_NAME and OTEL_EXPORTER_OTLP_HEADERS variables.
+func newTelemetry(endpoint string) *Telemetry {
+	if endpoint == "" {
+		return nil
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "botdeny"
+	}
+	headers := http.Header{}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if ok && strings.TrimSpace(key) != "" {
+			headers.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+	return &Telemetry{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		service:  service,
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		traceID:  randomHex(16),
+		started:  time.Now(),
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Start opens a span; parent may be nil for the root span.
+func (t *Telemetry) Start(name string, parent *Span) *Span {
+	if t == nil {
+		return nil
+	}
+	span := &Span{id: randomHex(8), name: name, start: time.Now()}
+	if parent != nil {
+		span.parentID = parent.id
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return span
+}
+
+// End closes the span.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+}
+
+// SetAttr attaches a string, bool, integer or float attribute.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, otlpAttr(key, value))
+}
+
+func otlpAttr(key string, value any) otlpAttribute {
+	switch v := value.(type) {
+	case bool:
+		return otlpAttribute{Key: key, Value: map[string]any{"boolValue": v}}
+	case int:
+		return otlpAttribute{Key: key, Value: map[string]any{"intValue": strconv.Itoa(v)}}
+	case int64:
+		return otlpAttribute{Key: key, Value: map[string]any{"intValue": strconv.FormatInt(v, 10)}}
+	case float64:
+		return otlpAttribute{Key: key, Value: map[string]any{"doubleValue": v}}
+	default:
+		return otlpAttribute{Key: key, Value: map[string]any{"stringValue": fmt.Sprint(v)}}
+	}
+}
+
+// Count records a per-run delta counter.
+func (t *Telemetry) Count(name, unit string, value int64, attrs ...otlpAttribute) {
+	if t == nil {
+		return
+	}
+	point := map[string]any{
+		"asInt":             strconv.FormatInt(value, 10),
+		"startTimeUnixNano": unixNano(t.started),
+		"timeUnixNano":      unixNano(time.Now()),
+		"attributes":        attrs,
+	}
+	t.addMetric(otlpMetric{Name: name, Unit: unit, Sum: map[string]any{
+		"aggregationTemporality": 1,
+		"isMonotonic":            true,
+		"dataPoints":             []any{point},
+	}})
+}
+
+// Gauge records a point-in-time value.
+func (t *Telemetry) Gauge(name, unit string, value float64, attrs ...otlpAttribute) {
+	if t == nil {
+		return
+	}
+	point := map[string]any{
+		"asDouble":     value,
+		"timeUnixNano": unixNano(time.Now()),
+		"attributes":   attrs,
+	}
+	t.addMetric(otlpMetric{Name: name, Unit: unit, Gauge: map[string]any{"dataPoints": []any{point}}})
+}
+
+func (t *Telemetry) addMetric(metric otlpMetric) {
+	t.mu.Lock()
+	t.metrics = append(t.metrics, metric)
+	t.mu.Unlock()
+}
+
+func unixNano(ts time.Time) string {
+	return strconv.FormatInt(ts.UnixNano(), 10)
+}
+
+func (t *Telemetry) resource() map[string]any {
+	host, _ := os.Hostname()
+	return map[string]any{"attributes": []otlpAttribute{
+		otlpAttr("service.name", t.service),
+		otlpAttr("host.name", host),
+	}}
+}
+
+func (t *Telemetry) tracesPayload() map[string]any {
+	spans := make([]map[string]any, 0, len(t.spans))
+	for _, span := range t.spans {
+		end := span.end
+		if end.IsZero() {
+			end = time.Now()
+		}
+		spans = append(spans, map[string]any{
+			"traceId":           t.traceID,
+			"spanId":            span.id,
+			"parentSpanId":      span.parentID,
+			"name":              span.name,
+			"kind":              1,
+			"startTimeUnixNano": unixNano(span.start),
+			"endTimeUnixNano":   unixNano(end),
+			"attributes":        span.attrs,
+		})
+	}
+	return map[string]any{"resourceSpans": []any{map[string]any{
+		"resource":   t.resource(),
+		"scopeSpans": []any{map[string]any{"scope": map[string]any{"name": "botdeny"}, "spans": spans}},
+	}}}
+}
+
+func (t *Telemetry) metricsPayload() map[string]any {
+	return map[string]any{"resourceMetrics": []any{map[string]any{
+		"resource":     t.resource(),
+		"scopeMetrics": []any{map[string]any{"scope": map[string]any{"name": "botdeny"}, "metrics": t.metrics}},
+	}}}
+}
+
+// Flush exports recorded spans and metrics and resets them.
+func (t *Telemetry) Flush() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	traces, metrics := t.tracesPayload(), t.metricsPayload()
+	hasSpans, hasMetrics := len(t.spans) > 0, len(t.metrics) > 0
+	t.spans, t.metrics = nil, nil
+	t.traceID = randomHex(16)
+	t.started = time.Now()
+	t.mu.Unlock()
+
+	if hasSpans {
+		if err := t.post("/v1/traces", traces); err != nil {
+			return fmt.Errorf("export traces: %w", err)
+		}
+	}
+	if hasMetrics {
+		if err := t.post("/v1/metrics", metrics); err != nil {
+			return fmt.Errorf("export metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *Telemetry) post(path string, payload map[string]any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postJSON(t.client, t.endpoint+path, t.headers, body)
+}
+
+// recordSuspectMetrics reports analyzed IPs and suspects per severity.
+func recordSuspectMetrics(t *Telemetry, ips int, suspects []Suspicion) {
+	if t == nil {
+		return
+	}
+	t.Gauge("botdeny.ips", "{ip}", float64(ips))
+	bySeverity := make(map[Severity]int)
+	for _, suspect := range suspects {
+		bySeverity[suspect.Severity]++
+	}
+	for severity := SeverityInfo; severity <= SeverityCritical; severity++ {
+		t.Gauge("botdeny.suspects", "{ip}", float64(bySeverity[severity]), otlpAttr("severity", severity.String()))
+	}
+}
+
+// flushTelemetry exports pending data, logging rather than failing the run.
+func flushTelemetry(t *Telemetry) {
+	if err := t.Flush(); err != nil {
+		log.Printf("otlp: %v", err)
+	}
+}
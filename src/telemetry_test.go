@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTelemetryExportsSpansAndMetrics(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		payloads = make(map[string]map[string]any)
+		auth     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode %s: %v", r.URL.Path, err)
+		}
+		mu.Lock()
+		payloads[r.URL.Path] = body
+		auth = r.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	t.Setenv("OTEL_SERVICE_NAME", "edge-1")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer abc")
+	telemetry := newTelemetry(server.URL + "/")
+	root := telemetry.Start("botdeny.run", nil)
+	child := telemetry.Start("botdeny.ingest", root)
+	child.SetAttr("botdeny.entries", 42)
+	child.End()
+	root.End()
+	telemetry.Count("botdeny.entries", "{entry}", 42)
+	recordSuspectMetrics(telemetry, 10, []Suspicion{{Severity: SeverityHigh}, {Severity: SeverityHigh}})
+
+	if err := telemetry.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if auth != "Bearer abc" {
+		t.Fatalf("expected header from OTEL_EXPORTER_OTLP_HEADERS, got %q", auth)
+	}
+
+	traces, ok := payloads["/v1/traces"]
+	if !ok {
+		t.Fatalf("no traces exported: %v", payloads)
+	}
+	resource := traces["resourceSpans"].([]any)[0].(map[string]any)
+	service := resource["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if service["value"].(map[string]any)["stringValue"] != "edge-1" {
+		t.Fatalf("unexpected service attribute: %v", service)
+	}
+	spans := resource["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	rootSpan, childSpan := spans[0].(map[string]any), spans[1].(map[string]any)
+	if childSpan["parentSpanId"] != rootSpan["spanId"] || childSpan["traceId"] != rootSpan["traceId"] {
+		t.Fatalf("child span not linked to root: %v / %v", rootSpan, childSpan)
+	}
+	if len(rootSpan["traceId"].(string)) != 32 || len(rootSpan["spanId"].(string)) != 16 {
+		t.Fatalf("unexpected id lengths: %v", rootSpan)
+	}
+
+	metrics, ok := payloads["/v1/metrics"]
+	if !ok {
+		t.Fatal("no metrics exported")
+	}
+	list := metrics["resourceMetrics"].([]any)[0].(map[string]any)["scopeMetrics"].([]any)[0].(map[string]any)["metrics"].([]any)
+	// One entries counter, one IP gauge and one suspect gauge per severity.
+	if len(list) != 2+int(SeverityCritical-SeverityInfo)+1 {
+		t.Fatalf("unexpected metric count %d", len(list))
+	}
+	entries := list[0].(map[string]any)
+	point := entries["sum"].(map[string]any)["dataPoints"].([]any)[0].(map[string]any)
+	if entries["name"] != "botdeny.entries" || point["asInt"] != "42" {
+		t.Fatalf("unexpected entries metric: %v", entries)
+	}
+
+	payloads = make(map[string]map[string]any)
+	if err := telemetry.Flush(); err != nil {
+		t.Fatalf("second flush: %v", err)
+	}
+	if len(payloads) != 0 {
+		t.Fatalf("expected nothing to export after flush, got %v", payloads)
+	}
+}
+
+func TestNilTelemetryIsNoop(t *testing.T) {
+	telemetry := newTelemetry("")
+	span := telemetry.Start("botdeny.run", nil)
+	span.SetAttr("k", "v")
+	span.End()
+	telemetry.Count("botdeny.entries", "{entry}", 1)
+	recordSuspectMetrics(telemetry, 1, nil)
+	if err := telemetry.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+func TestTelemetryFlushReportsCollectorErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	telemetry := newTelemetry(server.URL)
+	telemetry.Start("botdeny.run", nil).End()
+	if err := telemetry.Flush(); err == nil {
+		t.Fatal("expected error from failing collector")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timeFormatNames maps --time-format shorthands to Go layouts.
+var timeFormatNames = map[string]string{
+	"kitchen":  time.Kitchen,
+	"rfc3339":  time.RFC3339,
+	"datetime": time.DateTime,
+	"stamp":    time.Stamp,
+}
+
+// longWindowLayout replaces the default Kitchen layout when the analyzed
+// window spans more than a day, where a bare time of day is ambiguous.
+const longWindowLayout = "Jan 02 15:04"
+
+// TimeDisplay controls how report tables show timestamps.
+type TimeDisplay struct {
+	Layout string
+	// Location converts timestamps before formatting; nil keeps the offset recorded in the log.
+	Location *time.Location
+	// Auto marks the default layout, which ForWindow may widen to include dates.
+	Auto bool
+}
+
+// parseTimeDisplay accepts a shorthand (kitchen, rfc3339, datetime, stamp) or a
+// Go layout, and an IANA zone name, "Local" or "UTC". Empty values keep the
+// historical Kitchen display in the log's own offset.
+func parseTimeDisplay(format, zone string) (TimeDisplay, error) {
+	display := TimeDisplay{Layout: time.Kitchen, Auto: format == ""}
+	if format != "" {
+		if layout, ok := timeFormatNames[strings.ToLower(format)]; ok {
+			display.Layout = layout
+		} else {
+			probe := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+			if probe.Format(format) == format {
+				return display, fmt.Errorf("time format %q has no time fields (want kitchen, rfc3339, datetime, stamp or a Go layout such as \"Jan 02 15:04\")", format)
+			}
+			display.Layout = format
+		}
+	}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return display, fmt.Errorf("timezone: %w", err)
+		}
+		display.Location = loc
+	}
+	return display, nil
+}
+
+// Format renders t, or "-" for the zero time.
+func (d TimeDisplay) Format(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	if d.Location != nil {
+		t = t.In(d.Location)
+	}
+	layout := d.Layout
+	if layout == "" {
+		layout = time.Kitchen
+	}
+	return t.Format(layout)
+}
+
+// ForWindow adds dates to the default layout when span exceeds 24 hours.
+// Explicitly configured layouts are kept as is.
+func (d TimeDisplay) ForWindow(span time.Duration) TimeDisplay {
+	if d.Auto && span > 24*time.Hour {
+		d.Layout = longWindowLayout
+	}
+	return d
+}
+
+// formatActive renders how long an IP was active, e.g. 45m, 3h12m or 3d2h.
+func formatActive(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	default:
+		return fmt.Sprintf("%dd%dh", int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour))
+	}
+}
+
+// Width is the column width that fits formatted timestamps, at least 8.
+func (d TimeDisplay) Width() int {
+	sample := d.Format(time.Date(2006, 12, 30, 23, 59, 59, 0, time.UTC))
+	return max(8, len(sample))
+}
+
+// timeBoundLayouts are the absolute forms --since and --until accept, read in
+// the --timezone zone (local time by default) unless they carry an offset.
+var timeBoundLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimeBound reads a --since or --until value: a duration such as 2h,
+// counted back from now, or a timestamp such as 2025-10-19T06:00 or RFC 3339.
+// An empty value is the zero time, meaning no bound.
+func parseTimeBound(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("duration %q must not be negative", value)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	for _, layout := range timeBoundLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration such as 2h nor a time such as 2025-10-19T06:00", value)
+}
+
+// parseTimeBounds parses --since and --until and checks that the window is not empty.
+func parseTimeBounds(since, until string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	from, err := parseTimeBound(since, now, loc)
+	if err != nil {
+		return from, time.Time{}, fmt.Errorf("since: %w", err)
+	}
+	to, err := parseTimeBound(until, now, loc)
+	if err != nil {
+		return from, to, fmt.Errorf("until: %w", err)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("since %s is not before until %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
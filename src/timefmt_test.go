@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeDisplay(t *testing.T) {
+	seen := time.Date(2025, 10, 19, 14, 5, 0, 0, time.FixedZone("", 2*3600))
+
+	cases := []struct {
+		format, zone, want string
+	}{
+		{"", "", "2:05PM"},
+		{"rfc3339", "", "2025-10-19T14:05:00+02:00"},
+		{"RFC3339", "UTC", "2025-10-19T12:05:00Z"},
+		{"datetime", "America/New_York", "2025-10-19 08:05:00"},
+		{"Jan 02 15:04", "", "Oct 19 14:05"},
+	}
+	for _, c := range cases {
+		display, err := parseTimeDisplay(c.format, c.zone)
+		if err != nil {
+			t.Fatalf("parseTimeDisplay(%q, %q): %v", c.format, c.zone, err)
+		}
+		if got := display.Format(seen); got != c.want {
+			t.Fatalf("format %q zone %q: got %q, want %q", c.format, c.zone, got, c.want)
+		}
+	}
+
+	if _, err := parseTimeDisplay("first seen", ""); err == nil {
+		t.Fatal("expected error for layout without time fields")
+	}
+	if _, err := parseTimeDisplay("", "Mars/Olympus"); err == nil {
+		t.Fatal("expected error for unknown timezone")
+	}
+}
+
+func TestTimeDisplayWidth(t *testing.T) {
+	kitchen, _ := parseTimeDisplay("", "")
+	rfc, _ := parseTimeDisplay("rfc3339", "UTC")
+	if kitchen.Width() != 8 || rfc.Width() != len("2006-12-30T23:59:59Z") {
+		t.Fatalf("unexpected widths: kitchen=%d rfc3339=%d", kitchen.Width(), rfc.Width())
+	}
+	if got := kitchen.Format(time.Time{}); got != "-" {
+		t.Fatalf("expected - for zero time, got %q", got)
+	}
+}
+
+func TestTimeDisplayForWindow(t *testing.T) {
+	seen := time.Date(2025, 10, 19, 14, 5, 0, 0, time.UTC)
+	auto, _ := parseTimeDisplay("", "")
+	if got := auto.ForWindow(2 * time.Hour).Format(seen); got != "2:05PM" {
+		t.Fatalf("short windows keep kitchen layout, got %q", got)
+	}
+	if got := auto.ForWindow(50 * time.Hour).Format(seen); got != "Oct 19 14:05" {
+		t.Fatalf("long windows should include dates, got %q", got)
+	}
+	explicit, _ := parseTimeDisplay("kitchen", "")
+	if got := explicit.ForWindow(50 * time.Hour).Format(seen); got != "2:05PM" {
+		t.Fatalf("explicit layouts must be kept, got %q", got)
+	}
+}
+
+func TestFormatActive(t *testing.T) {
+	cases := map[time.Duration]string{
+		20 * time.Second:              "<1m",
+		45 * time.Minute:              "45m",
+		3*time.Hour + 12*time.Minute:  "3h12m",
+		74*time.Hour + 30*time.Minute: "3d2h",
+		0:                             "<1m",
+	}
+	for d, want := range cases {
+		if got := formatActive(d); got != want {
+			t.Fatalf("formatActive(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no zone data: %v", err)
+	}
+	cases := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"2h", now.Add(-2 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"2025-10-19T06:00", time.Date(2025, 10, 19, 6, 0, 0, 0, paris)},
+		{"2025-10-19 06:00:30", time.Date(2025, 10, 19, 6, 0, 30, 0, paris)},
+		{"2025-10-18", time.Date(2025, 10, 18, 0, 0, 0, 0, paris)},
+		{"2025-10-19T06:00:00Z", time.Date(2025, 10, 19, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got, err := parseTimeBound(c.value, now, paris)
+		if err != nil {
+			t.Fatalf("parseTimeBound(%q): %v", c.value, err)
+		}
+		if !got.Equal(c.want) {
+			t.Errorf("parseTimeBound(%q) = %v, want %v", c.value, got, c.want)
+		}
+	}
+	for _, bad := range []string{"-2h", "yesterday", "19/Oct/2025"} {
+		if _, err := parseTimeBound(bad, now, paris); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if _, _, err := parseTimeBounds("1h", "2h", now, nil); err == nil {
+		t.Error("expected a window ending before it starts to be rejected")
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/tls"
+	"sort"
+	"strings"
+)
+
+// maxTLSVariants bounds the distinct protocols, ciphers and JA3 fingerprints
+// kept per IP; the rules only need to tell one from several.
+const maxTLSVariants = 20
+
+// tlsVersionNames maps TLS version numbers, as Caddy logs them, to the names
+// nginx logs in $ssl_protocol.
+var tlsVersionNames = map[uint16]string{
+	tls.VersionSSL30: "SSLv3",
+	tls.VersionTLS10: "TLSv1",
+	tls.VersionTLS11: "TLSv1.1",
+	tls.VersionTLS12: "TLSv1.2",
+	tls.VersionTLS13: "TLSv1.3",
+}
+
+// legacyTLS reports whether protocol, an $ssl_protocol value, is one current
+// browsers no longer speak.
+func legacyTLS(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "sslv2", "sslv3", "tlsv1", "tlsv1.1":
+		return true
+	}
+	return false
+}
+
+// tlsLogValue returns value, or "" for the "-" nginx logs for an empty
+// variable such as $ssl_protocol on a plain HTTP request.
+func tlsLogValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// recordTLS counts the TLS protocol, cipher and JA3 fingerprint of a request
+// whose log line records them.
+func (s *IPStats) recordTLS(entry Entry) {
+	if entry.TLSProtocol == "" && entry.TLSCipher == "" {
+		return
+	}
+	s.TLSRequests++
+	s.TLSProtocols = countTLSVariant(s.TLSProtocols, entry.TLSProtocol)
+	s.TLSCiphers = countTLSVariant(s.TLSCiphers, entry.TLSCipher)
+	s.JA3s = countTLSVariant(s.JA3s, entry.JA3)
+}
+
+func countTLSVariant(counts map[string]int, value string) map[string]int {
+	if value == "" {
+		return counts
+	}
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	if _, seen := counts[value]; seen || len(counts) < maxTLSVariants {
+		counts[value]++
+	}
+	return counts
+}
+
+// legacyTLSRequests returns how many requests of the IP used a legacy
+// protocol, and those protocols.
+func (s *IPStats) legacyTLSRequests() (int, []string) {
+	total := 0
+	var protocols []string
+	for protocol, count := range s.TLSProtocols {
+		if legacyTLS(protocol) {
+			total += count
+			protocols = append(protocols, protocol)
+		}
+	}
+	sort.Strings(protocols)
+	return total, protocols
+}
+
+// singleCipher returns the cipher and JA3 fingerprint every TLS request of
+// the IP used, or "" when it used several or the log does not record JA3.
+// A cipher alone is too weak a signal: a browser keeps one per server.
+func (s *IPStats) singleCipher() (cipher, ja3 string) {
+	if len(s.TLSCiphers) != 1 || len(s.JA3s) != 1 {
+		return "", ""
+	}
+	for c, count := range s.TLSCiphers {
+		if count != s.TLSRequests {
+			return "", ""
+		}
+		cipher = c
+	}
+	for j, count := range s.JA3s {
+		if count != s.TLSRequests {
+			return "", ""
+		}
+		ja3 = j
+	}
+	return cipher, ja3
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogFormatReadsTLSFields(t *testing.T) {
+	format, err := parseLogFormat(`$remote_addr [$time_local] "$request" $status $ssl_protocol $ssl_cipher "$http_ssl_ja3_hash"`)
+	if err != nil {
+		t.Fatalf("parseLogFormat: %v", err)
+	}
+	entry, err := format.Parse(`192.0.2.7 [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 TLSv1.2 ECDHE-RSA-AES128-GCM-SHA256 "e7d705a3286e19ea42f587b344ee6865"`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if entry.TLSProtocol != "TLSv1.2" || entry.TLSCipher != "ECDHE-RSA-AES128-GCM-SHA256" || entry.JA3 != "e7d705a3286e19ea42f587b344ee6865" {
+		t.Fatalf("unexpected TLS fields %+v", entry)
+	}
+	// Plain HTTP requests log the variables empty.
+	entry, err = format.Parse(`192.0.2.7 [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 - - "-"`)
+	if err != nil || entry.TLSProtocol != "" || entry.TLSCipher != "" || entry.JA3 != "" {
+		t.Fatalf("expected no TLS fields, got %+v, %v", entry, err)
+	}
+}
+
+func TestCaddyLogFormatReadsTLS(t *testing.T) {
+	line := strings.Replace(caddyAccessLine, `"uri":"/cart?id=1",`, `"uri":"/cart?id=1","tls":{"resumed":false,"version":769,"cipher_suite":49199,"proto":"h2","server_name":"shop.example.com"},`, 1)
+	entry, err := caddyLogFormat.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if entry.TLSProtocol != "TLSv1" || entry.TLSCipher != "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256" {
+		t.Fatalf("unexpected TLS fields %q %q", entry.TLSProtocol, entry.TLSCipher)
+	}
+}
+
+func TestAnalyzerTLSRules(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinLegacyTLS = 20
+	cfg.MinSingleCipher = 100
+	a := New(cfg, nil)
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 120; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		// A script on an old TLS stack, pinned to one cipher.
+		a.Process(Entry{Time: at, ClientIP: "198.51.100.4", Status: 404, URI: "/", TLSProtocol: "TLSv1", TLSCipher: "AES128-SHA", JA3: "6734f37431670b3ab4292b8f60f29984"})
+		// A browser resuming sessions on several ciphers.
+		cipher := "TLS_AES_128_GCM_SHA256"
+		if i%2 == 0 {
+			cipher = "TLS_CHACHA20_POLY1305_SHA256"
+		}
+		a.Process(Entry{Time: at, ClientIP: "192.0.2.7", Status: 404, URI: "/", TLSProtocol: "TLSv1.3", TLSCipher: cipher})
+		// A client whose JA3 changes is not rigid, even on one cipher.
+		a.Process(Entry{Time: at, ClientIP: "203.0.113.9", Status: 404, URI: "/", TLSProtocol: "TLSv1.3", TLSCipher: "TLS_AES_128_GCM_SHA256", JA3: []string{"a", "b"}[i%2]})
+		// Without JA3 in the log one cipher is not enough.
+		a.Process(Entry{Time: at, ClientIP: "198.51.100.20", Status: 404, URI: "/", TLSProtocol: "TLSv1.3", TLSCipher: "TLS_AES_128_GCM_SHA256"})
+	}
+
+	rules := make(map[string]string)
+	var reasons []string
+	for _, suspect := range a.Suspicious() {
+		rules[suspect.IP] = strings.Join(suspect.Rules, ",")
+		if suspect.IP == "198.51.100.4" {
+			reasons = suspect.Reasons
+		}
+	}
+	if !strings.Contains(rules["198.51.100.4"], RuleLegacyTLS) || !strings.Contains(rules["198.51.100.4"], RuleSingleCipher) {
+		t.Fatalf("expected the legacy client to trip both TLS rules, got %v", rules)
+	}
+	joined := strings.Join(reasons, "; ")
+	if !strings.Contains(joined, "120 requests over TLSv1") || !strings.Contains(joined, "120 TLS requests all with cipher AES128-SHA and JA3 6734f37431670b3ab4292b8f60f29984") {
+		t.Fatalf("unexpected reasons %v", reasons)
+	}
+	for _, ip := range []string{"192.0.2.7", "203.0.113.9", "198.51.100.20"} {
+		if strings.Contains(rules[ip], RuleLegacyTLS) || strings.Contains(rules[ip], RuleSingleCipher) {
+			t.Fatalf("expected %s not to trip the TLS rules, got %v", ip, rules[ip])
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// traefikLogFormat reads Traefik access logs in its common format, which
+// appends the request count, router, server URL and duration to the combined
+// fields, and in its JSON format.
+var traefikLogFormat = &LogFormat{Name: "traefik", parse: parseTraefikLine}
+
+// traefikCommonLog matches Traefik's CLF-with-extras lines. Its trailing fields
+// would pass for nginx's $request_time, so detectLogFormat checks it even for
+// lines the combined parser accepts.
+var traefikCommonLog = &LogFormat{
+	Name:    "traefik",
+	pattern: regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) (\S+) "([^"]*)" "([^"]*)" (\d+) "([^"]*)" "([^"]*)" (\d+)ms$`),
+	fields:  []string{"remote_addr", "", "remote_user", "time_local", "request", "status", "body_bytes_sent", "http_referer", "http_user_agent", "", "backend", "", "request_time_ms"},
+}
+
+// traefikAccessLog is the subset of a Traefik JSON access log entry botdeny
+// uses. Request headers are only present when accessLog.fields.headers keeps them.
+type traefikAccessLog struct {
+	ClientHost            string `json:"ClientHost"`
+	ClientAddr            string `json:"ClientAddr"`
+	ClientUsername        string `json:"ClientUsername"`
+	StartUTC              string `json:"StartUTC"`
+	StartLocal            string `json:"StartLocal"`
+	RequestMethod         string `json:"RequestMethod"`
+	RequestPath           string `json:"RequestPath"`
+	RequestProtocol       string `json:"RequestProtocol"`
+	RequestHost           string `json:"RequestHost"`
+	DownstreamStatus      int    `json:"DownstreamStatus"`
+	DownstreamContentSize int64  `json:"DownstreamContentSize"`
+	// Duration is in nanoseconds.
+	Duration     int64  `json:"Duration"`
+	RouterName   string `json:"RouterName"`
+	ServiceName  string `json:"ServiceName"`
+	UserAgent    string `json:"request_User-Agent"`
+	Referer      string `json:"request_Referer"`
+	ForwardedFor string `json:"request_X-Forwarded-For"`
+}
+
+// parseTraefikLine parses a JSON entry or a common format line.
+func parseTraefikLine(line string) (Entry, error) {
+	if !strings.HasPrefix(line, "{") {
+		return traefikCommonLog.Parse(line)
+	}
+	var record traefikAccessLog
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return Entry{}, fmt.Errorf("parse traefik entry: %v: %w", err, ErrUnmatchedLine)
+	}
+	if record.DownstreamStatus == 0 || record.RequestMethod == "" {
+		return Entry{}, fmt.Errorf("traefik entry is not an access log: %w", ErrUnmatchedLine)
+	}
+	start := record.StartUTC
+	if start == "" {
+		start = record.StartLocal
+	}
+	t, err := time.Parse(time.RFC3339Nano, start)
+	if err != nil {
+		return Entry{}, fmt.Errorf("parse time: %w", err)
+	}
+
+	remote := record.ClientHost
+	if remote == "" {
+		if host, _, err := net.SplitHostPort(record.ClientAddr); err == nil {
+			remote = host
+		}
+	}
+	backend := record.ServiceName
+	if backend == "" {
+		backend = record.RouterName
+	}
+	return Entry{
+		ClientIP:     deriveClientIP(remote, record.ForwardedFor),
+		RemoteAddr:   remote,
+		ForwardedFor: record.ForwardedFor,
+		UserAuth:     record.ClientUsername,
+		Time:         t,
+		Method:       record.RequestMethod,
+		URI:          record.RequestPath,
+		Protocol:     record.RequestProtocol,
+		Status:       record.DownstreamStatus,
+		Bytes:        record.DownstreamContentSize,
+		Referer:      record.Referer,
+		UserAgent:    record.UserAgent,
+		RequestTime:  time.Duration(record.Duration).Seconds(),
+		Host:         record.RequestHost,
+		Backend:      backend,
+	}, nil
+}
+
+// parseDurationMillis reads a millisecond count such as Traefik's "3ms" field.
+func parseDurationMillis(value string) (float64, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration: %w", err)
+	}
+	return float64(ms) / 1000, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const traefikCommonLine = `192.0.2.7 - alice [19/Oct/2025:12:02:35 +0000] "GET /cart?id=1 HTTP/2.0" 404 512 "-" "curl/8.0" 42 "shop@kubernetes" "http://10.42.0.7:8080" 125ms`
+
+func TestTraefikCommonFormat(t *testing.T) {
+	format, err := logFormatFor("traefik", "", LogTimes{})
+	if err != nil || format != traefikLogFormat {
+		t.Fatalf("expected traefik format, got %v, %v", format, err)
+	}
+	entry, err := format.Parse(traefikCommonLine)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if entry.ClientIP != "192.0.2.7" || entry.UserAuth != "alice" || entry.URI != "/cart?id=1" || entry.Status != 404 ||
+		entry.Bytes != 512 || entry.UserAgent != "curl/8.0" || entry.Backend != "shop@kubernetes" || entry.RequestTime != 0.125 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+}
+
+func TestTraefikJSONFormat(t *testing.T) {
+	line := `{"ClientAddr":"10.0.0.5:51234","ClientHost":"10.0.0.5","ClientUsername":"-","DownstreamContentSize":512,"DownstreamStatus":404,"Duration":125000000,` +
+		`"RequestHost":"shop.example.com","RequestMethod":"GET","RequestPath":"/cart?id=1","RequestProtocol":"HTTP/2.0","RouterName":"shop@kubernetes",` +
+		`"ServiceName":"default-shop-8080@kubernetes","StartUTC":"2025-10-19T12:02:35.25Z","request_User-Agent":"curl/8.0","request_X-Forwarded-For":"192.0.2.7","level":"info","msg":"","time":"2025-10-19T12:02:35Z"}`
+	entry, err := traefikLogFormat.Parse(line)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := Entry{
+		ClientIP:     "192.0.2.7",
+		RemoteAddr:   "10.0.0.5",
+		ForwardedFor: "192.0.2.7",
+		UserAuth:     "-",
+		Time:         time.Date(2025, 10, 19, 12, 2, 35, 250000000, time.UTC),
+		Method:       "GET",
+		URI:          "/cart?id=1",
+		Protocol:     "HTTP/2.0",
+		Status:       404,
+		Bytes:        512,
+		UserAgent:    "curl/8.0",
+		RequestTime:  0.125,
+		Host:         "shop.example.com",
+		Backend:      "default-shop-8080@kubernetes",
+	}
+	if entry != want {
+		t.Fatalf("unexpected entry:\n got %+v\nwant %+v", entry, want)
+	}
+	if _, err := traefikLogFormat.Parse(`{"level":"info","msg":"Configuration loaded"}`); err == nil {
+		t.Fatal("expected a non-access JSON line to be rejected")
+	}
+}
+
+func TestStreamDetectsTraefikCommon(t *testing.T) {
+	// The combined parser accepts these lines, reading the request count as
+	// $request_time, so detection must look past a successful parse.
+	entries, errs := Stream(strings.NewReader(traefikCommonLine + "\n" + traefikCommonLine + "\n"))
+	analyzer := New(DefaultConfig(), nil)
+	for entry := range entries {
+		analyzer.Process(entry)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	stat := analyzer.stats["192.0.2.7"]
+	if stat == nil || stat.Backends["shop@kubernetes"] != 2 || stat.RequestTime != 0.25 {
+		t.Fatalf("expected traefik entries attributed to the router, got %+v", stat)
+	}
+}
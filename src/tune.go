@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tuneMultipliers scale the configured numeric thresholds during a sweep.
+var tuneMultipliers = []float64{0.5, 1, 1.5, 2}
+
+// TuneCandidate is one threshold combination evaluated by `botdeny tune`.
+type TuneCandidate struct {
+	MinRequests      int
+	MaxAverageRPM    float64
+	MaxBurstRequests int
+	ScoreThreshold   int
+	Current          bool
+
+	BlockedIPs      int
+	BlockedRequests int
+	BlockedShare    float64
+	// LikelyFPs counts blocked IPs that never received an error response and
+	// tripped no sensitive URL or honeytoken rule.
+	LikelyFPs int
+}
+
+// tuneCandidates returns the threshold grid around cfg, the current values first.
+func tuneCandidates(cfg Config) []TuneCandidate {
+	scores := []int{cfg.ScoreThreshold - 1, cfg.ScoreThreshold, cfg.ScoreThreshold + 1}
+	candidates := []TuneCandidate{{
+		MinRequests:      cfg.MinRequests,
+		MaxAverageRPM:    cfg.MaxAverageRPM,
+		MaxBurstRequests: cfg.MaxBurstRequests,
+		ScoreThreshold:   cfg.ScoreThreshold,
+		Current:          true,
+	}}
+	for _, minMul := range tuneMultipliers {
+		for _, rpmMul := range tuneMultipliers {
+			for _, burstMul := range tuneMultipliers {
+				for _, score := range scores {
+					if score < 1 || (minMul == 1 && rpmMul == 1 && burstMul == 1 && score == cfg.ScoreThreshold) {
+						continue
+					}
+					candidates = append(candidates, TuneCandidate{
+						MinRequests:      max(1, int(math.Round(float64(cfg.MinRequests)*minMul))),
+						MaxAverageRPM:    cfg.MaxAverageRPM * rpmMul,
+						MaxBurstRequests: max(1, int(math.Round(float64(cfg.MaxBurstRequests)*burstMul))),
+						ScoreThreshold:   score,
+					})
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// evaluateCandidate scores every IP with the candidate thresholds.
+func (a *Analyzer) evaluateCandidate(candidate *TuneCandidate, totalRequests int) {
+	saved := a.cfg
+	defer func() { a.cfg = saved }()
+	a.cfg.MinRequests = candidate.MinRequests
+	a.cfg.MaxAverageRPM = candidate.MaxAverageRPM
+	a.cfg.MaxBurstRequests = candidate.MaxBurstRequests
+	a.cfg.ScoreThreshold = candidate.ScoreThreshold
+
+	for _, stat := range a.stats {
+		suspect, blocked := a.evaluate(stat)
+		if !blocked {
+			continue
+		}
+		candidate.BlockedIPs++
+		candidate.BlockedRequests += stat.Requests
+		forced := containsStringCI(RuleSensitivePath, suspect.Rules) || containsStringCI(RuleHoneytoken, suspect.Rules)
+		if !forced && errorResponses(stat) == 0 {
+			candidate.LikelyFPs++
+		}
+	}
+	if totalRequests > 0 {
+		candidate.BlockedShare = float64(candidate.BlockedRequests) / float64(totalRequests)
+	}
+}
+
+// rankCandidates orders candidates by distance from the target share, then by
+// fewer likely false positives.
+func rankCandidates(candidates []TuneCandidate, target float64) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		di := math.Abs(candidates[i].BlockedShare - target)
+		dj := math.Abs(candidates[j].BlockedShare - target)
+		if di != dj {
+			return di < dj
+		}
+		return candidates[i].LikelyFPs < candidates[j].LikelyFPs
+	})
+}
+
+// parseRate accepts "0.5%" or a fraction such as "0.005".
+func parseRate(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	percent := strings.HasSuffix(value, "%")
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", value)
+	}
+	if percent {
+		rate /= 100
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate %q out of range", value)
+	}
+	return rate, nil
+}
+
+func printTuneCandidates(w io.Writer, target float64, current TuneCandidate, ranked []TuneCandidate) {
+	fmt.Fprintf(w, "target blocked-request share %.3f%%; current thresholds block %.3f%% (%d IPs, %d likely FPs)\n\n",
+		target*100, current.BlockedShare*100, current.BlockedIPs, current.LikelyFPs)
+	fmt.Fprintf(w, "%-13s %-16s %-19s %-16s %-12s %-14s %s\n",
+		"min_requests", "max_average_rpm", "max_burst_requests", "score_threshold", "blocked_ips", "blocked_share", "likely_fps")
+	for _, c := range ranked {
+		marker := ""
+		if c.Current {
+			marker = " (current)"
+		}
+		fmt.Fprintf(w, "%-13d %-16.1f %-19d %-16d %-12d %-14s %d%s\n",
+			c.MinRequests, c.MaxAverageRPM, c.MaxBurstRequests, c.ScoreThreshold,
+			c.BlockedIPs, fmt.Sprintf("%.3f%%", c.BlockedShare*100), c.LikelyFPs, marker)
+	}
+	if len(ranked) > 0 {
+		best := ranked[0]
+		fmt.Fprintf(w, "\nsuggested config:\nmin_requests: %d\nmax_average_rpm: %.1f\nmax_burst_requests: %d\nscore_threshold: %d\n",
+			best.MinRequests, best.MaxAverageRPM, best.MaxBurstRequests, best.ScoreThreshold)
+	}
+}
+
+func runTune(args []string) int {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	filePath := fs.String("file", "", "path to Nginx access log (defaults to config file or access.log)")
+	targetFlag := fs.String("target-block-rate", "", "desired share of requests coming from blocked IPs, e.g. 0.5% or 0.005")
+	limit := fs.Int("limit", 10, "number of configurations to list")
+	fs.Parse(args)
+
+	if *targetFlag == "" {
+		fmt.Fprintln(os.Stderr, "usage: botdeny tune --target-block-rate 0.5% [--file access.log] [--config config.yaml] [--limit N]")
+		return 2
+	}
+	target, err := parseRate(*targetFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "target-block-rate: %v\n", err)
+		return 2
+	}
+
+	cfg, defaults, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *filePath == "" {
+		*filePath = defaults.File
+	}
+
+	logFormat, err := logFormatFor(defaults.Format, defaults.LogFormat, defaults.LogTimes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	analyzer := New(cfg, nil)
+	totalRequests := 0
+	err = streamLogFileWith(*filePath, StreamOptions{Format: logFormat}, func(entry Entry) {
+		totalRequests++
+		analyzer.Process(entry)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse log: %v\n", err)
+		return 1
+	}
+
+	candidates := tuneCandidates(cfg)
+	for i := range candidates {
+		analyzer.evaluateCandidate(&candidates[i], totalRequests)
+	}
+	current := candidates[0]
+	rankCandidates(candidates, target)
+	if *limit > 0 && len(candidates) > *limit {
+		candidates = candidates[:*limit]
+	}
+	printTuneCandidates(os.Stdout, target, current, candidates)
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for input, want := range map[string]float64{"0.5%": 0.005, "0.02": 0.02, "10%": 0.1} {
+		got, err := parseRate(input)
+		if err != nil || got != want {
+			t.Fatalf("parseRate(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := parseRate("150%"); err == nil {
+		t.Fatalf("expected out of range rate to fail")
+	}
+}
+
+func TestTuneRanksCandidatesByTargetShare(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 20
+	cfg.ScoreThreshold = 2
+	analyzer := New(cfg, nil)
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	total := 0
+	for i := 0; i < 30; i++ {
+		analyzer.Process(Entry{ClientIP: "192.0.2.1", Time: start.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/missing/%d", i), Status: 404})
+		total++
+	}
+	for ip := 0; ip < 10; ip++ {
+		for i := 0; i < 30; i++ {
+			analyzer.Process(Entry{ClientIP: fmt.Sprintf("198.51.100.%d", ip), Time: start.Add(time.Duration(i) * time.Minute), URI: "/", Status: 200})
+			total++
+		}
+	}
+
+	candidates := tuneCandidates(cfg)
+	if !candidates[0].Current || len(candidates) < 100 {
+		t.Fatalf("expected current thresholds first in a full grid, got %d candidates", len(candidates))
+	}
+	for i := range candidates {
+		analyzer.evaluateCandidate(&candidates[i], total)
+	}
+	if analyzer.cfg.MinRequests != 20 {
+		t.Fatalf("expected analyzer thresholds to be restored")
+	}
+
+	rankCandidates(candidates, 30.0/330.0)
+	best := candidates[0]
+	if best.BlockedIPs != 1 || best.LikelyFPs != 0 {
+		t.Fatalf("expected best candidate to block only the scanner, got %+v", best)
+	}
+}
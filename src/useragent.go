@@ -0,0 +1,99 @@
+package main
+
+import "strings"
+
+// UAClass groups user agents by what they declare themselves to be.
+type UAClass string
+
+const (
+	UAClassBot     UAClass = "bot"
+	UAClassBrowser UAClass = "browser"
+	UAClassUnknown UAClass = "unknown"
+)
+
+// uaClasses lists the classes in display order.
+var uaClasses = []UAClass{UAClassBot, UAClassBrowser, UAClassUnknown}
+
+// botUAMarkers are lowercase substrings used by self-declared bots and HTTP tooling.
+var botUAMarkers = []string{
+	"bot",
+	"crawl",
+	"spider",
+	"slurp",
+	"scrapy",
+	"curl/",
+	"wget/",
+	"python-requests",
+	"python-urllib",
+	"aiohttp",
+	"go-http-client",
+	"java/",
+	"okhttp",
+	"libwww-perl",
+	"httpclient",
+	"headlesschrome",
+	"phantomjs",
+}
+
+// browserUAMarkers are substrings carried by mainstream browser user agents.
+var browserUAMarkers = []string{
+	"chrome/",
+	"firefox/",
+	"safari/",
+	"edg/",
+	"opr/",
+	"trident/",
+}
+
+// ClassLimit overrides detection thresholds for IPs whose traffic is dominated by one UA class.
+// Zero values inherit the global thresholds.
+type ClassLimit struct {
+	MinRequests    int     `yaml:"min_requests"`
+	MaxAverageRPM  float64 `yaml:"max_average_rpm"`
+	ScoreThreshold int     `yaml:"score_threshold"`
+}
+
+// classifyUserAgent reports whether ua declares itself a bot, a browser, or neither.
+func classifyUserAgent(ua string) UAClass {
+	lower := strings.ToLower(strings.TrimSpace(ua))
+	if lower == "" || lower == "-" {
+		return UAClassUnknown
+	}
+	for _, marker := range botUAMarkers {
+		if strings.Contains(lower, marker) {
+			return UAClassBot
+		}
+	}
+	if strings.HasPrefix(lower, "mozilla/") {
+		for _, marker := range browserUAMarkers {
+			if strings.Contains(lower, marker) {
+				return UAClassBrowser
+			}
+		}
+	}
+	return UAClassUnknown
+}
+
+// DominantClass returns the UA class responsible for most of the IP's requests.
+func (s *IPStats) DominantClass() UAClass {
+	best := UAClassUnknown
+	bestCount := 0
+	for _, class := range uaClasses {
+		if count := s.UAClassCounts[class]; count > bestCount {
+			best = class
+			bestCount = count
+		}
+	}
+	return best
+}
+
+// dominantAgent returns the user agent an IP sent most often.
+func dominantAgent(stat *IPStats) string {
+	agent, best := "", 0
+	for ua, count := range stat.UserAgents {
+		if count > best || (count == best && ua < agent) {
+			agent, best = ua, count
+		}
+	}
+	return strings.TrimSpace(agent)
+}
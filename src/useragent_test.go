@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestClassifyUserAgent(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want UAClass
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", UAClassBot},
+		{"curl/8.4.0", UAClassBot},
+		{"python-requests/2.31.0", UAClassBot},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", UAClassBrowser},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", UAClassBrowser},
+		{"", UAClassUnknown},
+		{"-", UAClassUnknown},
+		{"SomethingCustom/1.0", UAClassUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := classifyUserAgent(tt.ua); got != tt.want {
+			t.Errorf("classifyUserAgent(%q) = %s, want %s", tt.ua, got, tt.want)
+		}
+	}
+}
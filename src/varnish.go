@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+)
+
+// varnishLogFormat reads varnishncsa output that appends the cache handling
+// to the NCSA fields, optionally followed by the time taken in microseconds:
+//
+//	varnishncsa -F '%h %l %u %t "%r" %s %b "%{Referer}i" "%{User-agent}i" %{Varnish:handling}x %D'
+//
+// %{Varnish:hitmiss}x works too. varnishncsa's default output lacks the
+// handling and is read as the combined format.
+var varnishLogFormat = &LogFormat{Name: "varnish", parse: parseVarnishLine}
+
+// varnishNCSALog matches the fields of varnishLogFormat.
+var varnishNCSALog = &LogFormat{
+	Name:    "varnish",
+	pattern: regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\S+) "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)" (hit|miss|pass|pipe|synth)(?: (\d+))?$`),
+	fields:  []string{"remote_addr", "", "remote_user", "time_local", "request", "status", "body_bytes_sent", "http_referer", "http_user_agent", "upstream_cache_status", "request_time_us"},
+}
+
+func parseVarnishLine(line string) (Entry, error) {
+	entry, err := varnishNCSALog.Parse(line)
+	if err != nil {
+		return Entry{}, err
+	}
+	// %r rebuilds an absolute URL from the Host header, e.g. "GET http://www.example.com/path HTTP/1.1".
+	if target, err := url.Parse(entry.URI); err == nil && target.Host != "" {
+		entry.Host = target.Hostname()
+		entry.URI = target.RequestURI()
+	}
+	return entry, nil
+}
+
+// cacheMissShare is the share of an IP's requests with a logged cache status
+// that must have reached the origin for MinCacheMisses to apply.
+const cacheMissShare = 0.9
+
+// cacheMiss reports whether a cache status means the origin served the
+// request: Varnish's miss, pass and pipe, and nginx's MISS, BYPASS and
+// EXPIRED. Hits, stale copies and responses the cache made itself do not
+// reach the origin.
+func cacheMiss(status string) bool {
+	switch status {
+	case "miss", "pass", "pipe", "bypass", "expired":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const varnishLine = `192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET http://shop.example.com/cart?id=1 HTTP/1.1" 200 512 "-" "curl/8.0" miss 125000`
+
+func TestVarnishFormat(t *testing.T) {
+	format, err := logFormatFor("varnish", "", LogTimes{})
+	if err != nil || format != varnishLogFormat {
+		t.Fatalf("expected varnish format, got %v, %v", format, err)
+	}
+	entry, err := format.Parse(varnishLine)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if entry.ClientIP != "192.0.2.7" || entry.Status != 200 || entry.Bytes != 512 || entry.UserAgent != "curl/8.0" ||
+		entry.Host != "shop.example.com" || entry.URI != "/cart?id=1" ||
+		entry.CacheStatus != "miss" || entry.RequestTime != 0.125 {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	entry, err = format.Parse(strings.TrimSuffix(strings.Replace(varnishLine, " miss", " hit", 1), " 125000"))
+	if err != nil || entry.CacheStatus != "hit" || entry.RequestTime != 0 {
+		t.Fatalf("expected a hit without time taken, got %+v, %v", entry, err)
+	}
+	// varnishncsa's default output has no handling.
+	if _, err := format.Parse(`192.0.2.7 - - [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`); err == nil {
+		t.Fatal("expected a line without the handling to be rejected")
+	}
+}
+
+func TestNginxUpstreamCacheStatus(t *testing.T) {
+	format, err := parseLogFormat(`$remote_addr [$time_local] "$request" $status $upstream_cache_status`)
+	if err != nil {
+		t.Fatalf("parseLogFormat: %v", err)
+	}
+	for line, want := range map[string]string{
+		`192.0.2.7 [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 BYPASS`: "bypass",
+		`192.0.2.7 [19/Oct/2025:12:02:35 +0000] "GET / HTTP/1.1" 200 -`:      "",
+	} {
+		entry, err := format.Parse(line)
+		if err != nil || entry.CacheStatus != want {
+			t.Fatalf("parse %q: got %q, %v; want %q", line, entry.CacheStatus, err, want)
+		}
+	}
+}
+
+func TestStreamDetectsVarnish(t *testing.T) {
+	// The combined parser ignores the trailing fields, so detection must
+	// look past a successful parse.
+	entries, errs := Stream(strings.NewReader(varnishLine + "\n" + varnishLine + "\n"))
+	statuses := 0
+	for entry := range entries {
+		if entry.CacheStatus == "miss" {
+			statuses++
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if statuses != 2 {
+		t.Fatalf("expected both entries to keep their cache status, got %d", statuses)
+	}
+}
+
+func TestAnalyzerCacheMisses(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinCacheMisses = 20
+	a := New(cfg, nil)
+	start := time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		// A scraper walks the catalogue, which is never in cache.
+		a.Process(Entry{Time: at, ClientIP: "198.51.100.4", Status: 404, URI: fmt.Sprintf("/p/%d", i), CacheStatus: "miss"})
+		// A visitor gets mostly cached pages.
+		status := "hit"
+		if i%3 == 0 {
+			status = "miss"
+		}
+		a.Process(Entry{Time: at, ClientIP: "192.0.2.7", Status: 404, URI: "/", CacheStatus: status})
+	}
+
+	var flagged []string
+	for _, suspect := range a.Suspicious() {
+		if strings.Contains(strings.Join(suspect.Rules, ","), RuleCacheMiss) {
+			flagged = append(flagged, suspect.IP)
+			if !strings.Contains(strings.Join(suspect.Reasons, "; "), "30 requests past the cache (100% misses)") {
+				t.Fatalf("unexpected reasons %v", suspect.Reasons)
+			}
+		}
+	}
+	if len(flagged) != 1 || flagged[0] != "198.51.100.4" {
+		t.Fatalf("expected only the scraper to trip the cache miss rule, got %v", flagged)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// crawlerIdentity describes how a well-known crawler can be verified via DNS.
+type crawlerIdentity struct {
+	Name     string
+	Suffixes []string
+}
+
+// knownCrawlers lists crawlers whose operators document reverse DNS verification.
+var knownCrawlers = []crawlerIdentity{
+	{Name: "Googlebot", Suffixes: []string{".googlebot.com", ".google.com"}},
+	{Name: "bingbot", Suffixes: []string{".search.msn.com"}},
+	{Name: "Applebot", Suffixes: []string{".applebot.apple.com"}},
+	{Name: "YandexBot", Suffixes: []string{".yandex.ru", ".yandex.net", ".yandex.com"}},
+	{Name: "Baiduspider", Suffixes: []string{".baidu.com", ".baidu.jp"}},
+	{Name: "Pinterestbot", Suffixes: []string{".pinterest.com"}},
+}
+
+// dnsResolver is the subset of net.Resolver used for crawler verification.
+type dnsResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// BotVerification captures the outcome of the DNS and configured-range checks for an IP.
+type BotVerification struct {
+	IP            string
+	Hostnames     []string
+	Crawler       string
+	ForwardHost   string
+	ForwardIPs    []string
+	ForwardMatch  bool
+	RangeMatch    string
+	RangeListName string
+}
+
+// Verdict summarises the verification in a single line.
+func (v BotVerification) Verdict() string {
+	switch {
+	case v.Crawler != "" && v.ForwardMatch:
+		return fmt.Sprintf("verified %s", v.Crawler)
+	case v.Crawler != "":
+		return fmt.Sprintf("NOT verified: reverse DNS claims %s but forward DNS does not confirm", v.Crawler)
+	case v.RangeMatch != "":
+		return fmt.Sprintf("allowed by %s range %s", v.RangeListName, v.RangeMatch)
+	default:
+		return "NOT verified: no known crawler hostname or configured range matched"
+	}
+}
+
+// verifyBot runs reverse DNS and forward-confirmed DNS checks for an IP, then
+// looks it up in the ranges configured in allow_cidrs.
+func verifyBot(ctx context.Context, resolver dnsResolver, ip string, cfg Config) (BotVerification, error) {
+	result := BotVerification{IP: ip}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return result, fmt.Errorf("invalid IP %q", ip)
+	}
+
+	if hosts, err := resolver.LookupAddr(ctx, ip); err == nil {
+		result.Hostnames = hosts
+	}
+
+	for _, host := range result.Hostnames {
+		name := crawlerForHost(host)
+		if name == "" {
+			continue
+		}
+		result.Crawler = name
+		result.ForwardHost = host
+		addrs, err := resolver.LookupHost(ctx, strings.TrimSuffix(host, "."))
+		if err != nil {
+			continue
+		}
+		result.ForwardIPs = addrs
+		for _, addr := range addrs {
+			if forward := net.ParseIP(addr); forward != nil && forward.Equal(parsed) {
+				result.ForwardMatch = true
+				break
+			}
+		}
+		if result.ForwardMatch {
+			break
+		}
+	}
+
+	if match := matchCIDR(parsed, cfg.AllowedCIDRs); match != "" {
+		result.RangeMatch = match
+		result.RangeListName = "allow_cidrs"
+	}
+
+	return result, nil
+}
+
+func crawlerForHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, crawler := range knownCrawlers {
+		for _, suffix := range crawler.Suffixes {
+			if strings.HasSuffix(host, suffix) {
+				return crawler.Name
+			}
+		}
+	}
+	return ""
+}
+
+func matchCIDR(ip net.IP, cidrs []string) string {
+	for _, raw := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(raw))
+		if err != nil {
+			continue
+		}
+		if network.Contains(ip) {
+			return network.String()
+		}
+	}
+	return ""
+}
+
+func printBotVerification(w io.Writer, v BotVerification) {
+	hostnames := "(none)"
+	if len(v.Hostnames) > 0 {
+		hostnames = strings.Join(v.Hostnames, ", ")
+	}
+	fmt.Fprintf(w, "ip:            %s\n", v.IP)
+	fmt.Fprintf(w, "reverse dns:   %s\n", hostnames)
+	if v.Crawler != "" {
+		forward := "(none)"
+		if len(v.ForwardIPs) > 0 {
+			forward = strings.Join(v.ForwardIPs, ", ")
+		}
+		fmt.Fprintf(w, "forward dns:   %s -> %s\n", v.ForwardHost, forward)
+	}
+	rangeMatch := "no match"
+	if v.RangeMatch != "" {
+		rangeMatch = fmt.Sprintf("%s (%s)", v.RangeMatch, v.RangeListName)
+	}
+	fmt.Fprintf(w, "configured:    %s\n", rangeMatch)
+	fmt.Fprintf(w, "verdict:       %s\n", v.Verdict())
+}
+
+// runVerifyBot implements `botdeny verify-bot <ip>`.
+func runVerifyBot(args []string) int {
+	fs := flag.NewFlagSet("verify-bot", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file")
+	profileName := fs.String("profile-name", "", "named profile from the config's profiles section")
+	timeout := fs.Duration("timeout", 5*time.Second, "DNS lookup timeout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: botdeny verify-bot [--config file] <ip> [ip...]")
+		fs.PrintDefaults()
+	}
+	ips, err := parseInterspersed(fs, args)
+	if err != nil || len(ips) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, _, err := loadConfigForCommand(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	exitCode := 0
+	for i, ip := range ips {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		result, err := verifyBot(ctx, net.DefaultResolver, ip, cfg)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "verify %s: %v\n", ip, err)
+			exitCode = 1
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		printBotVerification(os.Stdout, result)
+	}
+	return exitCode
+}
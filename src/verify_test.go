@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeResolver struct {
+	addrs map[string][]string
+	hosts map[string][]string
+}
+
+func (f fakeResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	if names, ok := f.addrs[addr]; ok {
+		return names, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (f fakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if ips, ok := f.hosts[host]; ok {
+		return ips, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestVerifyBotForwardConfirmed(t *testing.T) {
+	resolver := fakeResolver{
+		addrs: map[string][]string{"66.249.66.1": {"crawl-66-249-66-1.googlebot.com."}},
+		hosts: map[string][]string{"crawl-66-249-66-1.googlebot.com": {"66.249.66.1"}},
+	}
+
+	result, err := verifyBot(context.Background(), resolver, "66.249.66.1", DefaultConfig())
+	if err != nil {
+		t.Fatalf("verifyBot: %v", err)
+	}
+	if result.Crawler != "Googlebot" || !result.ForwardMatch {
+		t.Fatalf("expected verified Googlebot, got %+v", result)
+	}
+	if result.Verdict() != "verified Googlebot" {
+		t.Fatalf("unexpected verdict: %s", result.Verdict())
+	}
+}
+
+func TestVerifyBotSpoofedReverseDNS(t *testing.T) {
+	resolver := fakeResolver{
+		addrs: map[string][]string{"203.0.113.9": {"fake.googlebot.com."}},
+		hosts: map[string][]string{"fake.googlebot.com": {"198.51.100.1"}},
+	}
+
+	result, err := verifyBot(context.Background(), resolver, "203.0.113.9", DefaultConfig())
+	if err != nil {
+		t.Fatalf("verifyBot: %v", err)
+	}
+	if result.ForwardMatch {
+		t.Fatalf("expected forward confirmation to fail, got %+v", result)
+	}
+}
+
+func TestVerifyBotRejectsCloudCustomerHosts(t *testing.T) {
+	// Any Google Cloud customer gets a googleusercontent.com PTR record.
+	resolver := fakeResolver{
+		addrs: map[string][]string{"34.120.1.2": {"2.1.120.34.bc.googleusercontent.com."}},
+		hosts: map[string][]string{"2.1.120.34.bc.googleusercontent.com": {"34.120.1.2"}},
+	}
+
+	result, err := verifyBot(context.Background(), resolver, "34.120.1.2", DefaultConfig())
+	if err != nil {
+		t.Fatalf("verifyBot: %v", err)
+	}
+	if result.Crawler != "" || result.Verdict() == "verified Googlebot" {
+		t.Fatalf("expected a cloud customer host not to verify as Googlebot, got %+v", result)
+	}
+}
+
+func TestVerifyBotConfiguredRange(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowedCIDRs = []string{"35.191.0.0/16"}
+
+	result, err := verifyBot(context.Background(), fakeResolver{}, "35.191.50.44", cfg)
+	if err != nil {
+		t.Fatalf("verifyBot: %v", err)
+	}
+	if result.RangeMatch != "35.191.0.0/16" || result.RangeListName != "allow_cidrs" {
+		t.Fatalf("expected allow_cidrs match, got %+v", result)
+	}
+	if got := result.Verdict(); got != "allowed by allow_cidrs range 35.191.0.0/16" {
+		t.Fatalf("unexpected verdict: %s", got)
+	}
+}
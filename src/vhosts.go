@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// VhostScope counts and judges the requests for some Host headers apart from
+// the rest of a multi-site log, so one site's API traffic does not inflate
+// the counts of another. Zero thresholds inherit the global ones.
+type VhostScope struct {
+	// Hosts lists the Host headers of the scope; "*.example.com" also
+	// matches subdomains. Empty means the scope's own name.
+	Hosts            []string `yaml:"hosts"`
+	MinRequests      int      `yaml:"min_requests"`
+	MaxAverageRPM    float64  `yaml:"max_average_rpm"`
+	MaxBurstRequests int      `yaml:"max_burst_requests"`
+	ScoreThreshold   int      `yaml:"score_threshold"`
+	// AllowIPs and AllowCIDRs are never blocked for this scope's traffic,
+	// on top of the global allowlist.
+	AllowIPs   []string `yaml:"allow_ips"`
+	AllowCIDRs []string `yaml:"allow_cidrs"`
+	// DenyOutput receives the scope's suspects instead of the main deny file.
+	DenyOutput string `yaml:"deny_output"`
+}
+
+// vhostScopes resolves Host headers to the scope they belong to.
+type vhostScopes struct {
+	exact    map[string]string
+	suffixes []vhostSuffix
+	allow    map[string]allowSet
+}
+
+type vhostSuffix struct {
+	suffix, scope string
+}
+
+// allowSet is an allowlist of single IPs and networks.
+type allowSet struct {
+	ips   map[string]struct{}
+	cidrs []*net.IPNet
+}
+
+func newAllowSet(ips, cidrs []string) allowSet {
+	set := allowSet{ips: make(map[string]struct{})}
+	for _, ip := range ips {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		set.ips[ip] = struct{}{}
+	}
+	for _, raw := range cidrs {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			continue
+		}
+		set.cidrs = append(set.cidrs, network)
+	}
+	return set
+}
+
+// allowedBy returns the IP or network of the set covering ip, or "".
+func (s allowSet) allowedBy(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	if _, ok := s.ips[ip]; ok {
+		return ip
+	}
+	if len(s.cidrs) == 0 {
+		return ""
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	for _, network := range s.cidrs {
+		if network.Contains(parsed) {
+			return network.String()
+		}
+	}
+	return ""
+}
+
+func newVhostScopes(scopes map[string]VhostScope) vhostScopes {
+	resolved := vhostScopes{exact: make(map[string]string), allow: make(map[string]allowSet, len(scopes))}
+	for _, name := range vhostScopeNames(scopes) {
+		scope := scopes[name]
+		hosts := scope.Hosts
+		if len(hosts) == 0 {
+			hosts = []string{name}
+		}
+		for _, host := range hosts {
+			host = normalizeHost(host)
+			if suffix, ok := strings.CutPrefix(host, "*."); ok {
+				resolved.suffixes = append(resolved.suffixes, vhostSuffix{suffix: "." + suffix, scope: name})
+				continue
+			}
+			if _, taken := resolved.exact[host]; !taken {
+				resolved.exact[host] = name
+			}
+		}
+		resolved.allow[name] = newAllowSet(scope.AllowIPs, scope.AllowCIDRs)
+	}
+	return resolved
+}
+
+// scopeOf returns the scope a Host header belongs to, or "" for the rest of
+// the log. Exact hosts win over wildcards.
+func (v vhostScopes) scopeOf(host string) string {
+	if len(v.exact) == 0 && len(v.suffixes) == 0 {
+		return ""
+	}
+	host = normalizeHost(host)
+	if host == "" {
+		return ""
+	}
+	if scope, ok := v.exact[host]; ok {
+		return scope
+	}
+	for _, s := range v.suffixes {
+		if strings.HasSuffix(host, s.suffix) {
+			return s.scope
+		}
+	}
+	return ""
+}
+
+// normalizeHost lowercases a Host header and drops its port.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return strings.Trim(h, "[]")
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+func vhostScopeNames(scopes map[string]VhostScope) []string {
+	names := make([]string, 0, len(scopes))
+	for name := range scopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statKey keys an IP's stats within a vhost scope; the rest of the log keeps
+// the bare IP.
+func statKey(ip, scope string) string {
+	if scope == "" {
+		return ip
+	}
+	return ip + " " + scope
+}
+
+// key identifies the suspect across ticks: its IP, within its vhost scope.
+func (s Suspicion) key() string {
+	if s.Stats == nil {
+		return s.IP
+	}
+	return statKey(s.IP, s.Stats.Vhost)
+}
+
+// denyOutputs assigns suspects to deny files: those of a vhost scope with
+// its own deny_output go there, the rest to path. Every file is listed, even
+// when it gets no entries, so a scope's last block is lifted too.
+func denyOutputs(path string, suspects []Suspicion, scopes map[string]VhostScope) map[string][]Suspicion {
+	outputs := map[string][]Suspicion{path: nil}
+	for _, scope := range scopes {
+		if scope.DenyOutput != "" {
+			outputs[scope.DenyOutput] = nil
+		}
+	}
+	for _, suspect := range suspects {
+		target := path
+		if suspect.Stats != nil {
+			if scope, ok := scopes[suspect.Stats.Vhost]; ok && scope.DenyOutput != "" {
+				target = scope.DenyOutput
+			}
+		}
+		outputs[target] = append(outputs[target], suspect)
+	}
+	return outputs
+}
+
+// denyOutputPaths lists the files of denyOutputs, the main one first.
+func denyOutputPaths(path string, outputs map[string][]Suspicion) []string {
+	paths := make([]string, 0, len(outputs))
+	for p := range outputs {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return append([]string{path}, paths...)
+}
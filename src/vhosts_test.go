@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVhostScopeOf(t *testing.T) {
+	scopes := newVhostScopes(map[string]VhostScope{
+		"api":  {Hosts: []string{"api.example.com", "*.api.example.com"}},
+		"shop": {},
+	})
+	cases := map[string]string{
+		"api.example.com":      "api",
+		"API.example.com:8443": "api",
+		"eu.api.example.com":   "api",
+		"shop":                 "shop",
+		"www.example.com":      "",
+		"":                     "",
+		"evil-api.example.com": "",
+		"api.example.com.":     "api",
+		"[2001:db8::1]:443":    "",
+	}
+	for host, want := range cases {
+		if got := scopes.scopeOf(host); got != want {
+			t.Errorf("scopeOf(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestVhostScopesCountApart(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 50
+	cfg.MaxAverageRPM = 10
+	cfg.VhostScopes = map[string]VhostScope{
+		"api": {Hosts: []string{"api.example.com"}, MinRequests: 500, MaxAverageRPM: 1000, AllowIPs: []string{"198.51.100.9"}},
+	}
+	analyzer := New(cfg, nil)
+	now := time.Now()
+	// 192.0.2.7 polls the API heavily and browses the blog lightly; neither
+	// alone crosses its scope's thresholds.
+	for i := 0; i < 200; i++ {
+		at := now.Add(time.Duration(i) * time.Second)
+		analyzer.Process(Entry{ClientIP: "192.0.2.7", Host: "api.example.com", Time: at, URI: fmt.Sprintf("/v1/items/%d", i), Status: 200})
+		analyzer.Process(Entry{ClientIP: "198.51.100.9", Host: "api.example.com", Time: at, URI: "/v1/sync", Status: 404})
+	}
+	for i := 0; i < 20; i++ {
+		analyzer.Process(Entry{ClientIP: "192.0.2.7", Host: "blog.example.com", Time: now.Add(time.Duration(i) * time.Minute), URI: "/", Status: 200})
+	}
+	// 198.51.100.9 is only allowlisted for the API.
+	for i := 0; i < 200; i++ {
+		analyzer.Process(Entry{ClientIP: "198.51.100.9", Host: "blog.example.com", Time: now.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/wp-%d.php", i), Status: 404})
+	}
+
+	suspects := analyzer.Suspicious()
+	if len(suspects) != 1 || suspects[0].IP != "198.51.100.9" || suspects[0].Stats.Vhost != "" {
+		t.Fatalf("expected only the blog traffic of 198.51.100.9 flagged, got %+v", suspects)
+	}
+	if len(analyzer.Stats()) != 4 {
+		t.Fatalf("expected each IP counted once per scope, got %d stats", len(analyzer.Stats()))
+	}
+	if suspect, seen, _ := analyzer.Explain("192.0.2.7"); !seen || suspect.Stats.Requests != 20 {
+		t.Fatalf("expected Explain to find the unscoped stats, got %+v", suspect)
+	}
+}
+
+func TestDenyOutputs(t *testing.T) {
+	scopes := map[string]VhostScope{"api": {DenyOutput: "api.conf"}, "shop": {}}
+	suspects := []Suspicion{
+		{IP: "192.0.2.1", Stats: &IPStats{Vhost: "api"}},
+		{IP: "192.0.2.2", Stats: &IPStats{Vhost: "shop"}},
+		{IP: "192.0.2.3", Stats: &IPStats{}},
+		{IP: "203.0.113.0/24"},
+	}
+	outputs := denyOutputs("main.conf", suspects, scopes)
+	if len(outputs["api.conf"]) != 1 || len(outputs["main.conf"]) != 3 {
+		t.Fatalf("unexpected outputs %+v", outputs)
+	}
+	if paths := denyOutputPaths("main.conf", outputs); len(paths) != 2 || paths[0] != "main.conf" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+	if outputs := denyOutputs("main.conf", nil, scopes); len(outputs) != 2 {
+		t.Fatalf("expected the scope file listed without suspects, got %+v", outputs)
+	}
+}
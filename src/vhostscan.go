@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// maxHostHeaders bounds the distinct Host headers tracked per IP, so a
+// scanner cycling through random names cannot grow IPStats without limit.
+const maxHostHeaders = 500
+
+// recordHostHeader counts a request's Host header, lowercased and without
+// port or trailing dot, and notes hosts the server answered with an error,
+// as it does for names no server block serves.
+func (s *IPStats) recordHostHeader(host string, status int) {
+	host = normalizeHostHeader(host)
+	if host == "" {
+		return
+	}
+	if s.HostHeaders == nil {
+		s.HostHeaders = make(map[string]int)
+	}
+	if _, seen := s.HostHeaders[host]; !seen && len(s.HostHeaders) >= maxHostHeaders {
+		return
+	}
+	s.HostHeaders[host]++
+	if status >= 400 {
+		if s.failedHosts == nil {
+			s.failedHosts = make(map[string]struct{})
+		}
+		s.failedHosts[host] = struct{}{}
+	}
+}
+
+// normalizeHostHeader returns host in the form virtual hosts are matched in,
+// or "" for a missing header.
+func normalizeHostHeader(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" || host == "-" {
+		return ""
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// hostHeaderNames lists the Host headers an IP sent, most requested first.
+func hostHeaderNames(stat *IPStats) []string {
+	return namesByCount(stat.HostHeaders)
+}
+
+// reportedHostHeaders is how many Host headers the report lists per suspect.
+const reportedHostHeaders = 5
+
+// formatHostHeaders renders the most requested Host headers of an IP with
+// their counts, followed by how many others were sent.
+func formatHostHeaders(stat *IPStats) string {
+	names := hostHeaderNames(stat)
+	parts := make([]string, 0, reportedHostHeaders+1)
+	for i, name := range names {
+		if i == reportedHostHeaders {
+			parts = append(parts, fmt.Sprintf("%d more", len(names)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", name, stat.HostHeaders[name]))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeHostHeader(t *testing.T) {
+	cases := map[string]string{
+		"Shop.Example.com":     "shop.example.com",
+		"shop.example.com:443": "shop.example.com",
+		"shop.example.com.":    "shop.example.com",
+		"[2001:db8::1]:8080":   "2001:db8::1",
+		"-":                    "",
+		"":                     "",
+	}
+	for in, want := range cases {
+		if got := normalizeHostHeader(in); got != want {
+			t.Errorf("normalizeHostHeader(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAnalyzerFlagsVirtualHostScanning(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinRequests = 1
+	cfg.ScoreThreshold = 1
+	cfg.MinHostHeaders = 10
+	a := New(cfg, nil)
+	now := time.Now()
+
+	// A scanner guessing names, answered by the default server with 404.
+	for i := 0; i < 12; i++ {
+		a.Process(Entry{Time: now, ClientIP: "198.51.100.4", RemoteAddr: "198.51.100.4", Status: 404, URI: "/", Host: fmt.Sprintf("dev%d.example.com", i)})
+	}
+	a.Process(Entry{Time: now, ClientIP: "198.51.100.4", RemoteAddr: "198.51.100.4", Status: 200, URI: "/", Host: "www.example.com"})
+	// A visitor moving between two sites on the same server.
+	for i := 0; i < 30; i++ {
+		host := "www.example.com"
+		if i%2 == 0 {
+			host = "shop.example.com:443"
+		}
+		a.Process(Entry{Time: now, ClientIP: "192.0.2.7", RemoteAddr: "192.0.2.7", Status: 200, URI: "/", Host: host})
+	}
+
+	suspects := a.Suspicious()
+	if len(suspects) != 1 || suspects[0].IP != "198.51.100.4" {
+		t.Fatalf("expected only the scanner to be flagged, got %+v", suspects)
+	}
+	scanner := suspects[0]
+	if !strings.Contains(strings.Join(scanner.Rules, ","), RuleVhostScan) {
+		t.Fatalf("expected the %s rule, got %v", RuleVhostScan, scanner.Rules)
+	}
+	if want := "13 Host headers probed (12 answered with errors)"; !strings.Contains(strings.Join(scanner.Reasons, "; "), want) {
+		t.Fatalf("expected reason %q, got %v", want, scanner.Reasons)
+	}
+	if got := formatHostHeaders(scanner.Stats); !strings.HasSuffix(got, "; 8 more") {
+		t.Fatalf("expected the report to list five hosts and a remainder, got %q", got)
+	}
+}
+
+func TestRecordHostHeaderIsBounded(t *testing.T) {
+	stat := &IPStats{}
+	for i := 0; i < maxHostHeaders+10; i++ {
+		stat.recordHostHeader(fmt.Sprintf("h%d.example.com", i), 404)
+	}
+	stat.recordHostHeader("h0.example.com", 404)
+	if len(stat.HostHeaders) != maxHostHeaders || stat.HostHeaders["h0.example.com"] != 2 {
+		t.Fatalf("expected %d tracked hosts with repeats still counted, got %d", maxHostHeaders, len(stat.HostHeaders))
+	}
+}
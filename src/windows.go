@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ignoreWindowLayouts are accepted for window bounds without a UTC offset,
+// which are read in the local time zone.
+var ignoreWindowLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// TimeWindow is a half-open interval [Start, End).
+type TimeWindow struct {
+	Start, End time.Time
+}
+
+// Contains reports whether t falls inside the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// parseTimeWindow parses "start/end", e.g. "2025-11-28T00:00/2025-11-29T00:00".
+func parseTimeWindow(value string) (TimeWindow, error) {
+	startRaw, endRaw, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return TimeWindow{}, fmt.Errorf("invalid window %q, want start/end", value)
+	}
+	start, err := parseWindowBound(startRaw)
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid window %q: %w", value, err)
+	}
+	end, err := parseWindowBound(endRaw)
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid window %q: %w", value, err)
+	}
+	if !end.After(start) {
+		return TimeWindow{}, fmt.Errorf("invalid window %q: end is not after start", value)
+	}
+	return TimeWindow{Start: start, End: end}, nil
+}
+
+func parseWindowBound(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range ignoreWindowLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time %q", value)
+}
+
+// parseTimeWindows parses every window in values.
+func parseTimeWindows(values []string) ([]TimeWindow, error) {
+	windows := make([]TimeWindow, 0, len(values))
+	for _, value := range values {
+		window, err := parseTimeWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// inIgnoreWindow reports whether t falls in any configured ignore window.
+func (a *Analyzer) inIgnoreWindow(t time.Time) bool {
+	for _, window := range a.cfg.IgnoreWindows {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateInIgnoreWindow scores an IP whose traffic fell mostly in ignore
+// windows: with a relax factor thresholds are raised by it, otherwise the IP is
+// only blocked for sensitive URL or honeytoken hits.
+func (a *Analyzer) evaluateInIgnoreWindow(stat *IPStats) (Suspicion, bool) {
+	saved := a.cfg
+	defer func() { a.cfg = saved }()
+	a.cfg.IgnoreWindows = nil
+	if a.cfg.IgnoreWindowRelax > 0 {
+		// The same scaling sampling uses, raising thresholds instead of lowering them.
+		// Country spikes are judged on all traffic, so their settings stay as is.
+		scaleConfigForSample(&a.cfg, a.cfg.IgnoreWindowRelax)
+		a.cfg.CountryBaselines = saved.CountryBaselines
+		a.cfg.CountrySpikeMinRequests = saved.CountrySpikeMinRequests
+	}
+	suspect, blocked := a.evaluate(stat)
+	if blocked && saved.IgnoreWindowRelax <= 0 {
+		blocked = containsStringCI(RuleSensitivePath, suspect.Rules) || containsStringCI(RuleHoneytoken, suspect.Rules)
+	}
+	return suspect, blocked
+}
+
+// mostlyInIgnoreWindows reports whether most of an IP's requests fell in ignore windows.
+func mostlyInIgnoreWindows(stat *IPStats) bool {
+	return stat.IgnoredWindowRequests > 0 && stat.IgnoredWindowRequests*2 >= stat.Requests
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	window, err := parseTimeWindow("2025-11-28T00:00:00Z/2025-11-29T00:00:00Z")
+	if err != nil {
+		t.Fatalf("parseTimeWindow: %v", err)
+	}
+	if !window.Contains(time.Date(2025, 11, 28, 23, 59, 0, 0, time.UTC)) || window.Contains(window.End) {
+		t.Fatalf("unexpected bounds %+v", window)
+	}
+	local, err := parseTimeWindow("2025-11-28T00:00/2025-11-29")
+	if err != nil {
+		t.Fatalf("parseTimeWindow: %v", err)
+	}
+	if !local.Start.Equal(time.Date(2025, 11, 28, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("expected local start, got %v", local.Start)
+	}
+	for _, bad := range []string{"2025-11-28", "2025-11-29/2025-11-28", "yesterday/today"} {
+		if _, err := parseTimeWindow(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestIgnoreWindowsSuspendBlocking(t *testing.T) {
+	start := time.Date(2025, 11, 28, 10, 0, 0, 0, time.UTC)
+	shopper := func(analyzer *Analyzer, ip string) {
+		// 300 requests in five minutes, a tenth of them 404s: blocked on a normal day.
+		for i := 0; i < 300; i++ {
+			status := 200
+			if i%10 == 0 {
+				status = 404
+			}
+			analyzer.Process(Entry{ClientIP: ip, Time: start.Add(time.Duration(i) * time.Second), URI: fmt.Sprintf("/product/%d", i), Status: status})
+		}
+	}
+	cfg := DefaultConfig()
+	cfg.MinUniquePaths = 100
+	if _, _, blocked := explainAfter(cfg, shopper); !blocked {
+		t.Fatal("expected the burst to be blocked outside an ignore window")
+	}
+
+	cfg.IgnoreWindows = []TimeWindow{{Start: start.Add(-time.Hour), End: start.Add(time.Hour)}}
+	if _, _, blocked := explainAfter(cfg, shopper); blocked {
+		t.Fatal("expected blocking to be disabled inside the ignore window")
+	}
+
+	cfg.IgnoreWindowRelax = 1.5
+	if _, _, blocked := explainAfter(cfg, shopper); !blocked {
+		t.Fatal("expected a 1.5x relaxation to still block this burst")
+	}
+	cfg.IgnoreWindowRelax = 10
+	if _, _, blocked := explainAfter(cfg, shopper); blocked {
+		t.Fatal("expected a 10x relaxation to let the burst through")
+	}
+
+	cfg.IgnoreWindowRelax = 0
+	cfg.Honeytokens = []string{"/product/7"}
+	if _, _, blocked := explainAfter(cfg, shopper); !blocked {
+		t.Fatal("expected honeytoken hits to block even inside the ignore window")
+	}
+}
+
+func explainAfter(cfg Config, feed func(*Analyzer, string)) (Suspicion, bool, bool) {
+	analyzer := New(cfg, nil)
+	feed(analyzer, "192.0.2.50")
+	return analyzer.Explain("192.0.2.50")
+}